@@ -0,0 +1,110 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AcceptLimit represents the limits of the incoming connections, so that
+// floods or reconnect storms, i.e. thousands of clients after a network
+// blip, don't exhaust the memory. The connections over the limits get a 421
+// reply and are closed right away. The zero values mean no limit.
+type AcceptLimit struct {
+	// The connections accepted per second on average
+	Rate float64
+
+	// The connections which could be accepted at once over Rate, if 0 it's
+	// Rate rounded up
+	Burst int
+
+	// The maximum number of connections which are not logged in yet
+	MaxPending int
+}
+
+// acceptLimiter is a token bucket of the accepted connections
+type acceptLimiter struct {
+	limit  *AcceptLimit
+	lock   sync.Mutex
+	tokens float64
+	last   time.Time
+	// the connections not logged in yet
+	pending int32
+}
+
+func newAcceptLimiter(limit *AcceptLimit) *acceptLimiter {
+	if limit == nil {
+		return nil
+	}
+	limiter := &acceptLimiter{limit: limit, last: time.Now()}
+	limiter.tokens = limiter.burst()
+	return limiter
+}
+
+func (limiter *acceptLimiter) burst() float64 {
+	if limiter.limit.Burst > 0 {
+		return float64(limiter.limit.Burst)
+	}
+	if limiter.limit.Rate < 1 {
+		return 1
+	}
+	return float64(int(limiter.limit.Rate + 0.999))
+}
+
+// allow reports whether a new connection could be accepted, it's counted as
+// pending if so
+func (limiter *acceptLimiter) allow() bool {
+	if limiter == nil {
+		return true
+	}
+	if max := limiter.limit.MaxPending; max > 0 && atomic.LoadInt32(&limiter.pending) >= int32(max) {
+		return false
+	}
+	if limiter.limit.Rate > 0 {
+		limiter.lock.Lock()
+		now := time.Now()
+		limiter.tokens += now.Sub(limiter.last).Seconds() * limiter.limit.Rate
+		if burst := limiter.burst(); limiter.tokens > burst {
+			limiter.tokens = burst
+		}
+		limiter.last = now
+		if limiter.tokens < 1 {
+			limiter.lock.Unlock()
+			return false
+		}
+		limiter.tokens--
+		limiter.lock.Unlock()
+	}
+	atomic.AddInt32(&limiter.pending, 1)
+	return true
+}
+
+// done removes a connection from the pending ones
+func (limiter *acceptLimiter) done() {
+	if limiter != nil {
+		atomic.AddInt32(&limiter.pending, -1)
+	}
+}
+
+// refuseConnection replies 421 to the connection over the limits and
+// closes it. It's called on its own goroutine as the reply of an implicit
+// TLS connection starts the handshake, which reads from the client, the
+// deadline bounds both.
+func refuseConnection(conn net.Conn) {
+	_ = conn.SetDeadline(time.Now().Add(time.Second))
+	_, _ = conn.Write([]byte("421 Too many connections, try again later\r\n"))
+	conn.Close()
+}
+
+// handshakeDone marks the session as logged in or closed, it's not pending
+// anymore
+func (sess *Session) handshakeDone() {
+	if atomic.CompareAndSwapInt32(&sess.pending, 1, 0) {
+		sess.server.acceptLimiter.done()
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcceptLimiter(t *testing.T) {
+	var limiter *acceptLimiter
+	assert.True(t, limiter.allow())
+	limiter.done()
+
+	limiter = newAcceptLimiter(&AcceptLimit{Rate: 10, Burst: 2})
+	assert.True(t, limiter.allow())
+	assert.True(t, limiter.allow())
+	assert.False(t, limiter.allow())
+	limiter.last = limiter.last.Add(-100 * time.Millisecond)
+	assert.True(t, limiter.allow())
+	assert.False(t, limiter.allow())
+
+	limiter = newAcceptLimiter(&AcceptLimit{MaxPending: 2})
+	assert.True(t, limiter.allow())
+	assert.True(t, limiter.allow())
+	assert.False(t, limiter.allow())
+	limiter.done()
+	assert.True(t, limiter.allow())
+}
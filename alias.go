@@ -0,0 +1,216 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Aliases returns a DriverMiddleware resolving the alias paths to their
+// targets before calling the driver, i.e. "/current" to "/releases/v2.3".
+// They work like symbolic links on drivers without them, the aliases are
+// shown in the listings of their parent directories and could not be
+// deleted or renamed themselves. The optional interfaces of the driver, i.e.
+// QuotaReporter, StorageStats, RangeGetter, Locker, Symlinker or Searcher,
+// are used with the paths resolved.
+func Aliases(aliases map[string]string) DriverMiddleware {
+	var names = make([]string, 0, len(aliases))
+	var cleaned = make(map[string]string, len(aliases))
+	for alias, target := range aliases {
+		alias = path.Join("/", alias)
+		cleaned[alias] = path.Join("/", target)
+		names = append(names, alias)
+	}
+	// the longest aliases are resolved first
+	sort.Slice(names, func(i, j int) bool {
+		return len(names[i]) > len(names[j])
+	})
+	return func(driver Driver) Driver {
+		aliased := &aliasDriver{
+			Driver:  driver,
+			names:   names,
+			aliases: cleaned,
+		}
+		// keep the driver authentication and only set the modification
+		// times if the driver does
+		auth, isAuth := driver.(Auth)
+		if _, ok := driver.(ModTimeSetter); ok {
+			if isAuth {
+				return &aliasAuthModTimeDriver{aliasModTimeDriver: &aliasModTimeDriver{aliased}, Auth: auth}
+			}
+			return &aliasModTimeDriver{aliased}
+		}
+		if isAuth {
+			return &aliasAuthDriver{aliasDriver: aliased, Auth: auth}
+		}
+		return aliased
+	}
+}
+
+var (
+	_ Driver        = &aliasDriver{}
+	_ ModTimeSetter = &aliasModTimeDriver{}
+	_ Versioner     = &aliasDriver{}
+
+	errAlias = errors.New("An alias could not be changed")
+)
+
+type aliasDriver struct {
+	Driver
+	names   []string
+	aliases map[string]string
+}
+
+func (driver *aliasDriver) unwrap() Driver {
+	return driver.Driver
+}
+
+func (driver *aliasDriver) mapPath(p string) string {
+	return driver.resolve(p)
+}
+
+type aliasAuthDriver struct {
+	*aliasDriver
+	Auth
+}
+
+type aliasModTimeDriver struct {
+	*aliasDriver
+}
+
+type aliasAuthModTimeDriver struct {
+	*aliasModTimeDriver
+	Auth
+}
+
+func isUnderPath(p, dir string) bool {
+	return dir == "/" || p == dir || strings.HasPrefix(p, dir+"/")
+}
+
+// resolve returns the path the aliases resolve p to
+func (driver *aliasDriver) resolve(p string) string {
+	p = path.Join("/", p)
+	for _, alias := range driver.names {
+		if isUnderPath(p, alias) {
+			return path.Join(driver.aliases[alias], strings.TrimPrefix(p, alias))
+		}
+	}
+	return p
+}
+
+func (driver *aliasDriver) isAlias(p string) bool {
+	_, ok := driver.aliases[path.Join("/", p)]
+	return ok
+}
+
+// aliasInfo reports the name of the alias instead of the one of the target
+type aliasInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (info *aliasInfo) Name() string {
+	return info.name
+}
+
+func (driver *aliasDriver) Stat(ctx *Context, p string) (os.FileInfo, error) {
+	info, err := driver.Driver.Stat(ctx, driver.resolve(p))
+	if err != nil || !driver.isAlias(p) {
+		return info, err
+	}
+	return &aliasInfo{FileInfo: info, name: path.Base(p)}, nil
+}
+
+func (driver *aliasDriver) ListDir(ctx *Context, p string, callback func(os.FileInfo) error) error {
+	var listed = make(map[string]bool)
+	err := driver.Driver.ListDir(ctx, driver.resolve(p), func(info os.FileInfo) error {
+		listed[info.Name()] = true
+		return callback(info)
+	})
+	if err != nil {
+		return err
+	}
+
+	dir := path.Join("/", p)
+	for _, alias := range driver.names {
+		name := path.Base(alias)
+		if alias == "/" || path.Dir(alias) != dir || listed[name] {
+			continue
+		}
+		info, err := driver.Driver.Stat(ctx, driver.aliases[alias])
+		if err != nil {
+			// dangling aliases are not listed
+			continue
+		}
+		if err := callback(&aliasInfo{FileInfo: info, name: name}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (driver *aliasDriver) DeleteDir(ctx *Context, p string) error {
+	if driver.isAlias(p) {
+		return errAlias
+	}
+	return driver.Driver.DeleteDir(ctx, driver.resolve(p))
+}
+
+func (driver *aliasDriver) DeleteFile(ctx *Context, p string) error {
+	if driver.isAlias(p) {
+		return errAlias
+	}
+	return driver.Driver.DeleteFile(ctx, driver.resolve(p))
+}
+
+func (driver *aliasDriver) Rename(ctx *Context, fromPath string, toPath string) error {
+	if driver.isAlias(fromPath) || driver.isAlias(toPath) {
+		return errAlias
+	}
+	return driver.Driver.Rename(ctx, driver.resolve(fromPath), driver.resolve(toPath))
+}
+
+func (driver *aliasDriver) MakeDir(ctx *Context, p string) error {
+	return driver.Driver.MakeDir(ctx, driver.resolve(p))
+}
+
+func (driver *aliasDriver) GetFile(ctx *Context, p string, offset int64) (int64, io.ReadCloser, error) {
+	return driver.Driver.GetFile(ctx, driver.resolve(p), offset)
+}
+
+func (driver *aliasDriver) PutFile(ctx *Context, destPath string, data io.Reader, offset int64) (int64, error) {
+	return driver.Driver.PutFile(ctx, driver.resolve(destPath), data, offset)
+}
+
+func (driver *aliasModTimeDriver) SetModTime(ctx *Context, p string, mtime time.Time) error {
+	return driver.Driver.(ModTimeSetter).SetModTime(ctx, driver.resolve(p), mtime)
+}
+
+// Versions implements Versioner
+func (driver *aliasDriver) Versions(ctx *Context, p string) ([]FileVersion, error) {
+	versioner, ok := driver.Driver.(Versioner)
+	if !ok {
+		return nil, errVersionsNotSupported
+	}
+	return versioner.Versions(ctx, driver.resolve(p))
+}
+
+// RestoreVersion implements Versioner
+func (driver *aliasDriver) RestoreVersion(ctx *Context, p string, id string) error {
+	if driver.isAlias(p) {
+		return errAlias
+	}
+	versioner, ok := driver.Driver.(Versioner)
+	if !ok {
+		return errVersionsNotSupported
+	}
+	return versioner.RestoreVersion(ctx, driver.resolve(p), id)
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// StorageStats is an optional interface a Driver could implement to report
+// the space available to the uploads, so that the uploads announced by ALLO
+// could be refused before any byte is transferred.
+type StorageStats interface {
+	// params  - the context of the request, a directory path
+	// returns - the bytes which could be written in the directory or any
+	//           error encountered
+	AvailableSpace(ctx *Context, dir string) (int64, error)
+}
+
+// AllocatedSize returns the size of the upload announced by ALLO if
+// Options.Preallocate is set, so that the driver could reserve the space of
+// the file, 0 otherwise
+func (ctx *Context) AllocatedSize() int64 {
+	if ctx.Sess == nil || !ctx.Sess.server.Preallocate {
+		return 0
+	}
+	return ctx.Sess.allocSize
+}
+
+// parseAllo parses the param of ALLO, the size could be followed by the
+// maximum record size which is ignored, i.e. "1000 R 100"
+func parseAllo(param string) (int64, error) {
+	fields := strings.Fields(param)
+	if len(fields) != 1 && (len(fields) != 3 || strings.ToUpper(fields[1]) != "R") {
+		return 0, errors.New("invalid param")
+	}
+	size, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid size %s", fields[0])
+	}
+	return size, nil
+}
+
+// checkSpace replies 552 and returns false if the size announced by ALLO
+// doesn't fit in the space available in the directory. The uploads are
+// allowed if the driver can't tell the space available.
+func (sess *Session) checkSpace(cmd, dir string) bool {
+	driver, mapPath := optionalDriver(sess.server.Driver, func(driver Driver) bool {
+		_, ok := driver.(StorageStats)
+		return ok
+	})
+	if driver == nil || sess.allocSize <= 0 {
+		return true
+	}
+	available, err := driver.(StorageStats).AvailableSpace(&Context{
+		Sess:  sess,
+		Cmd:   cmd,
+		Param: dir,
+		Data:  make(map[string]interface{}),
+	}, mapPath(dir))
+	if err != nil {
+		sess.logf("%v", err)
+		return true
+	}
+	if sess.allocSize > available {
+		sess.writeMessage(552, fmt.Sprintf("Insufficient storage space, %d bytes available", available))
+		sess.allocSize = 0
+		return false
+	}
+	return true
+}
+
+// checkAllocation checks the space of the upload announced by ALLO before
+// it starts
+func (sess *Session) checkAllocation(cmd, p string) bool {
+	return sess.checkSpace(cmd, path.Dir(p))
+}
@@ -0,0 +1,97 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// auditConnect is the command of the records of the connections refused by
+// the GeoIP policy or the DNSBL
+const auditConnect = "CONNECT"
+
+// AuditRecord describes a command executed by the server, the credentials
+// of the argument are redacted. The connections refused by the GeoIP policy
+// or the DNSBL are recorded with the command CONNECT and the code 421.
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	SessionID string    `json:"session_id"`
+	User      string    `json:"user,omitempty"`
+	IP        string    `json:"ip"`
+	Command   string    `json:"command"`
+	Param     string    `json:"param,omitempty"`
+	Code      int       `json:"code"`        // the last reply to the command
+	Duration  float64   `json:"duration_ms"` // in milliseconds
+
+	// The TLS control connection, only for the AUTH and PASS commands
+	TLS *TLSInfo `json:"tls,omitempty"`
+
+	// The capability negotiated by the command, only the first time the
+	// session used it, i.e. "EPSV"
+	Capability string `json:"capability,omitempty"`
+}
+
+// AuditSink receives a record per command when it's set as Options.Audit,
+// it's called from the sessions concurrently
+type AuditSink interface {
+	Audit(record *AuditRecord)
+}
+
+// jsonAuditSink writes the records as JSON lines
+type jsonAuditSink struct {
+	lock sync.Mutex
+	enc  *json.Encoder
+}
+
+// NewJSONAuditSink returns an AuditSink writing one JSON record per line
+// to w
+func NewJSONAuditSink(w io.Writer) AuditSink {
+	return &jsonAuditSink{enc: json.NewEncoder(w)}
+}
+
+func (sink *jsonAuditSink) Audit(record *AuditRecord) {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	_ = sink.enc.Encode(record)
+}
+
+// lastReplyCode returns the code of the last reply sent to the client
+func (sess *Session) lastReplyCode() int {
+	sess.writeLock.Lock()
+	defer sess.writeLock.Unlock()
+	return sess.lastCode
+}
+
+// audit sends the record of a command to Options.Audit, user is the login
+// user if the command logged out
+func (sess *Session) audit(command, param, user string, code int, start time.Time) {
+	if sess.server.Audit == nil {
+		return
+	}
+	if sess.user != "" {
+		user = sess.user
+	}
+	command = strings.ToUpper(command)
+	var info *TLSInfo
+	if command == "AUTH" || command == "PASS" {
+		info = sess.TLS()
+	}
+	sess.server.Audit.Audit(&AuditRecord{
+		Time:       start,
+		SessionID:  sess.id,
+		User:       sess.pseudoUser(user),
+		IP:         sess.pseudoIP(),
+		Command:    command,
+		Param:      sess.pseudoParam(command, param),
+		Code:       code,
+		Duration:   float64(time.Since(start)) / float64(time.Millisecond),
+		TLS:        info,
+		Capability: sess.capability,
+	})
+}
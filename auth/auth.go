@@ -0,0 +1,113 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package auth implements a server.Auth checking the passwords against their
+// hashes, so that the passwords are not kept in clear in the code or in the
+// configuration. The hashes are generated by HashPassword or by the Hasher
+// of the scheme, i.e. Bcrypt or Argon2id.
+package auth
+
+import (
+	"errors"
+	"sync"
+
+	"goftp.io/server/v2"
+)
+
+// Hasher represents a password hashing scheme, the hashes are encoded with
+// their parameters and their salt
+type Hasher interface {
+	// params  - the password
+	// returns - the encoded hash of the password or any error encountered
+	Hash(password string) (string, error)
+
+	// params  - an encoded hash
+	// returns - whether the hash is in the format of the scheme
+	Match(hash string) bool
+
+	// params  - an encoded hash of the scheme, the password
+	// returns - whether the password matches the hash, the comparison takes
+	//           a constant time, or any error encountered
+	Verify(hash, password string) (bool, error)
+}
+
+// ErrUnknownHash is returned by CheckPasswd when the hash of the user is in
+// none of the formats of the hashers
+var ErrUnknownHash = errors.New("unknown password hash format")
+
+var _ server.Auth = &HashedAuth{}
+
+// HashedAuth implements server.Auth with the hashes of the passwords of one
+// or several users
+type HashedAuth struct {
+	// The encoded hashes of the passwords by user name
+	Users map[string]string
+
+	// The hashers of the supported formats, if nil bcrypt and argon2id
+	Hashers []Hasher
+
+	dummyOnce sync.Once
+	dummy     string
+}
+
+// NewHashedAuth returns an auth of a single user
+func NewHashedAuth(name, hash string) *HashedAuth {
+	return &HashedAuth{
+		Users: map[string]string{name: hash},
+	}
+}
+
+// DefaultHashers returns the hashers used when HashedAuth.Hashers is nil
+func DefaultHashers() []Hasher {
+	return []Hasher{Bcrypt{}, Argon2id{}}
+}
+
+// HashPassword returns the bcrypt hash of the password with the default
+// cost, i.e. to store it in HashedAuth.Users
+func HashPassword(password string) (string, error) {
+	return Bcrypt{}.Hash(password)
+}
+
+func (a *HashedAuth) hashers() []Hasher {
+	if a.Hashers == nil {
+		return DefaultHashers()
+	}
+	return a.Hashers
+}
+
+// CheckPasswd implements server.Auth, the password of an unknown user is
+// still verified against a hash so that the users could not be guessed by
+// the time the check takes
+func (a *HashedAuth) CheckPasswd(ctx *server.Context, name, pass string) (bool, error) {
+	hash, ok := a.Users[name]
+	if !ok {
+		a.verifyDummy(pass)
+		return false, nil
+	}
+	for _, hasher := range a.hashers() {
+		if hasher.Match(hash) {
+			return hasher.Verify(hash, pass)
+		}
+	}
+	return false, ErrUnknownHash
+}
+
+// verifyDummy verifies the password against the hash of a random password
+// by the first hasher
+func (a *HashedAuth) verifyDummy(pass string) {
+	hashers := a.hashers()
+	if len(hashers) == 0 {
+		return
+	}
+	a.dummyOnce.Do(func() {
+		salt, err := randomBytes(16)
+		if err != nil {
+			return
+		}
+		a.dummy, _ = hashers[0].Hash(string(salt))
+	})
+	if a.dummy != "" {
+		_, _ = hashers[0].Verify(a.dummy, pass)
+	}
+}
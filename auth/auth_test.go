@@ -0,0 +1,90 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashers(t *testing.T) {
+	for _, hasher := range []Hasher{
+		Bcrypt{Cost: bcrypt.MinCost},
+		Argon2id{Memory: 1024},
+	} {
+		hash, err := hasher.Hash("secret")
+		assert.NoError(t, err)
+		assert.True(t, hasher.Match(hash))
+
+		ok, err := hasher.Verify(hash, "secret")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = hasher.Verify(hash, "wrong")
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+		// the salt is random
+		other, err := hasher.Hash("secret")
+		assert.NoError(t, err)
+		assert.NotEqual(t, hash, other)
+	}
+
+	_, err := Argon2id{}.Verify("$argon2id$v=19$m=1024$salt", "secret")
+	assert.Error(t, err)
+
+	// the malformed parameters are refused instead of panicking or
+	// allocating without bound
+	for _, params := range []string{
+		"m=1024,t=0,p=1",
+		"m=1024,t=1,p=0",
+		"m=4294967295,t=1,p=1",
+	} {
+		_, err := Argon2id{}.Verify("$argon2id$v=19$"+params+"$c2FsdA$a2V5", "secret")
+		assert.Equal(t, errInvalidHash, err, params)
+	}
+}
+
+func TestHashedAuth(t *testing.T) {
+	bcryptHash, err := Bcrypt{Cost: bcrypt.MinCost}.Hash("admin")
+	assert.NoError(t, err)
+	argon2Hash, err := Argon2id{Memory: 1024}.Hash("guest")
+	assert.NoError(t, err)
+
+	auth := &HashedAuth{
+		Users: map[string]string{
+			"admin": bcryptHash,
+			"guest": argon2Hash,
+			"plain": "guest",
+		},
+		Hashers: []Hasher{Bcrypt{Cost: bcrypt.MinCost}, Argon2id{Memory: 1024}},
+	}
+	for _, c := range []struct {
+		name, pass string
+		ok         bool
+	}{
+		{"admin", "admin", true},
+		{"admin", "guest", false},
+		{"guest", "guest", true},
+		{"guest", "admin", false},
+		{"nobody", "admin", false},
+	} {
+		ok, err := auth.CheckPasswd(nil, c.name, c.pass)
+		assert.NoError(t, err)
+		assert.EqualValues(t, c.ok, ok, c.name+"/"+c.pass)
+	}
+
+	// the passwords in clear are refused
+	ok, err := auth.CheckPasswd(nil, "plain", "guest")
+	assert.Equal(t, ErrUnknownHash, err)
+	assert.False(t, ok)
+
+	single := NewHashedAuth("admin", bcryptHash)
+	ok, err = single.CheckPasswd(nil, "admin", "admin")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
@@ -0,0 +1,47 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"path"
+)
+
+// autoMkdir reports whether the missing parents of the uploads of the
+// session are created
+func (sess *Session) autoMkdir() bool {
+	return sess.server.AutoMkdir || (sess.userInfo != nil && sess.userInfo.AutoMkdir)
+}
+
+// makeParents creates the missing parent directories of the upload if
+// enabled, it replies 550 and returns false if one couldn't be created
+func (sess *Session) makeParents(cmd, p string) bool {
+	if !sess.autoMkdir() {
+		return true
+	}
+	var ctx = Context{
+		Sess:  sess,
+		Cmd:   cmd,
+		Param: p,
+		Data:  make(map[string]interface{}),
+	}
+	var missing []string
+	for dir := path.Dir(p); dir != "/"; dir = path.Dir(dir) {
+		if _, err := sess.server.Driver.Stat(&ctx, dir); err == nil {
+			break
+		}
+		missing = append(missing, dir)
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		sess.server.notifiers.BeforeCreateDir(&ctx, missing[i])
+		err := sess.server.Driver.MakeDir(&ctx, missing[i])
+		sess.server.notifiers.AfterDirCreated(&ctx, missing[i], err)
+		if err != nil {
+			sess.writeMessage(550, fmt.Sprint("Action not taken: ", err))
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,125 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"sync"
+)
+
+// UserBandwidth represents the data transferred by an user across the
+// sessions, i.e. for chargeback reporting
+type UserBandwidth struct {
+	Uploaded   int64 // the bytes uploaded
+	Downloaded int64 // the bytes downloaded
+	Uploads    int64 // the number of the uploads
+	Downloads  int64 // the number of the downloads
+}
+
+// BandwidthStore persists the data transferred by the users, the totals are
+// kept in memory only if Options.BandwidthStore is nil
+type BandwidthStore interface {
+	// LoadBandwidth returns the totals of the users persisted, it's called
+	// by NewServer
+	LoadBandwidth() (map[string]UserBandwidth, error)
+
+	// AddBandwidth persists the data of a transfer of the user, it's called
+	// once the transfer is done
+	AddBandwidth(userName string, transfer UserBandwidth) error
+}
+
+// bandwidthState aggregates the data transferred per user
+type bandwidthState struct {
+	lock  sync.Mutex
+	users map[string]UserBandwidth
+}
+
+func (state *bandwidthState) load(store BandwidthStore) error {
+	if store == nil {
+		return nil
+	}
+	users, err := store.LoadBandwidth()
+	if err != nil {
+		return err
+	}
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	state.users = make(map[string]UserBandwidth, len(users))
+	for user, bandwidth := range users {
+		state.users[user] = bandwidth
+	}
+	return nil
+}
+
+func (state *bandwidthState) add(userName string, transfer UserBandwidth) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	if state.users == nil {
+		state.users = make(map[string]UserBandwidth)
+	}
+	total := state.users[userName]
+	total.Uploaded += transfer.Uploaded
+	total.Downloaded += transfer.Downloaded
+	total.Uploads += transfer.Uploads
+	total.Downloads += transfer.Downloads
+	state.users[userName] = total
+}
+
+func (state *bandwidthState) get(userName string) UserBandwidth {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	return state.users[userName]
+}
+
+func (state *bandwidthState) stats() map[string]UserBandwidth {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	var stats = make(map[string]UserBandwidth, len(state.users))
+	for user, bandwidth := range state.users {
+		stats[user] = bandwidth
+	}
+	return stats
+}
+
+// accountTransfer accounts the bytes of a transfer of the login user to its
+// bandwidth and to its transfer quota, the files are counted if the transfer
+// succeeded
+func (sess *Session) accountTransfer(ctx *Context, uploaded, downloaded int64, err error) {
+	sess.addTransferUsage(ctx, uploaded, downloaded)
+	if sess.user == "" {
+		return
+	}
+	var transfer = UserBandwidth{Uploaded: uploaded, Downloaded: downloaded}
+	switch {
+	case err != nil:
+	case ctx.Cmd == "RETR" || ctx.Cmd == "SITE SEGRETR":
+		transfer.Downloads = 1
+	default:
+		transfer.Uploads = 1
+	}
+	sess.server.bandwidth.add(sess.user, transfer)
+	if store := sess.server.BandwidthStore; store != nil {
+		if err := store.AddBandwidth(sess.user, transfer); err != nil {
+			sess.logf("%v", err)
+		}
+	}
+}
+
+// siteUsage responds to the SITE USAGE command. It reports the data the
+// login user transferred across the sessions.
+type siteUsage struct{}
+
+func (cmd siteUsage) RequireParam() bool {
+	return false
+}
+
+func (cmd siteUsage) Execute(sess *Session, param string) {
+	bandwidth := sess.server.bandwidth.get(sess.LoginUser())
+	sess.writeMessageLines(200, "The data transferred by this user are:", []string{
+		"Name: " + sess.LoginUser(),
+		fmt.Sprintf("Uploaded: %d bytes in %d files", bandwidth.Uploaded, bandwidth.Uploads),
+		fmt.Sprintf("Downloaded: %d bytes in %d files", bandwidth.Downloaded, bandwidth.Downloads),
+	}, "End of usage")
+}
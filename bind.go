@@ -0,0 +1,64 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"net"
+)
+
+// bindIP returns the local IP the data connections are bound to, addr is
+// either an IP or the name of a network interface. The address of the
+// interface of the family of the control connection is preferred. It
+// returns nil if addr is empty.
+func (sess *Session) bindIP(addr string) (net.IP, error) {
+	if addr == "" {
+		return nil, nil
+	}
+	if ip := net.ParseIP(addr); ip != nil {
+		return ip, nil
+	}
+
+	iface, err := net.InterfaceByName(addr)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	var ipv4 = true
+	if local, ok := sess.conn.LocalAddr().(*net.TCPAddr); ok {
+		ipv4 = local.IP.To4() != nil
+	}
+	var first net.IP
+	for _, a := range addrs {
+		ipNet, ok := a.(*net.IPNet)
+		// the link local addresses would need a zone
+		if !ok || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if (ipNet.IP.To4() != nil) == ipv4 {
+			return ipNet.IP, nil
+		}
+		if first == nil {
+			first = ipNet.IP
+		}
+	}
+	if first == nil {
+		return nil, fmt.Errorf("No address on the interface %s", addr)
+	}
+	return first, nil
+}
+
+// validateBindAddress returns an error if the address is neither an IP nor
+// the name of a network interface
+func validateBindAddress(addr string) error {
+	if addr == "" || net.ParseIP(addr) != nil {
+		return nil
+	}
+	_, err := net.InterfaceByName(addr)
+	return err
+}
@@ -0,0 +1,96 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"strings"
+)
+
+// The capabilities negotiated by the clients, they are reported by Stats,
+// SessionInfo and the audit records so that the operators could see who
+// still relies on the legacy ones before disabling them
+const (
+	CapabilityPASV      = "PASV"
+	CapabilityEPSV      = "EPSV"
+	CapabilityPORT      = "PORT"
+	CapabilityEPRT      = "EPRT"
+	CapabilityLPRT      = "LPRT"
+	CapabilityAuthTLS   = "AUTH TLS"
+	CapabilityPlaintext = "PLAINTEXT" // a login over a control connection not encrypted
+	CapabilityUTF8      = "UTF8"
+	CapabilityMLSD      = "MLSD"
+	CapabilityModeZ     = "MODE Z"
+)
+
+// commandCapability returns the capability negotiated by the command, if
+// it succeeded
+func (sess *Session) commandCapability(command, param string, code int) string {
+	if code >= 400 {
+		return ""
+	}
+	param = strings.ToUpper(strings.TrimSpace(param))
+	switch command {
+	case "PASV", "EPSV", "PORT", "EPRT", "LPRT", "MLSD":
+		return command
+	case "AUTH":
+		if sess.TLS() != nil {
+			return CapabilityAuthTLS
+		}
+	case "PASS":
+		if code == 230 && sess.TLS() == nil {
+			return CapabilityPlaintext
+		}
+	case "OPTS":
+		if strings.HasPrefix(param, "UTF8") {
+			return CapabilityUTF8
+		}
+	case "MODE":
+		if param == "Z" {
+			return CapabilityModeZ
+		}
+	}
+	return ""
+}
+
+// negotiate records the capability negotiated by the command and returns
+// it, if the session didn't negotiate it before
+func (sess *Session) negotiate(command, param string, code int) string {
+	capability := sess.commandCapability(strings.ToUpper(command), param, code)
+	if capability == "" {
+		return ""
+	}
+	for _, c := range sess.Info().Capabilities {
+		if c == capability {
+			return ""
+		}
+	}
+	sess.updateInfo(func(info *SessionInfo) {
+		// the snapshots returned by Info share the previous array
+		n := len(info.Capabilities)
+		info.Capabilities = append(info.Capabilities[:n:n], capability)
+	})
+	sess.debugf("Client negotiated %s", capability)
+
+	server := sess.server
+	server.capabilitiesLock.Lock()
+	if server.capabilities == nil {
+		server.capabilities = make(map[string]int64)
+	}
+	server.capabilities[capability]++
+	server.capabilitiesLock.Unlock()
+	return capability
+}
+
+// capabilityStats returns the number of the sessions which negotiated each
+// capability
+func (server *Server) capabilityStats() map[string]int64 {
+	server.capabilitiesLock.Lock()
+	defer server.capabilitiesLock.Unlock()
+	var stats = make(map[string]int64, len(server.capabilities))
+	for capability, sessions := range server.capabilities {
+		stats[capability] = sessions
+	}
+	return stats
+}
@@ -0,0 +1,79 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"io"
+	"net"
+
+	"goftp.io/server/v2/ratelimit"
+)
+
+// DataChannel opens the data connection of a transfer of the session in
+// process, i.e. one end of a net.Pipe handed to the client. When it's set the
+// passive and the active modes are disabled, the transfers start without
+// PASV, EPSV, PORT or EPRT.
+type DataChannel func(sess *Session) (net.Conn, error)
+
+// dataChannelOnly returns whether the data connections could only be opened
+// by Options.DataChannel, the passive and the active modes require a TCP
+// control connection
+func (sess *Session) dataChannelOnly() bool {
+	if sess.server.DataChannel != nil {
+		return true
+	}
+	_, ok := sess.conn.LocalAddr().(*net.TCPAddr)
+	return !ok
+}
+
+// openDataChannel opens the data connection via Options.DataChannel if the
+// session doesn't have one
+func (sess *Session) openDataChannel() error {
+	if sess.dataConn != nil || sess.server.DataChannel == nil {
+		return nil
+	}
+	conn, err := sess.server.DataChannel(sess)
+	if err != nil {
+		return err
+	}
+	sess.dataConn = &channelSocket{
+		conn:   conn,
+		reader: ratelimit.Reader(conn, sess.rateLimiter()),
+		writer: ratelimit.Writer(conn, sess.rateLimiter()),
+	}
+	return nil
+}
+
+// channelSocket is the data socket of a connection opened by DataChannel,
+// it has no host nor port
+type channelSocket struct {
+	conn   net.Conn
+	reader io.Reader
+	writer io.Writer
+}
+
+func (socket *channelSocket) Host() string {
+	return ""
+}
+
+func (socket *channelSocket) Port() int {
+	return 0
+}
+
+func (socket *channelSocket) Read(p []byte) (n int, err error) {
+	return socket.reader.Read(p)
+}
+
+func (socket *channelSocket) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(socket.writer, r)
+}
+
+func (socket *channelSocket) Write(p []byte) (n int, err error) {
+	return socket.writer.Write(p)
+}
+
+func (socket *channelSocket) Close() error {
+	return socket.conn.Close()
+}
@@ -0,0 +1,62 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"strings"
+)
+
+// maxClientSoftware bounds the distinct client software counted by the
+// stats, the clients could announce anything
+const maxClientSoftware = 100
+
+// maxClientNameLength bounds the length of the client software names counted
+// by the stats
+const maxClientNameLength = 32
+
+// ClientSoftwareOther is the name the client software is counted under once
+// maxClientSoftware distinct ones were counted, or if its name is too long
+const ClientSoftwareOther = "OTHER"
+
+// clientName returns the name of the client software announced via CLNT
+// without its version, i.e. "FileZilla" for "FileZilla 3.50.0"
+func clientName(software string) string {
+	fields := strings.Fields(software)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// countClient counts a session announcing the client software in the stats
+func (server *Server) countClient(software string) {
+	name := clientName(software)
+	if name == "" {
+		return
+	}
+	server.clientsLock.Lock()
+	defer server.clientsLock.Unlock()
+	if server.clients == nil {
+		server.clients = make(map[string]int64)
+	}
+	if _, ok := server.clients[name]; !ok {
+		if len(name) > maxClientNameLength || len(server.clients) >= maxClientSoftware {
+			name = ClientSoftwareOther
+		}
+	}
+	server.clients[name]++
+}
+
+// clientStats returns the number of the sessions which announced each client
+// software
+func (server *Server) clientStats() map[string]int64 {
+	server.clientsLock.Lock()
+	defer server.clientsLock.Unlock()
+	var stats = make(map[string]int64, len(server.clients))
+	for name, sessions := range server.clients {
+		stats[name] = sessions
+	}
+	return stats
+}
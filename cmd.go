@@ -7,13 +7,15 @@ package server
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/hex"
 	"fmt"
-	"log"
+	"io"
+	"net"
 	"os"
 	"path"
-	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Command represents a Command interface to a ftp command
@@ -26,6 +28,7 @@ type Command interface {
 
 var (
 	defaultCommands = map[string]Command{
+		"ABOR": commandAbor{},
 		"ADAT": commandAdat{},
 		"ALLO": commandAllo{},
 		"APPE": commandAppe{},
@@ -40,12 +43,14 @@ var (
 		"EPRT": commandEprt{},
 		"EPSV": commandEpsv{},
 		"FEAT": commandFeat{},
+		"HASH": commandHash{},
 		"LIST": commandList{},
 		"LPRT": commandLprt{},
 		"NLST": commandNlst{},
 		"MDTM": commandMdtm{},
 		"MIC":  commandMic{},
 		"MLSD": commandMLSD{},
+		"MLST": commandMLST{},
 		"MKD":  commandMkd{},
 		"MODE": commandMode{},
 		"NOOP": commandNoop{},
@@ -56,17 +61,20 @@ var (
 		"PORT": commandPort{},
 		"PROT": commandProt{},
 		"PWD":  commandPwd{},
+		"RANG": commandRang{},
 		"QUIT": commandQuit{},
 		"RETR": commandRetr{},
 		"REST": commandRest{},
 		"RNFR": commandRnfr{},
 		"RNTO": commandRnto{},
 		"RMD":  commandRmd{},
+		"SITE": commandSite{},
 		"SIZE": commandSize{},
 		"STAT": commandStat{},
 		"STOR": commandStor{},
 		"STRU": commandStru{},
 		"SYST": commandSyst{},
+		"THMB": commandThmb{},
 		"TYPE": commandType{},
 		"USER": commandUser{},
 		"XCUP": commandCdup{},
@@ -84,8 +92,9 @@ func DefaultCommands() map[string]Command {
 
 // commandAllo responds to the ALLO FTP command.
 //
-// This is essentially a ping from the client so we just respond with an
-// basic OK message.
+// The size announced is checked against the space available in the current
+// directory if the driver is a StorageStats, and is checked again by the
+// next upload.
 type commandAllo struct{}
 
 func (cmd commandAllo) IsExtend() bool {
@@ -97,11 +106,26 @@ func (cmd commandAllo) RequireParam() bool {
 }
 
 func (cmd commandAllo) RequireAuth() bool {
-	return false
+	return true
 }
 
 func (cmd commandAllo) Execute(sess *Session, param string) {
-	sess.writeMessage(202, "Obsolete")
+	size, err := parseAllo(param)
+	if err != nil {
+		sess.writeMessage(501, fmt.Sprint("Syntax error: ", err))
+		return
+	}
+	sess.allocSize = size
+	if driver, _ := optionalDriver(sess.server.Driver, func(driver Driver) bool {
+		_, ok := driver.(StorageStats)
+		return ok
+	}); driver == nil {
+		sess.writeMessage(202, "Obsolete")
+		return
+	}
+	if sess.checkSpace("ALLO", sess.curDir) {
+		sess.writeMessage(200, "Space available")
+	}
 }
 
 // commandAppe responds to the APPE FTP command. It allows the user to upload a
@@ -121,14 +145,46 @@ func (cmd commandAppe) RequireAuth() bool {
 }
 
 func (cmd commandAppe) Execute(sess *Session, param string) {
-	targetPath := sess.buildPath(param)
-	sess.writeMessage(150, "Data transfer starting")
-
-	if sess.preCommand != "REST" {
-		sess.lastFilePos = -1
+	targetPath, ok := sess.sanitizePath(sess.buildPath(param))
+	if !ok {
+		return
+	}
+	if sess.ignoreUpload(targetPath) {
+		return
+	}
+	if !sess.checkPathLimits("APPE", param, targetPath) {
+		return
+	}
+	if !sess.checkResume(targetPath) {
+		return
+	}
+	if !sess.checkAllocation("APPE", targetPath) {
+		return
+	}
+	if !sess.checkTransferQuota("APPE", true) {
+		return
+	}
+	if !sess.makeParents("APPE", targetPath) {
+		return
+	}
+	unlock, ok := sess.lockUpload("APPE", targetPath)
+	if !ok {
+		return
+	}
+	defer unlock()
+	if !sess.checkClobber("APPE", targetPath) {
+		return
+	}
+	if targetPath != sess.buildPath(param) {
+		// report the sanitized name like STOU does
+		sess.writeMessage(150, "FILE: "+targetPath)
+	} else {
+		sess.writeMessage(150, "Data transfer starting")
 	}
+
 	defer func() {
 		sess.lastFilePos = -1
+		sess.allocSize = 0
 	}()
 
 	var ctx = Context{
@@ -137,10 +193,53 @@ func (cmd commandAppe) Execute(sess *Session, param string) {
 		Param: param,
 		Data:  make(map[string]interface{}),
 	}
+	if sess.preCommand != "REST" {
+		// append to the end of the file, or create it
+		sess.lastFilePos = -1
+		if info, err := sess.server.Driver.Stat(&ctx, targetPath); err == nil && !info.IsDir() {
+			sess.lastFilePos = info.Size()
+		}
+	}
+	reader, err := sess.dataReader()
+	if err != nil {
+		sess.writeMessage(450, fmt.Sprint("error during transfer: ", err))
+		return
+	}
+	checksum := sess.newTransferChecksum()
+	// the uploads running at once are limited by the memory budget
+	_, release := sess.acquireTransferBuffer()
+	defer release()
 	sess.server.notifiers.BeforePutFile(&ctx, targetPath)
-	size, err := sess.server.Driver.PutFile(&ctx, targetPath, sess.dataConn, sess.lastFilePos)
-	sess.server.notifiers.AfterFilePut(&ctx, targetPath, size, err)
+	start := time.Now()
+	tr := sess.startTransfer(&ctx)
+	size, err := sess.server.Driver.PutFile(&ctx, targetPath, checksum.teeReader(tr.reader(reader)), sess.lastFilePos)
+	aborted := tr.stop()
+	if aborted {
+		// the data received until the data connection was closed is
+		// incomplete even if the driver didn't fail
+		err = errTransferAborted
+	} else if sess.dataConn != nil {
+		// a data connection carries a single upload
+		sess.dataConn.Close()
+		sess.dataConn = nil
+	}
+	var rejected int
 	if err == nil {
+		rejected, err = sess.processUpload(&ctx, checksum.event(newTransferEvent(targetPath, size, sess.lastFilePos, start, nil)))
+	}
+	// the rejected uploads are not counted as uploaded
+	sess.accountTransfer(&ctx, size, 0, err)
+	var stopped int64
+	if err != nil && rejected == 0 {
+		stopped = sess.stoppedUpload(&ctx, targetPath)
+	}
+	sess.server.notifiers.AfterFilePut(&ctx, targetPath, size, err)
+	sess.server.notifiers.AfterFilePutEvent(&ctx, checksum.event(newTransferEvent(targetPath, size, sess.lastFilePos, start, err)))
+	if aborted {
+		sess.replyAborted(false, stopped)
+	} else if rejected != 0 {
+		sess.writeMessage(rejected, fmt.Sprint("Upload rejected: ", err))
+	} else if err == nil {
 		msg := fmt.Sprintf("OK, received %d bytes", size)
 		sess.writeMessage(226, msg)
 	} else {
@@ -148,6 +247,9 @@ func (cmd commandAppe) Execute(sess *Session, param string) {
 	}
 }
 
+// commandCLNT responds to the CLNT FTP command. It allows the client to
+// announce its name and version, which is kept in the session so that
+// issues of a special client could be tracked down.
 type commandCLNT struct{}
 
 func (cmd commandCLNT) IsExtend() bool {
@@ -163,7 +265,11 @@ func (cmd commandCLNT) RequireAuth() bool {
 }
 
 func (cmd commandCLNT) Execute(sess *Session, param string) {
+	if sess.clientSoft == "" {
+		sess.server.countClient(param)
+	}
 	sess.clientSoft = param
+	sess.logf("Client software: %s", param)
 	sess.writeMessage(200, "OK")
 }
 
@@ -183,6 +289,14 @@ func (cmd commandOpts) RequireAuth() bool {
 
 func (cmd commandOpts) Execute(sess *Session, param string) {
 	parts := strings.Fields(param)
+	if len(parts) > 0 && strings.ToUpper(parts[0]) == "HASH" {
+		executeOptsHash(sess, parts[1:])
+		return
+	}
+	if len(parts) > 0 && strings.ToUpper(parts[0]) == "MLST" {
+		executeOptsMLST(sess, parts[1:])
+		return
+	}
 	if len(parts) != 2 {
 		sess.writeMessage(550, "Unknow params")
 		return
@@ -199,6 +313,27 @@ func (cmd commandOpts) Execute(sess *Session, param string) {
 	}
 }
 
+// executeOptsHash responds to OPTS HASH, it returns the hash algorithm used
+// by the HASH command or selects a new one.
+func executeOptsHash(sess *Session, params []string) {
+	if _, ok := sess.server.Commands["HASH"]; !ok {
+		sess.writeMessage(550, "Unknow params")
+		return
+	}
+	if len(params) == 0 {
+		sess.writeMessage(200, sess.hashAlgo)
+		return
+	}
+
+	algo := strings.ToUpper(params[0])
+	if _, ok := hashAlgos[algo]; !ok {
+		sess.writeMessage(501, "Unknown algorithm, current selection not changed")
+		return
+	}
+	sess.hashAlgo = algo
+	sess.writeMessage(200, algo)
+}
+
 type commandFeat struct{}
 
 func (cmd commandFeat) IsExtend() bool {
@@ -217,6 +352,47 @@ func (cmd commandFeat) Execute(sess *Session, param string) {
 	sess.writeMessageMultiline(211, sess.server.feats)
 }
 
+// commandHash responds to the HASH FTP command. It returns the checksum of
+// a file computed with the algorithm selected via OPTS HASH.
+type commandHash struct{}
+
+func (cmd commandHash) IsExtend() bool {
+	return false
+}
+
+func (cmd commandHash) RequireParam() bool {
+	return true
+}
+
+func (cmd commandHash) RequireAuth() bool {
+	return true
+}
+
+func (cmd commandHash) Execute(sess *Session, param string) {
+	path := sess.buildPath(param)
+	_, data, err := sess.server.Driver.GetFile(&Context{
+		Sess:  sess,
+		Cmd:   "HASH",
+		Param: param,
+		Data:  make(map[string]interface{}),
+	}, path, 0)
+	if err != nil {
+		sess.logf("%v", err)
+		sess.writeMessage(550, "File not available")
+		return
+	}
+	defer data.Close()
+
+	h := hashAlgos[sess.hashAlgo]()
+	size, err := io.Copy(h, data)
+	if err != nil {
+		sess.logf("%v", err)
+		sess.writeMessage(550, "Error reading file")
+		return
+	}
+	sess.writeMessage(213, fmt.Sprintf("%s 0-%d %s %s", sess.hashAlgo, size, hex.EncodeToString(h.Sum(nil)), param))
+}
+
 // cmdCdup responds to the CDUP FTP command.
 //
 // Allows the client change their current directory to the parent.
@@ -278,7 +454,7 @@ func (cmd commandCwd) Execute(sess *Session, param string) {
 	err = sess.changeCurDir(path)
 	sess.server.notifiers.AfterCurDirChanged(&ctx, sess.curDir, path, err)
 	if err == nil {
-		sess.writeMessage(250, "Directory changed to "+path)
+		sess.writeMessage(250, "Directory changed to "+encodePathname(path))
 	} else {
 		sess.logf("%v", err)
 		sess.writeMessage(550, fmt.Sprint("Directory change to ", path, " failed."))
@@ -309,8 +485,11 @@ func (cmd commandDele) Execute(sess *Session, param string) {
 		Param: param,
 		Data:  make(map[string]interface{}),
 	}
+	if !sess.checkProtected(path) {
+		return
+	}
 	sess.server.notifiers.BeforeDeleteFile(&ctx, path)
-	err := sess.server.Driver.DeleteFile(&ctx, path)
+	err := sess.deleteFile(&ctx, path)
 	sess.server.notifiers.AfterFileDeleted(&ctx, path, err)
 	if err == nil {
 		sess.writeMessage(250, "File deleted")
@@ -338,6 +517,13 @@ func (cmd commandEprt) RequireAuth() bool {
 }
 
 func (cmd commandEprt) Execute(sess *Session, param string) {
+	if sess.dataChannelOnly() {
+		sess.writeMessage(502, "EPRT is not supported, the data connections are opened in process")
+		return
+	}
+	if !sess.checkDataProtection() {
+		return
+	}
 	delim := string(param[0:1])
 	parts := strings.Split(param, delim)
 	addressFamily, err := strconv.Atoi(parts[1])
@@ -384,6 +570,9 @@ func (cmd commandLprt) RequireAuth() bool {
 
 func (cmd commandLprt) Execute(sess *Session, param string) {
 	// No tests for this code yet
+	if !sess.checkDataProtection() {
+		return
+	}
 
 	parts := strings.Split(param, ",")
 
@@ -458,6 +647,13 @@ func (cmd commandEpsv) RequireAuth() bool {
 }
 
 func (cmd commandEpsv) Execute(sess *Session, param string) {
+	if sess.dataChannelOnly() {
+		sess.writeMessage(502, "EPSV is not supported, the data connections are opened in process")
+		return
+	}
+	if !sess.checkDataProtection() {
+		return
+	}
 	socket, err := sess.newPassiveSocket()
 	if err != nil {
 		sess.log(err)
@@ -492,14 +688,24 @@ func convertFileInfo(sess *Session, f os.FileInfo, p string) (FileInfo, error) {
 	}
 	if f.IsDir() {
 		mode |= os.ModeDir
+	} else if f.Mode()&os.ModeSymlink != 0 {
+		mode |= os.ModeSymlink
 	}
-	owner, err := sess.server.Perm.GetOwner(p)
-	if err != nil {
-		return nil, err
+	var owner, group string
+	if ownerInfo, ok := f.(OwnerInfo); ok {
+		owner, group = ownerInfo.Owner(), ownerInfo.Group()
 	}
-	group, err := sess.server.Perm.GetGroup(p)
-	if err != nil {
-		return nil, err
+	if owner == "" {
+		owner, err = sess.server.Perm.GetOwner(p)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if group == "" {
+		group, err = sess.server.Perm.GetGroup(p)
+		if err != nil {
+			return nil, err
+		}
 	}
 	return &fileInfo{
 		FileInfo: f,
@@ -528,12 +734,15 @@ func list(sess *Session, cmd, p, param string) ([]FileInfo, error) {
 
 	var files []FileInfo
 	if info.IsDir() {
-		err = sess.server.Driver.ListDir(ctx, p, func(f os.FileInfo) error {
+		err = sess.listDir(ctx, p, func(f os.FileInfo) error {
+			if sess.isHidden(p, f.Name()) {
+				return nil
+			}
 			info, err := convertFileInfo(sess, f, path.Join(p, f.Name()))
 			if err != nil {
 				return err
 			}
-			files = append(files, info)
+			files = append(files, sess.withLinkTarget(ctx, info, path.Join(p, f.Name())))
 			return nil
 		})
 		if err != nil {
@@ -544,7 +753,7 @@ func list(sess *Session, cmd, p, param string) ([]FileInfo, error) {
 		if err != nil {
 			return nil, err
 		}
-		files = append(files, newInfo)
+		files = append(files, sess.withLinkTarget(ctx, newInfo, p))
 	}
 	return files, nil
 }
@@ -614,7 +823,10 @@ func (cmd commandNlst) Execute(sess *Session, param string) {
 	}
 
 	var files []FileInfo
-	err = sess.server.Driver.ListDir(ctx, path, func(f os.FileInfo) error {
+	err = sess.listDir(ctx, path, func(f os.FileInfo) error {
+		if sess.isHidden(path, f.Name()) {
+			return nil
+		}
 		mode, err := sess.server.Perm.GetMode(path)
 		if err != nil {
 			return err
@@ -694,17 +906,25 @@ func (cmd commandMkd) RequireAuth() bool {
 }
 
 func (cmd commandMkd) Execute(sess *Session, param string) {
-	path := sess.buildPath(param)
+	path, ok := sess.sanitizePath(sess.buildPath(param))
+	if !ok {
+		return
+	}
 	var ctx = Context{
 		Sess:  sess,
 		Cmd:   "MKD",
 		Param: param,
 		Data:  make(map[string]interface{}),
 	}
+	if !sess.checkPathLimits("MKD", param, path) {
+		return
+	}
 	sess.server.notifiers.BeforeCreateDir(&ctx, path)
 	err := sess.server.Driver.MakeDir(&ctx, path)
 	sess.server.notifiers.AfterDirCreated(&ctx, path, err)
-	if err == nil {
+	if err == nil && path != sess.buildPath(param) {
+		sess.writeMessage(257, quotePathname(path)+" directory created")
+	} else if err == nil {
 		sess.writeMessage(257, "Directory created")
 	} else {
 		sess.writeMessage(550, fmt.Sprint("Action not taken: ", err))
@@ -716,7 +936,8 @@ func (cmd commandMkd) Execute(sess *Session, param string) {
 // the original FTP spec had various options for hosts to negotiate how data
 // would be sent over the data socket, In reality these days (S)tream mode
 // is all that is used for the mode - data is just streamed down the data
-// socket unchanged.
+// socket unchanged. The (Z)lib compressed mode, which sends the data through a
+// zlib stream, is supported as well if it's enabled.
 type commandMode struct{}
 
 func (cmd commandMode) IsExtend() bool {
@@ -732,9 +953,18 @@ func (cmd commandMode) RequireAuth() bool {
 }
 
 func (cmd commandMode) Execute(sess *Session, param string) {
-	if strings.ToUpper(param) == "S" {
+	switch strings.ToUpper(param) {
+	case "S":
+		sess.modeZ = false
 		sess.writeMessage(200, "OK")
-	} else {
+	case "Z":
+		if !sess.server.Features.ModeZ {
+			sess.writeMessage(504, "MODE Z is disabled")
+			return
+		}
+		sess.modeZ = true
+		sess.writeMessage(200, "MODE Z ok")
+	default:
 		sess.writeMessage(504, "MODE is an obsolete command")
 	}
 }
@@ -778,6 +1008,10 @@ func (cmd commandPass) RequireAuth() bool {
 }
 
 func (cmd commandPass) Execute(sess *Session, param string) {
+	if sess.server.RequireTLSLogin && !sess.tls {
+		sess.writeMessage(530, "TLS required")
+		return
+	}
 	auth := sess.server.Auth
 	// If Driver implements Auth then call that instead of the Server version
 	if driverAuth, found := sess.server.Driver.(Auth); found {
@@ -789,18 +1023,62 @@ func (cmd commandPass) Execute(sess *Session, param string) {
 		Param: param,
 		Data:  make(map[string]interface{}),
 	}
-	ok, err := auth.CheckPasswd(&ctx, sess.reqUser, param)
-	sess.server.notifiers.AfterUserLogin(&ctx, sess.reqUser, param, ok, err)
-	if err != nil {
+	var (
+		ok        bool
+		anonymous = sess.server.Features.Anonymous && isAnonymousUser(sess.reqUser)
+		err       error
+	)
+	if anonymous {
+		ok = true
+	} else {
+		ok, err = auth.CheckPasswd(&ctx, sess.reqUser, param)
+	}
+	var (
+		userInfo *UserInfo
+		closeAt  time.Time
+	)
+	if ok && err == nil {
+		userInfo, err = lookupUserInfo(&ctx, auth, sess.reqUser)
+		if err == nil {
+			err = userInfo.checkValidity(time.Now())
+		}
+		if err == nil {
+			closeAt, err = userInfo.checkSchedule(time.Now())
+		}
+	}
+	sess.server.notifiers.AfterUserLogin(&ctx, sess.pseudoUser(sess.reqUser), param, ok, err)
+	switch err {
+	case nil:
+	case ErrAccountExpired:
+		sess.writeMessage(530, "Account expired, not logged in")
+		return
+	case ErrAccountNotYetValid:
+		sess.writeMessage(530, "Account not yet valid, not logged in")
+		return
+	case ErrOutsideSchedule:
+		sess.writeMessage(530, "Login not allowed at this time, not logged in")
+		return
+	default:
 		sess.writeMessage(550, "Checking password error")
 		return
 	}
 
 	if ok {
 		sess.user = sess.reqUser
+		sess.userInfo = userInfo
+		sess.anonymous = anonymous
+		sess.closeAt(closeAt)
+		sess.limiter = sess.server.rateLimiter.Share(int(userInfo.Priority))
+		sess.updateInfo(func(info *SessionInfo) {
+			info.limiter = sess.limiter
+		})
 		sess.reqUser = ""
+		sess.bindLogger()
+		sess.loginSucceeded()
+		sess.handshakeDone()
 		sess.writeMessage(230, "Password ok, continue")
 	} else {
+		sess.loginFailed()
 		sess.writeMessage(530, "Incorrect password, not logged in")
 	}
 }
@@ -824,10 +1102,17 @@ func (cmd commandPasv) RequireAuth() bool {
 }
 
 func (cmd commandPasv) Execute(sess *Session, param string) {
+	if sess.dataChannelOnly() {
+		sess.writeMessage(502, "PASV is not supported, the data connections are opened in process")
+		return
+	}
+	if !sess.checkDataProtection() {
+		return
+	}
 	listenIP := sess.passiveListenIP()
-	// TODO: IPv6 for this command is not implemented
-	if strings.HasPrefix(listenIP, "::") {
-		sess.writeMessage(550, "Action not taken")
+	// PASV could only carry an IPv4 address
+	if net.ParseIP(listenIP).To4() == nil {
+		sess.writeMessage(425, "PASV is not supported over IPv6, use EPSV")
 		return
 	}
 
@@ -865,6 +1150,13 @@ func (cmd commandPort) RequireAuth() bool {
 }
 
 func (cmd commandPort) Execute(sess *Session, param string) {
+	if sess.dataChannelOnly() {
+		sess.writeMessage(502, "PORT is not supported, the data connections are opened in process")
+		return
+	}
+	if !sess.checkDataProtection() {
+		return
+	}
 	nums := strings.Split(param, ",")
 	portOne, _ := strconv.Atoi(nums[4])
 	portTwo, _ := strconv.Atoi(nums[5])
@@ -897,7 +1189,7 @@ func (cmd commandPwd) RequireAuth() bool {
 }
 
 func (cmd commandPwd) Execute(sess *Session, param string) {
-	sess.writeMessage(257, "\""+sess.curDir+"\" is the current directory")
+	sess.writeMessage(257, quotePathname(sess.curDir)+" is the current directory")
 }
 
 // CommandQuit responds to the QUIT FTP command. The client has requested the
@@ -940,11 +1232,15 @@ func (cmd commandRetr) RequireAuth() bool {
 
 func (cmd commandRetr) Execute(sess *Session, param string) {
 	path := sess.buildPath(param)
-	if sess.preCommand != "REST" {
+	if sess.preCommand != "REST" && sess.preCommand != "RANG" {
 		sess.lastFilePos = -1
 	}
+	if sess.preCommand != "RANG" {
+		sess.rangeEnd = -1
+	}
 	defer func() {
 		sess.lastFilePos = -1
+		sess.rangeEnd = -1
 	}()
 	var ctx = Context{
 		Sess:  sess,
@@ -952,23 +1248,47 @@ func (cmd commandRetr) Execute(sess *Session, param string) {
 		Param: param,
 		Data:  make(map[string]interface{}),
 	}
+	if !sess.checkTransferQuota("RETR", false) {
+		return
+	}
 	sess.server.notifiers.BeforeDownloadFile(&ctx, path)
 	var readPos = sess.lastFilePos
 	if readPos < 0 {
 		readPos = 0
 	}
-	size, data, err := sess.server.Driver.GetFile(&ctx, path, readPos)
+	var length int64 = -1
+	if sess.rangeEnd >= 0 {
+		length = sess.rangeEnd - readPos + 1
+	}
+	start := time.Now()
+	tr := sess.startTransfer(&ctx)
+	size, data, writer, err := sess.getFileToSend(&ctx, path, readPos, length)
 	if err == nil {
 		defer data.Close()
 		sess.writeMessage(150, fmt.Sprintf("Data transfer starting %d bytes", size))
-		err = sess.sendOutofBandDataWriter(data)
-		sess.server.notifiers.AfterFileDownloaded(&ctx, path, size, err)
-		if err != nil {
+		var sent int64
+		checksum := sess.newTransferChecksum()
+		sent, err = sess.sendOutofBandDataVia(checksum.teeReadCloser(tr.readCloser(data)), writer)
+		sess.accountTransfer(&ctx, 0, sent, err)
+		if tr.stop() {
+			sess.replyAborted(err == nil, readPos+sent)
+			if err != nil {
+				err = errTransferAborted
+			}
+		} else if err != nil {
 			sess.writeMessage(551, "Error reading file")
 		}
+		sess.server.notifiers.AfterFileDownloaded(&ctx, path, size, err)
+		sess.server.notifiers.AfterFileDownloadedEvent(&ctx, checksum.event(newTransferEvent(path, sent, readPos, start, err)))
 	} else {
+		aborted := tr.stop()
 		sess.server.notifiers.AfterFileDownloaded(&ctx, path, size, err)
-		sess.writeMessage(551, "File not available")
+		sess.server.notifiers.AfterFileDownloadedEvent(&ctx, newTransferEvent(path, 0, readPos, start, err))
+		if aborted {
+			sess.replyAborted(false, readPos)
+		} else {
+			sess.writeMessage(551, "File not available")
+		}
 	}
 }
 
@@ -1016,6 +1336,9 @@ func (cmd commandRnfr) RequireAuth() bool {
 func (cmd commandRnfr) Execute(sess *Session, param string) {
 	sess.renameFrom = ""
 	p := sess.buildPath(param)
+	if !sess.checkProtected(p) {
+		return
+	}
 	if _, err := sess.server.Driver.Stat(&Context{
 		Sess:  sess,
 		Cmd:   "RNFR",
@@ -1046,8 +1369,16 @@ func (cmd commandRnto) RequireAuth() bool {
 }
 
 func (cmd commandRnto) Execute(sess *Session, param string) {
-	toPath := sess.buildPath(param)
-	err := sess.server.Driver.Rename(&Context{
+	toPath, ok := sess.sanitizePath(sess.buildPath(param))
+	if !ok {
+		sess.renameFrom = ""
+		return
+	}
+	if !sess.checkPathLimits("RNTO", param, toPath) {
+		sess.renameFrom = ""
+		return
+	}
+	err := sess.rename(&Context{
 		Sess:  sess,
 		Cmd:   "RNTO",
 		Param: param,
@@ -1057,7 +1388,9 @@ func (cmd commandRnto) Execute(sess *Session, param string) {
 		sess.renameFrom = ""
 	}()
 
-	if err == nil {
+	if err == nil && toPath != sess.buildPath(param) {
+		sess.writeMessage(250, "File renamed to "+encodePathname(toPath))
+	} else if err == nil {
 		sess.writeMessage(250, "File renamed")
 	} else {
 		sess.writeMessage(550, fmt.Sprint("Action not taken: ", err))
@@ -1116,11 +1449,14 @@ func executeRmd(cmd string, sess *Session, param string) {
 		sess.writeMessage(550, "Directory / cannot be deleted")
 		return
 	}
+	if !sess.checkProtected(p) {
+		return
+	}
 
 	var needChangeCurDir = strings.HasPrefix(param, sess.curDir)
 
 	sess.server.notifiers.BeforeDeleteDir(&ctx, p)
-	err := sess.server.Driver.DeleteDir(&ctx, p)
+	err := sess.deleteDir(&ctx, p)
 	if needChangeCurDir {
 		sess.curDir = path.Dir(param)
 	}
@@ -1244,26 +1580,11 @@ func (cmd commandMLSD) RequireAuth() bool {
 	return true
 }
 
-func toMLSDFormat(files []FileInfo) []byte {
+// toMLSDFormat returns the fact lines of the files, see mlstFacts
+func toMLSDFormat(files []FileInfo, facts []string) []byte {
 	var buf bytes.Buffer
 	for _, file := range files {
-		var fileType = "file"
-		if file.IsDir() {
-			fileType = "dir"
-		}
-		/*Possible facts "Size" / "Modify" / "Create" /
-				  "Type" / "Unique" / "Perm" /
-				  "Lang" / "Media-Type" / "CharSet"
-				  TODO: Perm pvals        = "a" / "c" / "d" / "e" / "f" /
-		                     "l" / "m" / "p" / "r" / "w"
-		*/
-		fmt.Fprintf(&buf,
-			"Type=%s;Modify=%s;Size=%d; %s\n",
-			fileType,
-			file.ModTime().Format("20060102150405"),
-			file.Size(),
-			file.Name(),
-		)
+		fmt.Fprintf(&buf, "%s %s\r\n", fileFacts(file, facts), file.Name())
 	}
 	return buf.Bytes()
 }
@@ -1281,7 +1602,7 @@ func (cmd commandMLSD) Execute(sess *Session, param string) {
 	}
 
 	sess.writeMessage(150, "Opening ASCII mode data connection for file list")
-	sess.sendOutofbandData(toMLSDFormat(files))
+	sess.sendOutofbandData(toMLSDFormat(files, sess.factsOrDefault()))
 }
 
 type commandPbsz struct{}
@@ -1322,7 +1643,10 @@ func (cmd commandProt) RequireAuth() bool {
 
 func (cmd commandProt) Execute(sess *Session, param string) {
 	if sess.tls && param == "P" {
+		sess.protected = true
 		sess.writeMessage(200, "OK")
+	} else if sess.tls && param == "C" && sess.requiresProtectedData() {
+		sess.writeMessage(534, "Request denied for policy reasons, PROT P required")
 	} else if sess.tls {
 		sess.writeMessage(536, "Only P level is supported")
 	} else {
@@ -1366,18 +1690,29 @@ func (cmd commandSize) RequireAuth() bool {
 
 func (cmd commandSize) Execute(sess *Session, param string) {
 	path := sess.buildPath(param)
-	stat, err := sess.server.Driver.Stat(&Context{
+	ctx := &Context{
 		Sess:  sess,
 		Cmd:   "SIZE",
 		Param: param,
 		Data:  make(map[string]interface{}),
-	}, path)
+	}
+	stat, err := sess.server.Driver.Stat(ctx, path)
 	if err != nil {
-		log.Printf("Size: error(%s)", err)
+		sess.logf("Size: error(%s)", err)
 		sess.writeMessage(450, fmt.Sprintf("path %s not found", param))
-	} else {
-		sess.writeMessage(213, strconv.Itoa(int(stat.Size())))
+		return
+	}
+	if stat.IsDir() && sess.server.DirSize != nil {
+		usage, err := sess.dirUsage(ctx, path)
+		if err != nil {
+			sess.logf("Size: error(%s)", err)
+			sess.writeMessage(550, fmt.Sprint("Action not taken: ", err))
+			return
+		}
+		sess.writeMessage(213, strconv.FormatInt(usage.bytes, 10))
+		return
 	}
+	sess.writeMessage(213, strconv.Itoa(int(stat.Size())))
 }
 
 // commandStat responds to the STAT FTP command. It returns the stat of the
@@ -1399,56 +1734,33 @@ func (cmd commandStat) RequireAuth() bool {
 func (cmd commandStat) Execute(sess *Session, param string) {
 	// system stat
 	if param == "" {
-		sess.writeMessage(211, fmt.Sprintf("%s FTP server status:\nVersion %s"+
-			"Connected to %s (%s)\n"+
-			"Logged in %s\n"+
-			"TYPE: ASCII, FORM: Nonprint; STRUcture: File; transfer MODE: Stream\n"+
-			"No data connection", sess.PublicIP(), version, sess.PublicIP(),
-			version, sess.LoginUser()))
-		sess.writeMessage(211, "End of status")
+		sess.writeMessageLines(211, fmt.Sprintf("%s FTP server status:", sess.server.Name), []string{
+			"Version " + version,
+			"Connected to " + sess.RemoteAddr().String(),
+			"Logged in " + sess.LoginUser(),
+			"TYPE: ASCII, FORM: Nonprint; STRUcture: File; transfer MODE: Stream",
+			"No data connection",
+		}, "End of status")
 		return
 	}
 
-	var ctx = Context{
-		Sess:  sess,
-		Cmd:   "STAT",
-		Param: param,
-		Data:  make(map[string]interface{}),
+	// file or directory stat, the listing is sent over the control connection
+	// so that clients don't need to open a data connection for it
+	p := sess.buildPath(parseListParam(param))
+	files, err := list(sess, "STAT", p, param)
+	if err != nil {
+		sess.logf("%v", err)
+		sess.writeMessage(450, fmt.Sprintf("path %s not found", p))
+		return
 	}
 
-	// file or directory stat
-	path := sess.buildPath(param)
-	stat, err := sess.server.Driver.Stat(&ctx, path)
-	if err != nil {
-		log.Printf("Size: error(%s)", err)
-		sess.writeMessage(450, fmt.Sprintf("path %s not found", path))
-	} else {
-		var files []FileInfo
-		if stat.IsDir() {
-			err = sess.server.Driver.ListDir(&ctx, path, func(f os.FileInfo) error {
-				info, err := convertFileInfo(sess, f, filepath.Join(path, f.Name()))
-				if err != nil {
-					return err
-				}
-				files = append(files, info)
-				return nil
-			})
-			if err != nil {
-				sess.writeMessage(550, err.Error())
-				return
-			}
-			sess.writeMessage(213, "Opening ASCII mode data connection for file list")
-		} else {
-			info, err := convertFileInfo(sess, stat, path)
-			if err != nil {
-				sess.writeMessage(550, err.Error())
-				return
-			}
-			files = append(files, info)
-			sess.writeMessage(212, "Opening ASCII mode data connection for file list")
+	var lines []string
+	for _, line := range strings.Split(string(listFormatter(files).Detailed()), "\r\n") {
+		if line != "" {
+			lines = append(lines, line)
 		}
-		sess.sendOutofbandData(listFormatter(files).Detailed())
 	}
+	sess.writeMessageLines(213, "Status of "+p+":", lines, "End of status")
 }
 
 // commandStor responds to the STOR FTP command. It allows the user to upload a
@@ -1468,8 +1780,44 @@ func (cmd commandStor) RequireAuth() bool {
 }
 
 func (cmd commandStor) Execute(sess *Session, param string) {
-	targetPath := sess.buildPath(param)
-	sess.writeMessage(150, "Data transfer starting")
+	targetPath, ok := sess.sanitizePath(sess.buildPath(param))
+	if !ok {
+		return
+	}
+	if sess.ignoreUpload(targetPath) {
+		return
+	}
+	if !sess.checkPathLimits("STOR", param, targetPath) {
+		return
+	}
+	if !sess.checkResume(targetPath) {
+		return
+	}
+	if !sess.checkAllocation("STOR", targetPath) {
+		return
+	}
+	if !sess.checkTransferQuota("STOR", true) {
+		return
+	}
+	if !sess.makeParents("STOR", targetPath) {
+		return
+	}
+	unlock, ok := sess.lockUpload("STOR", targetPath)
+	if !ok {
+		return
+	}
+	defer unlock()
+	// check once the lock is held, so no other session creates the file
+	// in between
+	if !sess.checkClobber("STOR", targetPath) {
+		return
+	}
+	if targetPath != sess.buildPath(param) {
+		// report the sanitized name like STOU does
+		sess.writeMessage(150, "FILE: "+targetPath)
+	} else {
+		sess.writeMessage(150, "Data transfer starting")
+	}
 
 	if sess.preCommand != "REST" {
 		sess.lastFilePos = -1
@@ -1477,6 +1825,7 @@ func (cmd commandStor) Execute(sess *Session, param string) {
 
 	defer func() {
 		sess.lastFilePos = -1
+		sess.allocSize = 0
 	}()
 
 	var ctx = Context{
@@ -1485,10 +1834,46 @@ func (cmd commandStor) Execute(sess *Session, param string) {
 		Param: param,
 		Data:  make(map[string]interface{}),
 	}
+	reader, err := sess.dataReader()
+	if err != nil {
+		sess.writeMessage(450, fmt.Sprint("error during transfer: ", err))
+		return
+	}
+	checksum := sess.newTransferChecksum()
+	// the uploads running at once are limited by the memory budget
+	_, release := sess.acquireTransferBuffer()
+	defer release()
 	sess.server.notifiers.BeforePutFile(&ctx, targetPath)
-	size, err := sess.server.Driver.PutFile(&ctx, targetPath, sess.dataConn, sess.lastFilePos)
-	sess.server.notifiers.AfterFilePut(&ctx, targetPath, size, err)
+	start := time.Now()
+	tr := sess.startTransfer(&ctx)
+	size, err := sess.server.Driver.PutFile(&ctx, targetPath, checksum.teeReader(tr.reader(reader)), sess.lastFilePos)
+	aborted := tr.stop()
+	if aborted {
+		// the data received until the data connection was closed is
+		// incomplete even if the driver didn't fail
+		err = errTransferAborted
+	} else if sess.dataConn != nil {
+		// a data connection carries a single upload
+		sess.dataConn.Close()
+		sess.dataConn = nil
+	}
+	var rejected int
 	if err == nil {
+		rejected, err = sess.processUpload(&ctx, checksum.event(newTransferEvent(targetPath, size, sess.lastFilePos, start, nil)))
+	}
+	// the rejected uploads are not counted as uploaded
+	sess.accountTransfer(&ctx, size, 0, err)
+	var stopped int64
+	if err != nil && rejected == 0 {
+		stopped = sess.stoppedUpload(&ctx, targetPath)
+	}
+	sess.server.notifiers.AfterFilePut(&ctx, targetPath, size, err)
+	sess.server.notifiers.AfterFilePutEvent(&ctx, checksum.event(newTransferEvent(targetPath, size, sess.lastFilePos, start, err)))
+	if aborted {
+		sess.replyAborted(false, stopped)
+	} else if rejected != 0 {
+		sess.writeMessage(rejected, fmt.Sprint("Upload rejected: ", err))
+	} else if err == nil {
 		msg := fmt.Sprintf("OK, received %d bytes", size)
 		sess.writeMessage(226, msg)
 	} else {
@@ -1596,12 +1981,16 @@ func (cmd commandUser) RequireAuth() bool {
 }
 
 func (cmd commandUser) Execute(sess *Session, param string) {
+	if sess.server.RequireTLSLogin && !sess.tls {
+		sess.writeMessage(530, "TLS required")
+		return
+	}
 	sess.reqUser = param
 	sess.server.notifiers.BeforeLoginUser(&Context{
 		Sess:  sess,
 		Cmd:   "USER",
-		Param: param,
+		Param: sess.pseudoUser(param),
 		Data:  make(map[string]interface{}),
-	}, sess.reqUser)
+	}, sess.pseudoUser(sess.reqUser))
 	sess.writeMessage(331, "User name ok, password required")
 }
@@ -0,0 +1,63 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// ftpreplay replays a session recorded with Options.RecordDir against a
+// server and reports the replies which differ from the recorded ones.
+//
+//	ftpreplay -addr localhost:2121 -pass secret recording.jsonl
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/replay"
+)
+
+func main() {
+	var (
+		addr    = flag.String("addr", "localhost:2121", "the address of the server")
+		pass    = flag.String("pass", "", "the password sent instead of the redacted ones")
+		timeout = flag.Duration("timeout", 10*time.Second, "how long to wait for a reply")
+	)
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: ftpreplay [flags] recording")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	records, err := server.ReadRecording(f)
+	f.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	conn, err := net.DialTimeout("tcp", *addr, *timeout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	mismatches, err := replay.Replay(conn, records, &replay.Options{
+		Password: *pass,
+		Timeout:  *timeout,
+	})
+	for _, m := range mismatches {
+		fmt.Println(m)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(mismatches) > 0 {
+		os.Exit(1)
+	}
+}
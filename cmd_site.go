@@ -0,0 +1,244 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SiteCommand represents a sub command of the SITE ftp command
+type SiteCommand interface {
+	RequireParam() bool
+	Execute(*Session, string)
+}
+
+var (
+	defaultSiteCommands = map[string]SiteCommand{
+		"DU":       siteDu{},
+		"HELP":     siteHelp{},
+		"QUOTA":    siteQuota{},
+		"RMDIR":    siteRmdir{},
+		"SEGMENTS": siteSegments{},
+		"SEARCH":   siteSearch{},
+		"SEGRETR":  siteSegretr{},
+		"SYMLINK":  siteSymlink{},
+		"UNDELETE": siteUndelete{},
+		"USAGE":    siteUsage{},
+		"UTIME":    siteUtime{},
+		"VERSIONS": siteVersions{},
+		"XFERLOG":  siteXferlog{},
+	}
+)
+
+// DefaultSiteCommands returns the default sub commands of the SITE command
+func DefaultSiteCommands() map[string]SiteCommand {
+	return defaultSiteCommands
+}
+
+// commandSite responds to the SITE FTP command. It dispatches the request
+// to the registered sub command.
+type commandSite struct{}
+
+func (cmd commandSite) IsExtend() bool {
+	return false
+}
+
+func (cmd commandSite) RequireParam() bool {
+	return true
+}
+
+func (cmd commandSite) RequireAuth() bool {
+	return true
+}
+
+func (cmd commandSite) Execute(sess *Session, param string) {
+	parts := strings.SplitN(strings.TrimSpace(param), " ", 2)
+	var (
+		name     = strings.ToUpper(parts[0])
+		subParam string
+	)
+	if len(parts) > 1 {
+		subParam = strings.TrimSpace(parts[1])
+	}
+
+	siteCmd := sess.server.SiteCommands[name]
+	if siteCmd == nil {
+		sess.writeMessage(500, fmt.Sprintf("SITE %s not understood", name))
+		return
+	}
+	if siteCmd.RequireParam() && subParam == "" {
+		sess.writeMessage(501, "action aborted, required param missing")
+		return
+	}
+	siteCmd.Execute(sess, subParam)
+}
+
+// siteHelp responds to the SITE HELP command. It lists the sub commands of
+// SITE the server supports.
+type siteHelp struct{}
+
+func (cmd siteHelp) RequireParam() bool {
+	return false
+}
+
+func (cmd siteHelp) Execute(sess *Session, param string) {
+	var names = make([]string, 0, len(sess.server.SiteCommands))
+	for name := range sess.server.SiteCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sess.writeMessageLines(214, "The following SITE commands are recognized", names, "End of help")
+}
+
+// siteQuota responds to the SITE QUOTA command. It reports the quota and
+// the usage of the login user, along with the usage of the transfer quota,
+// so that users could find out why a transfer has been refused.
+type siteQuota struct{}
+
+func (cmd siteQuota) RequireParam() bool {
+	return false
+}
+
+func formatQuotaLimit(limit int64) string {
+	if limit <= 0 {
+		return "unlimited"
+	}
+	return strconv.FormatInt(limit, 10)
+}
+
+func (cmd siteQuota) Execute(sess *Session, param string) {
+	var ctx = &Context{
+		Sess:  sess,
+		Cmd:   "SITE QUOTA",
+		Param: param,
+		Data:  make(map[string]interface{}),
+	}
+	usage, err := sess.sessionTransferUsage(ctx)
+	if err != nil {
+		sess.logf("%v", err)
+		sess.writeMessage(550, fmt.Sprint("Action not taken: ", err))
+		return
+	}
+	driver, _ := optionalDriver(sess.server.Driver, func(driver Driver) bool {
+		_, ok := driver.(QuotaReporter)
+		return ok
+	})
+	reporter, ok := driver.(QuotaReporter)
+	if !ok && usage == nil {
+		sess.writeMessage(502, "SITE QUOTA is not supported by the driver")
+		return
+	}
+
+	var lines = []string{"Name: " + sess.LoginUser()}
+	if ok {
+		quota, err := reporter.Quota(ctx)
+		if err != nil {
+			sess.logf("%v", err)
+			sess.writeMessage(550, fmt.Sprint("Action not taken: ", err))
+			return
+		}
+		lines = append(lines,
+			fmt.Sprintf("Bytes: %d/%s", quota.BytesUsed, formatQuotaLimit(quota.BytesLimit)),
+			fmt.Sprintf("Files: %d/%s", quota.FilesUsed, formatQuotaLimit(quota.FilesLimit)))
+	}
+	if usage != nil {
+		since := usage.Since.Format("2006-01-02")
+		lines = append(lines,
+			fmt.Sprintf("Uploaded: %d/%s %s since %s", usage.Uploaded, formatQuotaLimit(usage.UploadLimit), usage.Period, since),
+			fmt.Sprintf("Downloaded: %d/%s %s since %s", usage.Downloaded, formatQuotaLimit(usage.DownloadLimit), usage.Period, since))
+	}
+	sess.writeMessageLines(200, "The current quota for this session are [current/limit]:", lines, "End of quota")
+}
+
+// siteUtime responds to the SITE UTIME command. It allows the client to
+// change the modification time of a file. Both of the forms used in the wild
+// are supported:
+//
+//	SITE UTIME 20200102150405 path
+//	SITE UTIME path 20200102150405 20200102150405 20200102150405 UTC
+//
+// The second form carries access, modification and creation time, only the
+// modification time is used.
+type siteUtime struct{}
+
+func (cmd siteUtime) RequireParam() bool {
+	return true
+}
+
+func (cmd siteUtime) Execute(sess *Session, param string) {
+	setter, ok := sess.server.Driver.(ModTimeSetter)
+	if !ok {
+		sess.writeMessage(502, "SITE UTIME is not supported by the driver")
+		return
+	}
+
+	p, mtime, err := parseUtimeParam(param)
+	if err != nil {
+		sess.writeMessage(501, err.Error())
+		return
+	}
+
+	var ctx = &Context{
+		Sess:  sess,
+		Cmd:   "SITE UTIME",
+		Param: param,
+		Data:  make(map[string]interface{}),
+	}
+	path := sess.buildPath(p)
+	if !sess.checkTrashWrite(ctx, path) {
+		return
+	}
+	err = setter.SetModTime(ctx, path, mtime)
+	if err != nil {
+		sess.logf("%v", err)
+		sess.writeMessage(550, fmt.Sprint("Action not taken: ", err))
+		return
+	}
+	sess.writeMessage(200, "SITE UTIME command successful")
+}
+
+// parseUtimeParam returns the path and the modification time a SITE UTIME
+// parameter refers to.
+func parseUtimeParam(param string) (string, time.Time, error) {
+	fields := strings.Fields(param)
+	if len(fields) >= 5 && strings.EqualFold(fields[len(fields)-1], "UTC") {
+		mtime, err := parseUtimeTime(fields[len(fields)-3])
+		if err == nil {
+			// the path may contain spaces, so cut the four trailing fields
+			p := strings.TrimSpace(param)
+			for i := 0; i < 4; i++ {
+				p = strings.TrimSpace(p[:strings.LastIndex(p, " ")])
+			}
+			return p, mtime, nil
+		}
+	}
+
+	parts := strings.SplitN(strings.TrimSpace(param), " ", 2)
+	if len(parts) != 2 {
+		return "", time.Time{}, fmt.Errorf("invalid SITE UTIME param %q", param)
+	}
+	mtime, err := parseUtimeTime(parts[0])
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return strings.TrimSpace(parts[1]), mtime, nil
+}
+
+func parseUtimeTime(v string) (time.Time, error) {
+	var layout string
+	switch len(v) {
+	case 12:
+		layout = "200601021504"
+	case 14:
+		layout = "20060102150405"
+	default:
+		return time.Time{}, fmt.Errorf("invalid time %q", v)
+	}
+	return time.ParseInLocation(layout, v, time.UTC)
+}
@@ -4,7 +4,14 @@
 
 package server
 
-import "testing"
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
 
 func TestParseListParam(t *testing.T) {
 	var paramTests = []struct {
@@ -32,3 +39,112 @@ func TestParseListParam(t *testing.T) {
 		}
 	}
 }
+
+func TestParseUtimeParam(t *testing.T) {
+	var utimeTests = []struct {
+		param    string
+		path     string
+		expected time.Time
+	}{
+		{"20200102150405 a.txt", "a.txt", time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{"202001021504 dir/a b.txt", "dir/a b.txt", time.Date(2020, 1, 2, 15, 4, 0, 0, time.UTC)},
+		{"a b.txt 20190101000000 20200102150405 20190101000000 UTC", "a b.txt", time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC)},
+	}
+
+	for _, tt := range utimeTests {
+		p, mtime, err := parseUtimeParam(tt.param)
+		if err != nil {
+			t.Errorf("parseUtimeParam(%s): unexpected error %v", tt.param, err)
+			continue
+		}
+		if p != tt.path || !mtime.Equal(tt.expected) {
+			t.Errorf("parseUtimeParam(%s): expected %s %v, actual %s %v", tt.param, tt.path, tt.expected, p, mtime)
+		}
+	}
+
+	if _, _, err := parseUtimeParam("a.txt"); err == nil {
+		t.Errorf("parseUtimeParam(a.txt): expected error")
+	}
+}
+
+type ownedFileInfo struct {
+	os.FileInfo
+	owner string
+}
+
+func (f ownedFileInfo) Owner() string { return f.owner }
+func (f ownedFileInfo) Group() string { return "" }
+
+func TestConvertFileInfoOwner(t *testing.T) {
+	sess := &Session{
+		server: &Server{
+			Options: &Options{
+				Perm: NewSimplePerm("perm-owner", "perm-group"),
+			},
+		},
+	}
+	stat, err := os.Stat("cmd_test.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := convertFileInfo(sess, stat, "/cmd_test.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Owner() != "perm-owner" || info.Group() != "perm-group" {
+		t.Errorf("expected the owner and the group of the perm, actual %s %s", info.Owner(), info.Group())
+	}
+
+	info, err = convertFileInfo(sess, ownedFileInfo{stat, "driver-owner"}, "/cmd_test.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Owner() != "driver-owner" || info.Group() != "perm-group" {
+		t.Errorf("expected the owner of the driver and the group of the perm, actual %s %s", info.Owner(), info.Group())
+	}
+}
+
+func TestListSymlinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "symlinks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Symlink("a.txt", filepath.Join(dir, "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+	stat, err := os.Lstat(filepath.Join(dir, "b.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sess := &Session{
+		server: &Server{
+			Options: &Options{
+				Perm: NewSimplePerm("test", "test"),
+			},
+		},
+	}
+	info, err := convertFileInfo(sess, stat, "/b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listing := string(listFormatter([]FileInfo{info}).Detailed())
+	if !strings.HasPrefix(listing, "lrwxrwxrwx 1 test test ") || !strings.HasSuffix(listing, " b.txt\r\n") {
+		t.Errorf("unexpected listing of the link %q", listing)
+	}
+	if facts := string(toMLSDFormat([]FileInfo{info}, mlstFacts)); !strings.HasPrefix(facts, "Type=OS.unix=symlink;") {
+		t.Errorf("unexpected facts of the link %q", facts)
+	}
+
+	info.(*fileInfo).target = "/a.txt"
+	listing = string(listFormatter([]FileInfo{info}).Detailed())
+	if !strings.HasSuffix(listing, " b.txt -> /a.txt\r\n") {
+		t.Errorf("unexpected listing of the link %q", listing)
+	}
+	if facts := string(toMLSDFormat([]FileInfo{info}, mlstFacts)); !strings.HasPrefix(facts, "Type=OS.unix=slink:/a.txt;") {
+		t.Errorf("unexpected facts of the link %q", facts)
+	}
+}
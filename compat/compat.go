@@ -0,0 +1,185 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package compat runs the drivers written for the v1 API of the server on
+// the v2 one.
+//
+// A v1 driver is created per connection by its DriverFactory and receives
+// no Context, the adapter creates one driver per session and keeps it in the
+// session data:
+//
+//	driver := compat.NewDriver(factory)
+//	s, err := server.NewServer(&server.Options{
+//		Driver: driver,
+//		...
+//	})
+package compat
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"goftp.io/server/v2"
+)
+
+// Driver represents the v1 driver interface. The Init method of v1 drivers
+// took the v1 connection, drivers needing the session should implement
+// Initializer instead. ChangeDir is called when the client changes the
+// current directory, its error refuses the change.
+type Driver interface {
+	Stat(string) (server.FileInfo, error)
+	ChangeDir(string) error
+	ListDir(string, func(server.FileInfo) error) error
+	DeleteDir(string) error
+	DeleteFile(string) error
+	Rename(string, string) error
+	MakeDir(string) error
+	GetFile(string, int64) (int64, io.ReadCloser, error)
+	PutFile(string, io.Reader, bool) (int64, error)
+}
+
+// Initializer is an optional interface a v1 driver could implement to be
+// initialized with the session it's created for
+type Initializer interface {
+	Init(*server.Session)
+}
+
+// DriverFactory represents the v1 driver factory interface
+type DriverFactory interface {
+	NewDriver() (Driver, error)
+}
+
+const sessionDataKey = "compat.driver"
+
+var (
+	_ server.Driver = &Adapter{}
+)
+
+// Adapter implements the v2 server.Driver interface on top of the v1 drivers
+// produced by a factory
+type Adapter struct {
+	factory DriverFactory
+}
+
+// NewDriver returns an adapter for the drivers produced by the factory
+func NewDriver(factory DriverFactory) *Adapter {
+	return &Adapter{factory: factory}
+}
+
+// driver returns the v1 driver of the session, creating it on first use
+func (adapter *Adapter) driver(ctx *server.Context) (Driver, error) {
+	sess := ctx.Sess
+	if sess == nil {
+		return adapter.factory.NewDriver()
+	}
+	if driver, ok := sess.Data[sessionDataKey].(Driver); ok {
+		return driver, nil
+	}
+	driver, err := adapter.factory.NewDriver()
+	if err != nil {
+		return nil, err
+	}
+	if initializer, ok := driver.(Initializer); ok {
+		initializer.Init(sess)
+	}
+	sess.Data[sessionDataKey] = driver
+	return driver, nil
+}
+
+// Stat implements server.Driver
+func (adapter *Adapter) Stat(ctx *server.Context, path string) (os.FileInfo, error) {
+	driver, err := adapter.driver(ctx)
+	if err != nil {
+		return nil, err
+	}
+	info, err := driver.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	// the v2 server checks the new current directory via Stat
+	if ctx.Cmd == "CWD" && info.IsDir() {
+		if err := driver.ChangeDir(path); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+// ListDir implements server.Driver
+func (adapter *Adapter) ListDir(ctx *server.Context, path string, callback func(os.FileInfo) error) error {
+	driver, err := adapter.driver(ctx)
+	if err != nil {
+		return err
+	}
+	return driver.ListDir(path, func(info server.FileInfo) error {
+		return callback(info)
+	})
+}
+
+// DeleteDir implements server.Driver
+func (adapter *Adapter) DeleteDir(ctx *server.Context, path string) error {
+	driver, err := adapter.driver(ctx)
+	if err != nil {
+		return err
+	}
+	return driver.DeleteDir(path)
+}
+
+// DeleteFile implements server.Driver
+func (adapter *Adapter) DeleteFile(ctx *server.Context, path string) error {
+	driver, err := adapter.driver(ctx)
+	if err != nil {
+		return err
+	}
+	return driver.DeleteFile(path)
+}
+
+// Rename implements server.Driver
+func (adapter *Adapter) Rename(ctx *server.Context, fromPath string, toPath string) error {
+	driver, err := adapter.driver(ctx)
+	if err != nil {
+		return err
+	}
+	return driver.Rename(fromPath, toPath)
+}
+
+// MakeDir implements server.Driver
+func (adapter *Adapter) MakeDir(ctx *server.Context, path string) error {
+	driver, err := adapter.driver(ctx)
+	if err != nil {
+		return err
+	}
+	return driver.MakeDir(path)
+}
+
+// GetFile implements server.Driver
+func (adapter *Adapter) GetFile(ctx *server.Context, path string, offset int64) (int64, io.ReadCloser, error) {
+	driver, err := adapter.driver(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	return driver.GetFile(path, offset)
+}
+
+// PutFile implements server.Driver. The v1 drivers could only append to the
+// end of a file, so a positive offset has to be the size of the file.
+func (adapter *Adapter) PutFile(ctx *server.Context, destPath string, data io.Reader, offset int64) (int64, error) {
+	driver, err := adapter.driver(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if offset <= 0 {
+		return driver.PutFile(destPath, data, false)
+	}
+
+	info, err := driver.Stat(destPath)
+	if err != nil {
+		return 0, err
+	}
+	if info.Size() != offset {
+		return 0, fmt.Errorf("It's unsupported that offset %d is not equal to %d", offset, info.Size())
+	}
+	return driver.PutFile(destPath, data, true)
+}
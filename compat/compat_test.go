@@ -0,0 +1,146 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package compat
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockFileInfo struct {
+	name  string
+	size  int64
+	isDir bool
+}
+
+func (m *mockFileInfo) Name() string       { return m.name }
+func (m *mockFileInfo) Size() int64        { return m.size }
+func (m *mockFileInfo) Mode() os.FileMode  { return os.ModePerm }
+func (m *mockFileInfo) ModTime() time.Time { return time.Time{} }
+func (m *mockFileInfo) IsDir() bool        { return m.isDir }
+func (m *mockFileInfo) Sys() interface{}   { return nil }
+func (m *mockFileInfo) Owner() string      { return "owner" }
+func (m *mockFileInfo) Group() string      { return "group" }
+
+// mockDriver is a v1 driver holding the files in memory
+type mockDriver struct {
+	files   map[string]string
+	curDir  string
+	appends []bool
+}
+
+func (d *mockDriver) Stat(path string) (server.FileInfo, error) {
+	if strings.HasSuffix(path, "dir") {
+		return &mockFileInfo{name: path, isDir: true}, nil
+	}
+	content, ok := d.files[path]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return &mockFileInfo{name: path, size: int64(len(content))}, nil
+}
+
+func (d *mockDriver) ChangeDir(path string) error {
+	if path == "/forbidden-dir" {
+		return errors.New("forbidden")
+	}
+	d.curDir = path
+	return nil
+}
+
+func (d *mockDriver) ListDir(path string, callback func(server.FileInfo) error) error {
+	for name, content := range d.files {
+		if err := callback(&mockFileInfo{name: name, size: int64(len(content))}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *mockDriver) DeleteDir(path string) error          { return nil }
+func (d *mockDriver) DeleteFile(path string) error         { delete(d.files, path); return nil }
+func (d *mockDriver) Rename(fromPath, toPath string) error { return nil }
+func (d *mockDriver) MakeDir(path string) error            { return nil }
+func (d *mockDriver) GetFile(path string, offset int64) (int64, io.ReadCloser, error) {
+	content := d.files[path][offset:]
+	return int64(len(content)), ioutil.NopCloser(strings.NewReader(content)), nil
+}
+
+func (d *mockDriver) PutFile(path string, data io.Reader, appendData bool) (int64, error) {
+	buf, err := ioutil.ReadAll(data)
+	if err != nil {
+		return 0, err
+	}
+	d.appends = append(d.appends, appendData)
+	if appendData {
+		d.files[path] += string(buf)
+	} else {
+		d.files[path] = string(buf)
+	}
+	return int64(len(buf)), nil
+}
+
+type mockFactory struct {
+	drivers []*mockDriver
+}
+
+func (f *mockFactory) NewDriver() (Driver, error) {
+	driver := &mockDriver{files: make(map[string]string)}
+	f.drivers = append(f.drivers, driver)
+	return driver, nil
+}
+
+func TestAdapter(t *testing.T) {
+	factory := &mockFactory{}
+	adapter := NewDriver(factory)
+	ctx := &server.Context{
+		Sess: &server.Session{Data: make(map[string]interface{})},
+	}
+
+	size, err := adapter.PutFile(ctx, "/a.txt", strings.NewReader("abc"), -1)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, size)
+
+	_, err = adapter.PutFile(ctx, "/a.txt", strings.NewReader("def"), 3)
+	assert.NoError(t, err)
+	_, err = adapter.PutFile(ctx, "/a.txt", strings.NewReader("ghi"), 2)
+	assert.Error(t, err)
+
+	size, r, err := adapter.GetFile(ctx, "/a.txt", 2)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 4, size)
+	buf, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	assert.EqualValues(t, "cdef", string(buf))
+
+	var names []string
+	assert.NoError(t, adapter.ListDir(ctx, "/", func(info os.FileInfo) error {
+		names = append(names, info.Name())
+		assert.EqualValues(t, "owner", info.(server.FileInfo).Owner())
+		return nil
+	}))
+	assert.EqualValues(t, []string{"/a.txt"}, names)
+
+	ctx.Cmd = "CWD"
+	_, err = adapter.Stat(ctx, "/sub-dir")
+	assert.NoError(t, err)
+	_, err = adapter.Stat(ctx, "/forbidden-dir")
+	assert.Error(t, err)
+
+	// all the calls of a session are sent to the same driver
+	if assert.Len(t, factory.drivers, 1) {
+		assert.EqualValues(t, []bool{false, true}, factory.drivers[0].appends)
+		assert.EqualValues(t, "/sub-dir", factory.drivers[0].curDir)
+	}
+}
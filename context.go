@@ -4,10 +4,68 @@
 
 package server
 
+import (
+	"context"
+	"time"
+)
+
 // Context represents a context the driver may want to know
 type Context struct {
 	Sess  *Session
 	Cmd   string                 // request command on this request
 	Param string                 // request param on this request
 	Data  map[string]interface{} // share data between middlewares
+
+	ctx context.Context // cancelled when the transfer is aborted
+}
+
+// Context returns the context of the request, the context of a transfer is
+// cancelled when the client aborts it or closes the control connection, so
+// the driver could stop the backend operations
+func (ctx *Context) Context() context.Context {
+	if ctx.ctx == nil {
+		return context.Background()
+	}
+	return ctx.ctx
+}
+
+// Backoff pauses the transfers of the server for d, i.e. when the storage
+// asks to slow down, so the clients are slowed instead of the transfers
+// failing
+func (ctx *Context) Backoff(d time.Duration) {
+	if ctx.Sess == nil {
+		return
+	}
+	ctx.Sess.server.rateLimiter.Backoff(d)
+}
+
+// ClientSoftware returns the client software announced via the CLNT command
+func (ctx *Context) ClientSoftware() string {
+	if ctx.Sess == nil {
+		return ""
+	}
+	return ctx.Sess.ClientSoftware()
+}
+
+// Country returns the country of the client resolved by Options.GeoIP
+func (ctx *Context) Country() string {
+	if ctx.Sess == nil {
+		return ""
+	}
+	return ctx.Sess.Country()
+}
+
+// Sessions returns the snapshots of the other active sessions of the login
+// user, i.e. to tell if a file is in use by another session
+func (ctx *Context) Sessions() []SessionInfo {
+	if ctx.Sess == nil || !ctx.Sess.IsLogin() {
+		return nil
+	}
+	var infos []SessionInfo
+	for _, sess := range ctx.Sess.server.userSessions(ctx.Sess.LoginUser()) {
+		if sess != ctx.Sess {
+			infos = append(infos, sess.Info())
+		}
+	}
+	return infos
 }
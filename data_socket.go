@@ -6,6 +6,7 @@ package server
 
 import (
 	"crypto/tls"
+	"errors"
 	"io"
 	"net"
 	"os"
@@ -40,18 +41,41 @@ type DataSocket interface {
 }
 
 type activeSocket struct {
-	conn *net.TCPConn
+	conn   *net.TCPConn
 	reader io.Reader
 	writer io.Writer
-	sess *Session
-	host string
-	port int
+	sess   *Session
+	host   string
+	port   int
+}
+
+// errFXPDisabled is returned when a data connection to or from another host
+// than the client is refused
+var errFXPDisabled = errors.New("data connection with a foreign host is not allowed")
+
+// allowDataHost returns if a data connection could be established with the
+// host, only the client host is allowed if FXP is disabled
+func (sess *Session) allowDataHost(host string) bool {
+	if sess.server.Features.FXP {
+		return true
+	}
+	remote, ok := sess.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.Equal(remote.IP)
 }
 
 func newActiveSocket(sess *Session, remote string, port int) (DataSocket, error) {
 	connectTo := net.JoinHostPort(remote, strconv.Itoa(port))
 
-	sess.log("Opening active data connection to " + connectTo)
+	if !sess.allowDataHost(remote) {
+		sess.log(errFXPDisabled)
+		return nil, errFXPDisabled
+	}
+
+	sess.debugf("Opening active data connection to %s", connectTo)
 
 	raddr, err := net.ResolveTCPAddr("tcp", connectTo)
 
@@ -60,18 +84,32 @@ func newActiveSocket(sess *Session, remote string, port int) (DataSocket, error)
 		return nil, err
 	}
 
-	tcpConn, err := net.DialTCP("tcp", nil, raddr)
+	var laddr *net.TCPAddr
+	ip, err := sess.bindIP(sess.server.ActiveBindAddress)
+	if err != nil {
+		sess.log(err)
+		return nil, err
+	} else if ip != nil {
+		laddr = &net.TCPAddr{IP: ip}
+	}
+
+	tcpConn, err := net.DialTCP("tcp", laddr, raddr)
 
 	if err != nil {
 		sess.log(err)
 		return nil, err
 	}
+	if err := sess.server.Socket.tune(tcpConn); err != nil {
+		sess.log(err)
+		tcpConn.Close()
+		return nil, err
+	}
 
 	socket := new(activeSocket)
 	socket.sess = sess
 	socket.conn = tcpConn
-	socket.reader = ratelimit.Reader(tcpConn, sess.server.rateLimiter)
-	socket.writer = ratelimit.Writer(tcpConn, sess.server.rateLimiter)
+	socket.reader = ratelimit.Reader(tcpConn, sess.rateLimiter())
+	socket.writer = ratelimit.Writer(tcpConn, sess.rateLimiter())
 	socket.host = remote
 	socket.port = port
 
@@ -103,16 +141,17 @@ func (socket *activeSocket) Close() error {
 }
 
 type passiveSocket struct {
-	sess    *Session
-	conn    net.Conn
-	reader io.Reader
-	writer io.Writer
-	port    int
-	host    string
-	ingress chan []byte
-	egress  chan []byte
-	lock    sync.Mutex // protects conn and err
-	err     error
+	sess     *Session
+	conn     net.Conn
+	reader   io.Reader
+	writer   io.Writer
+	port     int
+	host     string
+	ingress  chan []byte
+	egress   chan []byte
+	lock     sync.Mutex // protects conn and err
+	err      error
+	listener net.Listener // closed by Close to stop waiting for the connection
 }
 
 // Detect if an error is "bind: address already in use"
@@ -142,24 +181,38 @@ func isErrorAddressAlreadyInUse(err error) bool {
 }
 
 func (sess *Session) newPassiveSocket() (DataSocket, error) {
+	socket, err := sess.listenPassive()
+	sess.dataConn = socket
+	return socket, err
+}
+
+// listenPassive returns a passive socket accepting a data connection
+func (sess *Session) listenPassive() (*passiveSocket, error) {
 	socket := new(passiveSocket)
 	socket.ingress = make(chan []byte)
 	socket.egress = make(chan []byte)
 	socket.sess = sess
 	socket.host = sess.passiveListenIP()
 
-	const retries = 10
-	var err error
-	for i := 1; i <= retries; i++ {
-		socket.port = sess.PassivePort()
+	// the ports of the range are tried in turn from a random one, so a
+	// free port is found even if the range is almost full
+	var (
+		err      error
+		port     = sess.PassivePort()
+		attempts = sess.passivePortCount()
+	)
+	if attempts == 0 {
+		attempts = 1
+	}
+	for i := 0; i < attempts; i++ {
+		socket.port = port
 		err = socket.ListenAndServe()
-		if err != nil && socket.port != 0 && isErrorAddressAlreadyInUse(err) {
-			// choose a different port on error already in use
+		if err != nil && port != 0 && isErrorAddressAlreadyInUse(err) {
+			port = sess.nextPassivePort(port)
 			continue
 		}
 		break
 	}
-	sess.dataConn = socket
 	return socket, err
 }
 
@@ -171,20 +224,24 @@ func (socket *passiveSocket) Port() int {
 	return socket.port
 }
 
-func (socket *passiveSocket) Read(p []byte) (n int, err error) {
+// accepted waits for the data connection, the lock isn't held during the
+// transfer so that the socket could be closed to abort it
+func (socket *passiveSocket) accepted() error {
 	socket.lock.Lock()
 	defer socket.lock.Unlock()
-	if socket.err != nil {
-		return 0, socket.err
+	return socket.err
+}
+
+func (socket *passiveSocket) Read(p []byte) (n int, err error) {
+	if err := socket.accepted(); err != nil {
+		return 0, err
 	}
 	return socket.reader.Read(p)
 }
 
 func (socket *passiveSocket) ReadFrom(r io.Reader) (int64, error) {
-	socket.lock.Lock()
-	defer socket.lock.Unlock()
-	if socket.err != nil {
-		return 0, socket.err
+	if err := socket.accepted(); err != nil {
+		return 0, err
 	}
 
 	// For normal TCPConn, this will use sendfile syscall; if not,
@@ -193,15 +250,16 @@ func (socket *passiveSocket) ReadFrom(r io.Reader) (int64, error) {
 }
 
 func (socket *passiveSocket) Write(p []byte) (n int, err error) {
-	socket.lock.Lock()
-	defer socket.lock.Unlock()
-	if socket.err != nil {
-		return 0, socket.err
+	if err := socket.accepted(); err != nil {
+		return 0, err
 	}
 	return socket.writer.Write(p)
 }
 
 func (socket *passiveSocket) Close() error {
+	if socket.listener != nil {
+		_ = socket.listener.Close()
+	}
 	socket.lock.Lock()
 	defer socket.lock.Unlock()
 	if socket.conn != nil {
@@ -211,14 +269,20 @@ func (socket *passiveSocket) Close() error {
 }
 
 func (socket *passiveSocket) ListenAndServe() (err error) {
-	laddr, err := net.ResolveTCPAddr("tcp", net.JoinHostPort("", strconv.Itoa(socket.port)))
+	var host string
+	if ip, err := socket.sess.bindIP(socket.sess.server.PassiveBindAddress); err != nil {
+		socket.sess.log(err)
+		return err
+	} else if ip != nil {
+		host = ip.String()
+	}
+	laddr, err := net.ResolveTCPAddr("tcp", net.JoinHostPort(host, strconv.Itoa(socket.port)))
 	if err != nil {
 		socket.sess.log(err)
 		return err
 	}
 
-	var tcplistener *net.TCPListener
-	tcplistener, err = net.ListenTCP("tcp", laddr)
+	tcplistener, err := socket.sess.server.listenTCP(laddr.String())
 	if err != nil {
 		socket.sess.log(err)
 		return err
@@ -247,6 +311,10 @@ func (socket *passiveSocket) ListenAndServe() (err error) {
 		listener = tls.NewListener(listener, socket.sess.server.tlsConfig)
 	}
 
+	socket.listener = listener
+	// resolved here as the login could change the limiter of the session
+	// while the connection is awaited
+	limiter := socket.sess.rateLimiter()
 	socket.lock.Lock()
 	go func() {
 		defer socket.lock.Unlock()
@@ -256,10 +324,18 @@ func (socket *passiveSocket) ListenAndServe() (err error) {
 			socket.err = err
 			return
 		}
+		host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+		if !socket.sess.allowDataHost(host) {
+			socket.sess.log(errFXPDisabled)
+			socket.err = errFXPDisabled
+			conn.Close()
+			_ = listener.Close()
+			return
+		}
 		socket.err = nil
 		socket.conn = conn
-		socket.reader = ratelimit.Reader(socket.conn, socket.sess.server.rateLimiter)
-		socket.writer = ratelimit.Writer(socket.conn, socket.sess.server.rateLimiter)
+		socket.reader = ratelimit.Reader(socket.conn, limiter)
+		socket.writer = ratelimit.Writer(socket.conn, limiter)
 		_ = listener.Close()
 	}()
 	return nil
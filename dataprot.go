@@ -0,0 +1,25 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+// requiresProtectedData reports whether the data connections of the session
+// must be protected by PROT P, for every user or for the login user
+func (sess *Session) requiresProtectedData() bool {
+	if sess.server.ForceProtectedData {
+		return true
+	}
+	return sess.userInfo != nil && sess.userInfo.ForceProtectedData
+}
+
+// checkDataProtection replies 521 and returns false if the data connection
+// could not be opened with the PROT level of the session
+func (sess *Session) checkDataProtection() bool {
+	if sess.protected || !sess.requiresProtectedData() {
+		return true
+	}
+	sess.warnf("Data connection refused without PROT P")
+	sess.writeMessage(521, "Data connection cannot be opened with this PROT setting, PROT P required")
+	return false
+}
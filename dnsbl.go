@@ -0,0 +1,128 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// DNSBL represents the DNS block lists the client IPs are checked against.
+// The lists are queried concurrently while the welcome message is sent and
+// the result is awaited before the first command is executed. Lookup errors
+// and timeouts are ignored so an unavailable list never blocks clients.
+type DNSBL struct {
+	// The zones of the lists, i.e. zen.spamhaus.org
+	Lists []string
+
+	// The maximum duration of the lookups, if 0 it's 2 seconds
+	Timeout time.Duration
+
+	// If true listed clients are only flagged, see Session.DNSBLListed,
+	// instead of being rejected
+	FlagOnly bool
+
+	// LookupHost resolves the list queries, if nil net.DefaultResolver is used
+	LookupHost func(ctx context.Context, host string) ([]string, error)
+}
+
+const defaultDNSBLTimeout = 2 * time.Second
+
+// dnsblQuery returns the name to query in the zone for the IP, the octets
+// of an IPv4 or the nibbles of an IPv6 in reverse order
+func dnsblQuery(ip net.IP, zone string) string {
+	var b strings.Builder
+	if ip4 := ip.To4(); ip4 != nil {
+		for i := len(ip4) - 1; i >= 0; i-- {
+			fmt.Fprintf(&b, "%d.", ip4[i])
+		}
+	} else {
+		ip16 := ip.To16()
+		for i := len(ip16) - 1; i >= 0; i-- {
+			fmt.Fprintf(&b, "%x.%x.", ip16[i]&0xf, ip16[i]>>4)
+		}
+	}
+	b.WriteString(strings.TrimSuffix(zone, "."))
+	return b.String()
+}
+
+// lookup returns the lists the IP is listed in
+func (bl *DNSBL) lookup(ip net.IP) []string {
+	timeout := bl.Timeout
+	if timeout <= 0 {
+		timeout = defaultDNSBLTimeout
+	}
+	lookupHost := bl.LookupHost
+	if lookupHost == nil {
+		lookupHost = net.DefaultResolver.LookupHost
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var results = make(chan string, len(bl.Lists))
+	for _, zone := range bl.Lists {
+		go func(zone string) {
+			addrs, err := lookupHost(ctx, dnsblQuery(ip, zone))
+			if err == nil && len(addrs) > 0 {
+				results <- zone
+			} else {
+				results <- ""
+			}
+		}(zone)
+	}
+
+	var listed []string
+	for range bl.Lists {
+		if zone := <-results; zone != "" {
+			listed = append(listed, zone)
+		}
+	}
+	return listed
+}
+
+// startDNSBL starts the lookup of the client IP in the background
+func (sess *Session) startDNSBL() {
+	bl := sess.server.DNSBL
+	if bl == nil || len(bl.Lists) == 0 {
+		return
+	}
+	ip := net.ParseIP(sess.remoteIP())
+	if ip == nil {
+		return
+	}
+	sess.dnsblResult = make(chan []string, 1)
+	go func() {
+		sess.dnsblResult <- bl.lookup(ip)
+	}()
+}
+
+// checkDNSBL waits for the lookup started by startDNSBL and reports whether
+// the client could go on
+func (sess *Session) checkDNSBL() bool {
+	if sess.dnsblResult == nil {
+		return true
+	}
+	listed := <-sess.dnsblResult
+	sess.dnsblResult = nil
+	if len(listed) == 0 {
+		return true
+	}
+	sess.dnsblListed = listed
+	if sess.server.DNSBL.FlagOnly {
+		sess.logf("Client is listed in %s", strings.Join(listed, ", "))
+		return true
+	}
+	sess.logf("Connection rejected, client is listed in %s", strings.Join(listed, ", "))
+	return false
+}
+
+// DNSBLListed returns the DNS block lists the client is listed in when
+// Options.DNSBL only flags the clients
+func (sess *Session) DNSBLListed() []string {
+	return sess.dnsblListed
+}
@@ -0,0 +1,35 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDNSBL(t *testing.T) {
+	assert.EqualValues(t, "4.3.2.1.bl.example.org", dnsblQuery(net.ParseIP("1.2.3.4"), "bl.example.org."))
+	assert.EqualValues(t, "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.bl.example.org",
+		dnsblQuery(net.ParseIP("2001:db8::1"), "bl.example.org"))
+
+	bl := &DNSBL{
+		Lists: []string{"listed.example.org", "clean.example.org", "broken.example.org"},
+		LookupHost: func(ctx context.Context, host string) ([]string, error) {
+			switch host {
+			case "4.3.2.1.listed.example.org":
+				return []string{"127.0.0.2"}, nil
+			case "4.3.2.1.broken.example.org":
+				return nil, errors.New("timeout")
+			}
+			return nil, &net.DNSError{Err: "no such host", Name: host}
+		},
+	}
+	assert.EqualValues(t, []string{"listed.example.org"}, bl.lookup(net.ParseIP("1.2.3.4")))
+	assert.Empty(t, bl.lookup(net.ParseIP("5.6.7.8")))
+}
@@ -5,16 +5,25 @@
 package server
 
 import (
+	"context"
 	"errors"
 	"io"
 	"os"
 	"strings"
+	"time"
 )
 
 // FileInfo represents an file interface
 type FileInfo interface {
 	os.FileInfo
+	OwnerInfo
+}
 
+// OwnerInfo is an optional interface the os.FileInfo returned by a Driver
+// could implement to report the real owner and group of a file, they are
+// used by the listings instead of the ones of Perm. An empty owner or group
+// falls back to Perm.
+type OwnerInfo interface {
 	Owner() string
 	Group() string
 }
@@ -63,7 +72,19 @@ type Driver interface {
 	PutFile(*Context, string, io.Reader, int64) (int64, error)
 }
 
-var _ Driver = &MultiDriver{}
+// ModTimeSetter is an optional interface a Driver could implement to allow
+// clients to change the modification time of files, i.e. via SITE UTIME.
+type ModTimeSetter interface {
+	// params  - path, the new modification time
+	// returns - nil if the time was changed or any error encountered
+	SetModTime(*Context, string, time.Time) error
+}
+
+var (
+	_ Driver                = &MultiDriver{}
+	_ ModTimeSetter         = &MultiDriver{}
+	_ BackendsHealthChecker = &MultiDriver{}
+)
 
 // MultiDriver represents a composite driver
 type MultiDriver struct {
@@ -77,6 +98,12 @@ func NewMultiDriver(drivers map[string]Driver) Driver {
 	}
 }
 
+// CheckBackends implements BackendsHealthChecker, the backends are named
+// after their prefixes
+func (driver *MultiDriver) CheckBackends(ctx context.Context) map[string]error {
+	return CheckBackends(ctx, driver.drivers)
+}
+
 // Stat implements Driver
 func (driver *MultiDriver) Stat(ctx *Context, path string) (os.FileInfo, error) {
 	for prefix, driver := range driver.drivers {
@@ -122,6 +149,9 @@ func (driver *MultiDriver) DeleteFile(ctx *Context, path string) error {
 func (driver *MultiDriver) Rename(ctx *Context, fromPath string, toPath string) error {
 	for prefix, driver := range driver.drivers {
 		if strings.HasPrefix(fromPath, prefix) {
+			if !strings.HasPrefix(toPath, prefix) {
+				return ErrRenameNotSupported
+			}
 			return driver.Rename(ctx, strings.TrimPrefix(fromPath, prefix), strings.TrimPrefix(toPath, prefix))
 		}
 	}
@@ -160,3 +190,18 @@ func (driver *MultiDriver) PutFile(ctx *Context, destPath string, data io.Reader
 
 	return 0, errors.New("Not a file")
 }
+
+// SetModTime implements ModTimeSetter
+func (driver *MultiDriver) SetModTime(ctx *Context, path string, mtime time.Time) error {
+	for prefix, driver := range driver.drivers {
+		if strings.HasPrefix(path, prefix) {
+			setter, ok := driver.(ModTimeSetter)
+			if !ok {
+				return errors.New("Not supported")
+			}
+			return setter.SetModTime(ctx, strings.TrimPrefix(path, prefix), mtime)
+		}
+	}
+
+	return errors.New("Not a file")
+}
@@ -0,0 +1,22 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package file
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// preallocate reserves the blocks of size bytes of the file after the
+// offset without changing its size, only the lack of space is an error as
+// the file systems may not support it
+func preallocate(f *os.File, offset, size int64) error {
+	err := unix.Fallocate(int(f.Fd()), unix.FALLOC_FL_KEEP_SIZE, offset, size)
+	if err == unix.ENOSPC {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package file
+
+import "os"
+
+func preallocate(f *os.File, offset, size int64) error {
+	return nil
+}
@@ -5,16 +5,30 @@
 package file
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"goftp.io/server/v2"
 )
 
+var (
+	_ server.Driver              = &Driver{}
+	_ server.ModTimeSetter       = &Driver{}
+	_ server.RangeGetter         = &Driver{}
+	_ server.HealthChecker       = &Driver{}
+	_ server.PrecompressedDriver = &Driver{}
+	_ server.StorageStats        = &Driver{}
+	_ server.Symlinker           = &Driver{}
+	_ server.DirRenamer          = &Driver{}
+)
+
 // Driver implements Driver directly read local file system
 type Driver struct {
 	RootPath string
@@ -30,9 +44,25 @@ func NewDriver(rootPath string) (server.Driver, error) {
 	return &Driver{rootPath}, nil
 }
 
+// CheckHealth implements server.HealthChecker, the root directory must be
+// accessible
+func (driver *Driver) CheckHealth(ctx context.Context) error {
+	info, err := os.Stat(driver.RootPath)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", driver.RootPath)
+	}
+	return nil
+}
+
+// realPath returns the path of the file below the root, the "/"-separated
+// pathname is cleaned as an absolute one first so that it never leads out
+// of the root, whatever the separator of the OS
 func (driver *Driver) realPath(path string) string {
-	paths := strings.Split(path, "/")
-	return filepath.Join(append([]string{driver.RootPath}, paths...)...)
+	clean := filepath.Clean(string(filepath.Separator) + filepath.FromSlash(path))
+	return filepath.Join(driver.RootPath, clean)
 }
 
 // Stat implements Driver
@@ -99,10 +129,92 @@ func (driver *Driver) Rename(ctx *server.Context, fromPath string, toPath string
 	return os.Rename(oldPath, newPath)
 }
 
-// MakeDir implements Driver
+// RenameDir implements DirRenamer
+func (driver *Driver) RenameDir(ctx *server.Context, fromPath string, toPath string) error {
+	return driver.Rename(ctx, fromPath, toPath)
+}
+
+// MakeDir implements Driver, the directory gets the mode of the context
+// whatever the umask of the process
 func (driver *Driver) MakeDir(ctx *server.Context, path string) error {
 	rPath := driver.realPath(path)
-	return os.MkdirAll(rPath, os.ModePerm)
+	mode := ctx.DirMode()
+	if mode == 0 {
+		return os.MkdirAll(rPath, os.ModePerm)
+	}
+	if err := os.MkdirAll(rPath, mode); err != nil {
+		return err
+	}
+	return os.Chmod(rPath, mode)
+}
+
+// resolvePath resolves the symbolic links of the real path, the last
+// element is kept if it doesn't exist. The resolved path must be below the
+// root.
+func (driver *Driver) resolvePath(rPath string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(rPath)
+	if os.IsNotExist(err) {
+		var dir string
+		if dir, err = filepath.EvalSymlinks(filepath.Dir(rPath)); err == nil {
+			resolved = filepath.Join(dir, filepath.Base(rPath))
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	root, err := filepath.EvalSymlinks(driver.RootPath)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errors.New("the path points out of the root")
+	}
+	return resolved, nil
+}
+
+// Symlink implements Symlinker, the link is relative so that it still
+// points into the root if the root is moved. It's relative to the resolved
+// directory of the link as the system resolves it through the links of its
+// parents.
+func (driver *Driver) Symlink(ctx *server.Context, target, link string) error {
+	rLink := driver.realPath(link)
+	dir, err := driver.resolvePath(filepath.Dir(rLink))
+	if err != nil {
+		return err
+	}
+	resolved, err := driver.resolvePath(driver.realPath(target))
+	if err != nil {
+		return err
+	}
+	rTarget, err := filepath.Rel(dir, resolved)
+	if err != nil {
+		return err
+	}
+	return os.Symlink(rTarget, filepath.Join(dir, filepath.Base(rLink)))
+}
+
+// Readlink implements Symlinker
+func (driver *Driver) Readlink(ctx *server.Context, link string) (string, error) {
+	rLink := driver.realPath(link)
+	rTarget, err := os.Readlink(rLink)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(rTarget) {
+		rTarget = filepath.Join(filepath.Dir(rLink), rTarget)
+	}
+	rel, err := filepath.Rel(driver.RootPath, rTarget)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s points out of the root", link)
+	}
+	return path.Join("/", filepath.ToSlash(rel)), nil
+}
+
+// SetModTime implements ModTimeSetter
+func (driver *Driver) SetModTime(ctx *server.Context, path string, mtime time.Time) error {
+	rPath := driver.realPath(path)
+	return os.Chtimes(rPath, mtime, mtime)
 }
 
 // GetFile implements Driver
@@ -131,6 +243,53 @@ func (driver *Driver) GetFile(ctx *server.Context, path string, offset int64) (i
 	return info.Size() - offset, f, nil
 }
 
+// limitedFile reads the first bytes of a file
+type limitedFile struct {
+	io.Reader
+	io.Closer
+}
+
+// GetFileRange implements RangeGetter
+func (driver *Driver) GetFileRange(ctx *server.Context, path string, offset, length int64) (int64, io.ReadCloser, error) {
+	size, f, err := driver.GetFile(ctx, path, offset)
+	if err != nil || length < 0 {
+		return size, f, err
+	}
+	if size > length {
+		size = length
+	}
+	return size, &limitedFile{Reader: io.LimitReader(f, length), Closer: f}, nil
+}
+
+// GetPrecompressedFile implements PrecompressedDriver, the compressed
+// variant of a file is the file with the .gz extension next to it
+func (driver *Driver) GetPrecompressedFile(ctx *server.Context, path string) (io.ReadCloser, error) {
+	rPath := driver.realPath(path)
+	info, err := os.Stat(rPath)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(rPath + ".gz")
+	if err != nil {
+		return nil, err
+	}
+	compressed, err := f.Stat()
+	if err == nil && (compressed.IsDir() || compressed.ModTime().Before(info.ModTime())) {
+		err = os.ErrNotExist
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// AvailableSpace implements StorageStats, it's the free space of the file
+// system of the root directory
+func (driver *Driver) AvailableSpace(ctx *server.Context, dir string) (int64, error) {
+	return freeSpace(driver.RootPath)
+}
+
 // PutFile implements Driver
 func (driver *Driver) PutFile(ctx *server.Context, destPath string, data io.Reader, offset int64) (int64, error) {
 	rPath := driver.realPath(destPath)
@@ -165,6 +324,18 @@ func (driver *Driver) PutFile(ctx *server.Context, destPath string, data io.Read
 			return 0, err
 		}
 		defer f.Close()
+		// the file gets the mode of the context whatever the umask of the
+		// process
+		if mode := ctx.FileMode(); mode != 0 {
+			if err := f.Chmod(mode); err != nil {
+				return 0, err
+			}
+		}
+		if size := ctx.AllocatedSize(); size > 0 {
+			if err := preallocate(f, 0, size); err != nil {
+				return 0, err
+			}
+		}
 		bytes, err := io.Copy(f, data)
 		if err != nil {
 			return 0, err
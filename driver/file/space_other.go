@@ -0,0 +1,14 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux && !darwin && !dragonfly && !freebsd
+// +build !linux,!darwin,!dragonfly,!freebsd
+
+package file
+
+import "errors"
+
+func freeSpace(p string) (int64, error) {
+	return 0, errors.New("the free space is not supported")
+}
@@ -0,0 +1,20 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin || dragonfly || freebsd
+// +build linux darwin dragonfly freebsd
+
+package file
+
+import "golang.org/x/sys/unix"
+
+// freeSpace returns the bytes available to the unprivileged users on the
+// file system of the path
+func freeSpace(p string) (int64, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(p, &stat); err != nil {
+		return 0, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
@@ -0,0 +1,174 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package minio
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	minio "github.com/minio/minio-go/v6"
+)
+
+const (
+	defaultHealthCheckInterval = 10 * time.Second
+
+	// checkTimeout is how long an endpoint is given to answer a check
+	checkTimeout = 5 * time.Second
+)
+
+// endpoint is a node of the object store
+type endpoint struct {
+	address string
+	client  *minio.Client
+	core    *minio.Core
+
+	lock     sync.Mutex
+	err      error     // why the endpoint is down, nil if it's up
+	checked  time.Time // when the endpoint went down or was last checked
+	checking bool
+}
+
+// isNodeFailure tells if the error is a failure of the endpoint rather than
+// an error of the request, i.e. the connection is refused
+func isNodeFailure(err error) bool {
+	uerr, ok := err.(*url.Error)
+	if !ok {
+		_, ok = err.(net.Error)
+		return ok
+	}
+	return uerr.Err != context.Canceled && uerr.Err != context.DeadlineExceeded
+}
+
+// observe marks the endpoint down if the error is a failure of the node
+func (ep *endpoint) observe(err error) {
+	if !isNodeFailure(err) {
+		return
+	}
+	ep.lock.Lock()
+	if ep.err == nil {
+		ep.checked = time.Now()
+	}
+	ep.err = err
+	ep.lock.Unlock()
+}
+
+// up tells if the endpoint is up, the endpoints which are down are checked
+// again in the background once the interval elapsed
+func (ep *endpoint) up(driver *Driver) bool {
+	ep.lock.Lock()
+	defer ep.lock.Unlock()
+	if ep.err == nil {
+		return true
+	}
+	if !ep.checking && time.Since(ep.checked) >= driver.checkInterval {
+		ep.checking = true
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+			defer cancel()
+			err := ep.check(ctx, driver.bucket)
+			ep.lock.Lock()
+			ep.err, ep.checked, ep.checking = err, time.Now(), false
+			ep.lock.Unlock()
+		}()
+	}
+	return false
+}
+
+// check returns an error if the bucket isn't reachable through the endpoint
+func (ep *endpoint) check(ctx context.Context, bucket string) error {
+	exists, err := ep.client.BucketExistsWithContext(ctx, bucket)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("bucket %s does not exist", bucket)
+	}
+	return nil
+}
+
+// primary returns the first endpoint which is up, the writes are sent to
+// it. If all the endpoints are down, the first one is returned.
+func (driver *Driver) primary() *endpoint {
+	for _, ep := range driver.endpoints {
+		if ep.up(driver) {
+			return ep
+		}
+	}
+	return driver.endpoints[0]
+}
+
+// replica returns the endpoint the reads are sent to, the endpoints which
+// are up take turns if Options.ReadFromReplica is set
+func (driver *Driver) replica() *endpoint {
+	if !driver.readFromReplica {
+		return driver.primary()
+	}
+	var up []*endpoint
+	for _, ep := range driver.endpoints {
+		if ep.up(driver) {
+			up = append(up, ep)
+		}
+	}
+	if len(up) == 0 {
+		return driver.endpoints[0]
+	}
+	return up[int(atomic.AddUint32(&driver.next, 1))%len(up)]
+}
+
+// withEndpoint calls fn with the endpoint of the request, it's called again
+// with the next endpoint which is up if the endpoint failed. fn must be
+// safe to be called again, the streaming requests don't fail over.
+func (driver *Driver) withEndpoint(read bool, fn func(ep *endpoint) error) error {
+	var (
+		err   error
+		tried = make(map[*endpoint]bool)
+	)
+	for {
+		var ep *endpoint
+		if read {
+			ep = driver.replica()
+		} else {
+			ep = driver.primary()
+		}
+		if tried[ep] {
+			return err
+		}
+		tried[ep] = true
+		if err = fn(ep); !isNodeFailure(err) {
+			return err
+		}
+		ep.observe(err)
+	}
+}
+
+// CheckHealth implements server.HealthChecker, the bucket must be reachable
+// through all the endpoints. The endpoints are marked up or down by the
+// check.
+func (driver *Driver) CheckHealth(ctx context.Context) error {
+	var errs []string
+	for _, ep := range driver.endpoints {
+		err := ep.check(ctx, driver.bucket)
+		ep.lock.Lock()
+		ep.err, ep.checked = err, time.Now()
+		ep.lock.Unlock()
+		if err == nil {
+			continue
+		}
+		if len(driver.endpoints) == 1 {
+			return err
+		}
+		errs = append(errs, fmt.Sprintf("endpoint %s: %v", ep.address, err))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -5,11 +5,18 @@
 package minio
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"strings"
 	"time"
 
@@ -18,41 +25,272 @@ import (
 )
 
 var (
-	_ server.Driver = &Driver{}
+	_ server.Driver        = &Driver{}
+	_ server.RangeGetter   = &Driver{}
+	_ server.HealthChecker = &Driver{}
 )
 
 // Driver implements Driver to store files in minio
 type Driver struct {
-	client *minio.Client
-	bucket string
+	// the first endpoint which is up is the primary
+	endpoints       []*endpoint
+	readFromReplica bool
+	checkInterval   time.Duration
+	next            uint32 // the replica of the next read
+
+	bucket   string
+	partSize int64
+	// the number of parts sent at once
+	partConcurrency int
+	// stat the objects after the uploads
+	verifyWrites bool
+	throttle     *throttleTransport
+	// the credentials of the requests minio-go doesn't implement
+	accessKeyID     string
+	secretAccessKey string
 }
 
-// NewDriver implements DriverFactory
+// Options represents the options of the minio driver
+type Options struct {
+	Endpoint string
+
+	// The other nodes of the object store, the requests are sent to the
+	// first endpoint which is up, starting with Endpoint. An endpoint is down
+	// once its connections fail, it's checked again after
+	// HealthCheckInterval, 10s if 0. As minio-go retries the failed requests
+	// before the driver fails over, MaxRetry should be low.
+	Endpoints           []string
+	HealthCheckInterval time.Duration
+
+	// Send the reads to all the endpoints which are up in turn rather than to
+	// the primary, the nodes must replicate the writes synchronously not to
+	// serve stale objects
+	ReadFromReplica bool
+
+	AccessKeyID     string
+	SecretAccessKey string
+	Location        string
+	Bucket          string
+	UseSSL          bool
+
+	// Transport, if not nil, is used for the requests instead of the one
+	// built from the options below
+	Transport http.RoundTripper
+
+	// The timeouts of the requests, the defaults are used if 0
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	IdleConnTimeout       time.Duration
+
+	// The maximum number of idle connections, the defaults are used if 0
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+
+	// The TLS configuration of the requests, i.e. to verify pinned
+	// certificates via VerifyPeerCertificate. RootCAs is a shortcut to only
+	// replace the trusted root certificates.
+	TLSConfig *tls.Config
+	RootCAs   *x509.CertPool
+
+	// Proxy returns the proxy of a request, if nil the proxy is read from
+	// the environment variables
+	Proxy func(*http.Request) (*url.URL, error)
+
+	// Logger, if not nil, receives the traced S3 calls
+	Logger server.Logger
+
+	// Log every S3 call at the debug level
+	TraceCalls bool
+
+	// Log the S3 calls taking longer at the warning level, 0 means no slow
+	// calls are logged
+	SlowCallThreshold time.Duration
+
+	// OnCall, if not nil, is called after every S3 call, i.e. to collect
+	// metrics
+	OnCall func(Call)
+
+	// The size of the parts of the multipart uploads, if 0 it's 16MiB. It
+	// can't be less than 5MiB, the minimum part size of S3.
+	PartSize int64
+
+	// The number of parts of a multipart upload sent at once, if 0 it's 1.
+	// The parts are buffered, so an upload uses up to PartSize times
+	// PartConcurrency bytes of memory.
+	PartConcurrency int
+
+	// The maximum number of retries of a failed request, 0 means the minio
+	// default. Note that minio-go only supports a process wide setting, so
+	// it applies to all the minio clients.
+	MaxRetry int
+
+	// Stat the objects after the uploads and fail the uploads whose object
+	// is missing or doesn't have the size of the data sent, so that the
+	// clients don't get a success for the writes lost by the backend
+	VerifyWrites bool
+
+	// The first and the maximum delays of the requests once the storage
+	// replies 503 SlowDown, the defaults are used if 0. The transfers of the
+	// server are paused for the delay too, so the clients are slowed down
+	// instead of the transfers failing.
+	ThrottleBackoff    time.Duration
+	MaxThrottleBackoff time.Duration
+}
+
+const (
+	defaultDialTimeout           = 10 * time.Second
+	defaultTLSHandshakeTimeout   = 10 * time.Second
+	defaultResponseHeaderTimeout = time.Minute
+	defaultIdleConnTimeout       = 90 * time.Second
+	defaultMaxIdleConns          = 100
+	defaultMaxIdleConnsPerHost   = 16
+)
+
+func durationOrDefault(d, def time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return def
+}
+
+func intOrDefault(v, def int) int {
+	if v > 0 {
+		return v
+	}
+	return def
+}
+
+// transport returns the http transport built from the options
+func (opts *Options) transport() http.RoundTripper {
+	if opts.Transport != nil {
+		return opts.Transport
+	}
+
+	var tlsConfig *tls.Config
+	if opts.TLSConfig != nil {
+		tlsConfig = opts.TLSConfig.Clone()
+	} else {
+		tlsConfig = &tls.Config{}
+	}
+	if opts.RootCAs != nil {
+		tlsConfig.RootCAs = opts.RootCAs
+	}
+
+	proxy := opts.Proxy
+	if proxy == nil {
+		proxy = http.ProxyFromEnvironment
+	}
+
+	return &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   durationOrDefault(opts.DialTimeout, defaultDialTimeout),
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   durationOrDefault(opts.TLSHandshakeTimeout, defaultTLSHandshakeTimeout),
+		ResponseHeaderTimeout: durationOrDefault(opts.ResponseHeaderTimeout, defaultResponseHeaderTimeout),
+		IdleConnTimeout:       durationOrDefault(opts.IdleConnTimeout, defaultIdleConnTimeout),
+		MaxIdleConns:          intOrDefault(opts.MaxIdleConns, defaultMaxIdleConns),
+		MaxIdleConnsPerHost:   intOrDefault(opts.MaxIdleConnsPerHost, defaultMaxIdleConnsPerHost),
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// NewDriver creates a minio driver storing the files in the bucket
 func NewDriver(endpoint, accessKeyID, secretAccessKey, location, bucket string, useSSL bool) (server.Driver, error) {
-	// Initialize minio client object.
-	minioClient, err := minio.New(endpoint, accessKeyID, secretAccessKey, useSSL)
-	if err != nil {
-		return nil, err
+	return NewDriverWithOptions(&Options{
+		Endpoint:        endpoint,
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+		Location:        location,
+		Bucket:          bucket,
+		UseSSL:          useSSL,
+	})
+}
+
+// NewDriverWithOptions creates a minio driver with the options
+func NewDriverWithOptions(opts *Options) (server.Driver, error) {
+	transport := opts.transport()
+	if opts.Logger != nil || opts.OnCall != nil {
+		transport = &traceTransport{
+			RoundTripper: transport,
+			bucket:       opts.Bucket,
+			opts:         opts,
+		}
+	}
+	throttle := &throttleTransport{
+		RoundTripper: transport,
+		min:          durationOrDefault(opts.ThrottleBackoff, defaultThrottleBackoff),
+		max:          durationOrDefault(opts.MaxThrottleBackoff, defaultMaxThrottleBackoff),
+	}
+	if opts.MaxRetry > 0 {
+		minio.MaxRetry = opts.MaxRetry
 	}
 
-	if err = minioClient.MakeBucket(bucket, location); err != nil {
-		// Check to see if we already own this bucket (which happens if you run this twice)
-		exists, errBucketExists := minioClient.BucketExists(bucket)
-		if !exists || errBucketExists != nil {
+	var endpoints []*endpoint
+	for _, address := range append([]string{opts.Endpoint}, opts.Endpoints...) {
+		// Initialize minio client object.
+		minioClient, err := minio.New(address, opts.AccessKeyID, opts.SecretAccessKey, opts.UseSSL)
+		if err != nil {
 			return nil, err
 		}
+		minioClient.SetCustomTransport(throttle)
+		endpoints = append(endpoints, &endpoint{
+			address: address,
+			client:  minioClient,
+			core:    &minio.Core{Client: minioClient},
+		})
 	}
 
-	return &Driver{
-		client: minioClient,
-		bucket: bucket,
-	}, nil
+	partSize := opts.PartSize
+	if partSize <= 0 {
+		partSize = defaultPartSize
+	} else if partSize < minPartSize {
+		partSize = minPartSize
+	}
+
+	driver := &Driver{
+		endpoints:       endpoints,
+		readFromReplica: opts.ReadFromReplica,
+		checkInterval:   durationOrDefault(opts.HealthCheckInterval, defaultHealthCheckInterval),
+		bucket:          opts.Bucket,
+		partSize:        partSize,
+		partConcurrency: intOrDefault(opts.PartConcurrency, 1),
+		verifyWrites:    opts.VerifyWrites,
+		throttle:        throttle,
+		accessKeyID:     opts.AccessKeyID,
+		secretAccessKey: opts.SecretAccessKey,
+	}
+	err := driver.withEndpoint(false, func(ep *endpoint) error {
+		err := ep.client.MakeBucket(driver.bucket, opts.Location)
+		if err != nil {
+			// Check to see if we already own this bucket (which happens if you run this twice)
+			exists, errBucketExists := ep.client.BucketExists(driver.bucket)
+			if isNodeFailure(errBucketExists) {
+				return errBucketExists
+			}
+			if exists && errBucketExists == nil {
+				return nil
+			}
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return driver, nil
 }
 
+// buildMinioPath returns the object key of the path, the "/"-separated
+// pathname is cleaned so that "/a//b/" and "/a/./b" are the key "a/b"
 func buildMinioPath(p string) string {
-	return strings.TrimPrefix(p, "/")
+	return strings.TrimPrefix(path.Clean("/"+p), "/")
 }
 
+// buildMinioDir returns the prefix of the objects in the directory, it
+// ends with "/" so that "/a" is not a prefix of "/ab"
 func buildMinioDir(p string) string {
 	v := buildMinioPath(p)
 	if !strings.HasSuffix(v, "/") {
@@ -61,6 +299,12 @@ func buildMinioDir(p string) string {
 	return v
 }
 
+// baseName returns the last element of the object key, without the "/" of
+// the directories
+func baseName(key string) string {
+	return path.Base("/" + key)
+}
+
 type minioFileInfo struct {
 	p     string
 	info  minio.ObjectInfo
@@ -94,10 +338,12 @@ func (m *minioFileInfo) Sys() interface{} {
 func (driver *Driver) isDir(path string) (bool, error) {
 	p := buildMinioDir(path)
 
-	info, err := driver.client.StatObject(driver.bucket, p, minio.StatObjectOptions{})
+	ep := driver.replica()
+	info, err := ep.client.StatObject(driver.bucket, p, minio.StatObjectOptions{})
 	if err != nil {
+		ep.observe(err)
 		doneCh := make(chan struct{})
-		objectCh := driver.client.ListObjects(driver.bucket, p, false, doneCh)
+		objectCh := ep.client.ListObjects(driver.bucket, p, false, doneCh)
 		for object := range objectCh {
 			if strings.HasPrefix(object.Key, p) {
 				close(doneCh)
@@ -122,13 +368,17 @@ func (driver *Driver) Stat(ctx *server.Context, path string) (os.FileInfo, error
 	}
 
 	p := buildMinioPath(path)
-	objInfo, err := driver.client.StatObject(driver.bucket, p, minio.StatObjectOptions{})
+	var objInfo minio.ObjectInfo
+	err := driver.withEndpoint(true, func(ep *endpoint) (err error) {
+		objInfo, err = ep.client.StatObject(driver.bucket, p, minio.StatObjectOptions{})
+		return err
+	})
 	if err != nil {
 		if isDir, err := driver.isDir(p); err != nil {
 			return nil, err
 		} else if isDir {
 			return &minioFileInfo{
-				p:     path,
+				p:     baseName(p),
 				isDir: true,
 			}, nil
 		}
@@ -136,7 +386,7 @@ func (driver *Driver) Stat(ctx *server.Context, path string) (os.FileInfo, error
 	}
 	isDir := strings.HasSuffix(objInfo.Key, "/")
 	return &minioFileInfo{
-		p:     p,
+		p:     baseName(p),
 		info:  objInfo,
 		isDir: isDir,
 	}, nil
@@ -151,9 +401,11 @@ func (driver *Driver) ListDir(ctx *server.Context, path string, callback func(os
 	if p == "/" {
 		p = ""
 	}
-	objectCh := driver.client.ListObjects(driver.bucket, p, false, doneCh)
+	ep := driver.replica()
+	objectCh := ep.client.ListObjects(driver.bucket, p, false, doneCh)
 	for object := range objectCh {
 		if object.Err != nil {
+			ep.observe(object.Err)
 			return object.Err
 		}
 
@@ -164,7 +416,7 @@ func (driver *Driver) ListDir(ctx *server.Context, path string, callback func(os
 
 		isDir := strings.HasSuffix(object.Key, "/")
 		info := minioFileInfo{
-			p:     strings.TrimPrefix(object.Key, p),
+			p:     baseName(object.Key),
 			info:  object,
 			isDir: isDir,
 		}
@@ -179,26 +431,33 @@ func (driver *Driver) ListDir(ctx *server.Context, path string, callback func(os
 
 // DeleteDir implements Driver
 func (driver *Driver) DeleteDir(ctx *server.Context, path string) error {
-	doneCh := make(chan struct{})
-	defer close(doneCh)
+	p := buildMinioDir(path)
+	if p == "/" {
+		p = ""
+	}
+	return driver.withEndpoint(false, func(ep *endpoint) error {
+		doneCh := make(chan struct{})
+		defer close(doneCh)
 
-	p := buildMinioPath(path)
-	objectCh := driver.client.ListObjects(driver.bucket, p, true, doneCh)
-	for object := range objectCh {
-		if object.Err != nil {
-			return object.Err
-		}
+		objectCh := ep.client.ListObjects(driver.bucket, p, true, doneCh)
+		for object := range objectCh {
+			if object.Err != nil {
+				return object.Err
+			}
 
-		if err := driver.client.RemoveObject(driver.bucket, object.Key); err != nil {
-			return err
+			if err := ep.client.RemoveObject(driver.bucket, object.Key); err != nil {
+				return err
+			}
 		}
-	}
-	return nil
+		return nil
+	})
 }
 
 // DeleteFile implements Driver
 func (driver *Driver) DeleteFile(ctx *server.Context, path string) error {
-	return driver.client.RemoveObject(driver.bucket, buildMinioPath(path))
+	return driver.withEndpoint(false, func(ep *endpoint) error {
+		return ep.client.RemoveObject(driver.bucket, buildMinioPath(path))
+	})
 }
 
 // Rename implements Driver
@@ -209,38 +468,63 @@ func (driver *Driver) Rename(ctx *server.Context, fromPath string, toPath string
 		return err
 	}
 
-	if err := driver.client.CopyObject(dst, src); err != nil {
-		return err
-	}
+	err = driver.withEndpoint(false, func(ep *endpoint) error {
+		if err := ep.client.CopyObject(dst, src); err != nil {
+			return err
+		}
 
-	return driver.client.RemoveObject(driver.bucket, buildMinioPath(fromPath))
+		return ep.client.RemoveObject(driver.bucket, buildMinioPath(fromPath))
+	})
+	if err != nil {
+		// the directories are prefixes which are moved by the server
+		if isDir, _ := driver.isDir(buildMinioPath(fromPath)); isDir {
+			return server.ErrRenameNotSupported
+		}
+	}
+	return err
 }
 
 // MakeDir implements Driver
 func (driver *Driver) MakeDir(ctx *server.Context, path string) error {
 	dirPath := buildMinioDir(path)
-	_, err := driver.client.PutObject(driver.bucket, dirPath, nil, 0, minio.PutObjectOptions{})
-	return err
+	return driver.withEndpoint(false, func(ep *endpoint) error {
+		_, err := ep.client.PutObject(driver.bucket, dirPath, nil, 0, minio.PutObjectOptions{})
+		return err
+	})
+}
+
+// ThrottleStats returns the state of the backoff on the throttled requests,
+// i.e. to collect metrics
+func (driver *Driver) ThrottleStats() ThrottleStats {
+	return driver.throttle.Stats()
 }
 
 // GetFile implements Driver
 func (driver *Driver) GetFile(ctx *server.Context, path string, offset int64) (int64, io.ReadCloser, error) {
-	var opts = minio.GetObjectOptions{}
-	object, err := driver.client.GetObject(driver.bucket, buildMinioPath(path), opts)
-	if err != nil {
-		return 0, nil, err
-	}
-	defer func() {
-		if err != nil && object != nil {
-			object.Close()
+	var (
+		object *minio.Object
+		info   minio.ObjectInfo
+	)
+	err := driver.withEndpoint(true, func(ep *endpoint) error {
+		var opts = minio.GetObjectOptions{}
+		var err error
+		object, err = ep.client.GetObjectWithContext(requestContext(ctx), driver.bucket, buildMinioPath(path), opts)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil && object != nil {
+				object.Close()
+			}
+		}()
+		_, err = object.Seek(offset, io.SeekStart)
+		if err != nil {
+			return err
 		}
-	}()
-	_, err = object.Seek(offset, io.SeekStart)
-	if err != nil {
-		return 0, nil, err
-	}
 
-	info, err := object.Stat()
+		info, err = object.Stat()
+		return err
+	})
 	if err != nil {
 		return 0, nil, err
 	}
@@ -248,41 +532,84 @@ func (driver *Driver) GetFile(ctx *server.Context, path string, offset int64) (i
 	return info.Size - offset, object, nil
 }
 
-// PutFile implements Driver
-func (driver *Driver) PutFile(ctx *server.Context, destPath string, data io.Reader, offset int64) (int64, error) {
-	p := buildMinioPath(destPath)
-	if offset == -1 {
-		return driver.client.PutObject(driver.bucket, p, data, -1, minio.PutObjectOptions{ContentType: "application/octet-stream"})
-	}
-
-	tempFile := p + ".tmp"
-	defer func() {
-		if err := driver.DeleteFile(ctx, tempFile); err != nil {
-			log.Println(err)
+// GetFileRange implements RangeGetter, only the range is requested
+func (driver *Driver) GetFileRange(ctx *server.Context, path string, offset, length int64) (int64, io.ReadCloser, error) {
+	var (
+		size   int64
+		object io.ReadCloser
+	)
+	err := driver.withEndpoint(true, func(ep *endpoint) error {
+		info, err := ep.client.StatObject(driver.bucket, buildMinioPath(path), minio.StatObjectOptions{})
+		if err != nil {
+			return err
+		}
+		if offset > info.Size {
+			return fmt.Errorf("Offset %d is beyond file size %d", offset, info.Size)
+		}
+		size = info.Size - offset
+		if length >= 0 && length < size {
+			size = length
+		}
+		if size == 0 {
+			object = ioutil.NopCloser(strings.NewReader(""))
+			return nil
 		}
-	}()
 
-	info, err := driver.client.StatObject(driver.bucket, p, minio.StatObjectOptions{})
+		var opts = minio.GetObjectOptions{}
+		if err := opts.SetRange(offset, offset+size-1); err != nil {
+			return err
+		}
+		object, err = ep.client.GetObjectWithContext(requestContext(ctx), driver.bucket, buildMinioPath(path), opts)
+		return err
+	})
 	if err != nil {
-		return 0, err
-	}
-	if offset != info.Size {
-		return 0, fmt.Errorf("It's unsupported that offset %d is not equal to %d", offset, info.Size)
+		return 0, nil, err
 	}
+	return size, object, nil
+}
 
-	size, err := driver.client.PutObject(driver.bucket, tempFile, data, -1, minio.PutObjectOptions{ContentType: "application/octet-stream"})
-	if err != nil {
-		return size, err
+// PutFile implements Driver. The data is streamed into a multipart upload,
+// a file is appended to, if offset is its size, by keeping its content as
+// the first parts of the upload. The upload is cancelled with the context.
+// The upload doesn't fail over as the data can't be sent again, the next
+// ones are sent to the next endpoint.
+func (driver *Driver) PutFile(ctx *server.Context, destPath string, data io.Reader, offset int64) (int64, error) {
+	p := buildMinioPath(destPath)
+	ep := driver.primary()
+	var prefix int64
+	if offset != -1 {
+		info, err := ep.client.StatObject(driver.bucket, p, minio.StatObjectOptions{})
+		if err != nil {
+			if minio.ToErrorResponse(err).Code != "NoSuchKey" || offset != 0 {
+				ep.observe(err)
+				return 0, err
+			}
+		} else if offset != info.Size {
+			return 0, fmt.Errorf("It's unsupported that offset %d is not equal to %d", offset, info.Size)
+		} else {
+			prefix = info.Size
+		}
 	}
 
-	var srcs = []minio.SourceInfo{
-		minio.NewSourceInfo(driver.bucket, tempFile, nil),
-		minio.NewSourceInfo(driver.bucket, p, nil),
+	size, err := driver.upload(requestContext(ctx), ep, p, data, prefix)
+	if err != nil || !driver.verifyWrites {
+		ep.observe(err)
+		return size, err
 	}
-	dst, err := minio.NewDestinationInfo(driver.bucket, p, nil, nil)
-	if err != nil {
+	if err := driver.verifyUpload(ctx.Context(), ep, p, prefix+size); err != nil {
 		return 0, err
 	}
+	return size, nil
+}
 
-	return size, driver.client.ComposeObject(dst, srcs)
+// verifyUpload checks that the object p has the size of the data uploaded
+func (driver *Driver) verifyUpload(ctx context.Context, ep *endpoint, p string, size int64) error {
+	info, err := ep.client.StatObjectWithContext(ctx, driver.bucket, p, minio.StatObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("verifying the upload failed: %v", err)
+	}
+	if info.Size != size {
+		return fmt.Errorf("verifying the upload failed: the object has %d bytes instead of %d", info.Size, size)
+	}
+	return nil
 }
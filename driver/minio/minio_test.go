@@ -0,0 +1,546 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package minio
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	minio "github.com/minio/minio-go/v6"
+	"goftp.io/server/v2"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestDriver(t *testing.T) (*Driver, func()) {
+	s3 := httptest.NewServer(newS3Mock())
+	driver, err := NewDriverWithOptions(&Options{
+		Endpoint:        strings.TrimPrefix(s3.URL, "http://"),
+		AccessKeyID:     "access",
+		SecretAccessKey: "secret",
+		Bucket:          "bucket",
+	})
+	if !assert.NoError(t, err) {
+		s3.Close()
+		t.FailNow()
+	}
+	return driver.(*Driver), s3.Close
+}
+
+func listNames(t *testing.T, driver *Driver, path string) []string {
+	var names []string
+	err := driver.ListDir(&server.Context{}, path, func(info os.FileInfo) error {
+		name := info.Name()
+		if info.IsDir() {
+			name += "|dir"
+		}
+		names = append(names, name)
+		return nil
+	})
+	assert.NoError(t, err)
+	sort.Strings(names)
+	return names
+}
+
+func readFile(t *testing.T, driver *Driver, path string, offset int64) (int64, string) {
+	size, r, err := driver.GetFile(&server.Context{}, path, offset)
+	if !assert.NoError(t, err) {
+		return 0, ""
+	}
+	defer r.Close()
+	buf, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	return size, string(buf)
+}
+
+func TestDriverFiles(t *testing.T) {
+	driver, closer := newTestDriver(t)
+	defer closer()
+	ctx := &server.Context{}
+
+	size, err := driver.PutFile(ctx, "/a.txt", strings.NewReader("0123456789"), -1)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 10, size)
+
+	info, err := driver.Stat(ctx, "/a.txt")
+	assert.NoError(t, err)
+	assert.False(t, info.IsDir())
+	assert.EqualValues(t, 10, info.Size())
+
+	size, content := readFile(t, driver, "/a.txt", 0)
+	assert.EqualValues(t, 10, size)
+	assert.EqualValues(t, "0123456789", content)
+
+	size, content = readFile(t, driver, "/a.txt", 4)
+	assert.EqualValues(t, 6, size)
+	assert.EqualValues(t, "456789", content)
+
+	assert.NoError(t, driver.Rename(ctx, "/a.txt", "/b.txt"))
+	_, err = driver.Stat(ctx, "/a.txt")
+	assert.Error(t, err)
+	_, content = readFile(t, driver, "/b.txt", 0)
+	assert.EqualValues(t, "0123456789", content)
+
+	assert.NoError(t, driver.DeleteFile(ctx, "/b.txt"))
+	_, err = driver.Stat(ctx, "/b.txt")
+	assert.Error(t, err)
+
+	_, _, err = driver.GetFile(ctx, "/missing.txt", 0)
+	assert.Error(t, err)
+}
+
+func TestDriverDirs(t *testing.T) {
+	driver, closer := newTestDriver(t)
+	defer closer()
+	ctx := &server.Context{}
+
+	info, err := driver.Stat(ctx, "/")
+	assert.NoError(t, err)
+	assert.True(t, info.IsDir())
+
+	assert.NoError(t, driver.MakeDir(ctx, "/src"))
+	info, err = driver.Stat(ctx, "/src")
+	assert.NoError(t, err)
+	assert.True(t, info.IsDir())
+
+	_, err = driver.PutFile(ctx, "/src/a.txt", strings.NewReader("a"), -1)
+	assert.NoError(t, err)
+	_, err = driver.PutFile(ctx, "/src/sub/b.txt", strings.NewReader("b"), -1)
+	assert.NoError(t, err)
+	_, err = driver.PutFile(ctx, "/c.txt", strings.NewReader("c"), -1)
+	assert.NoError(t, err)
+	_, err = driver.PutFile(ctx, "/srcs/d.txt", strings.NewReader("d"), -1)
+	assert.NoError(t, err)
+
+	// directories without a marker object exist as soon as they have content
+	info, err = driver.Stat(ctx, "/src/sub")
+	assert.NoError(t, err)
+	assert.True(t, info.IsDir())
+	assert.EqualValues(t, "sub", info.Name())
+
+	info, err = driver.Stat(ctx, "/src//./a.txt")
+	assert.NoError(t, err)
+	assert.EqualValues(t, "a.txt", info.Name())
+
+	// the names never contain "/"
+	assert.EqualValues(t, []string{"c.txt", "srcs|dir", "src|dir"}, listNames(t, driver, "/"))
+	assert.EqualValues(t, []string{"a.txt", "sub|dir"}, listNames(t, driver, "/src"))
+	assert.EqualValues(t, []string{"b.txt"}, listNames(t, driver, "/src/sub/"))
+
+	// the directories sharing the prefix are kept
+	assert.NoError(t, driver.DeleteDir(ctx, "/src"))
+	assert.EqualValues(t, []string{"c.txt", "srcs|dir"}, listNames(t, driver, "/"))
+	_, err = driver.Stat(ctx, "/src/sub")
+	assert.Error(t, err)
+}
+
+func TestDriverAppend(t *testing.T) {
+	driver, closer := newTestDriver(t)
+	defer closer()
+	ctx := &server.Context{}
+
+	size, err := driver.PutFile(ctx, "/a.txt", strings.NewReader("01234"), 0)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 5, size)
+
+	size, err = driver.PutFile(ctx, "/a.txt", strings.NewReader("56789"), 5)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 5, size)
+	_, content := readFile(t, driver, "/a.txt", 0)
+	assert.EqualValues(t, "0123456789", content)
+
+	_, err = driver.PutFile(ctx, "/a.txt", strings.NewReader("0"), 3)
+	assert.Error(t, err)
+
+	// large enough to be copied as a part
+	var large = strings.Repeat("0", minPartSize)
+	_, err = driver.PutFile(ctx, "/b.txt", strings.NewReader(large), -1)
+	assert.NoError(t, err)
+	size, err = driver.PutFile(ctx, "/b.txt", strings.NewReader("12"), minPartSize)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, size)
+	size, content = readFile(t, driver, "/b.txt", minPartSize-1)
+	assert.EqualValues(t, 3, size)
+	assert.EqualValues(t, "012", content)
+	assert.EqualValues(t, []string{"a.txt", "b.txt"}, listNames(t, driver, "/"))
+}
+
+func TestDriverMultipart(t *testing.T) {
+	driver, closer := newTestDriver(t)
+	defer closer()
+	ctx := &server.Context{}
+	driver.partSize = minPartSize
+	driver.partConcurrency = 2
+
+	// streamed in three parts, two at once
+	var content = strings.Repeat("0", 2*minPartSize) + "123"
+	size, err := driver.PutFile(ctx, "/a.txt", strings.NewReader(content), -1)
+	assert.NoError(t, err)
+	assert.EqualValues(t, len(content), size)
+	info, err := driver.Stat(ctx, "/a.txt")
+	assert.NoError(t, err)
+	assert.EqualValues(t, len(content), info.Size())
+
+	// the existing content is copied as a part
+	size, err = driver.PutFile(ctx, "/a.txt", strings.NewReader("45"), int64(len(content)))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, size)
+	size, tail := readFile(t, driver, "/a.txt", 2*minPartSize-1)
+	assert.EqualValues(t, 6, size)
+	assert.EqualValues(t, "012345", tail)
+	assert.EqualValues(t, []string{"a.txt"}, listNames(t, driver, "/"))
+}
+
+func TestDriverFileRange(t *testing.T) {
+	driver, closer := newTestDriver(t)
+	defer closer()
+	ctx := &server.Context{}
+
+	_, err := driver.PutFile(ctx, "/a.txt", strings.NewReader("0123456789"), -1)
+	assert.NoError(t, err)
+
+	var cases = []struct {
+		Offset, Length int64
+		Content        string
+	}{
+		{2, 3, "234"},
+		{2, -1, "23456789"},
+		{8, 5, "89"},
+		{10, 1, ""},
+	}
+	for _, c := range cases {
+		size, r, err := driver.GetFileRange(ctx, "/a.txt", c.Offset, c.Length)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		buf, err := ioutil.ReadAll(r)
+		assert.NoError(t, err)
+		assert.NoError(t, r.Close())
+		assert.EqualValues(t, len(c.Content), size)
+		assert.EqualValues(t, c.Content, string(buf))
+	}
+
+	_, _, err = driver.GetFileRange(ctx, "/a.txt", 11, 1)
+	assert.Error(t, err)
+}
+
+func TestDriverHealth(t *testing.T) {
+	driver, closer := newTestDriver(t)
+	assert.NoError(t, driver.CheckHealth(context.Background()))
+
+	driver.bucket = "missing"
+	assert.EqualError(t, driver.CheckHealth(context.Background()), "bucket missing does not exist")
+
+	closer()
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	assert.Error(t, driver.CheckHealth(ctx))
+}
+
+func TestDriverVerifyWrites(t *testing.T) {
+	mock := newS3Mock()
+	s3 := httptest.NewServer(mock)
+	defer s3.Close()
+	d, err := NewDriverWithOptions(&Options{
+		Endpoint:        strings.TrimPrefix(s3.URL, "http://"),
+		AccessKeyID:     "access",
+		SecretAccessKey: "secret",
+		Bucket:          "bucket",
+		VerifyWrites:    true,
+	})
+	assert.NoError(t, err)
+	driver := d.(*Driver)
+
+	size, err := driver.PutFile(&server.Context{}, "/a.txt", strings.NewReader("hello"), -1)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 5, size)
+	size, err = driver.PutFile(&server.Context{}, "/a.txt", strings.NewReader(" world"), 5)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 6, size)
+
+	// the backend silently truncates the objects
+	mock.lock.Lock()
+	mock.truncate = 1
+	mock.lock.Unlock()
+	_, err = driver.PutFile(&server.Context{}, "/b.txt", strings.NewReader("hello"), -1)
+	assert.EqualError(t, err, "verifying the upload failed: the object has 4 bytes instead of 5")
+
+	// the uploads are not verified by default
+	driver.verifyWrites = false
+	_, err = driver.PutFile(&server.Context{}, "/c.txt", strings.NewReader("hello"), -1)
+	assert.NoError(t, err)
+}
+
+func TestDriverThrottle(t *testing.T) {
+	mock := newS3Mock()
+	s3 := httptest.NewServer(mock)
+	defer s3.Close()
+	var (
+		lock      sync.Mutex
+		throttled []string
+	)
+	d, err := NewDriverWithOptions(&Options{
+		Endpoint:        strings.TrimPrefix(s3.URL, "http://"),
+		AccessKeyID:     "access",
+		SecretAccessKey: "secret",
+		Bucket:          "bucket",
+		ThrottleBackoff: 10 * time.Millisecond,
+		OnCall: func(call Call) {
+			if call.Throttled {
+				lock.Lock()
+				throttled = append(throttled, call.Operation)
+				lock.Unlock()
+			}
+		},
+	})
+	assert.NoError(t, err)
+	driver := d.(*Driver)
+
+	// the upload is retried rather than failing
+	mock.lock.Lock()
+	mock.slowDown = 2
+	mock.lock.Unlock()
+	size, err := driver.PutFile(&server.Context{}, "/a.txt", strings.NewReader("hello"), -1)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 5, size)
+
+	stats := driver.ThrottleStats()
+	assert.EqualValues(t, 2, stats.Events)
+	// doubled by the second throttled request and halved by the successful
+	// one
+	assert.EqualValues(t, 10*time.Millisecond, stats.Backoff)
+	lock.Lock()
+	assert.EqualValues(t, []string{"PutObject", "PutObject"}, throttled)
+	lock.Unlock()
+
+	// the backoff decreases once the storage isn't throttling
+	_, content := readFile(t, driver, "/a.txt", 0)
+	assert.EqualValues(t, "hello", content)
+	assert.EqualValues(t, 0, driver.ThrottleStats().Backoff)
+}
+
+func TestDriverFailover(t *testing.T) {
+	defer func(n int) { minio.MaxRetry = n }(minio.MaxRetry)
+
+	// the nodes of the object store share their objects
+	mock := newS3Mock()
+	var requests [2]int32
+	var nodes [2]*httptest.Server
+	for i := range nodes {
+		i := i
+		nodes[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests[i], 1)
+			mock.ServeHTTP(w, r)
+		}))
+		defer nodes[i].Close()
+	}
+	d, err := NewDriverWithOptions(&Options{
+		Endpoint:        strings.TrimPrefix(nodes[0].URL, "http://"),
+		Endpoints:       []string{strings.TrimPrefix(nodes[1].URL, "http://")},
+		AccessKeyID:     "access",
+		SecretAccessKey: "secret",
+		Bucket:          "bucket",
+		ReadFromReplica: true,
+		MaxRetry:        1,
+	})
+	assert.NoError(t, err)
+	driver := d.(*Driver)
+
+	// the writes are sent to the primary, the reads to both nodes
+	_, err = driver.PutFile(&server.Context{}, "/a.txt", strings.NewReader("hello"), -1)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, atomic.LoadInt32(&requests[1]))
+	for i := 0; i < 2; i++ {
+		_, content := readFile(t, driver, "/a.txt", 0)
+		assert.EqualValues(t, "hello", content)
+	}
+	assert.True(t, atomic.LoadInt32(&requests[1]) > 0)
+
+	// the primary is down
+	nodes[0].Close()
+	info, err := driver.Stat(&server.Context{}, "/a.txt")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 5, info.Size())
+	assert.Error(t, driver.CheckHealth(context.Background()))
+
+	_, err = driver.PutFile(&server.Context{}, "/b.txt", strings.NewReader("world"), -1)
+	assert.NoError(t, err)
+	_, content := readFile(t, driver, "/b.txt", 0)
+	assert.EqualValues(t, "world", content)
+	assert.NoError(t, driver.DeleteFile(&server.Context{}, "/a.txt"))
+	assert.EqualValues(t, []string{"b.txt"}, listNames(t, driver, "/"))
+}
+
+func TestDriverVersions(t *testing.T) {
+	mock := newS3Mock()
+	s3 := httptest.NewServer(mock)
+	defer s3.Close()
+	d, err := NewDriverWithOptions(&Options{
+		Endpoint:        strings.TrimPrefix(s3.URL, "http://"),
+		AccessKeyID:     "access",
+		SecretAccessKey: "secret",
+		Bucket:          "bucket",
+	})
+	assert.NoError(t, err)
+	driver := d.(*Driver)
+	ctx := &server.Context{}
+
+	_, err = driver.PutFile(ctx, "/a.txt", strings.NewReader("v1"), -1)
+	assert.NoError(t, err)
+	_, err = driver.Versions(ctx, "/a.txt")
+	assert.Equal(t, errVersioningDisabled, err)
+
+	mock.lock.Lock()
+	mock.versioned["bucket"] = true
+	mock.lock.Unlock()
+	for _, content := range []string{"v2", "v3"} {
+		_, err = driver.PutFile(ctx, "/a.txt", strings.NewReader(content), -1)
+		assert.NoError(t, err)
+	}
+	// the key of another object starting with the same name
+	_, err = driver.PutFile(ctx, "/a.txt.bak", strings.NewReader("bak"), -1)
+	assert.NoError(t, err)
+
+	versions, err := driver.Versions(ctx, "/a.txt")
+	assert.NoError(t, err)
+	if assert.Len(t, versions, 2) {
+		// the object stored before the versioning has no version id
+		assert.EqualValues(t, 2, versions[0].Size)
+		assert.Empty(t, versions[1].ID)
+
+		assert.NoError(t, driver.RestoreVersion(ctx, "/a.txt", versions[0].ID))
+		_, content := readFile(t, driver, "/a.txt", 0)
+		assert.EqualValues(t, "v2", content)
+	}
+	assert.Equal(t, errNoSuchVersion, driver.RestoreVersion(ctx, "/a.txt", "unknown"))
+
+	// the restored object became a version
+	versions, err = driver.Versions(ctx, "/a.txt")
+	assert.NoError(t, err)
+	assert.Len(t, versions, 3)
+}
+
+// countTransport counts the requests sent through it
+type countTransport struct {
+	http.RoundTripper
+	requests int32
+}
+
+func (t *countTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.requests, 1)
+	return t.RoundTripper.RoundTrip(req)
+}
+
+func TestDriverTransport(t *testing.T) {
+	s3 := httptest.NewServer(newS3Mock())
+	defer s3.Close()
+
+	// the options of the default transport
+	transport := (&Options{
+		ResponseHeaderTimeout: time.Second,
+		MaxIdleConnsPerHost:   2,
+	}).transport().(*http.Transport)
+	assert.EqualValues(t, time.Second, transport.ResponseHeaderTimeout)
+	assert.EqualValues(t, defaultTLSHandshakeTimeout, transport.TLSHandshakeTimeout)
+	assert.EqualValues(t, defaultIdleConnTimeout, transport.IdleConnTimeout)
+	assert.EqualValues(t, defaultMaxIdleConns, transport.MaxIdleConns)
+	assert.EqualValues(t, 2, transport.MaxIdleConnsPerHost)
+
+	// the requests are sent through the custom transport
+	custom := &countTransport{RoundTripper: http.DefaultTransport}
+	d, err := NewDriverWithOptions(&Options{
+		Endpoint:        strings.TrimPrefix(s3.URL, "http://"),
+		AccessKeyID:     "access",
+		SecretAccessKey: "secret",
+		Bucket:          "bucket",
+		Transport:       custom,
+	})
+	assert.NoError(t, err)
+	driver := d.(*Driver)
+
+	_, err = driver.PutFile(&server.Context{}, "/a.txt", strings.NewReader("hello"), -1)
+	assert.NoError(t, err)
+	_, content := readFile(t, driver, "/a.txt", 0)
+	assert.EqualValues(t, "hello", content)
+	assert.True(t, atomic.LoadInt32(&custom.requests) >= 2)
+}
+
+func TestDriverTimeout(t *testing.T) {
+	defer func(n int) { minio.MaxRetry = n }(minio.MaxRetry)
+
+	// the responses of the slow object come too late, but the upload one
+	mock := newS3Mock()
+	release := make(chan struct{})
+	s3 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/slow.txt") && r.Method != http.MethodPut {
+			select {
+			case <-release:
+			case <-time.After(5 * time.Second):
+			}
+		}
+		mock.ServeHTTP(w, r)
+	}))
+	defer s3.Close()
+	defer close(release)
+	d, err := NewDriverWithOptions(&Options{
+		Endpoint:              strings.TrimPrefix(s3.URL, "http://"),
+		AccessKeyID:           "access",
+		SecretAccessKey:       "secret",
+		Bucket:                "bucket",
+		ResponseHeaderTimeout: 50 * time.Millisecond,
+		MaxRetry:              1,
+	})
+	assert.NoError(t, err)
+	driver := d.(*Driver)
+
+	_, err = driver.PutFile(&server.Context{}, "/slow.txt", strings.NewReader("hello"), -1)
+	assert.NoError(t, err)
+
+	// minio-go waits for its retry backoff even after the last attempt
+	start := time.Now()
+	_, err = driver.Stat(&server.Context{}, "/slow.txt")
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < 3*time.Second, time.Since(start))
+}
+
+func TestDriverMaxRetry(t *testing.T) {
+	defer func(n int) { minio.MaxRetry = n }(minio.MaxRetry)
+
+	// the requests of the object always fail
+	mock := newS3Mock()
+	var requests int32
+	s3 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/a.txt") {
+			atomic.AddInt32(&requests, 1)
+			writeS3Error(w, r, http.StatusInternalServerError, "InternalError", "bucket", "a.txt")
+			return
+		}
+		mock.ServeHTTP(w, r)
+	}))
+	defer s3.Close()
+	d, err := NewDriverWithOptions(&Options{
+		Endpoint:        strings.TrimPrefix(s3.URL, "http://"),
+		AccessKeyID:     "access",
+		SecretAccessKey: "secret",
+		Bucket:          "bucket",
+		MaxRetry:        2,
+	})
+	assert.NoError(t, err)
+	driver := d.(*Driver)
+	assert.EqualValues(t, 2, minio.MaxRetry)
+
+	_, err = driver.Stat(&server.Context{}, "/a.txt")
+	assert.Error(t, err)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&requests))
+}
@@ -0,0 +1,159 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package minio
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"sort"
+	"sync"
+
+	minio "github.com/minio/minio-go/v6"
+)
+
+const (
+	// minPartSize is the minimum size of the parts of a multipart upload
+	// but the last one
+	minPartSize = 5 * 1024 * 1024
+
+	// maxCopyPartSize is the maximum size of a part copied from an object
+	maxCopyPartSize = 5 * 1024 * 1024 * 1024
+
+	defaultPartSize = 16 * 1024 * 1024
+
+	contentType = "application/octet-stream"
+)
+
+// upload streams the data into the object p through the endpoint, keeping the first prefix bytes
+// of the existing object. The data is sent in a single request if it fits in
+// one part, otherwise in a multipart upload, the kept bytes are copied on
+// the server side when they are large enough to be a part. It returns the
+// number of bytes of the data written.
+func (driver *Driver) upload(ctx context.Context, ep *endpoint, p string, data io.Reader, prefix int64) (int64, error) {
+	var kept int64
+	if prefix > 0 && prefix < minPartSize {
+		// too small to be copied as a part, so it's sent again
+		object, err := ep.client.GetObjectWithContext(ctx, driver.bucket, p, minio.GetObjectOptions{})
+		if err != nil {
+			return 0, err
+		}
+		defer object.Close()
+		data = io.MultiReader(io.LimitReader(object, prefix), data)
+		kept, prefix = prefix, 0
+	}
+
+	var buf = make([]byte, driver.partSize)
+	n, err := io.ReadFull(data, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return 0, err
+	}
+	if prefix == 0 && err != nil {
+		_, err := ep.client.PutObjectWithContext(ctx, driver.bucket, p, bytes.NewReader(buf[:n]), int64(n),
+			minio.PutObjectOptions{ContentType: contentType})
+		if err != nil {
+			return 0, err
+		}
+		return int64(n) - kept, nil
+	}
+
+	uploadID, err := ep.core.NewMultipartUpload(driver.bucket, p, minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return 0, err
+	}
+	size, err := driver.uploadParts(ctx, ep, p, uploadID, data, prefix, buf, n)
+	if err != nil {
+		// the upload is aborted even if the context is cancelled
+		if err := ep.core.AbortMultipartUpload(driver.bucket, p, uploadID); err != nil {
+			log.Println(err)
+		}
+		return 0, err
+	}
+	return size - kept, nil
+}
+
+// uploadParts uploads the parts of the multipart upload, buf holds the n
+// bytes of the data already read
+func (driver *Driver) uploadParts(ctx context.Context, ep *endpoint, p, uploadID string, data io.Reader, prefix int64, buf []byte, n int) (int64, error) {
+	var parts []minio.CompletePart
+
+	if prefix > 0 {
+		count := (prefix + maxCopyPartSize - 1) / maxCopyPartSize
+		length := (prefix + count - 1) / count
+		for start := int64(0); start < prefix; start += length {
+			if start+length > prefix {
+				length = prefix - start
+			}
+			part, err := ep.core.CopyObjectPartWithContext(ctx, driver.bucket, p, driver.bucket, p, uploadID,
+				len(parts)+1, start, length, nil)
+			if err != nil {
+				return 0, err
+			}
+			parts = append(parts, part)
+		}
+	}
+
+	var (
+		size      int64
+		partID    = len(parts)
+		buffers   = make(chan []byte, driver.partConcurrency)
+		allocated = 1
+		wg        sync.WaitGroup
+		lock      sync.Mutex
+		uploadErr error
+		uploaded  []minio.CompletePart
+	)
+	for n > 0 {
+		partID++
+		wg.Add(1)
+		go func(partID int, buf []byte) {
+			defer wg.Done()
+			part, err := ep.core.PutObjectPartWithContext(ctx, driver.bucket, p, uploadID, partID,
+				bytes.NewReader(buf), int64(len(buf)), "", "", nil)
+			lock.Lock()
+			if err != nil && uploadErr == nil {
+				uploadErr = err
+			}
+			uploaded = append(uploaded, minio.CompletePart{PartNumber: part.PartNumber, ETag: part.ETag})
+			lock.Unlock()
+			buffers <- buf[:cap(buf)]
+		}(partID, buf[:n])
+		size += int64(n)
+
+		// the next part is read while the previous ones are uploaded
+		if allocated < driver.partConcurrency {
+			buf = make([]byte, driver.partSize)
+			allocated++
+		} else {
+			buf = <-buffers
+		}
+		lock.Lock()
+		err := uploadErr
+		lock.Unlock()
+		if err != nil {
+			break
+		}
+
+		n, err = io.ReadFull(data, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			wg.Wait()
+			return 0, err
+		}
+	}
+	wg.Wait()
+	if uploadErr != nil {
+		return 0, uploadErr
+	}
+	sort.Slice(uploaded, func(i, j int) bool {
+		return uploaded[i].PartNumber < uploaded[j].PartNumber
+	})
+	parts = append(parts, uploaded...)
+
+	if _, err := ep.core.CompleteMultipartUploadWithContext(ctx, driver.bucket, p, uploadID, parts); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
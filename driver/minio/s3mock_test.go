@@ -0,0 +1,517 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package minio
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// s3Mock is an in-process server implementing the subset of the S3 API the
+// driver uses, so the driver could be tested without an object store
+type s3Mock struct {
+	lock    sync.Mutex
+	buckets map[string]map[string]*s3MockObject
+	uploads map[string]*s3MockUpload
+	nextID  int
+	// the bytes the objects lose when they are stored
+	truncate int
+	// the number of the next object requests replied with 503 SlowDown
+	slowDown int
+	// the versioned buckets and the previous versions of their objects by
+	// bucket/key, the latest first
+	versioned map[string]bool
+	versions  map[string][]*s3MockObject
+}
+
+type s3MockObject struct {
+	data      []byte
+	modTime   time.Time
+	versionID string
+}
+
+func (obj *s3MockObject) etag() string {
+	sum := md5.Sum(obj.data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+type s3MockUpload struct {
+	bucket string
+	key    string
+	parts  map[int][]byte
+}
+
+func newS3Mock() *s3Mock {
+	return &s3Mock{
+		buckets:   make(map[string]map[string]*s3MockObject),
+		uploads:   make(map[string]*s3MockUpload),
+		versioned: make(map[string]bool),
+		versions:  make(map[string][]*s3MockObject),
+	}
+}
+
+// store stores the object, the replaced one is kept as a version if the
+// bucket is versioned
+func (m *s3Mock) store(bucket, key string, obj *s3MockObject) {
+	if m.versioned[bucket] {
+		m.nextID++
+		obj.versionID = "v" + strconv.Itoa(m.nextID)
+		if old := m.buckets[bucket][key]; old != nil {
+			m.versions[bucket+"/"+key] = append([]*s3MockObject{old}, m.versions[bucket+"/"+key]...)
+		}
+	}
+	m.buckets[bucket][key] = obj
+}
+
+type s3MockError struct {
+	XMLName    xml.Name `xml:"Error"`
+	Code       string
+	Message    string
+	BucketName string
+	Key        string
+}
+
+func writeS3Error(w http.ResponseWriter, r *http.Request, status int, code, bucket, key string) {
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return
+	}
+	_ = xml.NewEncoder(w).Encode(s3MockError{
+		Code:       code,
+		Message:    code,
+		BucketName: bucket,
+		Key:        key,
+	})
+}
+
+func writeS3XML(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(v)
+}
+
+func (m *s3Mock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	bucket := parts[0]
+	var key string
+	if len(parts) > 1 {
+		key = parts[1]
+	}
+
+	objects, exists := m.buckets[bucket]
+	if key == "" {
+		m.serveBucket(w, r, bucket, objects, exists)
+		return
+	}
+	if !exists {
+		writeS3Error(w, r, http.StatusNotFound, "NoSuchBucket", bucket, key)
+		return
+	}
+	if m.slowDown > 0 {
+		m.slowDown--
+		writeS3Error(w, r, http.StatusServiceUnavailable, "SlowDown", bucket, key)
+		return
+	}
+	m.serveObject(w, r, bucket, key, objects)
+}
+
+type s3MockListResult struct {
+	XMLName        xml.Name `xml:"ListBucketResult"`
+	Name           string
+	Prefix         string
+	Marker         string
+	Delimiter      string
+	MaxKeys        int
+	IsTruncated    bool
+	Contents       []s3MockListObject
+	CommonPrefixes []s3MockPrefix
+}
+
+type s3MockListObject struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int64
+	StorageClass string
+}
+
+type s3MockPrefix struct {
+	Prefix string
+}
+
+func (m *s3Mock) serveBucket(w http.ResponseWriter, r *http.Request, bucket string, objects map[string]*s3MockObject, exists bool) {
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPut:
+		if exists {
+			writeS3Error(w, r, http.StatusConflict, "BucketAlreadyOwnedByYou", bucket, "")
+			return
+		}
+		m.buckets[bucket] = make(map[string]*s3MockObject)
+	case !exists:
+		writeS3Error(w, r, http.StatusNotFound, "NoSuchBucket", bucket, "")
+	case r.Method == http.MethodHead:
+	case r.Method == http.MethodGet && hasQuery(query, "location"):
+		writeS3XML(w, struct {
+			XMLName xml.Name `xml:"LocationConstraint"`
+		}{})
+	case r.Method == http.MethodGet && hasQuery(query, "versioning"):
+		var status string
+		if m.versioned[bucket] {
+			status = "Enabled"
+		}
+		writeS3XML(w, struct {
+			XMLName xml.Name `xml:"VersioningConfiguration"`
+			Status  string   `xml:",omitempty"`
+		}{Status: status})
+	case r.Method == http.MethodGet && hasQuery(query, "versions"):
+		m.listVersions(w, bucket, objects, query.Get("prefix"))
+	case r.Method == http.MethodGet:
+		m.list(w, bucket, objects, query)
+	default:
+		writeS3Error(w, r, http.StatusNotImplemented, "NotImplemented", bucket, "")
+	}
+}
+
+func (m *s3Mock) list(w http.ResponseWriter, bucket string, objects map[string]*s3MockObject, query url.Values) {
+	var (
+		prefix    = query.Get("prefix")
+		delimiter = query.Get("delimiter")
+		marker    = query.Get("marker")
+		keys      []string
+	)
+	for key := range objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var (
+		result = s3MockListResult{
+			Name:      bucket,
+			Prefix:    prefix,
+			Marker:    marker,
+			Delimiter: delimiter,
+			MaxKeys:   1000,
+		}
+		prefixes = make(map[string]bool)
+	)
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) || key <= marker {
+			continue
+		}
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				common := key[:len(prefix)+i+len(delimiter)]
+				if !prefixes[common] {
+					prefixes[common] = true
+					result.CommonPrefixes = append(result.CommonPrefixes, s3MockPrefix{Prefix: common})
+				}
+				continue
+			}
+		}
+		obj := objects[key]
+		result.Contents = append(result.Contents, s3MockListObject{
+			Key:          key,
+			LastModified: obj.modTime.UTC().Format(time.RFC3339),
+			ETag:         obj.etag(),
+			Size:         int64(len(obj.data)),
+			StorageClass: "STANDARD",
+		})
+	}
+	writeS3XML(w, result)
+}
+
+type s3MockVersion struct {
+	Key          string
+	VersionId    string
+	IsLatest     bool
+	LastModified string
+	ETag         string
+	Size         int64
+}
+
+// listVersions lists the versions of the objects, the versions of a key are
+// listed the latest first and are never truncated
+func (m *s3Mock) listVersions(w http.ResponseWriter, bucket string, objects map[string]*s3MockObject, prefix string) {
+	var keys []string
+	for key := range objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var result = struct {
+		XMLName xml.Name `xml:"ListVersionsResult"`
+		Name    string
+		Prefix  string
+		Version []s3MockVersion
+	}{Name: bucket, Prefix: prefix}
+	for _, key := range keys {
+		for i, obj := range append([]*s3MockObject{objects[key]}, m.versions[bucket+"/"+key]...) {
+			result.Version = append(result.Version, s3MockVersion{
+				Key:          key,
+				VersionId:    obj.versionID,
+				IsLatest:     i == 0,
+				LastModified: obj.modTime.UTC().Format(time.RFC3339Nano),
+				ETag:         obj.etag(),
+				Size:         int64(len(obj.data)),
+			})
+		}
+	}
+	writeS3XML(w, result)
+}
+
+// copySource returns the object the x-amz-copy-source header refers to, or
+// its version if the source has a versionId
+func (m *s3Mock) copySource(r *http.Request) (string, string, *s3MockObject) {
+	src := strings.TrimPrefix(r.Header.Get("X-Amz-Copy-Source"), "/")
+	var versionID string
+	if i := strings.Index(src, "?versionId="); i >= 0 {
+		versionID, _ = url.QueryUnescape(src[i+len("?versionId="):])
+		src = src[:i]
+	}
+	src, _ = url.PathUnescape(src)
+	parts := strings.SplitN(src, "/", 2)
+	if len(parts) != 2 {
+		return src, "", nil
+	}
+	obj := m.buckets[parts[0]][parts[1]]
+	if versionID == "" {
+		return parts[0], parts[1], obj
+	}
+	for _, version := range append([]*s3MockObject{obj}, m.versions[src]...) {
+		if version != nil && version.versionID == versionID {
+			return parts[0], parts[1], version
+		}
+	}
+	return parts[0], parts[1], nil
+}
+
+// decodeChunked returns the payload of a body signed by chunks, every chunk
+// is "size;chunk-signature=...\r\ndata\r\n" and the last one is empty
+func decodeChunked(body []byte) ([]byte, bool) {
+	var data []byte
+	for {
+		i := bytes.Index(body, []byte("\r\n"))
+		if i < 0 {
+			return nil, false
+		}
+		header := strings.SplitN(string(body[:i]), ";", 2)[0]
+		size, err := strconv.ParseInt(header, 16, 64)
+		if err != nil || int64(len(body)) < int64(i)+2+size+2 {
+			return nil, false
+		}
+		if size == 0 {
+			return data, true
+		}
+		body = body[i+2:]
+		data = append(data, body[:size]...)
+		body = body[size+2:]
+	}
+}
+
+// parseRange returns the start and the end, exclusive, of a range header
+func parseRange(header string, size int64) (int64, int64, bool) {
+	if !strings.HasPrefix(header, "bytes=") {
+		return 0, 0, false
+	}
+	bounds := strings.SplitN(strings.TrimPrefix(header, "bytes="), "-", 2)
+	if len(bounds) != 2 {
+		return 0, 0, false
+	}
+	if bounds[0] == "" {
+		n, err := strconv.ParseInt(bounds[1], 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size, true
+	}
+	start, err := strconv.ParseInt(bounds[0], 10, 64)
+	if err != nil || start >= size {
+		return 0, 0, false
+	}
+	end := size
+	if bounds[1] != "" {
+		last, err := strconv.ParseInt(bounds[1], 10, 64)
+		if err != nil || last < start {
+			return 0, 0, false
+		}
+		if last+1 < end {
+			end = last + 1
+		}
+	}
+	return start, end, true
+}
+
+func (m *s3Mock) serveObject(w http.ResponseWriter, r *http.Request, bucket, key string, objects map[string]*s3MockObject) {
+	query := r.URL.Query()
+	switch r.Method {
+	case http.MethodHead, http.MethodGet:
+		obj := objects[key]
+		if obj == nil {
+			writeS3Error(w, r, http.StatusNotFound, "NoSuchKey", bucket, key)
+			return
+		}
+		var (
+			size       = int64(len(obj.data))
+			start, end = int64(0), size
+			status     = http.StatusOK
+		)
+		if header := r.Header.Get("Range"); header != "" {
+			var ok bool
+			start, end, ok = parseRange(header, size)
+			if !ok {
+				writeS3Error(w, r, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", bucket, key)
+				return
+			}
+			status = http.StatusPartialContent
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end-1, size))
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(end-start, 10))
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("ETag", obj.etag())
+		w.Header().Set("Last-Modified", obj.modTime.UTC().Format(http.TimeFormat))
+		w.WriteHeader(status)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(obj.data[start:end])
+		}
+	case http.MethodPut:
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			writeS3Error(w, r, http.StatusBadRequest, "IncompleteBody", bucket, key)
+			return
+		}
+		if r.Header.Get("X-Amz-Content-Sha256") == "STREAMING-AWS4-HMAC-SHA256-PAYLOAD" {
+			var ok bool
+			if data, ok = decodeChunked(data); !ok {
+				writeS3Error(w, r, http.StatusBadRequest, "IncompleteBody", bucket, key)
+				return
+			}
+		}
+		var copied *s3MockObject
+		if r.Header.Get("X-Amz-Copy-Source") != "" {
+			srcBucket, srcKey, src := m.copySource(r)
+			if src == nil {
+				writeS3Error(w, r, http.StatusNotFound, "NoSuchKey", srcBucket, srcKey)
+				return
+			}
+			data = src.data
+			if header := r.Header.Get("X-Amz-Copy-Source-Range"); header != "" {
+				start, end, ok := parseRange(header, int64(len(data)))
+				if !ok {
+					writeS3Error(w, r, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", bucket, key)
+					return
+				}
+				data = data[start:end]
+			}
+			copied = &s3MockObject{data: data, modTime: time.Now()}
+		}
+
+		if uploadID := query.Get("uploadId"); uploadID != "" {
+			upload := m.uploads[uploadID]
+			if upload == nil {
+				writeS3Error(w, r, http.StatusNotFound, "NoSuchUpload", bucket, key)
+				return
+			}
+			partNumber, _ := strconv.Atoi(query.Get("partNumber"))
+			upload.parts[partNumber] = append([]byte(nil), data...)
+			part := &s3MockObject{data: data}
+			if copied != nil {
+				writeS3XML(w, struct {
+					XMLName      xml.Name `xml:"CopyPartResult"`
+					LastModified string
+					ETag         string
+				}{LastModified: time.Now().UTC().Format(time.RFC3339), ETag: part.etag()})
+				return
+			}
+			w.Header().Set("ETag", part.etag())
+			return
+		}
+
+		if m.truncate > 0 && len(data) >= m.truncate {
+			data = data[:len(data)-m.truncate]
+		}
+		obj := &s3MockObject{data: append([]byte(nil), data...), modTime: time.Now()}
+		m.store(bucket, key, obj)
+		if copied != nil {
+			writeS3XML(w, struct {
+				XMLName      xml.Name `xml:"CopyObjectResult"`
+				LastModified string
+				ETag         string
+			}{LastModified: obj.modTime.UTC().Format(time.RFC3339), ETag: obj.etag()})
+			return
+		}
+		w.Header().Set("ETag", obj.etag())
+	case http.MethodPost:
+		switch {
+		case hasQuery(query, "uploads"):
+			m.nextID++
+			uploadID := strconv.Itoa(m.nextID)
+			m.uploads[uploadID] = &s3MockUpload{
+				bucket: bucket,
+				key:    key,
+				parts:  make(map[int][]byte),
+			}
+			writeS3XML(w, struct {
+				XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+				Bucket   string
+				Key      string
+				UploadId string
+			}{Bucket: bucket, Key: key, UploadId: uploadID})
+		case query.Get("uploadId") != "":
+			upload := m.uploads[query.Get("uploadId")]
+			if upload == nil {
+				writeS3Error(w, r, http.StatusNotFound, "NoSuchUpload", bucket, key)
+				return
+			}
+			var numbers []int
+			for n := range upload.parts {
+				numbers = append(numbers, n)
+			}
+			sort.Ints(numbers)
+			var data bytes.Buffer
+			for _, n := range numbers {
+				data.Write(upload.parts[n])
+			}
+			delete(m.uploads, query.Get("uploadId"))
+			obj := &s3MockObject{data: data.Bytes(), modTime: time.Now()}
+			m.store(bucket, key, obj)
+			writeS3XML(w, struct {
+				XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+				Bucket  string
+				Key     string
+				ETag    string
+			}{Bucket: bucket, Key: key, ETag: obj.etag()})
+		default:
+			writeS3Error(w, r, http.StatusNotImplemented, "NotImplemented", bucket, key)
+		}
+	case http.MethodDelete:
+		if uploadID := query.Get("uploadId"); uploadID != "" {
+			delete(m.uploads, uploadID)
+		} else {
+			delete(objects, key)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeS3Error(w, r, http.StatusNotImplemented, "NotImplemented", bucket, key)
+	}
+}
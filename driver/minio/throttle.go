@@ -0,0 +1,122 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package minio
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"goftp.io/server/v2"
+)
+
+const (
+	defaultThrottleBackoff    = 200 * time.Millisecond
+	defaultMaxThrottleBackoff = 10 * time.Second
+)
+
+// ThrottleStats is the state of the backoff of the driver
+type ThrottleStats struct {
+	Events  int64         // the number of the throttled requests
+	Backoff time.Duration // the current backoff, 0 if the storage isn't throttling
+	Waited  time.Duration // how long the requests waited for the backoffs
+}
+
+// isThrottled tells if the storage asks to slow down, S3 replies 503
+// SlowDown and some compatible stores 429
+func isThrottled(resp *http.Response) bool {
+	return resp != nil && (resp.StatusCode == http.StatusServiceUnavailable ||
+		resp.StatusCode == http.StatusTooManyRequests)
+}
+
+// contextKey is the key of the server context in the contexts of the
+// requests, so the transport could pause the transfers of the server
+type contextKey struct{}
+
+// requestContext returns the context the requests of a transfer are sent
+// with
+func requestContext(ctx *server.Context) context.Context {
+	return context.WithValue(ctx.Context(), contextKey{}, ctx)
+}
+
+// throttleTransport delays the requests while the storage is throttling
+// them. The backoff doubles with every throttled response and halves with
+// every other one, the retries are left to minio-go.
+type throttleTransport struct {
+	http.RoundTripper
+	min, max time.Duration
+
+	lock    sync.Mutex
+	backoff time.Duration
+	until   time.Time // the requests are delayed until then
+	stats   ThrottleStats
+}
+
+func (t *throttleTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.wait(req.Context()); err != nil {
+		return nil, err
+	}
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if !isThrottled(resp) {
+		t.lock.Lock()
+		if t.backoff /= 2; t.backoff < t.min {
+			t.backoff = 0
+		}
+		t.lock.Unlock()
+		return resp, nil
+	}
+
+	t.lock.Lock()
+	t.backoff *= 2
+	if t.backoff < t.min {
+		t.backoff = t.min
+	} else if t.backoff > t.max {
+		t.backoff = t.max
+	}
+	backoff := t.backoff
+	t.until = time.Now().Add(backoff)
+	t.stats.Events++
+	t.lock.Unlock()
+
+	// the data connections are paused too rather than being buffered
+	if ctx, ok := req.Context().Value(contextKey{}).(*server.Context); ok {
+		ctx.Backoff(backoff)
+	}
+	return resp, nil
+}
+
+// wait waits for the end of the backoff
+func (t *throttleTransport) wait(ctx context.Context) error {
+	t.lock.Lock()
+	d := time.Until(t.until)
+	if d > 0 {
+		t.stats.Waited += d
+	}
+	t.lock.Unlock()
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *throttleTransport) Stats() ThrottleStats {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	stats := t.stats
+	stats.Backoff = t.backoff
+	return stats
+}
@@ -0,0 +1,145 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package minio
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"goftp.io/server/v2"
+)
+
+// Call represents a S3 API call made by the driver
+type Call struct {
+	Operation  string // i.e. GetObject or ListObjects
+	Key        string // the object key, empty for bucket operations
+	Duration   time.Duration
+	StatusCode int  // 0 if no response has been received
+	Throttled  bool // the storage asked to slow down
+	Err        error
+}
+
+// traceTransport reports the calls sent through the wrapped transport
+type traceTransport struct {
+	http.RoundTripper
+	bucket string
+	opts   *Options
+}
+
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.RoundTripper.RoundTrip(req)
+
+	key := t.objectKey(req)
+	call := Call{
+		Operation: s3Operation(req, key != ""),
+		Key:       key,
+		Duration:  time.Since(start),
+		Err:       err,
+		Throttled: isThrottled(resp),
+	}
+	if resp != nil {
+		call.StatusCode = resp.StatusCode
+	}
+	t.report(call)
+	return resp, err
+}
+
+// objectKey returns the key of the request for both path style and virtual
+// host style requests
+func (t *traceTransport) objectKey(req *http.Request) string {
+	p := strings.TrimPrefix(req.URL.Path, "/")
+	if !strings.HasPrefix(req.URL.Host, t.bucket+".") {
+		p = strings.TrimPrefix(strings.TrimPrefix(p, t.bucket), "/")
+	}
+	return p
+}
+
+func (t *traceTransport) report(call Call) {
+	if t.opts.OnCall != nil {
+		t.opts.OnCall(call)
+	}
+	if t.opts.Logger == nil {
+		return
+	}
+
+	slow := t.opts.SlowCallThreshold > 0 && call.Duration >= t.opts.SlowCallThreshold
+	if !slow && !t.opts.TraceCalls {
+		return
+	}
+	format := "S3 %s %q status %d in %v"
+	v := []interface{}{call.Operation, call.Key, call.StatusCode, call.Duration}
+	if call.Err != nil {
+		format += ": %v"
+		v = append(v, call.Err)
+	}
+
+	leveled, ok := t.opts.Logger.(server.LeveledLogger)
+	switch {
+	case !ok:
+		t.opts.Logger.Printf("", format, v...)
+	case slow:
+		leveled.Warn("", "slow "+format, v...)
+	default:
+		leveled.Debug("", format, v...)
+	}
+}
+
+// s3Operation returns the name of the S3 API operation of the request
+func s3Operation(req *http.Request, hasKey bool) string {
+	query := req.URL.Query()
+	switch req.Method {
+	case http.MethodHead:
+		if !hasKey {
+			return "HeadBucket"
+		}
+		return "HeadObject"
+	case http.MethodGet:
+		switch {
+		case hasQuery(query, "location"):
+			return "GetBucketLocation"
+		case hasQuery(query, "uploads"):
+			return "ListMultipartUploads"
+		case query.Get("uploadId") != "":
+			return "ListParts"
+		case hasQuery(query, "list-type") || hasQuery(query, "prefix") || hasQuery(query, "delimiter"):
+			return "ListObjects"
+		}
+		return "GetObject"
+	case http.MethodPut:
+		switch {
+		case query.Get("uploadId") != "" && req.Header.Get("X-Amz-Copy-Source") != "":
+			return "UploadPartCopy"
+		case query.Get("uploadId") != "":
+			return "UploadPart"
+		case req.Header.Get("X-Amz-Copy-Source") != "":
+			return "CopyObject"
+		case !hasKey && len(query) == 0:
+			return "MakeBucket"
+		}
+		return "PutObject"
+	case http.MethodPost:
+		switch {
+		case hasQuery(query, "uploads"):
+			return "CreateMultipartUpload"
+		case query.Get("uploadId") != "":
+			return "CompleteMultipartUpload"
+		case hasQuery(query, "delete"):
+			return "DeleteObjects"
+		}
+	case http.MethodDelete:
+		if query.Get("uploadId") != "" {
+			return "AbortMultipartUpload"
+		}
+		return "DeleteObject"
+	}
+	return req.Method
+}
+
+func hasQuery(query map[string][]string, name string) bool {
+	_, ok := query[name]
+	return ok
+}
@@ -0,0 +1,44 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package minio
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestS3Operation(t *testing.T) {
+	transport := &traceTransport{bucket: "bucket"}
+	var cases = []struct {
+		method string
+		url    string
+		header string
+		op     string
+		key    string
+	}{
+		{"GET", "http://s3/bucket/?list-type=2&prefix=a%2F", "", "ListObjects", ""},
+		{"GET", "http://s3/bucket/a/b.txt", "", "GetObject", "a/b.txt"},
+		{"GET", "http://bucket.s3/a/b.txt", "", "GetObject", "a/b.txt"},
+		{"HEAD", "http://s3/bucket/a", "", "HeadObject", "a"},
+		{"HEAD", "http://s3/bucket/", "", "HeadBucket", ""},
+		{"PUT", "http://s3/bucket/a", "", "PutObject", "a"},
+		{"PUT", "http://s3/bucket/a", "/bucket/b", "CopyObject", "a"},
+		{"PUT", "http://s3/bucket/", "", "MakeBucket", ""},
+		{"POST", "http://s3/bucket/a?uploads=", "", "CreateMultipartUpload", "a"},
+		{"DELETE", "http://s3/bucket/a", "", "DeleteObject", "a"},
+	}
+	for _, c := range cases {
+		req, err := http.NewRequest(c.method, c.url, nil)
+		assert.NoError(t, err)
+		if c.header != "" {
+			req.Header.Set("X-Amz-Copy-Source", c.header)
+		}
+		key := transport.objectKey(req)
+		assert.EqualValues(t, c.key, key, c.url)
+		assert.EqualValues(t, c.op, s3Operation(req, key != ""), c.url)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package minio
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	minio "github.com/minio/minio-go/v6"
+	"github.com/minio/minio-go/v6/pkg/s3signer"
+	"github.com/minio/minio-go/v6/pkg/s3utils"
+	"goftp.io/server/v2"
+)
+
+var _ server.Versioner = &Driver{}
+
+var (
+	errVersioningDisabled = errors.New("Bucket versioning is not enabled")
+	errNoSuchVersion      = errors.New("No such version")
+)
+
+// emptySHA256 is the hash of the empty payload of the requests
+var emptySHA256 = func() string {
+	sum := sha256.Sum256(nil)
+	return hex.EncodeToString(sum[:])
+}()
+
+// s3Request sends a request of the S3 API minio-go v6 doesn't implement, the
+// versions of the objects, and decodes the XML response into v if not nil
+func (driver *Driver) s3Request(ctx context.Context, ep *endpoint, method, key string, query url.Values, header http.Header, v interface{}) error {
+	location, err := ep.client.GetBucketLocation(driver.bucket)
+	if err != nil {
+		return err
+	}
+	u := ep.client.EndpointURL()
+	u.Path = "/" + driver.bucket + "/" + key
+	u.RawPath = "/" + driver.bucket + "/" + s3utils.EncodePath(key)
+	u.RawQuery = s3utils.QueryEncode(query)
+
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("X-Amz-Content-Sha256", emptySHA256)
+	req = s3signer.SignV4(*req, driver.accessKeyID, driver.secretAccessKey, "", location)
+
+	resp, err := (&http.Client{Transport: driver.throttle}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		errResp := minio.ErrorResponse{StatusCode: resp.StatusCode}
+		if err := xml.NewDecoder(resp.Body).Decode(&errResp); err != nil || errResp.Code == "" {
+			errResp.Code = resp.Status
+			errResp.Message = resp.Status
+		}
+		return errResp
+	}
+	if v == nil {
+		return nil
+	}
+	return xml.NewDecoder(resp.Body).Decode(v)
+}
+
+// checkVersioning returns an error if the versioning of the bucket has never
+// been enabled
+func (driver *Driver) checkVersioning(ctx *server.Context) error {
+	var config struct {
+		Status string
+	}
+	err := driver.withEndpoint(true, func(ep *endpoint) error {
+		return driver.s3Request(requestContext(ctx), ep, http.MethodGet, "", url.Values{"versioning": {""}}, nil, &config)
+	})
+	if err != nil {
+		return err
+	}
+	if config.Status == "" {
+		return errVersioningDisabled
+	}
+	return nil
+}
+
+type listVersionsResult struct {
+	IsTruncated         bool
+	NextKeyMarker       string
+	NextVersionIdMarker string
+	Version             []struct {
+		Key          string
+		VersionId    string
+		IsLatest     bool
+		LastModified time.Time
+		Size         int64
+	}
+}
+
+// Versions implements server.Versioner with the versions of the object kept
+// by the bucket versioning, it fails if the bucket is not versioned
+func (driver *Driver) Versions(ctx *server.Context, path string) ([]server.FileVersion, error) {
+	if err := driver.checkVersioning(ctx); err != nil {
+		return nil, err
+	}
+
+	var (
+		key      = buildMinioPath(path)
+		query    = url.Values{"versions": {""}, "prefix": {key}}
+		versions []server.FileVersion
+	)
+	for {
+		var result listVersionsResult
+		err := driver.withEndpoint(true, func(ep *endpoint) error {
+			return driver.s3Request(requestContext(ctx), ep, http.MethodGet, "", query, nil, &result)
+		})
+		if err != nil {
+			return nil, err
+		}
+		// the versions of a key are listed the latest first
+		for _, version := range result.Version {
+			if version.Key == key && !version.IsLatest {
+				versions = append(versions, server.FileVersion{
+					ID:      version.VersionId,
+					Size:    version.Size,
+					ModTime: version.LastModified,
+				})
+			}
+		}
+		if !result.IsTruncated {
+			return versions, nil
+		}
+		query.Set("key-marker", result.NextKeyMarker)
+		query.Set("version-id-marker", result.NextVersionIdMarker)
+	}
+}
+
+// RestoreVersion implements server.Versioner, the version is copied over
+// the object so the replaced object is kept as a version by the bucket
+func (driver *Driver) RestoreVersion(ctx *server.Context, path string, id string) error {
+	if err := driver.checkVersioning(ctx); err != nil {
+		return err
+	}
+
+	key := buildMinioPath(path)
+	header := http.Header{}
+	header.Set("X-Amz-Copy-Source", s3utils.EncodePath("/"+driver.bucket+"/"+key)+"?versionId="+url.QueryEscape(id))
+	err := driver.withEndpoint(false, func(ep *endpoint) error {
+		return driver.s3Request(requestContext(ctx), ep, http.MethodPut, key, nil, header, nil)
+	})
+	if errResp, ok := err.(minio.ErrorResponse); ok && (errResp.Code == "NoSuchVersion" || errResp.Code == "NoSuchKey" || errResp.Code == "InvalidArgument") {
+		return errNoSuchVersion
+	}
+	return err
+}
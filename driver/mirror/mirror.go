@@ -0,0 +1,342 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package mirror keeps a warm standby copy of the files of a driver, every
+// change is applied to a primary and a secondary driver:
+//
+//	driver := mirror.NewDriver(&mirror.Options{
+//		Primary:   fileDriver,
+//		Secondary: minioDriver,
+//		Async:     true,
+//	})
+//	defer driver.Close()
+//
+// The reads are served by the primary, they fail over to the secondary when
+// the primary fails. The failures of the secondary are logged, they don't
+// fail the requests.
+package mirror
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"goftp.io/server/v2"
+)
+
+var (
+	_ server.Driver                = &Driver{}
+	_ server.ModTimeSetter         = &Driver{}
+	_ server.BackendsHealthChecker = &Driver{}
+)
+
+// ErrNotSupported is returned by SetModTime if the primary isn't a
+// server.ModTimeSetter
+var ErrNotSupported = errors.New("Not supported")
+
+const defaultQueueSize = 1024
+
+// Options represents the options of the mirror driver
+type Options struct {
+	Primary   server.Driver
+	Secondary server.Driver
+
+	// Apply the changes to the secondary in the background, the requests
+	// only wait for the primary. If false, the requests wait for both.
+	Async bool
+
+	// The number of the changes waiting for the secondary in async mode,
+	// 1024 if 0. The changes made while the queue is full aren't mirrored.
+	QueueSize int
+
+	// Logger, if not nil, receives the failures of the secondary, otherwise
+	// they are sent to the standard logger
+	Logger server.Logger
+}
+
+// change is a change to apply to the secondary
+type change struct {
+	ctx *server.Context
+	op  string
+	p   string
+	fn  func(ctx *server.Context) error
+}
+
+// Driver implements server.Driver mirroring the changes of the primary to
+// the secondary
+type Driver struct {
+	primary   server.Driver
+	secondary server.Driver
+	logger    server.Logger
+
+	queue chan change // nil in sync mode
+	done  chan struct{}
+	once  sync.Once
+}
+
+// NewDriver creates a mirror driver, the async ones must be closed
+func NewDriver(opts *Options) *Driver {
+	driver := &Driver{
+		primary:   opts.Primary,
+		secondary: opts.Secondary,
+		logger:    opts.Logger,
+	}
+	if opts.Async {
+		size := opts.QueueSize
+		if size <= 0 {
+			size = defaultQueueSize
+		}
+		driver.queue = make(chan change, size)
+		driver.done = make(chan struct{})
+		go driver.replay()
+	}
+	return driver
+}
+
+// Close applies the queued changes to the secondary and stops the driver
+func (driver *Driver) Close() error {
+	driver.once.Do(func() {
+		if driver.queue != nil {
+			close(driver.queue)
+			<-driver.done
+		}
+	})
+	return nil
+}
+
+// replay applies the queued changes to the secondary
+func (driver *Driver) replay() {
+	defer close(driver.done)
+	for c := range driver.queue {
+		driver.apply(c)
+	}
+}
+
+func (driver *Driver) apply(c change) {
+	if err := c.fn(c.ctx); err != nil {
+		driver.warnf(c.ctx, "mirroring %s %s failed: %v", c.op, c.p, err)
+	}
+}
+
+func (driver *Driver) warnf(ctx *server.Context, format string, v ...interface{}) {
+	var sessionID string
+	if ctx.Sess != nil {
+		sessionID = ctx.Sess.Info().ID
+	}
+	switch logger := driver.logger.(type) {
+	case nil:
+		log.Printf(format, v...)
+	case server.LeveledLogger:
+		logger.Warn(sessionID, format, v...)
+	default:
+		logger.Printf(sessionID, format, v...)
+	}
+}
+
+// mirror applies the change to the secondary once the primary succeeded
+func (driver *Driver) mirror(ctx *server.Context, op, p string, fn func(ctx *server.Context) error) {
+	if driver.queue == nil {
+		driver.apply(change{ctx, op, p, fn})
+		return
+	}
+	// the context of the request is cancelled once it's done
+	ctx = &server.Context{
+		Sess:  ctx.Sess,
+		Cmd:   ctx.Cmd,
+		Param: ctx.Param,
+		Data:  make(map[string]interface{}),
+	}
+	select {
+	case driver.queue <- change{ctx, op, p, fn}:
+	default:
+		driver.warnf(ctx, "mirroring %s %s failed: the queue is full", op, p)
+	}
+}
+
+// CheckBackends implements server.BackendsHealthChecker, the backends are
+// named primary and secondary
+func (driver *Driver) CheckBackends(ctx context.Context) map[string]error {
+	return server.CheckBackends(ctx, map[string]server.Driver{
+		"primary":   driver.primary,
+		"secondary": driver.secondary,
+	})
+}
+
+// Stat implements server.Driver
+func (driver *Driver) Stat(ctx *server.Context, p string) (os.FileInfo, error) {
+	info, err := driver.primary.Stat(ctx, p)
+	if err != nil {
+		if info, serr := driver.secondary.Stat(ctx, p); serr == nil {
+			return info, nil
+		}
+	}
+	return info, err
+}
+
+// ListDir implements server.Driver, it fails over only if the primary
+// failed before listing a file
+func (driver *Driver) ListDir(ctx *server.Context, p string, callback func(os.FileInfo) error) error {
+	var listed bool
+	err := driver.primary.ListDir(ctx, p, func(info os.FileInfo) error {
+		listed = true
+		return callback(info)
+	})
+	if err != nil && !listed {
+		if serr := driver.secondary.ListDir(ctx, p, callback); serr == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// GetFile implements server.Driver
+func (driver *Driver) GetFile(ctx *server.Context, p string, offset int64) (int64, io.ReadCloser, error) {
+	size, r, err := driver.primary.GetFile(ctx, p, offset)
+	if err != nil {
+		if size, r, serr := driver.secondary.GetFile(ctx, p, offset); serr == nil {
+			return size, r, nil
+		}
+	}
+	return size, r, err
+}
+
+// DeleteDir implements server.Driver
+func (driver *Driver) DeleteDir(ctx *server.Context, p string) error {
+	if err := driver.primary.DeleteDir(ctx, p); err != nil {
+		return err
+	}
+	driver.mirror(ctx, "DeleteDir", p, func(ctx *server.Context) error {
+		return driver.secondary.DeleteDir(ctx, p)
+	})
+	return nil
+}
+
+// DeleteFile implements server.Driver
+func (driver *Driver) DeleteFile(ctx *server.Context, p string) error {
+	if err := driver.primary.DeleteFile(ctx, p); err != nil {
+		return err
+	}
+	driver.mirror(ctx, "DeleteFile", p, func(ctx *server.Context) error {
+		return driver.secondary.DeleteFile(ctx, p)
+	})
+	return nil
+}
+
+// Rename implements server.Driver
+func (driver *Driver) Rename(ctx *server.Context, fromPath string, toPath string) error {
+	if err := driver.primary.Rename(ctx, fromPath, toPath); err != nil {
+		return err
+	}
+	driver.mirror(ctx, "Rename", fromPath, func(ctx *server.Context) error {
+		return driver.secondary.Rename(ctx, fromPath, toPath)
+	})
+	return nil
+}
+
+// MakeDir implements server.Driver
+func (driver *Driver) MakeDir(ctx *server.Context, p string) error {
+	if err := driver.primary.MakeDir(ctx, p); err != nil {
+		return err
+	}
+	driver.mirror(ctx, "MakeDir", p, func(ctx *server.Context) error {
+		return driver.secondary.MakeDir(ctx, p)
+	})
+	return nil
+}
+
+// PutFile implements server.Driver. In sync mode the data is streamed to
+// both drivers at once, in async mode the file is copied from the primary
+// once it's written.
+func (driver *Driver) PutFile(ctx *server.Context, destPath string, data io.Reader, offset int64) (int64, error) {
+	if driver.queue != nil {
+		size, err := driver.primary.PutFile(ctx, destPath, data, offset)
+		if err != nil {
+			return size, err
+		}
+		driver.mirror(ctx, "PutFile", destPath, func(ctx *server.Context) error {
+			return driver.copyFile(ctx, destPath)
+		})
+		return size, nil
+	}
+
+	pr, pw := io.Pipe()
+	tee := &teeWriter{w: pw}
+	var (
+		wg   sync.WaitGroup
+		serr error
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, serr = driver.secondary.PutFile(ctx, destPath, pr, offset)
+		// the primary isn't blocked by the secondary once it failed
+		_ = pr.CloseWithError(errSecondaryDone)
+	}()
+	size, err := driver.primary.PutFile(ctx, destPath, io.TeeReader(data, tee), offset)
+	if err != nil {
+		_ = pw.CloseWithError(err)
+	} else {
+		_ = pw.Close()
+	}
+	wg.Wait()
+	if err != nil {
+		return size, err
+	}
+	if serr != nil {
+		driver.warnf(ctx, "mirroring PutFile %s failed: %v", destPath, serr)
+	}
+	return size, nil
+}
+
+// errSecondaryDone stops feeding the secondary once it returned
+var errSecondaryDone = errors.New("the secondary returned")
+
+// teeWriter forwards the data to the secondary until it fails, so the
+// primary isn't failed by the secondary
+type teeWriter struct {
+	w      io.Writer
+	failed bool
+}
+
+func (t *teeWriter) Write(p []byte) (int, error) {
+	if !t.failed {
+		if _, err := t.w.Write(p); err != nil {
+			t.failed = true
+		}
+	}
+	return len(p), nil
+}
+
+// copyFile copies the file from the primary to the secondary
+func (driver *Driver) copyFile(ctx *server.Context, p string) error {
+	_, r, err := driver.primary.GetFile(ctx, p, 0)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = driver.secondary.PutFile(ctx, p, r, -1)
+	return err
+}
+
+// SetModTime implements server.ModTimeSetter, the time is mirrored if the
+// secondary is a server.ModTimeSetter too
+func (driver *Driver) SetModTime(ctx *server.Context, p string, mtime time.Time) error {
+	setter, ok := driver.primary.(server.ModTimeSetter)
+	if !ok {
+		return ErrNotSupported
+	}
+	if err := setter.SetModTime(ctx, p, mtime); err != nil {
+		return err
+	}
+	if setter, ok := driver.secondary.(server.ModTimeSetter); ok {
+		driver.mirror(ctx, "SetModTime", p, func(ctx *server.Context) error {
+			return setter.SetModTime(ctx, p, mtime)
+		})
+	}
+	return nil
+}
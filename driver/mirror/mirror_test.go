@@ -0,0 +1,144 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package mirror
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newFileDriver(t *testing.T) (server.Driver, func()) {
+	dir, err := ioutil.TempDir("", "mirror")
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver, err := file.NewDriver(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return driver, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func readFile(t *testing.T, driver server.Driver, p string) string {
+	_, r, err := driver.GetFile(&server.Context{}, p, 0)
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	defer r.Close()
+	buf, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	return string(buf)
+}
+
+// failingDriver fails the reads and the uploads while failing is set
+type failingDriver struct {
+	server.Driver
+	failing bool
+}
+
+var errFailing = errors.New("failing")
+
+func (driver *failingDriver) Stat(ctx *server.Context, p string) (os.FileInfo, error) {
+	if driver.failing {
+		return nil, errFailing
+	}
+	return driver.Driver.Stat(ctx, p)
+}
+
+func (driver *failingDriver) GetFile(ctx *server.Context, p string, offset int64) (int64, io.ReadCloser, error) {
+	if driver.failing {
+		return 0, nil, errFailing
+	}
+	return driver.Driver.GetFile(ctx, p, offset)
+}
+
+func (driver *failingDriver) PutFile(ctx *server.Context, p string, data io.Reader, offset int64) (int64, error) {
+	if driver.failing {
+		return 0, errFailing
+	}
+	return driver.Driver.PutFile(ctx, p, data, offset)
+}
+
+func TestDriverSync(t *testing.T) {
+	primary, cleanPrimary := newFileDriver(t)
+	defer cleanPrimary()
+	secondary, cleanSecondary := newFileDriver(t)
+	defer cleanSecondary()
+	failing := &failingDriver{Driver: secondary}
+
+	driver := NewDriver(&Options{Primary: primary, Secondary: failing})
+	defer driver.Close()
+	ctx := &server.Context{}
+
+	assert.NoError(t, driver.MakeDir(ctx, "/dir"))
+	size, err := driver.PutFile(ctx, "/dir/a.txt", strings.NewReader("hello"), -1)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 5, size)
+	assert.EqualValues(t, "hello", readFile(t, secondary, "/dir/a.txt"))
+
+	assert.NoError(t, driver.Rename(ctx, "/dir/a.txt", "/dir/b.txt"))
+	_, err = secondary.Stat(ctx, "/dir/a.txt")
+	assert.Error(t, err)
+	assert.EqualValues(t, "hello", readFile(t, secondary, "/dir/b.txt"))
+
+	// the reads fail over to the secondary
+	assert.NoError(t, primary.DeleteFile(ctx, "/dir/b.txt"))
+	assert.EqualValues(t, "hello", readFile(t, driver, "/dir/b.txt"))
+	info, err := driver.Stat(ctx, "/dir/b.txt")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 5, info.Size())
+
+	// the failures of the secondary don't fail the requests
+	failing.failing = true
+	_, err = driver.PutFile(ctx, "/c.txt", strings.NewReader("world"), -1)
+	assert.NoError(t, err)
+	assert.EqualValues(t, "world", readFile(t, primary, "/c.txt"))
+	failing.failing = false
+	_, err = secondary.Stat(ctx, "/c.txt")
+	assert.Error(t, err)
+
+	assert.NoError(t, driver.DeleteDir(ctx, "/dir"))
+	_, err = secondary.Stat(ctx, "/dir")
+	assert.Error(t, err)
+
+	driver = NewDriver(&Options{Primary: primary, Secondary: secondary})
+	assert.EqualValues(t, map[string]error{"primary": nil, "secondary": nil}, driver.CheckBackends(context.Background()))
+}
+
+func TestDriverAsync(t *testing.T) {
+	primary, cleanPrimary := newFileDriver(t)
+	defer cleanPrimary()
+	secondary, cleanSecondary := newFileDriver(t)
+	defer cleanSecondary()
+
+	driver := NewDriver(&Options{Primary: primary, Secondary: secondary, Async: true})
+	ctx := &server.Context{}
+
+	_, err := driver.PutFile(ctx, "/a.txt", strings.NewReader("hello"), -1)
+	assert.NoError(t, err)
+	_, err = driver.PutFile(ctx, "/a.txt", strings.NewReader(" world"), 5)
+	assert.NoError(t, err)
+	_, err = driver.PutFile(ctx, "/b.txt", strings.NewReader("removed"), -1)
+	assert.NoError(t, err)
+	assert.NoError(t, driver.DeleteFile(ctx, "/b.txt"))
+
+	// the queued changes are applied once closed
+	assert.NoError(t, driver.Close())
+	assert.EqualValues(t, "hello world", readFile(t, secondary, "/a.txt"))
+	_, err = secondary.Stat(ctx, "/b.txt")
+	assert.Error(t, err)
+}
@@ -0,0 +1,108 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16
+// +build go1.16
+
+package mount
+
+import (
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"goftp.io/server/v2"
+)
+
+var (
+	_ server.Driver = &fsDriver{}
+)
+
+// fsDriver implements a read only server.Driver serving a fs.FS
+type fsDriver struct {
+	fsys fs.FS
+}
+
+// FS returns a read only driver serving the files of fsys, i.e. an embed.FS
+// or os.DirFS
+func FS(fsys fs.FS) server.Driver {
+	return &fsDriver{fsys: fsys}
+}
+
+// fsName returns the name of the path in the fs.FS
+func fsName(p string) string {
+	name := strings.TrimPrefix(path.Clean("/"+p), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func (driver *fsDriver) Stat(ctx *server.Context, p string) (os.FileInfo, error) {
+	return fs.Stat(driver.fsys, fsName(p))
+}
+
+func (driver *fsDriver) ListDir(ctx *server.Context, p string, callback func(os.FileInfo) error) error {
+	entries, err := fs.ReadDir(driver.fsys, fsName(p))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if err := callback(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (driver *fsDriver) DeleteDir(ctx *server.Context, p string) error {
+	return ErrReadOnly
+}
+
+func (driver *fsDriver) DeleteFile(ctx *server.Context, p string) error {
+	return ErrReadOnly
+}
+
+func (driver *fsDriver) Rename(ctx *server.Context, fromPath string, toPath string) error {
+	return ErrReadOnly
+}
+
+func (driver *fsDriver) MakeDir(ctx *server.Context, p string) error {
+	return ErrReadOnly
+}
+
+func (driver *fsDriver) GetFile(ctx *server.Context, p string, offset int64) (int64, io.ReadCloser, error) {
+	f, err := driver.fsys.Open(fsName(p))
+	if err != nil {
+		return 0, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return 0, nil, err
+	}
+	if offset > 0 {
+		if seeker, ok := f.(io.Seeker); ok {
+			_, err = seeker.Seek(offset, io.SeekStart)
+		} else {
+			_, err = io.CopyN(ioutil.Discard, f, offset)
+		}
+		if err != nil {
+			f.Close()
+			return 0, nil, err
+		}
+	}
+	return info.Size() - offset, f, nil
+}
+
+func (driver *fsDriver) PutFile(ctx *server.Context, destPath string, data io.Reader, offset int64) (int64, error) {
+	return 0, ErrReadOnly
+}
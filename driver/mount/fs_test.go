@@ -0,0 +1,45 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16
+// +build go1.16
+
+package mount
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"goftp.io/server/v2"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFS(t *testing.T) {
+	driver := FS(fstest.MapFS{
+		"a.txt":     {Data: []byte("public")},
+		"dir/b.txt": {Data: []byte("b")},
+	})
+	ctx := &server.Context{}
+
+	assert.EqualValues(t, []string{"a.txt", "dir"}, listNames(t, driver, "/"))
+	assert.EqualValues(t, []string{"b.txt"}, listNames(t, driver, "/dir"))
+
+	info, err := driver.Stat(ctx, "/dir")
+	assert.NoError(t, err)
+	assert.True(t, info.IsDir())
+
+	size, r, err := driver.GetFile(ctx, "/a.txt", 3)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, size)
+	buf, err := ioutil.ReadAll(r)
+	r.Close()
+	assert.NoError(t, err)
+	assert.EqualValues(t, "lic", string(buf))
+
+	_, err = driver.PutFile(ctx, "/c.txt", strings.NewReader("c"), -1)
+	assert.Equal(t, ErrReadOnly, err)
+}
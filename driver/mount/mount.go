@@ -0,0 +1,352 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package mount combines multiple drivers in a single namespace, every
+// driver being mounted at a path prefix:
+//
+//	driver, err := mount.NewDriver(
+//		mount.Mount{Path: "/archive", Driver: minioDriver},
+//		mount.Mount{Path: "/inbox", Driver: fileDriver},
+//		mount.Mount{Path: "/public", Driver: mount.FS(os.DirFS("public"))},
+//	)
+//
+// The parents of the mount points are virtual directories which list the
+// mount points and could not be written.
+package mount
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"goftp.io/server/v2"
+)
+
+var (
+	_ server.Driver                = &Driver{}
+	_ server.ModTimeSetter         = &Driver{}
+	_ server.BackendsHealthChecker = &Driver{}
+	_ server.Perm                  = &perm{}
+)
+
+// The errors returned by the driver
+var (
+	ErrReadOnly        = errors.New("Read only file system")
+	ErrCrossMount      = errors.New("Rename across mount points is not supported")
+	ErrVirtualDir      = errors.New("Virtual directory could not be changed")
+	ErrNotSupported    = errors.New("Not supported")
+	ErrNoSuchFileOrDir = errors.New("No such file or directory")
+)
+
+// Mount represents a driver mounted at a path
+type Mount struct {
+	// The absolute path of the mount point, i.e. /archive
+	Path string
+
+	// The driver serving the files under the path, it receives the paths
+	// relative to the mount point
+	Driver server.Driver
+
+	// The perm of the files under the path used by Driver.Perm, if nil the
+	// fallback perm is used
+	Perm server.Perm
+
+	// Refuse all the changes of the files under the path
+	ReadOnly bool
+}
+
+// Driver implements server.Driver dispatching the requests to the mounted
+// drivers
+type Driver struct {
+	mounts []Mount // sorted by descending path length
+}
+
+// NewDriver creates a driver combining the mounts
+func NewDriver(mounts ...Mount) (*Driver, error) {
+	var seen = make(map[string]bool)
+	var sorted = make([]Mount, 0, len(mounts))
+	for _, m := range mounts {
+		if m.Driver == nil {
+			return nil, fmt.Errorf("mount %s has no driver", m.Path)
+		}
+		m.Path = path.Join("/", m.Path)
+		if seen[m.Path] {
+			return nil, fmt.Errorf("%s is mounted twice", m.Path)
+		}
+		seen[m.Path] = true
+		sorted = append(sorted, m)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i].Path) > len(sorted[j].Path)
+	})
+	return &Driver{mounts: sorted}, nil
+}
+
+// isUnder reports whether p is dir or below it
+func isUnder(p, dir string) bool {
+	return dir == "/" || p == dir || strings.HasPrefix(p, dir+"/")
+}
+
+// resolve returns the mount serving the path and the path relative to it,
+// nil if the path is not under any mount point
+func (driver *Driver) resolve(p string) (*Mount, string) {
+	p = path.Join("/", p)
+	for i := range driver.mounts {
+		m := &driver.mounts[i]
+		if isUnder(p, m.Path) {
+			return m, path.Join("/", strings.TrimPrefix(p, m.Path))
+		}
+	}
+	return nil, ""
+}
+
+// childMounts returns the names of the entries below the directory leading
+// to mount points, sorted
+func (driver *Driver) childMounts(dir string) []string {
+	dir = path.Join("/", dir)
+	var names []string
+	var seen = make(map[string]bool)
+	for _, m := range driver.mounts {
+		if m.Path == dir || !isUnder(m.Path, dir) {
+			continue
+		}
+		name := strings.SplitN(strings.TrimPrefix(strings.TrimPrefix(m.Path, dir), "/"), "/", 2)[0]
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// isMountPoint reports whether the path is a mount point or a parent of one
+func (driver *Driver) isMountPoint(p string) bool {
+	p = path.Join("/", p)
+	for _, m := range driver.mounts {
+		if isUnder(m.Path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+type virtualDir struct {
+	name string
+}
+
+func (v *virtualDir) Name() string       { return v.name }
+func (v *virtualDir) Size() int64        { return 0 }
+func (v *virtualDir) Mode() os.FileMode  { return os.ModeDir | 0555 }
+func (v *virtualDir) ModTime() time.Time { return time.Time{} }
+func (v *virtualDir) IsDir() bool        { return true }
+func (v *virtualDir) Sys() interface{}   { return nil }
+
+// Stat implements server.Driver
+func (driver *Driver) Stat(ctx *server.Context, p string) (os.FileInfo, error) {
+	m, rel := driver.resolve(p)
+	if m != nil {
+		info, err := m.Driver.Stat(ctx, rel)
+		if err == nil || !driver.isMountPoint(p) {
+			return info, err
+		}
+	}
+	if driver.isMountPoint(p) {
+		return &virtualDir{name: path.Base(p)}, nil
+	}
+	return nil, ErrNoSuchFileOrDir
+}
+
+// ListDir implements server.Driver
+func (driver *Driver) ListDir(ctx *server.Context, p string, callback func(os.FileInfo) error) error {
+	var listed = make(map[string]bool)
+	m, rel := driver.resolve(p)
+	if m != nil {
+		err := m.Driver.ListDir(ctx, rel, func(info os.FileInfo) error {
+			listed[info.Name()] = true
+			return callback(info)
+		})
+		if err != nil && !driver.isMountPoint(p) {
+			return err
+		}
+	} else if !driver.isMountPoint(p) {
+		return ErrNoSuchFileOrDir
+	}
+
+	for _, name := range driver.childMounts(p) {
+		if listed[name] {
+			continue
+		}
+		if err := callback(&virtualDir{name: name}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writable returns the mount serving the path if the path could be changed
+func (driver *Driver) writable(p string) (*Mount, string, error) {
+	m, rel := driver.resolve(p)
+	if m == nil {
+		return nil, "", ErrVirtualDir
+	}
+	if m.ReadOnly {
+		return nil, "", ErrReadOnly
+	}
+	return m, rel, nil
+}
+
+// DeleteDir implements server.Driver
+func (driver *Driver) DeleteDir(ctx *server.Context, p string) error {
+	if driver.isMountPoint(p) {
+		return ErrVirtualDir
+	}
+	m, rel, err := driver.writable(p)
+	if err != nil {
+		return err
+	}
+	return m.Driver.DeleteDir(ctx, rel)
+}
+
+// DeleteFile implements server.Driver
+func (driver *Driver) DeleteFile(ctx *server.Context, p string) error {
+	m, rel, err := driver.writable(p)
+	if err != nil {
+		return err
+	}
+	return m.Driver.DeleteFile(ctx, rel)
+}
+
+// Rename implements server.Driver, the paths have to be under the same mount
+// point. The directories moved across the mount points are copied by the
+// server.
+func (driver *Driver) Rename(ctx *server.Context, fromPath string, toPath string) error {
+	if driver.isMountPoint(fromPath) || driver.isMountPoint(toPath) {
+		return ErrVirtualDir
+	}
+	from, fromRel := driver.resolve(fromPath)
+	to, toRel := driver.resolve(toPath)
+	if from != nil && to != nil && from != to {
+		if info, err := from.Driver.Stat(ctx, fromRel); err == nil && info.IsDir() {
+			return server.ErrRenameNotSupported
+		}
+		return ErrCrossMount
+	}
+	if _, _, err := driver.writable(fromPath); err != nil {
+		return err
+	}
+	if _, _, err := driver.writable(toPath); err != nil {
+		return err
+	}
+	return from.Driver.Rename(ctx, fromRel, toRel)
+}
+
+// MakeDir implements server.Driver
+func (driver *Driver) MakeDir(ctx *server.Context, p string) error {
+	if driver.isMountPoint(p) {
+		return ErrVirtualDir
+	}
+	m, rel, err := driver.writable(p)
+	if err != nil {
+		return err
+	}
+	return m.Driver.MakeDir(ctx, rel)
+}
+
+// GetFile implements server.Driver
+func (driver *Driver) GetFile(ctx *server.Context, p string, offset int64) (int64, io.ReadCloser, error) {
+	m, rel := driver.resolve(p)
+	if m == nil {
+		return 0, nil, ErrNoSuchFileOrDir
+	}
+	return m.Driver.GetFile(ctx, rel, offset)
+}
+
+// PutFile implements server.Driver
+func (driver *Driver) PutFile(ctx *server.Context, destPath string, data io.Reader, offset int64) (int64, error) {
+	m, rel, err := driver.writable(destPath)
+	if err != nil {
+		return 0, err
+	}
+	return m.Driver.PutFile(ctx, rel, data, offset)
+}
+
+// SetModTime implements server.ModTimeSetter
+func (driver *Driver) SetModTime(ctx *server.Context, p string, mtime time.Time) error {
+	m, rel, err := driver.writable(p)
+	if err != nil {
+		return err
+	}
+	setter, ok := m.Driver.(server.ModTimeSetter)
+	if !ok {
+		return ErrNotSupported
+	}
+	return setter.SetModTime(ctx, rel, mtime)
+}
+
+// CheckBackends implements server.BackendsHealthChecker, the backends are
+// named after their mount points
+func (driver *Driver) CheckBackends(ctx context.Context) map[string]error {
+	var drivers = make(map[string]server.Driver, len(driver.mounts))
+	for _, m := range driver.mounts {
+		drivers[m.Path] = m.Driver
+	}
+	return server.CheckBackends(ctx, drivers)
+}
+
+// Perm returns a perm dispatching to the perms of the mounts, the fallback
+// perm is used for the virtual directories and the mounts without perm
+func (driver *Driver) Perm(fallback server.Perm) server.Perm {
+	return &perm{driver: driver, fallback: fallback}
+}
+
+// perm implements server.Perm for the mounts
+type perm struct {
+	driver   *Driver
+	fallback server.Perm
+}
+
+func (p *perm) resolve(name string) (server.Perm, string) {
+	m, rel := p.driver.resolve(name)
+	if m == nil || m.Perm == nil {
+		return p.fallback, name
+	}
+	return m.Perm, rel
+}
+
+func (p *perm) GetOwner(name string) (string, error) {
+	perm, rel := p.resolve(name)
+	return perm.GetOwner(rel)
+}
+
+func (p *perm) GetGroup(name string) (string, error) {
+	perm, rel := p.resolve(name)
+	return perm.GetGroup(rel)
+}
+
+func (p *perm) GetMode(name string) (os.FileMode, error) {
+	perm, rel := p.resolve(name)
+	return perm.GetMode(rel)
+}
+
+func (p *perm) ChOwner(name string, owner string) error {
+	perm, rel := p.resolve(name)
+	return perm.ChOwner(rel, owner)
+}
+
+func (p *perm) ChGroup(name string, group string) error {
+	perm, rel := p.resolve(name)
+	return perm.ChGroup(rel, group)
+}
+
+func (p *perm) ChMode(name string, mode os.FileMode) error {
+	perm, rel := p.resolve(name)
+	return perm.ChMode(rel, mode)
+}
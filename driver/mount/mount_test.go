@@ -0,0 +1,126 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package mount
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newFileDriver(t *testing.T) (server.Driver, func()) {
+	dir, err := ioutil.TempDir("", "mount")
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver, err := file.NewDriver(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return driver, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func listNames(t *testing.T, driver server.Driver, p string) []string {
+	var names []string
+	assert.NoError(t, driver.ListDir(&server.Context{}, p, func(info os.FileInfo) error {
+		names = append(names, info.Name())
+		return nil
+	}))
+	sort.Strings(names)
+	return names
+}
+
+func TestDriver(t *testing.T) {
+	inbox, cleanInbox := newFileDriver(t)
+	defer cleanInbox()
+	archive, cleanArchive := newFileDriver(t)
+	defer cleanArchive()
+
+	driver, err := NewDriver(
+		Mount{Path: "/inbox", Driver: inbox, Perm: server.NewSimplePerm("inbox", "inbox")},
+		Mount{Path: "/data/archive", Driver: archive, ReadOnly: true},
+	)
+	assert.NoError(t, err)
+	ctx := &server.Context{}
+
+	assert.EqualValues(t, []string{"data", "inbox"}, listNames(t, driver, "/"))
+	assert.EqualValues(t, []string{"archive"}, listNames(t, driver, "/data"))
+
+	info, err := driver.Stat(ctx, "/data")
+	assert.NoError(t, err)
+	assert.True(t, info.IsDir())
+	_, err = driver.Stat(ctx, "/missing")
+	assert.Error(t, err)
+
+	_, err = driver.PutFile(ctx, "/inbox/a.txt", strings.NewReader("inbox"), -1)
+	assert.NoError(t, err)
+	assert.EqualValues(t, []string{"a.txt"}, listNames(t, driver, "/inbox"))
+	_, err = inbox.Stat(ctx, "/a.txt")
+	assert.NoError(t, err)
+
+	// /inboxes is not under /inbox
+	_, err = driver.PutFile(ctx, "/inboxes/a.txt", strings.NewReader("inbox"), -1)
+	assert.Equal(t, ErrVirtualDir, err)
+
+	_, err = driver.PutFile(ctx, "/data/archive/a.txt", strings.NewReader("archive"), -1)
+	assert.Equal(t, ErrReadOnly, err)
+	assert.Equal(t, ErrCrossMount, driver.Rename(ctx, "/inbox/a.txt", "/data/archive/a.txt"))
+	assert.Equal(t, ErrVirtualDir, driver.Rename(ctx, "/inbox/a.txt", "/data/a.txt"))
+	assert.Equal(t, ErrVirtualDir, driver.DeleteDir(ctx, "/inbox"))
+	assert.Equal(t, ErrVirtualDir, driver.Rename(ctx, "/inbox", "/outbox"))
+	assert.NoError(t, driver.Rename(ctx, "/inbox/a.txt", "/inbox/b.txt"))
+
+	size, r, err := driver.GetFile(ctx, "/inbox/b.txt", 2)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, size)
+	buf, err := ioutil.ReadAll(r)
+	r.Close()
+	assert.NoError(t, err)
+	assert.EqualValues(t, "box", string(buf))
+
+	perm := driver.Perm(server.NewSimplePerm("root", "root"))
+	owner, err := perm.GetOwner("/inbox/b.txt")
+	assert.NoError(t, err)
+	assert.EqualValues(t, "inbox", owner)
+	owner, err = perm.GetOwner("/data/archive")
+	assert.NoError(t, err)
+	assert.EqualValues(t, "root", owner)
+
+	_, err = NewDriver(Mount{Path: "/a", Driver: inbox}, Mount{Path: "/a/", Driver: archive})
+	assert.Error(t, err)
+}
+
+func TestDriverHealth(t *testing.T) {
+	archive, closeArchive := newFileDriver(t)
+	defer closeArchive()
+	inbox, closeInbox := newFileDriver(t)
+
+	driver, err := NewDriver(
+		Mount{Path: "/archive", Driver: archive},
+		Mount{Path: "/inbox", Driver: inbox},
+	)
+	assert.NoError(t, err)
+
+	results := driver.CheckBackends(context.Background())
+	assert.Len(t, results, 2)
+	assert.NoError(t, results["/archive"])
+	assert.NoError(t, results["/inbox"])
+
+	// the storage of the inbox is gone
+	closeInbox()
+	results = driver.CheckBackends(context.Background())
+	assert.NoError(t, results["/archive"])
+	assert.Error(t, results["/inbox"])
+}
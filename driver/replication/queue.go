@@ -0,0 +1,173 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package replication
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The operations of the queued changes
+const (
+	opPut        = "put"
+	opDeleteFile = "delete-file"
+	opDeleteDir  = "delete-dir"
+	opRename     = "rename"
+	opMakeDir    = "mkdir"
+	opModTime    = "mtime"
+)
+
+// entry is a change waiting to be replicated
+type entry struct {
+	Seq     uint64    `json:"seq"`
+	Op      string    `json:"op"`
+	Path    string    `json:"path"`
+	To      string    `json:"to,omitempty"`       // the new path, for opRename
+	ModTime time.Time `json:"mod_time,omitempty"` // the time set, for opModTime
+	Queued  time.Time `json:"queued"`
+}
+
+// queue is a durable queue of changes, every entry is a file of the
+// directory named after its sequence number so the entries survive a restart
+type queue struct {
+	dir string
+
+	lock    sync.Mutex
+	next    uint64
+	pending []uint64 // the sequence numbers of the entries, in order
+	wake    chan struct{}
+}
+
+const entryExt = ".json"
+
+// openQueue opens the queue stored in dir, creating the directory if needed
+func openQueue(dir string) (*queue, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	q := &queue{
+		dir:  dir,
+		next: 1,
+		wake: make(chan struct{}, 1),
+	}
+	for _, info := range infos {
+		name := info.Name()
+		if strings.HasSuffix(name, ".tmp") {
+			// an entry which wasn't completely written
+			_ = os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, entryExt), 10, 64)
+		if err != nil || !strings.HasSuffix(name, entryExt) {
+			continue
+		}
+		q.pending = append(q.pending, seq)
+		if seq >= q.next {
+			q.next = seq + 1
+		}
+	}
+	sort.Slice(q.pending, func(i, j int) bool { return q.pending[i] < q.pending[j] })
+	return q, nil
+}
+
+func (q *queue) path(seq uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", seq, entryExt))
+}
+
+// push appends the entry to the queue once it's synced to the disk
+func (q *queue) push(e *entry) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	e.Seq = q.next
+	e.Queued = time.Now()
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	tmp := q.path(e.Seq) + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, q.path(e.Seq))
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	q.next++
+	q.pending = append(q.pending, e.Seq)
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// peek returns the sequence number and the first entry, 0 if the queue is
+// empty. The sequence number is returned with the errors so the unreadable
+// entries could be dropped.
+func (q *queue) peek() (uint64, *entry, error) {
+	q.lock.Lock()
+	if len(q.pending) == 0 {
+		q.lock.Unlock()
+		return 0, nil, nil
+	}
+	seq := q.pending[0]
+	q.lock.Unlock()
+
+	data, err := ioutil.ReadFile(q.path(seq))
+	if err != nil {
+		return seq, nil, err
+	}
+	var e entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return seq, nil, fmt.Errorf("entry %d: %v", seq, err)
+	}
+	e.Seq = seq
+	return seq, &e, nil
+}
+
+// pop removes the first entry
+func (q *queue) pop(seq uint64) error {
+	if err := os.Remove(q.path(seq)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if len(q.pending) > 0 && q.pending[0] == seq {
+		q.pending = q.pending[1:]
+	}
+	return nil
+}
+
+// len returns the number of the entries
+func (q *queue) len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.pending)
+}
@@ -0,0 +1,427 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package replication replicates the changes of a local driver to a remote
+// driver in the background, i.e. over a WAN:
+//
+//	driver, err := replication.NewDriver(&replication.Options{
+//		Local:    fileDriver,
+//		Remote:   minioDriver,
+//		QueueDir: "/var/lib/ftp/replication",
+//	})
+//	defer driver.Close()
+//
+// The requests are served by the local driver, the changes are recorded to
+// a durable queue before replying and replayed in order to the remote
+// driver, so they survive the restarts and the outages of the remote. A
+// change fails if it couldn't be queued as it would never be replicated. The
+// uploaded files are copied from the local driver when they are replayed.
+//
+// A change conflicts with the remote when the remote was changed by someone
+// else, i.e. the file to delete is already gone or the remote copy is newer
+// than the local one. The conflicts are logged and the local change wins
+// when it could still be applied.
+package replication
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"goftp.io/server/v2"
+)
+
+var (
+	_ server.Driver        = &Driver{}
+	_ server.ModTimeSetter = &Driver{}
+)
+
+// ErrNotSupported is returned by SetModTime if the local driver isn't a
+// server.ModTimeSetter
+var ErrNotSupported = errors.New("Not supported")
+
+const (
+	defaultRetryInterval    = time.Second
+	defaultMaxRetryInterval = time.Minute
+)
+
+// Options represents the options of the replication driver
+type Options struct {
+	Local  server.Driver
+	Remote server.Driver
+
+	// The directory of the queue of the changes waiting to be replicated
+	QueueDir string
+
+	// The delay before retrying a failed change, doubled with every failure
+	// up to MaxRetryInterval. The defaults are 1s and 1m if 0.
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+
+	// The number of attempts after which a failing change is dropped, 0
+	// means the changes are retried until they succeed. The changes are
+	// replayed in order, so a failing change delays the next ones.
+	MaxAttempts int
+
+	// Logger, if not nil, receives the conflicts and the failures, otherwise
+	// they are sent to the standard logger
+	Logger server.Logger
+}
+
+// Stats is the state of the replication
+type Stats struct {
+	Pending    int   // the changes waiting to be replicated
+	Replicated int64 // the changes replicated
+	Retries    int64 // the failed attempts
+	Conflicts  int64 // the changes conflicting with the remote
+	Dropped    int64 // the changes dropped after MaxAttempts
+}
+
+// Driver implements server.Driver serving the requests from the local
+// driver and replicating the changes to the remote driver
+type Driver struct {
+	local  server.Driver
+	remote server.Driver
+	queue  *queue
+	opts   Options
+
+	replicated int64
+	retries    int64
+	conflicts  int64
+	dropped    int64
+
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// NewDriver creates a replication driver, the changes left in the queue by
+// a previous driver are replayed first
+func NewDriver(opts *Options) (*Driver, error) {
+	q, err := openQueue(opts.QueueDir)
+	if err != nil {
+		return nil, err
+	}
+	driver := &Driver{
+		local:   opts.Local,
+		remote:  opts.Remote,
+		queue:   q,
+		opts:    *opts,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if driver.opts.RetryInterval <= 0 {
+		driver.opts.RetryInterval = defaultRetryInterval
+	}
+	if driver.opts.MaxRetryInterval <= 0 {
+		driver.opts.MaxRetryInterval = defaultMaxRetryInterval
+	}
+	go driver.run()
+	return driver, nil
+}
+
+// Close stops the replication, the pending changes stay in the queue
+func (driver *Driver) Close() error {
+	driver.once.Do(func() {
+		close(driver.done)
+		<-driver.stopped
+	})
+	return nil
+}
+
+// Stats returns the state of the replication
+func (driver *Driver) Stats() Stats {
+	return Stats{
+		Pending:    driver.queue.len(),
+		Replicated: atomic.LoadInt64(&driver.replicated),
+		Retries:    atomic.LoadInt64(&driver.retries),
+		Conflicts:  atomic.LoadInt64(&driver.conflicts),
+		Dropped:    atomic.LoadInt64(&driver.dropped),
+	}
+}
+
+func (driver *Driver) logf(level server.LogLevel, format string, v ...interface{}) {
+	switch logger := driver.opts.Logger.(type) {
+	case nil:
+		log.Printf(format, v...)
+	case server.LeveledLogger:
+		if level == server.LevelError {
+			logger.Error("", format, v...)
+		} else {
+			logger.Warn("", format, v...)
+		}
+	default:
+		logger.Printf("", format, v...)
+	}
+}
+
+// conflictf logs a conflict with the remote
+func (driver *Driver) conflictf(e *entry, format string, v ...interface{}) {
+	atomic.AddInt64(&driver.conflicts, 1)
+	driver.logf(server.LevelWarn, "replication conflict of %s %s: "+format, append([]interface{}{e.Op, e.Path}, v...)...)
+}
+
+// sleep waits for d, it returns false if the driver is closed meanwhile
+func (driver *Driver) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-driver.done:
+		return false
+	}
+}
+
+// run replays the queued changes until the driver is closed
+func (driver *Driver) run() {
+	defer close(driver.stopped)
+	var (
+		attempts int
+		delay    = driver.opts.RetryInterval
+	)
+	for {
+		select {
+		case <-driver.done:
+			return
+		default:
+		}
+
+		seq, e, err := driver.queue.peek()
+		if err != nil {
+			// the entry is corrupted, it could never be replayed
+			driver.logf(server.LevelError, "replication queue: dropping %v", err)
+			atomic.AddInt64(&driver.dropped, 1)
+			if err := driver.queue.pop(seq); err != nil {
+				driver.logf(server.LevelError, "replication queue: %v", err)
+				return
+			}
+			continue
+		}
+		if seq == 0 {
+			select {
+			case <-driver.queue.wake:
+			case <-driver.done:
+				return
+			}
+			continue
+		}
+
+		if err := driver.replay(e); err != nil {
+			attempts++
+			atomic.AddInt64(&driver.retries, 1)
+			if driver.opts.MaxAttempts > 0 && attempts >= driver.opts.MaxAttempts {
+				driver.logf(server.LevelError, "replication of %s %s dropped after %d attempts: %v", e.Op, e.Path, attempts, err)
+				atomic.AddInt64(&driver.dropped, 1)
+			} else {
+				driver.logf(server.LevelWarn, "replication of %s %s failed, retrying in %v: %v", e.Op, e.Path, delay, err)
+				if !driver.sleep(delay) {
+					return
+				}
+				if delay *= 2; delay > driver.opts.MaxRetryInterval {
+					delay = driver.opts.MaxRetryInterval
+				}
+				continue
+			}
+		} else {
+			atomic.AddInt64(&driver.replicated, 1)
+		}
+		attempts, delay = 0, driver.opts.RetryInterval
+		if err := driver.queue.pop(e.Seq); err != nil {
+			driver.logf(server.LevelError, "replication queue: %v", err)
+		}
+	}
+}
+
+// replay applies the change to the remote, the conflicts are not errors
+func (driver *Driver) replay(e *entry) error {
+	ctx := &server.Context{Data: make(map[string]interface{})}
+	switch e.Op {
+	case opPut:
+		return driver.copyFile(ctx, e, e.Path)
+	case opDeleteFile, opDeleteDir:
+		var err error
+		if e.Op == opDeleteFile {
+			err = driver.remote.DeleteFile(ctx, e.Path)
+		} else {
+			err = driver.remote.DeleteDir(ctx, e.Path)
+		}
+		if err != nil && driver.remoteMissing(ctx, e.Path) {
+			driver.conflictf(e, "already deleted")
+			return nil
+		}
+		return err
+	case opRename:
+		err := driver.remote.Rename(ctx, e.Path, e.To)
+		if err != nil && driver.remoteMissing(ctx, e.Path) {
+			driver.conflictf(e, "the remote file is missing, copying %s", e.To)
+			return driver.copyFile(ctx, e, e.To)
+		}
+		if err == nil && driver.changedSince(ctx, e.To) {
+			// the uploads of the file replayed after it was renamed locally
+			// were skipped, so the remote copy is stale
+			return driver.copyFile(ctx, e, e.To)
+		}
+		return err
+	case opMakeDir:
+		err := driver.remote.MakeDir(ctx, e.Path)
+		if err != nil {
+			if info, serr := driver.remote.Stat(ctx, e.Path); serr == nil && info.IsDir() {
+				return nil
+			}
+		}
+		return err
+	case opModTime:
+		if setter, ok := driver.remote.(server.ModTimeSetter); ok {
+			return setter.SetModTime(ctx, e.Path, e.ModTime)
+		}
+		return nil
+	}
+	driver.logf(server.LevelError, "replication of unknown change %s %s dropped", e.Op, e.Path)
+	return nil
+}
+
+// remoteMissing tells if the file or the directory is missing from the
+// remote
+func (driver *Driver) remoteMissing(ctx *server.Context, p string) bool {
+	_, err := driver.remote.Stat(ctx, p)
+	return os.IsNotExist(err)
+}
+
+// changedSince tells if the local file differs from the remote copy, the
+// directories are never reported as changed. The modification times are
+// compared at the precision of the remote, which could be coarser.
+func (driver *Driver) changedSince(ctx *server.Context, p string) bool {
+	local, err := driver.local.Stat(ctx, p)
+	if err != nil || local.IsDir() {
+		return false
+	}
+	remote, err := driver.remote.Stat(ctx, p)
+	if err != nil {
+		return false
+	}
+	if local.Size() != remote.Size() {
+		return true
+	}
+	_, canSetModTime := driver.remote.(server.ModTimeSetter)
+	return canSetModTime &&
+		!local.ModTime().Truncate(modTimePrecision(remote.ModTime())).Equal(remote.ModTime())
+}
+
+// modTimePrecision guesses the precision of the modification times of a
+// driver from one of them, i.e. a second for a remote with no sub-second
+// times
+func modTimePrecision(t time.Time) time.Duration {
+	for _, d := range []time.Duration{time.Second, time.Millisecond, time.Microsecond} {
+		if t.Truncate(d).Equal(t) {
+			return d
+		}
+	}
+	return time.Nanosecond
+}
+
+// copyFile copies a file from the local driver to the remote, the remote
+// copy gets the modification time of the local one if the remote is a
+// server.ModTimeSetter
+func (driver *Driver) copyFile(ctx *server.Context, e *entry, p string) error {
+	info, err := driver.local.Stat(ctx, p)
+	if os.IsNotExist(err) {
+		// deleted or renamed since, it's replayed by the next changes
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	setter, canSetModTime := driver.remote.(server.ModTimeSetter)
+	if canSetModTime {
+		if remote, err := driver.remote.Stat(ctx, p); err == nil && remote.ModTime().After(info.ModTime()) {
+			driver.conflictf(e, "the remote file is newer, overwriting it")
+		}
+	}
+
+	_, r, err := driver.local.GetFile(ctx, p, 0)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if _, err := driver.remote.PutFile(ctx, p, r, -1); err != nil {
+		return err
+	}
+	if canSetModTime {
+		return setter.SetModTime(ctx, p, info.ModTime())
+	}
+	return nil
+}
+
+// Stat implements server.Driver
+func (driver *Driver) Stat(ctx *server.Context, p string) (os.FileInfo, error) {
+	return driver.local.Stat(ctx, p)
+}
+
+// ListDir implements server.Driver
+func (driver *Driver) ListDir(ctx *server.Context, p string, callback func(os.FileInfo) error) error {
+	return driver.local.ListDir(ctx, p, callback)
+}
+
+// GetFile implements server.Driver
+func (driver *Driver) GetFile(ctx *server.Context, p string, offset int64) (int64, io.ReadCloser, error) {
+	return driver.local.GetFile(ctx, p, offset)
+}
+
+// DeleteDir implements server.Driver
+func (driver *Driver) DeleteDir(ctx *server.Context, p string) error {
+	if err := driver.local.DeleteDir(ctx, p); err != nil {
+		return err
+	}
+	return driver.queue.push(&entry{Op: opDeleteDir, Path: p})
+}
+
+// DeleteFile implements server.Driver
+func (driver *Driver) DeleteFile(ctx *server.Context, p string) error {
+	if err := driver.local.DeleteFile(ctx, p); err != nil {
+		return err
+	}
+	return driver.queue.push(&entry{Op: opDeleteFile, Path: p})
+}
+
+// Rename implements server.Driver
+func (driver *Driver) Rename(ctx *server.Context, fromPath string, toPath string) error {
+	if err := driver.local.Rename(ctx, fromPath, toPath); err != nil {
+		return err
+	}
+	return driver.queue.push(&entry{Op: opRename, Path: fromPath, To: toPath})
+}
+
+// MakeDir implements server.Driver
+func (driver *Driver) MakeDir(ctx *server.Context, p string) error {
+	if err := driver.local.MakeDir(ctx, p); err != nil {
+		return err
+	}
+	return driver.queue.push(&entry{Op: opMakeDir, Path: p})
+}
+
+// PutFile implements server.Driver
+func (driver *Driver) PutFile(ctx *server.Context, destPath string, data io.Reader, offset int64) (int64, error) {
+	size, err := driver.local.PutFile(ctx, destPath, data, offset)
+	if err != nil {
+		return size, err
+	}
+	return size, driver.queue.push(&entry{Op: opPut, Path: destPath})
+}
+
+// SetModTime implements server.ModTimeSetter
+func (driver *Driver) SetModTime(ctx *server.Context, p string, mtime time.Time) error {
+	setter, ok := driver.local.(server.ModTimeSetter)
+	if !ok {
+		return ErrNotSupported
+	}
+	if err := setter.SetModTime(ctx, p, mtime); err != nil {
+		return err
+	}
+	return driver.queue.push(&entry{Op: opModTime, Path: p, ModTime: mtime})
+}
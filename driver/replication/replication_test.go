@@ -0,0 +1,244 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package replication
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newFileDriver(t *testing.T, dir string) server.Driver {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	driver, err := file.NewDriver(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return driver
+}
+
+func readFile(t *testing.T, driver server.Driver, p string) string {
+	_, r, err := driver.GetFile(&server.Context{}, p, 0)
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	defer r.Close()
+	buf, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	return string(buf)
+}
+
+// waitReplicated waits until the queue is empty
+func waitReplicated(t *testing.T, driver *Driver) {
+	for start := time.Now(); driver.Stats().Pending > 0; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("%d changes are still pending", driver.Stats().Pending)
+		}
+	}
+}
+
+// offlineDriver fails the uploads while offline is set
+type offlineDriver struct {
+	server.Driver
+	offline int32
+}
+
+func (driver *offlineDriver) PutFile(ctx *server.Context, p string, data io.Reader, offset int64) (int64, error) {
+	if atomic.LoadInt32(&driver.offline) != 0 {
+		return 0, errors.New("offline")
+	}
+	return driver.Driver.PutFile(ctx, p, data, offset)
+}
+
+// coarseDriver keeps the modification times to the second, it fails the
+// uploads while offline is set
+type coarseDriver struct {
+	server.Driver
+	offline int32
+	puts    int32
+}
+
+type coarseInfo struct {
+	os.FileInfo
+}
+
+func (info coarseInfo) ModTime() time.Time {
+	return info.FileInfo.ModTime().Truncate(time.Second)
+}
+
+func (driver *coarseDriver) Stat(ctx *server.Context, p string) (os.FileInfo, error) {
+	info, err := driver.Driver.Stat(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return coarseInfo{info}, nil
+}
+
+func (driver *coarseDriver) PutFile(ctx *server.Context, p string, data io.Reader, offset int64) (int64, error) {
+	if atomic.LoadInt32(&driver.offline) != 0 {
+		return 0, errors.New("offline")
+	}
+	atomic.AddInt32(&driver.puts, 1)
+	return driver.Driver.PutFile(ctx, p, data, offset)
+}
+
+func (driver *coarseDriver) SetModTime(ctx *server.Context, p string, mtime time.Time) error {
+	return driver.Driver.(server.ModTimeSetter).SetModTime(ctx, p, mtime.Truncate(time.Second))
+}
+
+func TestDriver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replication")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	local := newFileDriver(t, filepath.Join(dir, "local"))
+	remote := newFileDriver(t, filepath.Join(dir, "remote"))
+
+	driver, err := NewDriver(&Options{
+		Local:         local,
+		Remote:        remote,
+		QueueDir:      filepath.Join(dir, "queue"),
+		RetryInterval: 10 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	defer driver.Close()
+	ctx := &server.Context{}
+
+	assert.NoError(t, driver.MakeDir(ctx, "/dir"))
+	_, err = driver.PutFile(ctx, "/dir/a.txt", strings.NewReader("hello"), -1)
+	assert.NoError(t, err)
+	_, err = driver.PutFile(ctx, "/dir/a.txt", strings.NewReader(" world"), 5)
+	assert.NoError(t, err)
+	assert.NoError(t, driver.Rename(ctx, "/dir/a.txt", "/dir/b.txt"))
+	_, err = driver.PutFile(ctx, "/c.txt", strings.NewReader("removed"), -1)
+	assert.NoError(t, err)
+	assert.NoError(t, driver.DeleteFile(ctx, "/c.txt"))
+	waitReplicated(t, driver)
+
+	assert.EqualValues(t, "hello world", readFile(t, remote, "/dir/b.txt"))
+	_, err = remote.Stat(ctx, "/dir/a.txt")
+	assert.True(t, os.IsNotExist(err))
+	_, err = remote.Stat(ctx, "/c.txt")
+	assert.True(t, os.IsNotExist(err))
+	localInfo, err := local.Stat(ctx, "/dir/b.txt")
+	assert.NoError(t, err)
+	remoteInfo, err := remote.Stat(ctx, "/dir/b.txt")
+	assert.NoError(t, err)
+	assert.EqualValues(t, localInfo.ModTime(), remoteInfo.ModTime())
+
+	// the remote copy was changed by someone else
+	conflicts := driver.Stats().Conflicts
+	_, err = remote.PutFile(ctx, "/dir/b.txt", strings.NewReader("changed"), -1)
+	assert.NoError(t, err)
+	assert.NoError(t, remote.(server.ModTimeSetter).SetModTime(ctx, "/dir/b.txt", time.Now().Add(time.Hour)))
+	_, err = driver.PutFile(ctx, "/dir/b.txt", strings.NewReader("!"), 11)
+	assert.NoError(t, err)
+	waitReplicated(t, driver)
+	assert.EqualValues(t, "hello world!", readFile(t, remote, "/dir/b.txt"))
+	assert.EqualValues(t, conflicts+1, driver.Stats().Conflicts)
+}
+
+func TestDriverRenameCoarse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replication")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	local := newFileDriver(t, filepath.Join(dir, "local"))
+	remote := &coarseDriver{Driver: newFileDriver(t, filepath.Join(dir, "remote"))}
+
+	driver, err := NewDriver(&Options{
+		Local:         local,
+		Remote:        remote,
+		QueueDir:      filepath.Join(dir, "queue"),
+		RetryInterval: 10 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	defer driver.Close()
+	ctx := &server.Context{}
+
+	_, err = driver.PutFile(ctx, "/a.txt", strings.NewReader("hello"), -1)
+	assert.NoError(t, err)
+	assert.NoError(t, driver.SetModTime(ctx, "/a.txt", time.Date(2020, 1, 2, 3, 4, 5, 6000, time.UTC)))
+	waitReplicated(t, driver)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&remote.puts))
+
+	// the remote copy is up to date at the second, it's not copied again
+	assert.NoError(t, driver.Rename(ctx, "/a.txt", "/b.txt"))
+	waitReplicated(t, driver)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&remote.puts))
+
+	// the upload is skipped since the file is renamed when it's replayed,
+	// the rename recopies it
+	atomic.StoreInt32(&remote.offline, 1)
+	_, err = driver.PutFile(ctx, "/b.txt", strings.NewReader("world"), -1)
+	assert.NoError(t, err)
+	assert.NoError(t, local.(server.ModTimeSetter).SetModTime(ctx, "/b.txt", time.Date(2020, 1, 2, 3, 4, 6, 0, time.UTC)))
+	assert.NoError(t, driver.Rename(ctx, "/b.txt", "/c.txt"))
+	atomic.StoreInt32(&remote.offline, 0)
+	waitReplicated(t, driver)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&remote.puts))
+	assert.EqualValues(t, "world", readFile(t, remote, "/c.txt"))
+}
+
+func TestDriverRetry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replication")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	local := newFileDriver(t, filepath.Join(dir, "local"))
+	remote := &offlineDriver{Driver: newFileDriver(t, filepath.Join(dir, "remote")), offline: 1}
+	opts := &Options{
+		Local:         local,
+		Remote:        remote,
+		QueueDir:      filepath.Join(dir, "queue"),
+		RetryInterval: 10 * time.Millisecond,
+	}
+
+	driver, err := NewDriver(opts)
+	assert.NoError(t, err)
+	ctx := &server.Context{}
+	_, err = driver.PutFile(ctx, "/a.txt", strings.NewReader("hello"), -1)
+	assert.NoError(t, err)
+	_, err = driver.PutFile(ctx, "/b.txt", strings.NewReader("world"), -1)
+	assert.NoError(t, err)
+	for start := time.Now(); driver.Stats().Retries < 2; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("the upload was not retried")
+		}
+	}
+	assert.NoError(t, driver.Close())
+	assert.EqualValues(t, 2, driver.Stats().Pending)
+
+	// the queue survives the restart
+	atomic.StoreInt32(&remote.offline, 0)
+	driver, err = NewDriver(opts)
+	assert.NoError(t, err)
+	defer driver.Close()
+	waitReplicated(t, driver)
+	assert.EqualValues(t, "hello", readFile(t, remote, "/a.txt"))
+	assert.EqualValues(t, "world", readFile(t, remote, "/b.txt"))
+
+	// the changes are dropped after MaxAttempts
+	assert.NoError(t, driver.Close())
+	atomic.StoreInt32(&remote.offline, 1)
+	opts.MaxAttempts = 2
+	driver, err = NewDriver(opts)
+	assert.NoError(t, err)
+	defer driver.Close()
+	_, err = driver.PutFile(ctx, "/c.txt", strings.NewReader("lost"), -1)
+	assert.NoError(t, err)
+	waitReplicated(t, driver)
+	assert.EqualValues(t, 1, driver.Stats().Dropped)
+}
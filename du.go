@@ -0,0 +1,171 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// DirSize represents how the recursive sizes of the directories reported by
+// SITE DU are computed. If Options.DirSize is not nil SIZE reports them for
+// directories too.
+type DirSize struct {
+	// The maximum number of entries walked, if 0 it's 100,000. Larger
+	// directories are refused so clients could not overload the driver.
+	MaxEntries int
+
+	// The duration the sizes are cached for, 0 means no caching. The cached
+	// sizes don't reflect the changes made meanwhile.
+	CacheTTL time.Duration
+}
+
+const defaultDirSizeMaxEntries = 100000
+
+var errTooManyEntries = errors.New("Too many entries to compute the size")
+
+func (dirSize *DirSize) maxEntries() int {
+	if dirSize == nil || dirSize.MaxEntries <= 0 {
+		return defaultDirSizeMaxEntries
+	}
+	return dirSize.MaxEntries
+}
+
+// dirUsage represents the recursive size of a directory
+type dirUsage struct {
+	bytes   int64
+	files   int64
+	created time.Time
+}
+
+// dirUsageCache caches the sizes per user and path
+type dirUsageCache struct {
+	lock    sync.Mutex
+	entries map[string]dirUsage
+}
+
+func (cache *dirUsageCache) get(key string, ttl time.Duration) (dirUsage, bool) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	usage, ok := cache.entries[key]
+	if !ok || time.Since(usage.created) > ttl {
+		delete(cache.entries, key)
+		return dirUsage{}, false
+	}
+	return usage, true
+}
+
+func (cache *dirUsageCache) put(key string, usage dirUsage, ttl time.Duration) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	if cache.entries == nil {
+		cache.entries = make(map[string]dirUsage)
+	}
+	// drop the expired entries so the cache doesn't grow forever
+	for k, v := range cache.entries {
+		if time.Since(v.created) > ttl {
+			delete(cache.entries, k)
+		}
+	}
+	cache.entries[key] = usage
+}
+
+// dirUsage returns the recursive size of the directory
+func (sess *Session) dirUsage(ctx *Context, p string) (dirUsage, error) {
+	dirSize := sess.server.DirSize
+	var ttl time.Duration
+	if dirSize != nil {
+		ttl = dirSize.CacheTTL
+	}
+	key := sess.LoginUser() + ":" + p
+	if ttl > 0 {
+		if usage, ok := sess.server.dirUsages.get(key, ttl); ok {
+			return usage, nil
+		}
+	}
+
+	var (
+		usage   dirUsage
+		entries int
+		walk    func(dir string) error
+	)
+	walk = func(dir string) error {
+		var dirs []string
+		err := sess.server.Driver.ListDir(ctx, dir, func(info os.FileInfo) error {
+			entries++
+			if entries > dirSize.maxEntries() {
+				return errTooManyEntries
+			}
+			if info.IsDir() {
+				dirs = append(dirs, path.Join(dir, info.Name()))
+			} else {
+				usage.bytes += info.Size()
+				usage.files++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, sub := range dirs {
+			if err := walk(sub); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(p); err != nil {
+		return dirUsage{}, err
+	}
+
+	usage.created = time.Now()
+	if ttl > 0 {
+		sess.server.dirUsages.put(key, usage, ttl)
+	}
+	return usage, nil
+}
+
+// siteDu responds to the SITE DU command. It reports the recursive size of
+// a directory, the current one if no path is given.
+type siteDu struct{}
+
+func (cmd siteDu) RequireParam() bool {
+	return false
+}
+
+func (cmd siteDu) Execute(sess *Session, param string) {
+	p := sess.buildPath(param)
+	if !sess.checkWriteOnly(p) || !sess.checkTrash(p) {
+		return
+	}
+	ctx := &Context{
+		Sess:  sess,
+		Cmd:   "SITE DU",
+		Param: param,
+		Data:  make(map[string]interface{}),
+	}
+	info, err := sess.server.Driver.Stat(ctx, p)
+	if err != nil {
+		sess.logf("%v", err)
+		sess.writeMessage(550, fmt.Sprint("Action not taken: ", err))
+		return
+	}
+	if !info.IsDir() {
+		sess.writeMessage(200, fmt.Sprintf("%d bytes in 1 files: %s", info.Size(), p))
+		return
+	}
+
+	usage, err := sess.dirUsage(ctx, p)
+	if err != nil {
+		sess.logf("%v", err)
+		sess.writeMessage(550, fmt.Sprint("Action not taken: ", err))
+		return
+	}
+	sess.writeMessage(200, fmt.Sprintf("%d bytes in %d files: %s", usage.bytes, usage.files, p))
+}
@@ -0,0 +1,106 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// isIPv6 returns whether the control connection uses IPv6, the IPv4 clients
+// of a dual stack listener don't
+func (sess *Session) isIPv6() bool {
+	if sess.conn == nil {
+		return false
+	}
+	local, ok := sess.conn.LocalAddr().(*net.TCPAddr)
+	return ok && local.IP.To4() == nil
+}
+
+// passivePorts returns the passive port range of the family of the control
+// connection
+func (sess *Session) passivePorts() string {
+	if sess.isIPv6() && sess.server.PassivePortsIPv6 != "" {
+		return sess.server.PassivePortsIPv6
+	}
+	return sess.server.PassivePorts
+}
+
+var errListenerClosed = errors.New("use of closed network connection")
+
+// multiListener accepts the connections of several listeners, i.e. an IPv4
+// and an IPv6 one
+type multiListener struct {
+	listeners []net.Listener
+	conns     chan net.Conn
+	errs      chan error
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newMultiListener(listeners []net.Listener) *multiListener {
+	var l = &multiListener{
+		listeners: listeners,
+		conns:     make(chan net.Conn),
+		errs:      make(chan error),
+		closed:    make(chan struct{}),
+	}
+	for _, listener := range listeners {
+		go l.accept(listener)
+	}
+	return l
+}
+
+func (l *multiListener) accept(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case l.errs <- err:
+			case <-l.closed:
+				return
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+		select {
+		case l.conns <- conn:
+		case <-l.closed:
+			conn.Close()
+			return
+		}
+	}
+}
+
+func (l *multiListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.closed:
+		return nil, errListenerClosed
+	}
+}
+
+func (l *multiListener) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.closed)
+		for _, listener := range l.listeners {
+			if cerr := listener.Close(); err == nil {
+				err = cerr
+			}
+		}
+	})
+	return err
+}
+
+func (l *multiListener) Addr() net.Addr {
+	return l.listeners[0].Addr()
+}
@@ -0,0 +1,115 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import "strings"
+
+// Features represents the protocol capabilities of the server which could
+// be enabled or disabled individually, disabled commands are answered as
+// not implemented and are not advertised by FEAT.
+type Features struct {
+	// Allow compressed transfers via MODE Z
+	ModeZ bool
+
+	// Allow data connections from or to another host than the client, which
+	// is required by server to server transfers (FXP)
+	FXP bool
+
+	// Allow the SITE command and its sub commands
+	Site bool
+
+	// Allow the HASH command to compute checksums of files
+	Hash bool
+
+	// Allow the APPE command to append data to files
+	Append bool
+
+	// Allow anonymous logins with the user anonymous or ftp and any password
+	Anonymous bool
+
+	// Allow the anonymous users to change the files, they could only read
+	// them otherwise
+	AnonymousWrite bool
+}
+
+// DefaultFeatures returns the features used when Options.Features is nil,
+// all the capabilities but anonymous logins are enabled
+func DefaultFeatures() *Features {
+	return &Features{
+		ModeZ:  true,
+		FXP:    true,
+		Site:   true,
+		Hash:   true,
+		Append: true,
+	}
+}
+
+// enabledCommands returns the commands which are not disabled by the features
+func (features *Features) enabledCommands(commands map[string]Command) map[string]Command {
+	var disabled = make(map[string]bool)
+	if !features.Site {
+		disabled["SITE"] = true
+	}
+	if !features.Hash {
+		disabled["HASH"] = true
+	}
+	if !features.Append {
+		disabled["APPE"] = true
+	}
+
+	var enabled = make(map[string]Command, len(commands))
+	for name, cmd := range commands {
+		if !disabled[name] {
+			enabled[name] = cmd
+		}
+	}
+	return enabled
+}
+
+func isAnonymousUser(user string) bool {
+	return user == "anonymous" || user == "ftp"
+}
+
+// writeCommands are the commands changing the files, the SITE commands
+// change them if their sub command does
+var writeCommands = map[string]func(param string) bool{
+	"STOR": nil,
+	"APPE": nil,
+	"MKD":  nil,
+	"XMKD": nil,
+	"DELE": nil,
+	"RMD":  nil,
+	"XRMD": nil,
+	"RNFR": nil,
+	"RNTO": nil,
+	"SITE": isSiteWrite,
+}
+
+// isSiteWrite reports whether the SITE sub command changes the files
+func isSiteWrite(param string) bool {
+	fields := strings.Fields(strings.ToUpper(param))
+	if len(fields) == 0 {
+		return false
+	}
+	switch fields[0] {
+	case "RMDIR", "SYMLINK", "UNDELETE", "UTIME":
+		return true
+	case "VERSIONS":
+		return len(fields) > 1 && fields[1] == "RESTORE"
+	}
+	return false
+}
+
+// isReadOnly reports whether the session could only read the files, i.e.
+// an anonymous login unless Features.AnonymousWrite is set
+func (sess *Session) isReadOnly() bool {
+	return sess.anonymous && !sess.server.Features.AnonymousWrite
+}
+
+// isWriteCommand reports whether the command changes the files
+func isWriteCommand(cmd, param string) bool {
+	isWrite, ok := writeCommands[cmd]
+	return ok && (isWrite == nil || isWrite(param))
+}
@@ -9,9 +9,10 @@ import "os"
 type fileInfo struct {
 	os.FileInfo
 
-	mode  os.FileMode
-	owner string
-	group string
+	mode   os.FileMode
+	owner  string
+	group  string
+	target string // the target of a link, if known
 }
 
 func (f *fileInfo) Mode() os.FileMode {
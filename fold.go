@@ -0,0 +1,238 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// UnicodeNormalization represents the Unicode normalization form the file
+// names are converted to before calling the driver. Clients on macOS upload
+// decomposed (NFD) names while most of the others expect composed (NFC)
+// ones.
+type UnicodeNormalization int
+
+// The supported normalization forms
+const (
+	NormalizeNone UnicodeNormalization = iota
+	NormalizeNFC
+	NormalizeNFD
+)
+
+func (normalization UnicodeNormalization) form() norm.Form {
+	if normalization == NormalizeNFD {
+		return norm.NFD
+	}
+	return norm.NFC
+}
+
+// maxFoldIndexes is the number of directories whose index is kept
+const maxFoldIndexes = 1024
+
+// foldNames wraps the driver so that the created files are named in the
+// normalization form and the existing files are found whatever the form, or
+// the case if caseInsensitive, of their names and of the requested paths.
+func foldNames(driver Driver, normalization UnicodeNormalization, caseInsensitive bool) Driver {
+	if normalization == NormalizeNone && !caseInsensitive {
+		return driver
+	}
+	folded := &foldDriver{
+		Driver:  driver,
+		create:  func(name string) string { return name },
+		indexes: make(map[string]map[string]string),
+	}
+	if normalization != NormalizeNone {
+		folded.create = normalization.form().String
+	}
+	folded.fold = folded.create
+	if caseInsensitive {
+		folded.fold = func(name string) string {
+			return strings.ToLower(folded.create(name))
+		}
+	}
+	// keep the driver authentication
+	if auth, ok := driver.(Auth); ok {
+		return &foldAuthDriver{foldDriver: folded, Auth: auth}
+	}
+	return folded
+}
+
+var (
+	_ Driver        = &foldDriver{}
+	_ ModTimeSetter = &foldDriver{}
+	_ Versioner     = &foldDriver{}
+)
+
+type foldDriver struct {
+	Driver
+	// the name of the created files
+	create func(string) string
+	// the names of the files are equal if they are once folded
+	fold func(string) string
+
+	lock sync.Mutex
+	// the folded names of the directories entries to their names
+	indexes map[string]map[string]string
+}
+
+func (driver *foldDriver) unwrap() Driver {
+	return driver.Driver
+}
+
+type foldAuthDriver struct {
+	*foldDriver
+	Auth
+}
+
+// resolve returns the path of the existing file p refers to, or the path to
+// create if there is none
+func (driver *foldDriver) resolve(ctx *Context, p string) string {
+	p = driver.create(path.Join("/", p))
+	if _, err := driver.Driver.Stat(ctx, p); err == nil || p == "/" {
+		return p
+	}
+
+	var (
+		resolved = "/"
+		parts    = strings.Split(strings.TrimPrefix(p, "/"), "/")
+	)
+	for i, part := range parts {
+		name, found := driver.findName(ctx, resolved, part)
+		if !found {
+			return path.Join(resolved, strings.Join(parts[i:], "/"))
+		}
+		resolved = path.Join(resolved, name)
+	}
+	return resolved
+}
+
+// findName returns the name of the entry of the directory which equals the
+// name once folded
+func (driver *foldDriver) findName(ctx *Context, dir, name string) (string, bool) {
+	key := driver.fold(name)
+	driver.lock.Lock()
+	found, ok := driver.indexes[dir][key]
+	driver.lock.Unlock()
+	if ok {
+		return found, true
+	}
+
+	// the index may be out of date, i.e. if the files were changed by
+	// another program, so it's rebuilt
+	var index = make(map[string]string)
+	err := driver.Driver.ListDir(ctx, dir, func(info os.FileInfo) error {
+		index[driver.fold(info.Name())] = info.Name()
+		return nil
+	})
+	if err != nil {
+		return "", false
+	}
+	driver.lock.Lock()
+	if len(driver.indexes) >= maxFoldIndexes {
+		driver.indexes = make(map[string]map[string]string)
+	}
+	driver.indexes[dir] = index
+	driver.lock.Unlock()
+
+	found, ok = index[key]
+	return found, ok
+}
+
+// invalidate drops the indexes of the parent directory of p and of the
+// directories under p
+func (driver *foldDriver) invalidate(p string) {
+	driver.lock.Lock()
+	defer driver.lock.Unlock()
+	delete(driver.indexes, path.Dir(p))
+	for dir := range driver.indexes {
+		if isUnderPath(dir, p) {
+			delete(driver.indexes, dir)
+		}
+	}
+}
+
+func (driver *foldDriver) Stat(ctx *Context, p string) (os.FileInfo, error) {
+	return driver.Driver.Stat(ctx, driver.resolve(ctx, p))
+}
+
+func (driver *foldDriver) ListDir(ctx *Context, p string, callback func(os.FileInfo) error) error {
+	return driver.Driver.ListDir(ctx, driver.resolve(ctx, p), callback)
+}
+
+func (driver *foldDriver) DeleteDir(ctx *Context, p string) error {
+	p = driver.resolve(ctx, p)
+	defer driver.invalidate(p)
+	return driver.Driver.DeleteDir(ctx, p)
+}
+
+func (driver *foldDriver) DeleteFile(ctx *Context, p string) error {
+	p = driver.resolve(ctx, p)
+	defer driver.invalidate(p)
+	return driver.Driver.DeleteFile(ctx, p)
+}
+
+func (driver *foldDriver) Rename(ctx *Context, fromPath string, toPath string) error {
+	fromPath = driver.resolve(ctx, fromPath)
+	toDir := driver.resolve(ctx, path.Dir(path.Join("/", toPath)))
+	if toDir == path.Dir(fromPath) && driver.fold(path.Base(toPath)) == driver.fold(path.Base(fromPath)) {
+		// changing the case of the name only
+		toPath = path.Join(toDir, driver.create(path.Base(toPath)))
+	} else {
+		toPath = driver.resolve(ctx, toPath)
+	}
+	defer driver.invalidate(fromPath)
+	defer driver.invalidate(toPath)
+	return driver.Driver.Rename(ctx, fromPath, toPath)
+}
+
+func (driver *foldDriver) MakeDir(ctx *Context, p string) error {
+	p = driver.resolve(ctx, p)
+	defer driver.invalidate(p)
+	return driver.Driver.MakeDir(ctx, p)
+}
+
+func (driver *foldDriver) GetFile(ctx *Context, p string, offset int64) (int64, io.ReadCloser, error) {
+	return driver.Driver.GetFile(ctx, driver.resolve(ctx, p), offset)
+}
+
+func (driver *foldDriver) PutFile(ctx *Context, destPath string, data io.Reader, offset int64) (int64, error) {
+	destPath = driver.resolve(ctx, destPath)
+	defer driver.invalidate(destPath)
+	return driver.Driver.PutFile(ctx, destPath, data, offset)
+}
+
+func (driver *foldDriver) SetModTime(ctx *Context, p string, mtime time.Time) error {
+	setter, ok := driver.Driver.(ModTimeSetter)
+	if !ok {
+		return errors.New("Not supported")
+	}
+	return setter.SetModTime(ctx, driver.resolve(ctx, p), mtime)
+}
+
+// Versions implements Versioner
+func (driver *foldDriver) Versions(ctx *Context, p string) ([]FileVersion, error) {
+	versioner, ok := driver.Driver.(Versioner)
+	if !ok {
+		return nil, errVersionsNotSupported
+	}
+	return versioner.Versions(ctx, driver.resolve(ctx, p))
+}
+
+// RestoreVersion implements Versioner
+func (driver *foldDriver) RestoreVersion(ctx *Context, p string, id string) error {
+	versioner, ok := driver.Driver.(Versioner)
+	if !ok {
+		return errVersionsNotSupported
+	}
+	return versioner.RestoreVersion(ctx, driver.resolve(ctx, p), id)
+}
@@ -0,0 +1,91 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net"
+	"strings"
+)
+
+// GeoIPLookup resolves the country of an IP, i.e. backed by a MaxMind
+// GeoLite2 database
+type GeoIPLookup interface {
+	// Country returns the ISO 3166-1 alpha-2 code of the country of the IP,
+	// an empty string if it could not be resolved
+	Country(ip net.IP) (string, error)
+}
+
+// GeoIPPolicy represents which countries the clients could connect from
+type GeoIPPolicy struct {
+	// The lookup resolving the client IPs, it's required
+	Lookup GeoIPLookup
+
+	// The countries allowed to connect, if empty all the countries but the
+	// denied ones are allowed
+	AllowCountries []string
+
+	// The countries denied to connect
+	DenyCountries []string
+
+	// Allow the clients whose country could not be resolved, i.e. private
+	// networks or lookup errors
+	AllowUnknown bool
+
+	// Check, if not nil, is called after the lists are checked and could
+	// overrule their decision
+	Check func(ip net.IP, country string, allowed bool) bool
+}
+
+func containsCountry(countries []string, country string) bool {
+	for _, c := range countries {
+		if strings.EqualFold(c, country) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowed reports whether a client from the country could connect
+func (policy *GeoIPPolicy) allowed(ip net.IP, country string) bool {
+	var allowed bool
+	switch {
+	case country == "":
+		allowed = policy.AllowUnknown
+	case containsCountry(policy.DenyCountries, country):
+		allowed = false
+	case len(policy.AllowCountries) > 0:
+		allowed = containsCountry(policy.AllowCountries, country)
+	default:
+		allowed = true
+	}
+	if policy.Check != nil {
+		return policy.Check(ip, country, allowed)
+	}
+	return allowed
+}
+
+// checkGeoIP resolves the country of the client and reports whether it could
+// connect
+func (sess *Session) checkGeoIP() bool {
+	policy := sess.server.GeoIP
+	if policy == nil || policy.Lookup == nil {
+		return true
+	}
+	ip := net.ParseIP(sess.remoteIP())
+	if ip == nil {
+		return policy.allowed(nil, "")
+	}
+	country, err := policy.Lookup.Country(ip)
+	if err != nil {
+		sess.warnf("GeoIP lookup of %s failed: %v", sess.pseudoIP(), err)
+		country = ""
+	}
+	sess.country = strings.ToUpper(country)
+	if !policy.allowed(ip, sess.country) {
+		sess.logf("Connection from %s (%s) denied by the GeoIP policy", sess.pseudoIP(), sess.country)
+		return false
+	}
+	return true
+}
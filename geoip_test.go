@@ -0,0 +1,37 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeoIPPolicy(t *testing.T) {
+	ip := net.ParseIP("192.0.2.1")
+
+	policy := &GeoIPPolicy{
+		DenyCountries: []string{"xx"},
+	}
+	assert.True(t, policy.allowed(ip, "DE"))
+	assert.False(t, policy.allowed(ip, "XX"))
+	assert.False(t, policy.allowed(ip, ""))
+
+	policy = &GeoIPPolicy{
+		AllowCountries: []string{"DE", "FR"},
+		AllowUnknown:   true,
+	}
+	assert.True(t, policy.allowed(ip, "FR"))
+	assert.False(t, policy.allowed(ip, "US"))
+	assert.True(t, policy.allowed(ip, ""))
+
+	policy.Check = func(ip net.IP, country string, allowed bool) bool {
+		return allowed || country == "US"
+	}
+	assert.True(t, policy.allowed(ip, "US"))
+	assert.False(t, policy.allowed(ip, "CN"))
+}
@@ -0,0 +1,178 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"hash/crc32"
+	"io"
+	"strings"
+)
+
+const defaultHashAlgo = "SHA-256"
+
+var (
+	hashAlgoNames = []string{"CRC32", "CRC32C", "MD5", "SHA-1", "SHA-256", "SHA-512"}
+	hashAlgos     = map[string]func() hash.Hash{
+		"CRC32":   func() hash.Hash { return crc32.NewIEEE() },
+		"CRC32C":  func() hash.Hash { return crc32.New(crc32.MakeTable(crc32.Castagnoli)) },
+		"MD5":     md5.New,
+		"SHA-1":   sha1.New,
+		"SHA-256": sha256.New,
+		"SHA-512": sha512.New,
+	}
+)
+
+// hashFeat returns the algorithms list advertised by FEAT, the selected one
+// is marked with a star
+func hashFeat(selected string) string {
+	var names = make([]string, 0, len(hashAlgoNames))
+	for _, name := range hashAlgoNames {
+		if name == selected {
+			name += "*"
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, ";")
+}
+
+// transferChecksum computes the digest of the data transferred, a nil
+// transferChecksum computes nothing
+type transferChecksum struct {
+	algo string
+	hash hash.Hash
+	sum  []byte // the digest if combined from the ones of segments
+}
+
+// crc32Polys are the reversed polynomials of the algorithms which digests
+// of consecutive data could be combined, see combineChecksums
+var crc32Polys = map[string]uint32{
+	"CRC32":  crc32.IEEE,
+	"CRC32C": crc32.Castagnoli,
+}
+
+// newTransferChecksum returns the checksum of a transfer of the session, nil
+// if Options.TransferChecksum is empty
+func (sess *Session) newTransferChecksum() *transferChecksum {
+	newHash, ok := hashAlgos[sess.server.TransferChecksum]
+	if !ok {
+		return nil
+	}
+	return &transferChecksum{algo: sess.server.TransferChecksum, hash: newHash()}
+}
+
+// newSegmentChecksums returns the checksums of the segments of a download,
+// nil if no digest is computed or if the digests of the segments could not
+// be combined, i.e. MD5 or SHA-256
+func (sess *Session) newSegmentChecksums(n int) []*transferChecksum {
+	if _, ok := crc32Polys[sess.server.TransferChecksum]; !ok {
+		return nil
+	}
+	var checksums = make([]*transferChecksum, n)
+	for i := range checksums {
+		checksums[i] = sess.newTransferChecksum()
+	}
+	return checksums
+}
+
+// combineChecksums returns the checksum of the consecutive segments of the
+// sizes, nil if there are none
+func combineChecksums(checksums []*transferChecksum, sizes []int64) *transferChecksum {
+	if len(checksums) == 0 {
+		return nil
+	}
+	var (
+		poly = crc32Polys[checksums[0].algo]
+		crc  = checksums[0].hash.(hash.Hash32).Sum32()
+	)
+	for i := 1; i < len(checksums); i++ {
+		crc = crc32Combine(poly, crc, checksums[i].hash.(hash.Hash32).Sum32(), sizes[i])
+	}
+	var sum = make([]byte, 4)
+	binary.BigEndian.PutUint32(sum, crc)
+	return &transferChecksum{algo: checksums[0].algo, sum: sum}
+}
+
+// crc32Combine returns the CRC-32 of two consecutive blocks from their
+// CRC-32 and the length of the second one, as crc32_combine of zlib
+func crc32Combine(poly, crc1, crc2 uint32, len2 int64) uint32 {
+	if len2 <= 0 {
+		return crc1
+	}
+	// the operators appending 1, 2, 4... zero bits
+	var even, odd [32]uint32
+	odd[0] = poly
+	for n, row := 1, uint32(1); n < 32; n, row = n+1, row<<1 {
+		odd[n] = row
+	}
+	gf2MatrixSquare(even[:], odd[:])
+	gf2MatrixSquare(odd[:], even[:])
+	for {
+		gf2MatrixSquare(even[:], odd[:])
+		if len2&1 != 0 {
+			crc1 = gf2MatrixTimes(even[:], crc1)
+		}
+		if len2 >>= 1; len2 == 0 {
+			break
+		}
+		gf2MatrixSquare(odd[:], even[:])
+		if len2&1 != 0 {
+			crc1 = gf2MatrixTimes(odd[:], crc1)
+		}
+		if len2 >>= 1; len2 == 0 {
+			break
+		}
+	}
+	return crc1 ^ crc2
+}
+
+func gf2MatrixTimes(mat []uint32, vec uint32) uint32 {
+	var sum uint32
+	for i := 0; vec != 0; i, vec = i+1, vec>>1 {
+		if vec&1 != 0 {
+			sum ^= mat[i]
+		}
+	}
+	return sum
+}
+
+func gf2MatrixSquare(square, mat []uint32) {
+	for n := range square {
+		square[n] = gf2MatrixTimes(mat, mat[n])
+	}
+}
+
+func (checksum *transferChecksum) teeReader(r io.Reader) io.Reader {
+	if checksum == nil {
+		return r
+	}
+	return io.TeeReader(r, checksum.hash)
+}
+
+func (checksum *transferChecksum) teeReadCloser(rc io.ReadCloser) io.ReadCloser {
+	if checksum == nil {
+		return rc
+	}
+	return &readCloser{Reader: io.TeeReader(rc, checksum.hash), Closer: rc}
+}
+
+// event adds the digest to the event of the transfer if it succeeded
+func (checksum *transferChecksum) event(event *TransferEvent) *TransferEvent {
+	if checksum != nil && event.Err == nil {
+		sum := checksum.sum
+		if sum == nil {
+			sum = checksum.hash.Sum(nil)
+		}
+		event.ChecksumAlgo = checksum.algo
+		event.Checksum = hex.EncodeToString(sum)
+	}
+	return event
+}
@@ -0,0 +1,137 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HealthChecker is an optional interface a Driver could implement to report
+// whether its storage is reachable
+type HealthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
+
+// BackendsHealthChecker is an optional interface the drivers combining
+// several backends could implement to report the reachability of each of
+// them, by name. It's used instead of HealthChecker.
+type BackendsHealthChecker interface {
+	CheckBackends(ctx context.Context) map[string]error
+}
+
+// CheckBackends returns the health of the drivers which implement
+// HealthChecker or BackendsHealthChecker, by name. The names of the backends
+// of a BackendsHealthChecker are prefixed by the name of the driver.
+func CheckBackends(ctx context.Context, drivers map[string]Driver) map[string]error {
+	var results = make(map[string]error)
+	for name, driver := range drivers {
+		switch checker := driver.(type) {
+		case BackendsHealthChecker:
+			for backend, err := range checker.CheckBackends(ctx) {
+				results[name+backend] = err
+			}
+		case HealthChecker:
+			results[name] = checker.CheckHealth(ctx)
+		}
+	}
+	return results
+}
+
+// BackendHealth is the state of a storage backend
+type BackendHealth struct {
+	Name      string    `json:"name"`
+	Healthy   bool      `json:"healthy"`
+	LastError string    `json:"last_error,omitempty"`
+	Since     time.Time `json:"since"` // when the backend became healthy or unhealthy
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// The statuses of the server
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded" // the server is up but a backend is not
+)
+
+// Health is the state of the server and of its storage backends
+type Health struct {
+	Status   string          `json:"status"`
+	Backends []BackendHealth `json:"backends,omitempty"`
+}
+
+// healthState keeps the state of the backends between the checks
+type healthState struct {
+	lock     sync.Mutex
+	backends map[string]*BackendHealth
+}
+
+// driverBackend is the name of the backend of a driver implementing
+// HealthChecker
+const driverBackend = "driver"
+
+// CheckHealth checks the reachability of the storage backends, only the
+// drivers implementing HealthChecker or BackendsHealthChecker are reported
+func (server *Server) CheckHealth(ctx context.Context) Health {
+	results := CheckBackends(ctx, map[string]Driver{"": server.storage})
+	if err, ok := results[""]; ok {
+		delete(results, "")
+		results[driverBackend] = err
+	}
+
+	var (
+		now    = time.Now()
+		state  = &server.health
+		health = Health{Status: HealthOK}
+	)
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	if state.backends == nil {
+		state.backends = make(map[string]*BackendHealth)
+	}
+	for name, err := range results {
+		backend := state.backends[name]
+		if backend == nil {
+			backend = &BackendHealth{Name: name, Healthy: err == nil, Since: now}
+			state.backends[name] = backend
+		}
+		if backend.Healthy != (err == nil) {
+			backend.Healthy = err == nil
+			backend.Since = now
+		}
+		if err != nil {
+			backend.LastError = err.Error()
+			health.Status = HealthDegraded
+		}
+		backend.CheckedAt = now
+		health.Backends = append(health.Backends, *backend)
+	}
+	sort.Slice(health.Backends, func(i, j int) bool {
+		return health.Backends[i].Name < health.Backends[j].Name
+	})
+	return health
+}
+
+// healthTimeout is how long the backends are given to answer a check
+const healthTimeout = 5 * time.Second
+
+// HealthHandler returns a handler serving the health of the server as JSON,
+// the status code is 503 if a backend is unhealthy
+func (server *Server) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+		defer cancel()
+		health := server.CheckHealth(ctx)
+
+		w.Header().Set("Content-Type", "application/json")
+		if health.Status != HealthOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(health)
+	})
+}
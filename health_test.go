@@ -0,0 +1,73 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type healthDriver struct {
+	Driver
+	err error
+}
+
+func (driver *healthDriver) CheckHealth(ctx context.Context) error {
+	return driver.err
+}
+
+func TestHealth(t *testing.T) {
+	var (
+		archive = &healthDriver{}
+		inbox   = &healthDriver{}
+		server  = &Server{storage: NewMultiDriver(map[string]Driver{
+			"/archive": archive,
+			"/inbox":   inbox,
+		})}
+	)
+
+	health := server.CheckHealth(context.Background())
+	assert.EqualValues(t, HealthOK, health.Status)
+	if assert.Len(t, health.Backends, 2) {
+		assert.EqualValues(t, "/archive", health.Backends[0].Name)
+		assert.True(t, health.Backends[0].Healthy)
+	}
+	since := health.Backends[0].Since
+
+	archive.err = errors.New("endpoint unreachable")
+	health = server.CheckHealth(context.Background())
+	assert.EqualValues(t, HealthDegraded, health.Status)
+	assert.False(t, health.Backends[0].Healthy)
+	assert.EqualValues(t, "endpoint unreachable", health.Backends[0].LastError)
+	assert.True(t, health.Backends[0].Since.After(since))
+	down := health.Backends[0].Since
+	assert.True(t, health.Backends[1].Healthy)
+
+	// the backend is unhealthy since the first failed check
+	w := httptest.NewRecorder()
+	server.HealthHandler().ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+	assert.EqualValues(t, http.StatusServiceUnavailable, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &health))
+	assert.EqualValues(t, HealthDegraded, health.Status)
+	assert.True(t, health.Backends[0].Since.Equal(down))
+
+	// the last error is kept once the backend recovered
+	archive.err = nil
+	health = server.CheckHealth(context.Background())
+	assert.EqualValues(t, HealthOK, health.Status)
+	assert.True(t, health.Backends[0].Healthy)
+	assert.EqualValues(t, "endpoint unreachable", health.Backends[0].LastError)
+
+	// the drivers which don't check their health are not reported
+	health = (&Server{storage: &struct{ Driver }{}}).CheckHealth(context.Background())
+	assert.EqualValues(t, HealthOK, health.Status)
+	assert.Empty(t, health.Backends)
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"path"
+	"strings"
+)
+
+// HiddenFiles represents the files hidden from the listings of LIST, NLST,
+// MLSD and STAT. They could still be accessed directly, i.e. via RETR, if
+// permitted.
+type HiddenFiles struct {
+	// Hide the files whose name starts with a dot
+	DotFiles bool
+
+	// The shell patterns, as supported by path.Match, of the hidden files.
+	// The patterns containing a slash are matched against the absolute path,
+	// the others against the name, i.e. "*.tmp" or "/incoming/.quarantine".
+	Patterns []string
+}
+
+// validate checks the patterns are well formed
+func (hidden *HiddenFiles) validate() error {
+	for _, pattern := range hidden.Patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isHidden reports whether the file in the directory is hidden
+func (hidden *HiddenFiles) isHidden(dir, name string) bool {
+	if hidden == nil {
+		return false
+	}
+	if hidden.DotFiles && strings.HasPrefix(name, ".") {
+		return true
+	}
+	for _, pattern := range hidden.Patterns {
+		if matchPattern(pattern, path.Join(dir, name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isHidden reports whether the file in the directory is hidden from the
+// listings of the session
+func (sess *Session) isHidden(dir, name string) bool {
+	if sess.server.Trash != nil && path.Join(dir, name) == sess.server.Trash.dir() {
+		return true
+	}
+	if sess.inVersions(path.Join(dir, name)) {
+		return true
+	}
+	return sess.server.HiddenFiles.isHidden(dir, name)
+}
+
+// isHiddenPath reports whether the absolute path or one of its parents is
+// hidden from the listings of the session
+func (sess *Session) isHiddenPath(p string) bool {
+	for p = path.Join("/", p); p != "/"; p = path.Dir(p) {
+		if sess.isHidden(path.Dir(p), path.Base(p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPattern reports whether the absolute path matches the shell pattern,
+// a pattern containing a slash is matched against the path from the root,
+// the others against the name only
+func matchPattern(pattern, p string) bool {
+	var target = path.Base(p)
+	if strings.Contains(pattern, "/") {
+		pattern = path.Join("/", pattern)
+		target = p
+	}
+	matched, _ := path.Match(pattern, target)
+	return matched
+}
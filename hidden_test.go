@@ -0,0 +1,30 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHiddenFiles(t *testing.T) {
+	var hidden *HiddenFiles
+	assert.False(t, hidden.isHidden("/", ".profile"))
+
+	hidden = &HiddenFiles{
+		DotFiles: true,
+		Patterns: []string{"*.tmp", "/incoming/quarantine"},
+	}
+	assert.NoError(t, hidden.validate())
+	assert.True(t, hidden.isHidden("/", ".profile"))
+	assert.True(t, hidden.isHidden("/a", "b.tmp"))
+	assert.True(t, hidden.isHidden("/incoming", "quarantine"))
+	assert.False(t, hidden.isHidden("/outgoing", "quarantine"))
+	assert.False(t, hidden.isHidden("/", "a.txt"))
+
+	hidden.Patterns = []string{"[a"}
+	assert.Error(t, hidden.validate())
+}
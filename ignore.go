@@ -0,0 +1,95 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// IgnoreAction represents how an upload matching an IgnoreRule is handled
+type IgnoreAction int
+
+// The actions of the ignore rules
+const (
+	// Refuse the upload with 553
+	IgnoreRefuse IgnoreAction = iota
+	// Read and drop the data, then reply 226 as if it was stored
+	IgnoreDrop
+)
+
+// IgnoreRule represents uploads which are not stored
+type IgnoreRule struct {
+	// The pattern is gitignore alike: a shell pattern as supported by
+	// path.Match, matched against the name, or against the path from the
+	// root if it contains a slash. A pattern starting with "!" re-includes
+	// the files an earlier rule ignores, the last matching rule wins.
+	Pattern string
+	Action  IgnoreAction
+}
+
+// validateIgnoreRules checks the patterns are well formed
+func validateIgnoreRules(rules []IgnoreRule) error {
+	for _, rule := range rules {
+		if _, err := path.Match(strings.TrimPrefix(rule.Pattern, "!"), ""); err != nil {
+			return fmt.Errorf("invalid ignore pattern %q: %v", rule.Pattern, err)
+		}
+	}
+	return nil
+}
+
+// matchIgnoreRules returns the rule the upload of the absolute path matches,
+// nil if it's not ignored
+func matchIgnoreRules(rules []IgnoreRule, p string) *IgnoreRule {
+	var matched *IgnoreRule
+	for i, rule := range rules {
+		if strings.HasPrefix(rule.Pattern, "!") {
+			if matchPattern(rule.Pattern[1:], p) {
+				matched = nil
+			}
+		} else if matchPattern(rule.Pattern, p) {
+			matched = &rules[i]
+		}
+	}
+	return matched
+}
+
+// ignoreUpload handles the upload of the path if it matches an ignore rule,
+// it reports whether the upload has been handled
+func (sess *Session) ignoreUpload(targetPath string) bool {
+	rule := matchIgnoreRules(sess.server.IgnoreUploads, targetPath)
+	if rule == nil {
+		return false
+	}
+
+	if rule.Action == IgnoreRefuse {
+		sess.logf("Upload of %s refused by the ignore pattern %s", targetPath, rule.Pattern)
+		sess.writeMessage(553, "Requested action not taken. File name not allowed.")
+		return true
+	}
+
+	sess.logf("Upload of %s dropped by the ignore pattern %s", targetPath, rule.Pattern)
+	sess.writeMessage(150, "Data transfer starting")
+	reader, err := sess.dataReader()
+	if err != nil {
+		sess.writeMessage(450, fmt.Sprint("error during transfer: ", err))
+		return true
+	}
+	size, err := io.Copy(ioutil.Discard, reader)
+	// a data connection carries a single upload
+	if sess.dataConn != nil {
+		sess.dataConn.Close()
+		sess.dataConn = nil
+	}
+	if err != nil {
+		sess.writeMessage(450, fmt.Sprint("error during transfer: ", err))
+		return true
+	}
+	sess.writeMessage(226, fmt.Sprintf("OK, received %d bytes", size))
+	return true
+}
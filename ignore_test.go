@@ -0,0 +1,37 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	rules := []IgnoreRule{
+		{Pattern: "Thumbs.db", Action: IgnoreDrop},
+		{Pattern: ".DS_Store", Action: IgnoreDrop},
+		{Pattern: "*.tmp"},
+		{Pattern: "!keep.tmp"},
+		{Pattern: "incoming/*.exe"},
+	}
+	assert.NoError(t, validateIgnoreRules(rules))
+
+	rule := matchIgnoreRules(rules, "/photos/Thumbs.db")
+	if assert.NotNil(t, rule) {
+		assert.EqualValues(t, IgnoreDrop, rule.Action)
+	}
+	rule = matchIgnoreRules(rules, "/a/b.tmp")
+	if assert.NotNil(t, rule) {
+		assert.EqualValues(t, IgnoreRefuse, rule.Action)
+	}
+	assert.Nil(t, matchIgnoreRules(rules, "/a/keep.tmp"))
+	assert.NotNil(t, matchIgnoreRules(rules, "/incoming/a.exe"))
+	assert.Nil(t, matchIgnoreRules(rules, "/outgoing/a.exe"))
+	assert.Nil(t, matchIgnoreRules(rules, "/a.txt"))
+
+	assert.Error(t, validateIgnoreRules([]IgnoreRule{{Pattern: "!["}}))
+}
@@ -0,0 +1,351 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// IndexEntry is the metadata of an indexed file
+type IndexEntry struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+
+	// The fields extracted by the indexers, i.e. text or columns
+	Fields map[string]string
+}
+
+// Indexer extracts the fields of an uploaded file from its content
+type Indexer interface {
+	// Index returns the fields of the file read from r, r holds up to
+	// Index.MaxBytes bytes of the stored file. No fields are returned for
+	// the files the indexer doesn't handle.
+	Index(ctx *Context, p string, r io.Reader) (map[string]string, error)
+}
+
+// IndexStore stores the index entries, it must be safe for concurrent use
+type IndexStore interface {
+	Put(entry *IndexEntry) error
+
+	// Delete removes the entry of the path and the entries below it
+	Delete(p string) error
+
+	// Rename moves the entry of the path and the entries below it
+	Rename(fromPath, toPath string) error
+
+	// Search returns up to limit entries matching the query, the meaning of
+	// the query is up to the store
+	Search(ctx *Context, query string, limit int) ([]IndexEntry, error)
+}
+
+// Searcher is an optional interface a Driver could implement to search its
+// files, i.e. via SITE SEARCH
+type Searcher interface {
+	Search(ctx *Context, query string, limit int) ([]IndexEntry, error)
+}
+
+const defaultIndexMaxBytes = 1024 * 1024
+
+// Index represents the indexing of the uploaded files
+type Index struct {
+	// The indexers run on every uploaded file, the fields they return are
+	// merged
+	Indexers []Indexer
+
+	// The store of the entries
+	Store IndexStore
+
+	// The bytes of the content the indexers could read, if 0 it's 1MiB
+	MaxBytes int64
+}
+
+// Indexing returns a DriverMiddleware indexing the uploaded files once they
+// are stored and removing the deleted ones from the index. It implements
+// Searcher, so it should be the outermost middleware for the SITE SEARCH
+// to use the index. The failures of the indexing are logged, they don't
+// fail the uploads.
+func Indexing(index *Index) DriverMiddleware {
+	return func(driver Driver) Driver {
+		indexed := &indexDriver{Driver: driver, index: index}
+		// keep the driver authentication
+		if auth, ok := driver.(Auth); ok {
+			return &indexAuthDriver{indexDriver: indexed, Auth: auth}
+		}
+		return indexed
+	}
+}
+
+var (
+	_ ModTimeSetter = &indexDriver{}
+	_ Searcher      = &indexDriver{}
+	_ Versioner     = &indexDriver{}
+)
+
+type indexDriver struct {
+	Driver
+	index *Index
+}
+
+type indexAuthDriver struct {
+	*indexDriver
+	Auth
+}
+
+func (driver *indexDriver) unwrap() Driver {
+	return driver.Driver
+}
+
+func (driver *indexDriver) warnf(ctx *Context, format string, v ...interface{}) {
+	if ctx.Sess != nil {
+		ctx.Sess.warnf(format, v...)
+	}
+}
+
+// indexFile reads the stored file and runs the indexers on it
+func (driver *indexDriver) indexFile(ctx *Context, p string) error {
+	info, err := driver.Driver.Stat(ctx, p)
+	if err != nil {
+		return err
+	}
+	entry := &IndexEntry{
+		Path:    p,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Fields:  make(map[string]string),
+	}
+
+	maxBytes := driver.index.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultIndexMaxBytes
+	}
+	for _, indexer := range driver.index.Indexers {
+		_, r, err := driver.Driver.GetFile(ctx, p, 0)
+		if err != nil {
+			return err
+		}
+		fields, err := indexer.Index(ctx, p, io.LimitReader(r, maxBytes))
+		r.Close()
+		if err != nil {
+			driver.warnf(ctx, "indexing %s failed: %v", p, err)
+			continue
+		}
+		for name, value := range fields {
+			entry.Fields[name] = value
+		}
+	}
+	return driver.index.Store.Put(entry)
+}
+
+func (driver *indexDriver) PutFile(ctx *Context, destPath string, data io.Reader, offset int64) (int64, error) {
+	size, err := driver.Driver.PutFile(ctx, destPath, data, offset)
+	if err != nil {
+		return size, err
+	}
+	if err := driver.indexFile(ctx, destPath); err != nil {
+		driver.warnf(ctx, "indexing %s failed: %v", destPath, err)
+	}
+	return size, nil
+}
+
+func (driver *indexDriver) DeleteFile(ctx *Context, p string) error {
+	if err := driver.Driver.DeleteFile(ctx, p); err != nil {
+		return err
+	}
+	if err := driver.index.Store.Delete(p); err != nil {
+		driver.warnf(ctx, "unindexing %s failed: %v", p, err)
+	}
+	return nil
+}
+
+func (driver *indexDriver) DeleteDir(ctx *Context, p string) error {
+	if err := driver.Driver.DeleteDir(ctx, p); err != nil {
+		return err
+	}
+	if err := driver.index.Store.Delete(p); err != nil {
+		driver.warnf(ctx, "unindexing %s failed: %v", p, err)
+	}
+	return nil
+}
+
+func (driver *indexDriver) Rename(ctx *Context, fromPath string, toPath string) error {
+	if err := driver.Driver.Rename(ctx, fromPath, toPath); err != nil {
+		return err
+	}
+	if err := driver.index.Store.Rename(fromPath, toPath); err != nil {
+		driver.warnf(ctx, "reindexing %s failed: %v", fromPath, err)
+	}
+	return nil
+}
+
+func (driver *indexDriver) SetModTime(ctx *Context, p string, mtime time.Time) error {
+	setter, ok := driver.Driver.(ModTimeSetter)
+	if !ok {
+		return errors.New("Not supported")
+	}
+	return setter.SetModTime(ctx, p, mtime)
+}
+
+// Versions implements Versioner
+func (driver *indexDriver) Versions(ctx *Context, p string) ([]FileVersion, error) {
+	versioner, ok := driver.Driver.(Versioner)
+	if !ok {
+		return nil, errVersionsNotSupported
+	}
+	return versioner.Versions(ctx, p)
+}
+
+// RestoreVersion implements Versioner, the restored file is reindexed
+func (driver *indexDriver) RestoreVersion(ctx *Context, p string, id string) error {
+	versioner, ok := driver.Driver.(Versioner)
+	if !ok {
+		return errVersionsNotSupported
+	}
+	if err := versioner.RestoreVersion(ctx, p, id); err != nil {
+		return err
+	}
+	if err := driver.indexFile(ctx, p); err != nil {
+		driver.warnf(ctx, "indexing %s failed: %v", p, err)
+	}
+	return nil
+}
+
+// Search implements Searcher
+func (driver *indexDriver) Search(ctx *Context, query string, limit int) ([]IndexEntry, error) {
+	return driver.index.Store.Search(ctx, query, limit)
+}
+
+// TextIndexer indexes the content of the text files as the text field, the
+// files which aren't valid UTF-8 are not indexed
+type TextIndexer struct{}
+
+// Index implements Indexer
+func (TextIndexer) Index(ctx *Context, p string, r io.Reader) (map[string]string, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	// the content could be cut in the middle of a rune
+	for i := 0; i < utf8.UTFMax && len(data) > 0 && !utf8.Valid(data); i++ {
+		data = data[:len(data)-1]
+	}
+	if len(data) == 0 || !utf8.Valid(data) || strings.IndexByte(string(data), 0) >= 0 {
+		return nil, nil
+	}
+	return map[string]string{"text": string(data)}, nil
+}
+
+// CSVIndexer indexes the header of the .csv files as the columns field, the
+// names of the columns separated by commas
+type CSVIndexer struct{}
+
+// Index implements Indexer
+func (CSVIndexer) Index(ctx *Context, p string, r io.Reader) (map[string]string, error) {
+	if !strings.EqualFold(path.Ext(p), ".csv") {
+		return nil, nil
+	}
+	header, err := csv.NewReader(bufio.NewReader(r)).Read()
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return map[string]string{"columns": strings.Join(header, ",")}, nil
+}
+
+// MemoryIndexStore is an IndexStore keeping the entries in memory
+type MemoryIndexStore struct {
+	lock    sync.RWMutex
+	entries map[string]*IndexEntry
+}
+
+// NewMemoryIndexStore creates an empty index store
+func NewMemoryIndexStore() *MemoryIndexStore {
+	return &MemoryIndexStore{entries: make(map[string]*IndexEntry)}
+}
+
+// Put implements IndexStore
+func (store *MemoryIndexStore) Put(entry *IndexEntry) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	store.entries[entry.Path] = entry
+	return nil
+}
+
+// Delete implements IndexStore
+func (store *MemoryIndexStore) Delete(p string) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	for name := range store.entries {
+		if isUnderPath(name, p) {
+			delete(store.entries, name)
+		}
+	}
+	return nil
+}
+
+// Rename implements IndexStore
+func (store *MemoryIndexStore) Rename(fromPath, toPath string) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	var renamed []*IndexEntry
+	for name, entry := range store.entries {
+		if isUnderPath(name, fromPath) {
+			delete(store.entries, name)
+			moved := *entry
+			moved.Path = toPath + strings.TrimPrefix(name, fromPath)
+			renamed = append(renamed, &moved)
+		}
+	}
+	for _, entry := range renamed {
+		store.entries[entry.Path] = entry
+	}
+	return nil
+}
+
+// Search implements IndexStore, the query is a shell pattern matched against
+// the names of the files or a text the fields contain, case insensitively.
+// The entries are sorted by path.
+func (store *MemoryIndexStore) Search(ctx *Context, query string, limit int) ([]IndexEntry, error) {
+	if _, err := path.Match(query, ""); err != nil {
+		return nil, err
+	}
+	store.lock.RLock()
+	var entries []IndexEntry
+	for _, entry := range store.entries {
+		if entryMatches(entry, query) {
+			entries = append(entries, *entry)
+		}
+	}
+	store.lock.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+func entryMatches(entry *IndexEntry, query string) bool {
+	if ok, _ := path.Match(strings.ToLower(query), strings.ToLower(path.Base(entry.Path))); ok {
+		return true
+	}
+	for _, value := range entry.Fields {
+		if strings.Contains(strings.ToLower(value), strings.ToLower(query)) {
+			return true
+		}
+	}
+	return false
+}
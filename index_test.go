@@ -0,0 +1,143 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type indexFileInfo struct {
+	name string
+	size int64
+}
+
+func (info indexFileInfo) Name() string       { return info.name }
+func (info indexFileInfo) Size() int64        { return info.size }
+func (info indexFileInfo) Mode() os.FileMode  { return 0644 }
+func (info indexFileInfo) ModTime() time.Time { return time.Unix(1600000000, 0) }
+func (info indexFileInfo) IsDir() bool        { return false }
+func (info indexFileInfo) Sys() interface{}   { return nil }
+
+// indexStubDriver keeps the files in memory
+type indexStubDriver struct {
+	Driver
+	files map[string][]byte
+}
+
+func (driver *indexStubDriver) Stat(ctx *Context, p string) (os.FileInfo, error) {
+	data, ok := driver.files[p]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return indexFileInfo{name: path.Base(p), size: int64(len(data))}, nil
+}
+
+func (driver *indexStubDriver) GetFile(ctx *Context, p string, offset int64) (int64, io.ReadCloser, error) {
+	data, ok := driver.files[p]
+	if !ok {
+		return 0, nil, os.ErrNotExist
+	}
+	return int64(len(data)), ioutil.NopCloser(bytes.NewReader(data[offset:])), nil
+}
+
+func (driver *indexStubDriver) PutFile(ctx *Context, p string, data io.Reader, offset int64) (int64, error) {
+	buf, err := ioutil.ReadAll(data)
+	driver.files[p] = buf
+	return int64(len(buf)), err
+}
+
+func (driver *indexStubDriver) DeleteFile(ctx *Context, p string) error {
+	delete(driver.files, p)
+	return nil
+}
+
+func (driver *indexStubDriver) Rename(ctx *Context, fromPath string, toPath string) error {
+	driver.files[toPath] = driver.files[fromPath]
+	delete(driver.files, fromPath)
+	return nil
+}
+
+func searchPaths(t *testing.T, searcher Searcher, query string) []string {
+	entries, err := searcher.Search(&Context{}, query, 0)
+	assert.NoError(t, err)
+	var paths []string
+	for _, entry := range entries {
+		paths = append(paths, entry.Path)
+	}
+	return paths
+}
+
+func TestIndexing(t *testing.T) {
+	store := NewMemoryIndexStore()
+	driver := Indexing(&Index{
+		Indexers: []Indexer{TextIndexer{}, CSVIndexer{}},
+		Store:    store,
+	})(&indexStubDriver{files: make(map[string][]byte)})
+	searcher := driver.(Searcher)
+	ctx := &Context{}
+
+	_, err := driver.PutFile(ctx, "/notes.txt", strings.NewReader("Hello World"), -1)
+	assert.NoError(t, err)
+	_, err = driver.PutFile(ctx, "/data/users.csv", strings.NewReader("id,name,email\n1,a,a@example.com\n"), -1)
+	assert.NoError(t, err)
+	_, err = driver.PutFile(ctx, "/image.bin", bytes.NewReader([]byte{0x89, 'P', 'N', 'G', 0}), -1)
+	assert.NoError(t, err)
+
+	entries, err := store.Search(ctx, "users.csv", 0)
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		assert.EqualValues(t, "/data/users.csv", entries[0].Path)
+		assert.EqualValues(t, 32, entries[0].Size)
+		assert.EqualValues(t, "id,name,email", entries[0].Fields["columns"])
+	}
+	entries, err = store.Search(ctx, "*.bin", 0)
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		assert.Empty(t, entries[0].Fields)
+	}
+
+	assert.EqualValues(t, []string{"/data/users.csv", "/image.bin", "/notes.txt"}, searchPaths(t, searcher, "*"))
+	assert.EqualValues(t, []string{"/notes.txt"}, searchPaths(t, searcher, "world"))
+	assert.EqualValues(t, []string{"/data/users.csv"}, searchPaths(t, searcher, "EMAIL"))
+	limited, err := searcher.Search(ctx, "*", 2)
+	assert.NoError(t, err)
+	assert.Len(t, limited, 2)
+	_, err = searcher.Search(ctx, "[", 0)
+	assert.EqualValues(t, path.ErrBadPattern, err)
+
+	assert.NoError(t, driver.Rename(ctx, "/notes.txt", "/archive.txt"))
+	assert.EqualValues(t, []string{"/archive.txt"}, searchPaths(t, searcher, "world"))
+	assert.NoError(t, driver.DeleteFile(ctx, "/archive.txt"))
+	assert.Empty(t, searchPaths(t, searcher, "world"))
+
+	// the entries below a renamed directory are moved
+	assert.NoError(t, store.Rename("/data", "/old"))
+	assert.EqualValues(t, []string{"/old/users.csv"}, searchPaths(t, searcher, "*.csv"))
+	assert.NoError(t, store.Delete("/old"))
+	assert.EqualValues(t, []string{"/image.bin"}, searchPaths(t, searcher, "*"))
+}
+
+func TestTextIndexer(t *testing.T) {
+	fields, err := TextIndexer{}.Index(&Context{}, "/a.txt", strings.NewReader("héllo"[:2]))
+	assert.NoError(t, err)
+	assert.EqualValues(t, map[string]string{"text": "h"}, fields)
+
+	fields, err = TextIndexer{}.Index(&Context{}, "/a.bin", bytes.NewReader([]byte{'a', 0, 'b'}))
+	assert.NoError(t, err)
+	assert.Nil(t, fields)
+
+	fields, err = CSVIndexer{}.Index(&Context{}, "/a.txt", strings.NewReader("a,b\n"))
+	assert.NoError(t, err)
+	assert.Nil(t, fields)
+}
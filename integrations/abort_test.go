@@ -0,0 +1,152 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// openData sends EPSV over the control connection and connects to the
+// passive data connection
+func openData(t *testing.T, conn *textproto.Conn, host string) net.Conn {
+	_, err := conn.Cmd("EPSV")
+	assert.NoError(t, err)
+	_, msg, err := conn.ReadResponse(229)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	port := strings.Trim(msg[strings.Index(msg, "(")+1:], "|)")
+	dataConn, err := net.Dial("tcp", net.JoinHostPort(host, port))
+	assert.NoError(t, err)
+	return dataConn
+}
+
+func readResponse(conn *textproto.Conn) string {
+	code, msg, _ := conn.ReadResponse(0)
+	return fmt.Sprintf("%d %s", code, msg)
+}
+
+func TestAbort(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+	defer os.Remove("./testdata/abort.bin")
+	defer os.Remove("./testdata/abort-up.bin")
+	err = ioutil.WriteFile("./testdata/abort.bin", make([]byte, 32*1024*1024), os.ModePerm)
+	assert.NoError(t, err)
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2140,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			conn, err := textproto.Dial("tcp", "localhost:2140")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			_, _, err = conn.ReadResponse(220)
+			assert.NoError(t, err)
+			for _, cmd := range []string{"USER admin", "PASS admin", "TYPE I"} {
+				_, err = conn.Cmd("%s", cmd)
+				assert.NoError(t, err)
+				_, _, err = conn.ReadResponse(0)
+				assert.NoError(t, err)
+			}
+
+			// the download is stopped while the client doesn't read
+			dataConn := openData(t, conn, "localhost")
+			_, err = conn.Cmd("RETR /abort.bin")
+			assert.NoError(t, err)
+			assert.EqualValues(t, "150 Data transfer starting 33554432 bytes", readResponse(conn))
+			// the control connection is served during the transfer
+			_, err = conn.Cmd("NOOP")
+			assert.NoError(t, err)
+			assert.EqualValues(t, "200 OK", readResponse(conn))
+			_, err = conn.Cmd("STAT")
+			assert.NoError(t, err)
+			assert.True(t, strings.HasPrefix(readResponse(conn), "213 Status of the transfer:\nRETR /abort.bin: "))
+			_, err = conn.Cmd("\xff\xf4\xff\xf2ABOR")
+			assert.NoError(t, err)
+			assert.True(t, strings.HasPrefix(readResponse(conn), "426 Connection closed; transfer aborted at offset "))
+			assert.EqualValues(t, "226 ABOR command successful", readResponse(conn))
+			dataConn.Close()
+
+			// the upload is stopped while the client doesn't send
+			dataConn = openData(t, conn, "localhost")
+			_, err = conn.Cmd("STOR /abort-up.bin")
+			assert.NoError(t, err)
+			assert.EqualValues(t, "150 Data transfer starting", readResponse(conn))
+			_, err = dataConn.Write([]byte("partial"))
+			assert.NoError(t, err)
+			// let the server store the data before it's aborted
+			time.Sleep(100 * time.Millisecond)
+			_, err = conn.Cmd("ABOR")
+			assert.NoError(t, err)
+			assert.EqualValues(t, "426 Connection closed; transfer aborted at offset 7", readResponse(conn))
+			assert.EqualValues(t, "226 ABOR command successful", readResponse(conn))
+			dataConn.Close()
+
+			// the upload could only be resumed from the stored data
+			_, err = conn.Cmd("REST 100")
+			assert.NoError(t, err)
+			assert.EqualValues(t, "350 Start transfer from 100", readResponse(conn))
+			_, err = conn.Cmd("STOR /abort-up.bin")
+			assert.NoError(t, err)
+			assert.EqualValues(t, "554 Requested action not taken: invalid REST parameter, the transfer stopped at offset 7", readResponse(conn))
+
+			dataConn = openData(t, conn, "localhost")
+			_, err = conn.Cmd("REST 7")
+			assert.NoError(t, err)
+			assert.EqualValues(t, "350 Start transfer from 7", readResponse(conn))
+			_, err = conn.Cmd("STOR /abort-up.bin")
+			assert.NoError(t, err)
+			assert.EqualValues(t, "150 Data transfer starting", readResponse(conn))
+			_, err = dataConn.Write([]byte(" upload"))
+			assert.NoError(t, err)
+			dataConn.Close()
+			assert.EqualValues(t, "226 OK, received 7 bytes", readResponse(conn))
+			buf, err := ioutil.ReadFile("./testdata/abort-up.bin")
+			assert.NoError(t, err)
+			assert.EqualValues(t, "partial upload", string(buf))
+
+			// ABOR without a transfer
+			_, err = conn.Cmd("ABOR")
+			assert.NoError(t, err)
+			assert.EqualValues(t, "226 No transfer to abort", readResponse(conn))
+			_, err = conn.Cmd("NOOP")
+			assert.NoError(t, err)
+			assert.EqualValues(t, "200 OK", readResponse(conn))
+
+			assert.NoError(t, conn.Close())
+			break
+		}
+	})
+}
@@ -0,0 +1,141 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"os"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcceptLimit(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2137,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:        server.NewSimplePerm("test", "test"),
+		Logger:      new(server.DiscardLogger),
+		AcceptLimit: &server.AcceptLimit{MaxPending: 1},
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			pending, err := textproto.Dial("tcp", "localhost:2137")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			_, _, err = pending.ReadResponse(220)
+			assert.NoError(t, err)
+
+			refused, err := textproto.Dial("tcp", "localhost:2137")
+			assert.NoError(t, err)
+			code, _, _ := refused.ReadResponse(0)
+			assert.EqualValues(t, 421, code)
+			refused.Close()
+
+			// a logged in session isn't pending anymore
+			_, err = pending.Cmd("USER admin")
+			assert.NoError(t, err)
+			_, _, err = pending.ReadResponse(331)
+			assert.NoError(t, err)
+			_, err = pending.Cmd("PASS admin")
+			assert.NoError(t, err)
+			_, _, err = pending.ReadResponse(230)
+			assert.NoError(t, err)
+
+			responses := sendCommands(t, "localhost:2137", "USER admin", "PASS admin")
+			assert.EqualValues(t, []string{
+				"331 User name ok, password required",
+				"230 Password ok, continue",
+			}, responses)
+
+			pending.Close()
+			break
+		}
+	})
+}
+
+func TestAcceptLimitImplicitTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftptls")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeCertificate(t, dir)
+
+	driver, err := file.NewDriver(dir)
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2187,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:        server.NewSimplePerm("test", "test"),
+		Logger:      new(server.DiscardLogger),
+		TLS:         true,
+		CertFile:    certFile,
+		KeyFile:     keyFile,
+		AcceptLimit: &server.AcceptLimit{MaxPending: 1},
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		var (
+			pending net.Conn
+			timeout = time.NewTimer(time.Millisecond * 500)
+		)
+		for {
+			pending, err = net.Dial("tcp", "localhost:2187")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			break
+		}
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer pending.Close()
+
+		// a silent connection over the limit doesn't block the next ones
+		silent, err := net.Dial("tcp", "localhost:2187")
+		assert.NoError(t, err)
+		defer silent.Close()
+		time.Sleep(100 * time.Millisecond)
+
+		conn, err := tls.Dial("tcp", "localhost:2187", &tls.Config{InsecureSkipVerify: true})
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+		assert.NoError(t, conn.SetDeadline(time.Now().Add(500*time.Millisecond)))
+		code, _, err := textproto.NewConn(conn).ReadResponse(0)
+		assert.NoError(t, err)
+		assert.EqualValues(t, 421, code)
+	})
+}
@@ -0,0 +1,149 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAliases(t *testing.T) {
+	err := os.MkdirAll("./testdata/releases/v2.3", os.ModePerm)
+	assert.NoError(t, err)
+	defer os.RemoveAll("./testdata/releases")
+	assert.NoError(t, ioutil.WriteFile("./testdata/releases/v2.3/app.bin", []byte("v2.3"), os.ModePerm))
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2126,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+		DriverMiddlewares: []server.DriverMiddleware{
+			server.Aliases(map[string]string{
+				"/releases/current": "/releases/v2.3",
+			}),
+		},
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			f, err := ftp.Connect("localhost:2126")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, f.Login("admin", "admin"))
+
+			names, err := f.NameList("/releases")
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, []string{"v2.3", "current"}, names)
+
+			assert.NoError(t, f.ChangeDir("/releases/current"))
+			r, err := f.Retr("app.bin")
+			if assert.NoError(t, err) {
+				buf, err := ioutil.ReadAll(r)
+				r.Close()
+				assert.NoError(t, err)
+				assert.EqualValues(t, "v2.3", string(buf))
+			}
+
+			assert.NoError(t, f.Stor("/releases/current/notes.txt", strings.NewReader("notes")))
+			_, err = os.Stat("./testdata/releases/v2.3/notes.txt")
+			assert.NoError(t, err)
+
+			assert.Error(t, f.RemoveDir("/releases/current"))
+
+			assert.NoError(t, f.Quit())
+			break
+		}
+	})
+}
+
+// quotaSpaceDriver reports a quota and 100 bytes available in /small
+type quotaSpaceDriver struct {
+	spaceDriver
+}
+
+func (driver *quotaSpaceDriver) Quota(ctx *server.Context) (*server.Quota, error) {
+	return &server.Quota{BytesUsed: 10, BytesLimit: 100, FilesUsed: 1, FilesLimit: -1}, nil
+}
+
+func TestAliasesOptionalInterfaces(t *testing.T) {
+	err := os.MkdirAll("./testdata/small", os.ModePerm)
+	assert.NoError(t, err)
+	defer os.RemoveAll("./testdata/small")
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: &quotaSpaceDriver{spaceDriver{Driver: driver}},
+		Port:   2193,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:        server.NewSimplePerm("test", "test"),
+		Logger:      new(server.DiscardLogger),
+		Preallocate: true,
+		DriverMiddlewares: []server.DriverMiddleware{
+			server.Aliases(map[string]string{
+				"/tiny": "/small",
+			}),
+		},
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			conn, err := net.Dial("tcp", "localhost:2193")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			conn.Close()
+			break
+		}
+
+		// the driver behind the aliases still reports the quota and the
+		// space available in the resolved directories
+		assert.EqualValues(t, []string{
+			"331 User name ok, password required",
+			"230 Password ok, continue",
+			strings.Join([]string{
+				"200 The current quota for this session are [current/limit]:",
+				"Name: admin",
+				"Bytes: 10/100",
+				"Files: 1/unlimited",
+				"End of quota",
+			}, "\n"),
+			"250 Directory changed to /tiny",
+			"552 Insufficient storage space, 100 bytes available",
+		}, sendCommands(t, "localhost:2193", "USER admin", "PASS admin",
+			"SITE QUOTA", "CWD /tiny", "ALLO 1000"))
+	})
+}
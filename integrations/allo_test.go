@@ -0,0 +1,88 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// spaceDriver reports 100 bytes available in /small
+type spaceDriver struct {
+	server.Driver
+}
+
+func (driver *spaceDriver) AvailableSpace(ctx *server.Context, dir string) (int64, error) {
+	if dir == "/small" {
+		return 100, nil
+	}
+	return 1 << 30, nil
+}
+
+func TestAllo(t *testing.T) {
+	err := os.MkdirAll("./testdata/small", os.ModePerm)
+	assert.NoError(t, err)
+	defer os.RemoveAll("./testdata/small")
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: &spaceDriver{Driver: driver},
+		Port:   2160,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:        server.NewSimplePerm("test", "test"),
+		Logger:      new(server.DiscardLogger),
+		Preallocate: true,
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			conn, err := net.Dial("tcp", "localhost:2160")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			conn.Close()
+			break
+		}
+
+		responses := sendCommands(t, "localhost:2160", "USER admin", "PASS admin",
+			"ALLO", "ALLO x", "ALLO 1000 R 10", "CWD /small", "ALLO 1000", "ALLO 10")
+		assert.EqualValues(t, []string{
+			"331 User name ok, password required",
+			"230 Password ok, continue",
+			"501 Syntax error: invalid param",
+			"501 Syntax error: invalid size x",
+			"200 Space available",
+			"250 Directory changed to /small",
+			"552 Insufficient storage space, 100 bytes available",
+			"200 Space available",
+		}, responses[:8])
+
+		// the upload is refused before the data connection is used
+		responses = sendCommands(t, "localhost:2160", "USER admin", "PASS admin",
+			"ALLO 1000", "EPSV", "STOR /small/a.txt", "NOOP")
+		assert.Len(t, responses, 6)
+		assert.EqualValues(t, "200 Space available", responses[2])
+		assert.EqualValues(t, "552 Insufficient storage space, 100 bytes available", responses[4])
+		assert.EqualValues(t, "200 OK", responses[5])
+		_, err = os.Stat("./testdata/small/a.txt")
+		assert.True(t, os.IsNotExist(err))
+	})
+}
@@ -0,0 +1,104 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+)
+
+// syncBuffer is a buffer written by the sessions and read by the test
+type syncBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
+func TestAudit(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	var out syncBuffer
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2148,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+		Audit:  server.NewJSONAuditSink(&out),
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			f, err := ftp.Connect("localhost:2148")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, f.Login("admin", "admin"))
+			assert.Error(t, f.ChangeDir("/missing"))
+			assert.NoError(t, f.Quit())
+			break
+		}
+
+		// the record of QUIT is sent once the reply is
+		for i := 0; i < 50 && !strings.Contains(out.String(), `"QUIT"`); i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		var records = make(map[string]server.AuditRecord)
+		decoder := json.NewDecoder(strings.NewReader(out.String()))
+		for decoder.More() {
+			var record server.AuditRecord
+			if !assert.NoError(t, decoder.Decode(&record)) {
+				return
+			}
+			assert.NotEmpty(t, record.SessionID)
+			assert.EqualValues(t, "127.0.0.1", record.IP)
+			records[record.Command] = record
+		}
+
+		assert.EqualValues(t, "admin", records["USER"].Param)
+		assert.EqualValues(t, 331, records["USER"].Code)
+		assert.EqualValues(t, "****", records["PASS"].Param)
+		assert.EqualValues(t, "admin", records["PASS"].User)
+		assert.EqualValues(t, 230, records["PASS"].Code)
+		assert.EqualValues(t, "/missing", records["CWD"].Param)
+		assert.EqualValues(t, 550, records["CWD"].Code)
+		assert.EqualValues(t, "admin", records["QUIT"].User)
+		assert.EqualValues(t, 221, records["QUIT"].Code)
+	})
+}
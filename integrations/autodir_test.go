@@ -0,0 +1,68 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAutoMkdir(t *testing.T) {
+	err := os.MkdirAll("./testdata/scans", os.ModePerm)
+	assert.NoError(t, err)
+	defer os.RemoveAll("./testdata/scans")
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2164,
+		Auth: &validityAuth{users: map[string]*server.UserInfo{
+			"scanner": {AutoMkdir: true},
+		}},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			f, err := ftp.Connect("localhost:2164")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+
+			assert.NoError(t, f.Login("other", "secret"))
+			assert.Error(t, f.Stor("/scans/2020/a.txt", strings.NewReader("a")))
+
+			assert.NoError(t, f.Login("scanner", "secret"))
+			assert.NoError(t, f.ChangeDir("/scans"))
+			assert.NoError(t, f.Stor("2020/10/a.txt", strings.NewReader("a")))
+			assert.NoError(t, f.Stor("2020/11/b.txt", strings.NewReader("b")))
+			assert.NoError(t, f.Quit())
+			break
+		}
+
+		data, err := ioutil.ReadFile("./testdata/scans/2020/10/a.txt")
+		assert.NoError(t, err)
+		assert.EqualValues(t, "a", string(data))
+		info, err := os.Stat("./testdata/scans/2020/11")
+		assert.NoError(t, err)
+		assert.True(t, info.IsDir())
+	})
+}
@@ -0,0 +1,145 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+)
+
+// bandwidthStore persists the bandwidth in memory
+type bandwidthStore struct {
+	lock  sync.Mutex
+	users map[string]server.UserBandwidth
+}
+
+func (store *bandwidthStore) LoadBandwidth() (map[string]server.UserBandwidth, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	return store.users, nil
+}
+
+func (store *bandwidthStore) AddBandwidth(userName string, transfer server.UserBandwidth) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	total := store.users[userName]
+	total.Uploaded += transfer.Uploaded
+	total.Downloaded += transfer.Downloaded
+	total.Uploads += transfer.Uploads
+	total.Downloads += transfer.Downloads
+	store.users[userName] = total
+	return nil
+}
+
+type bandwidthNotifier struct {
+	server.NullNotifier
+	lock   sync.Mutex
+	events []server.UserBandwidth
+}
+
+func (n *bandwidthNotifier) AfterFilePutEvent(ctx *server.Context, event *server.TransferEvent) {
+	n.lock.Lock()
+	n.events = append(n.events, event.UserBandwidth)
+	n.lock.Unlock()
+}
+
+func (n *bandwidthNotifier) AfterFileDownloadedEvent(ctx *server.Context, event *server.TransferEvent) {
+	n.lock.Lock()
+	n.events = append(n.events, event.UserBandwidth)
+	n.lock.Unlock()
+}
+
+func TestUserBandwidth(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+	defer os.Remove("./testdata/bandwidth.txt")
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	store := &bandwidthStore{users: map[string]server.UserBandwidth{
+		"admin": {Uploaded: 100, Uploads: 1},
+	}}
+	notifier := &bandwidthNotifier{}
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2167,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:           server.NewSimplePerm("test", "test"),
+		Logger:         new(server.DiscardLogger),
+		BandwidthStore: store,
+	}
+
+	s, err := server.NewServer(opt)
+	assert.NoError(t, err)
+	s.RegisterNotifer(notifier)
+	go func() {
+		err := s.ListenAndServe()
+		assert.EqualError(t, err, server.ErrServerClosed.Error())
+	}()
+	defer s.Shutdown()
+
+	// Give server 0.5 seconds to get to the listening state
+	timeout := time.NewTimer(time.Millisecond * 500)
+	for {
+		f, err := ftp.Connect("localhost:2167")
+		if err != nil && len(timeout.C) == 0 { // Retry errors
+			continue
+		}
+		assert.NoError(t, err)
+
+		assert.NoError(t, f.Login("admin", "admin"))
+		assert.NoError(t, f.Stor("/bandwidth.txt", strings.NewReader("12345")))
+		for i := 0; i < 2; i++ {
+			r, err := f.Retr("/bandwidth.txt")
+			if assert.NoError(t, err) {
+				_, err = ioutil.ReadAll(r)
+				assert.NoError(t, err)
+				assert.NoError(t, r.Close())
+			}
+		}
+		assert.NoError(t, f.Quit())
+		break
+	}
+
+	total := server.UserBandwidth{Uploaded: 105, Downloaded: 10, Uploads: 2, Downloads: 2}
+	assert.EqualValues(t, map[string]server.UserBandwidth{"admin": total}, s.Stats().Bandwidth)
+	store.lock.Lock()
+	assert.EqualValues(t, total, store.users["admin"])
+	store.lock.Unlock()
+
+	notifier.lock.Lock()
+	assert.EqualValues(t, []server.UserBandwidth{
+		{Uploaded: 105, Uploads: 2},
+		{Uploaded: 105, Downloaded: 5, Uploads: 2, Downloads: 1},
+		total,
+	}, notifier.events)
+	notifier.lock.Unlock()
+
+	responses := sendCommands(t, "localhost:2167", "USER admin", "PASS admin", "SITE USAGE")
+	if assert.Len(t, responses, 3) {
+		assert.EqualValues(t, strings.Join([]string{
+			"200 The data transferred by this user are:",
+			"Name: admin",
+			"Uploaded: 105 bytes in 2 files",
+			"Downloaded: 10 bytes in 2 files",
+			"End of usage",
+		}, "\n"), responses[2])
+	}
+}
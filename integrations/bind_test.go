@@ -0,0 +1,95 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBindAddress(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the loopback addresses but 127.0.0.1 are only local on linux")
+	}
+
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2143,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:               server.NewSimplePerm("test", "test"),
+		Logger:             new(server.DiscardLogger),
+		PassiveBindAddress: "127.0.0.3",
+		ActiveBindAddress:  "127.0.0.2",
+	}
+
+	_, err = server.NewServer(&server.Options{
+		Driver:            driver,
+		Perm:              server.NewSimplePerm("test", "test"),
+		ActiveBindAddress: "no-such-interface",
+	})
+	assert.Error(t, err)
+
+	runServer(t, opt, nil, func() {
+		// the active data connection is opened from the address
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		defer l.Close()
+		port := l.Addr().(*net.TCPAddr).Port
+		var remote = make(chan net.Addr, 1)
+		go func() {
+			conn, err := l.Accept()
+			if err != nil {
+				remote <- nil
+				return
+			}
+			remote <- conn.RemoteAddr()
+			conn.Close()
+		}()
+
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			conn, err := net.Dial("tcp", "localhost:2143")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			conn.Close()
+			break
+		}
+
+		responses := sendCommands(t, "localhost:2143", "USER admin", "PASS admin", "PASV",
+			fmt.Sprintf("PORT 127,0,0,1,%d,%d", port/256, port%256))
+		if assert.Len(t, responses, 4) {
+			// the passive listener is advertised with the address
+			assert.True(t, strings.HasPrefix(responses[2], "227 Entering Passive Mode (127,0,0,3,"), responses[2])
+			assert.True(t, strings.HasPrefix(responses[3], "200 "), responses[3])
+		}
+		addr := <-remote
+		if assert.NotNil(t, addr) {
+			assert.EqualValues(t, "127.0.0.2", addr.(*net.TCPAddr).IP.String())
+		}
+	})
+}
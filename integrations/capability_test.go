@@ -0,0 +1,92 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapabilities(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	var out syncBuffer
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2156,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+		Audit:  server.NewJSONAuditSink(&out),
+	}
+
+	s, err := server.NewServer(opt)
+	assert.NoError(t, err)
+	go func() {
+		err := s.ListenAndServe()
+		assert.EqualError(t, err, server.ErrServerClosed.Error())
+	}()
+	defer s.Shutdown()
+
+	// Give server 0.5 seconds to get to the listening state
+	timeout := time.NewTimer(time.Millisecond * 500)
+	for {
+		conn, err := net.Dial("tcp", "localhost:2156")
+		if err != nil && len(timeout.C) == 0 { // Retry errors
+			continue
+		}
+		assert.NoError(t, err)
+		conn.Close()
+		break
+	}
+
+	// the commands are recorded once replied, so the sessions end by NOOP
+	responses := sendCommands(t, "localhost:2156", "USER admin", "PASS admin", "OPTS UTF8 ON",
+		"EPSV", "EPSV", "PASV", "MODE Z", "NOOP")
+	assert.Len(t, responses, 8)
+	responses = sendCommands(t, "localhost:2156", "USER admin", "PASS admin", "PASV", "NOOP")
+	assert.Len(t, responses, 4)
+
+	assert.EqualValues(t, map[string]int64{
+		server.CapabilityPlaintext: 2,
+		server.CapabilityUTF8:      1,
+		server.CapabilityEPSV:      1,
+		server.CapabilityPASV:      2,
+		server.CapabilityModeZ:     1,
+	}, s.Stats().Capabilities)
+
+	var negotiated = make(map[string]int)
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var record server.AuditRecord
+		assert.NoError(t, json.Unmarshal([]byte(line), &record))
+		if record.Capability != "" {
+			negotiated[record.Command+" "+record.Capability]++
+		}
+	}
+	assert.EqualValues(t, map[string]int{
+		"PASS PLAINTEXT": 2,
+		"OPTS UTF8":      1,
+		"EPSV EPSV":      1,
+		"PASV PASV":      2,
+		"MODE MODE Z":    1,
+	}, negotiated)
+}
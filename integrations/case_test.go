@@ -0,0 +1,81 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaseInsensitive(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2133,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:            server.NewSimplePerm("test", "test"),
+		Logger:          new(server.DiscardLogger),
+		CaseInsensitive: true,
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			f, err := ftp.Connect("localhost:2133")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, f.Login("admin", "admin"))
+
+			assert.NoError(t, f.MakeDir("/Case"))
+			assert.NoError(t, f.Stor("/Case/Readme.TXT", strings.NewReader("first")))
+			assert.NoError(t, f.Stor("/CASE/README.txt", strings.NewReader("second")))
+
+			r, err := f.Retr("/case/readme.txt")
+			assert.NoError(t, err)
+			buf, err := ioutil.ReadAll(r)
+			assert.NoError(t, err)
+			assert.EqualValues(t, "second", string(buf))
+			assert.NoError(t, r.Close())
+
+			names, err := f.NameList("/case")
+			assert.NoError(t, err)
+			assert.EqualValues(t, []string{"Readme.TXT"}, names)
+
+			assert.NoError(t, f.Rename("/case/readme.txt", "/case/README.TXT"))
+			names, err = f.NameList("/CASE")
+			assert.NoError(t, err)
+			assert.EqualValues(t, []string{"README.TXT"}, names)
+
+			assert.NoError(t, f.Delete("/case/readme.txt"))
+			assert.NoError(t, f.RemoveDir("/case"))
+			_, err = os.Stat("./testdata/Case")
+			assert.True(t, os.IsNotExist(err))
+
+			assert.NoError(t, f.Quit())
+			break
+		}
+	})
+}
@@ -0,0 +1,103 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+)
+
+type checksumNotifier struct {
+	server.NullNotifier
+	lock      sync.Mutex
+	checksums []string
+}
+
+func (n *checksumNotifier) AfterFilePutEvent(ctx *server.Context, event *server.TransferEvent) {
+	n.lock.Lock()
+	n.checksums = append(n.checksums, "put:"+event.ChecksumAlgo+":"+event.Checksum)
+	n.lock.Unlock()
+}
+
+func (n *checksumNotifier) AfterFileDownloadedEvent(ctx *server.Context, event *server.TransferEvent) {
+	n.lock.Lock()
+	n.checksums = append(n.checksums, "get:"+event.ChecksumAlgo+":"+event.Checksum)
+	n.lock.Unlock()
+}
+
+func TestTransferChecksum(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2136,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:             server.NewSimplePerm("test", "test"),
+		Logger:           new(server.DiscardLogger),
+		TransferChecksum: "CRC32C",
+	}
+
+	notifier := &checksumNotifier{}
+	runServer(t, opt, []server.Notifier{notifier}, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			f, err := ftp.Connect("localhost:2136")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, f.Login("admin", "admin"))
+
+			assert.NoError(t, f.Stor("/checksum.txt", strings.NewReader("123456789")))
+			r, err := f.Retr("/checksum.txt")
+			assert.NoError(t, err)
+			_, err = ioutil.ReadAll(r)
+			assert.NoError(t, err)
+			assert.NoError(t, r.Close())
+
+			// the download event is sent after the reply
+			for i := 0; i < 100; i++ {
+				notifier.lock.Lock()
+				n := len(notifier.checksums)
+				notifier.lock.Unlock()
+				if n == 2 {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			notifier.lock.Lock()
+			// the CRC32C check value
+			assert.EqualValues(t, []string{"put:CRC32C:e3069283", "get:CRC32C:e3069283"}, notifier.checksums)
+			notifier.lock.Unlock()
+
+			assert.NoError(t, f.Delete("/checksum.txt"))
+			assert.NoError(t, f.Quit())
+			break
+		}
+	})
+
+	opt.TransferChecksum = "CRC64"
+	_, err = server.NewServer(opt)
+	assert.Error(t, err)
+}
@@ -0,0 +1,81 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// clientNotifier records the client software of the sessions logging in
+type clientNotifier struct {
+	server.NullNotifier
+	lock    sync.Mutex
+	clients []string
+}
+
+func (n *clientNotifier) AfterUserLogin(ctx *server.Context, userName, password string, passMatched bool, err error) {
+	n.lock.Lock()
+	n.clients = append(n.clients, ctx.ClientSoftware())
+	n.lock.Unlock()
+}
+
+func TestCLNT(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2185,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+	}
+
+	notifier := &clientNotifier{}
+	runServer(t, opt, []server.Notifier{notifier}, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			conn, err := net.Dial("tcp", "localhost:2185")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			conn.Close()
+			break
+		}
+
+		assert.EqualValues(t, []string{
+			"200 OK",
+			"331 User name ok, password required",
+			"230 Password ok, continue",
+		}, sendCommands(t, "localhost:2185", "CLNT Test Client 1.2", "USER admin", "PASS admin"))
+		assert.EqualValues(t, []string{
+			"331 User name ok, password required",
+			"230 Password ok, continue",
+		}, sendCommands(t, "localhost:2185", "USER admin", "PASS admin"))
+
+		// the client software is recorded on its session only
+		notifier.lock.Lock()
+		assert.EqualValues(t, []string{"Test Client 1.2", ""}, notifier.clients)
+		notifier.lock.Unlock()
+	})
+}
@@ -0,0 +1,108 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"os"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// sendTLSCommands sends the commands over a new control connection upgraded
+// by AUTH TLS and returns the responses formatted as "code message"
+func sendTLSCommands(t *testing.T, addr string, commands ...string) []string {
+	conn, err := net.Dial("tcp", addr)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	defer conn.Close()
+
+	control := textproto.NewConn(conn)
+	if _, _, err = control.ReadResponse(220); !assert.NoError(t, err) {
+		return nil
+	}
+	if _, err = control.Cmd("AUTH TLS"); !assert.NoError(t, err) {
+		return nil
+	}
+	if _, _, err = control.ReadResponse(234); !assert.NoError(t, err) {
+		return nil
+	}
+
+	control = textproto.NewConn(tls.Client(conn, &tls.Config{InsecureSkipVerify: true}))
+	var responses []string
+	for _, cmd := range commands {
+		if _, err := control.Cmd("%s", cmd); !assert.NoError(t, err) {
+			return responses
+		}
+		code, msg, _ := control.ReadResponse(0)
+		responses = append(responses, fmt.Sprintf("%d %s", code, msg))
+	}
+	return responses
+}
+
+func TestForceProtectedData(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftpprot")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeCertificate(t, dir)
+
+	driver, err := file.NewDriver(dir)
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2158,
+		Auth: &validityAuth{users: map[string]*server.UserInfo{
+			"secure": {ForceProtectedData: true},
+		}},
+		Perm:         server.NewSimplePerm("test", "test"),
+		Logger:       new(server.DiscardLogger),
+		TLS:          true,
+		ExplicitFTPS: true,
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			conn, err := net.Dial("tcp", "localhost:2158")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			conn.Close()
+			break
+		}
+
+		responses := sendTLSCommands(t, "localhost:2158", "USER secure", "PASS secret",
+			"EPSV", "PORT 127,0,0,1,8,0", "PROT C", "PBSZ 0", "PROT P", "EPSV")
+		if assert.Len(t, responses, 8) {
+			assert.EqualValues(t, "521 Data connection cannot be opened with this PROT setting, PROT P required", responses[2])
+			assert.EqualValues(t, "521 Data connection cannot be opened with this PROT setting, PROT P required", responses[3])
+			assert.EqualValues(t, "534 Request denied for policy reasons, PROT P required", responses[4])
+			assert.EqualValues(t, "200 OK", responses[6])
+			assert.Contains(t, responses[7], "229 ")
+		}
+
+		// the other users are not required to protect the data connections
+		responses = sendTLSCommands(t, "localhost:2158", "USER other", "PASS secret", "EPSV")
+		if assert.Len(t, responses, 3) {
+			assert.Contains(t, responses[2], "229 ")
+		}
+	})
+}
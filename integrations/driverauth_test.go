@@ -0,0 +1,95 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// authDriver authenticates the users itself
+type authDriver struct {
+	server.Driver
+}
+
+func (driver *authDriver) CheckPasswd(ctx *server.Context, name, pass string) (bool, error) {
+	return name == "admin" && pass == "secret", nil
+}
+
+func TestDriverAuthWrapped(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "ftp-driverauth")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+	journal, err := server.OpenJournal(filepath.Join(dir, "journal"), false)
+	assert.NoError(t, err)
+	defer journal.Close()
+
+	for port, opt := range map[int]*server.Options{
+		2178: {Spool: &server.Spool{Dir: dir}},
+		2179: {DriverMiddlewares: []server.DriverMiddleware{server.Aliases(map[string]string{"/current": "/"})}},
+		2189: {DriverMiddlewares: []server.DriverMiddleware{server.Versioning("")}},
+		2194: {DriverMiddlewares: []server.DriverMiddleware{server.Journaling(journal)}},
+		2195: {DriverMiddlewares: []server.DriverMiddleware{server.Indexing(&server.Index{Store: server.NewMemoryIndexStore()})}},
+	} {
+		opt.Name = "test ftpd"
+		opt.Driver = &authDriver{Driver: driver}
+		opt.Port = port
+		opt.Perm = server.NewSimplePerm("test", "test")
+		opt.Logger = new(server.DiscardLogger)
+
+		addr := net.JoinHostPort("localhost", strconv.Itoa(port))
+		runServer(t, opt, nil, func() {
+			// Give server 0.5 seconds to get to the listening state
+			timeout := time.NewTimer(time.Millisecond * 500)
+			for {
+				conn, err := net.Dial("tcp", addr)
+				if err != nil && len(timeout.C) == 0 { // Retry errors
+					continue
+				}
+				assert.NoError(t, err)
+				conn.Close()
+				break
+			}
+
+			// the wrappers of the driver keep its authentication
+			assert.EqualValues(t, []string{
+				"331 User name ok, password required",
+				"530 Incorrect password, not logged in",
+				"331 User name ok, password required",
+				"230 Password ok, continue",
+			}, sendCommands(t, addr,
+				"USER admin", "PASS admin",
+				"USER admin", "PASS secret"))
+
+			if port == 2179 || port == 2189 {
+				// the wrappers don't set the modification times if the
+				// driver doesn't
+				assert.EqualValues(t, []string{
+					"331 User name ok, password required",
+					"230 Password ok, continue",
+					"502 SITE UTIME is not supported by the driver",
+				}, sendCommands(t, addr,
+					"USER admin", "PASS secret",
+					"SITE UTIME /current 20200102150405"))
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDirSize(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2129,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:    server.NewSimplePerm("test", "test"),
+		Logger:  new(server.DiscardLogger),
+		DirSize: &server.DirSize{MaxEntries: 4},
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			f, err := ftp.Connect("localhost:2129")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, f.Login("admin", "admin"))
+
+			assert.NoError(t, f.MakeDir("/du"))
+			assert.NoError(t, f.MakeDir("/du/sub"))
+			assert.NoError(t, f.Stor("/du/a.txt", strings.NewReader("12345")))
+			assert.NoError(t, f.Stor("/du/sub/b.txt", strings.NewReader("123")))
+
+			size, err := f.FileSize("/du")
+			assert.NoError(t, err)
+			assert.EqualValues(t, 8, size)
+
+			responses := sendCommands(t, "localhost:2129", "USER admin", "PASS admin",
+				"CWD /du", "SITE DU", "SITE DU sub/b.txt")
+			assert.EqualValues(t, []string{
+				"331 User name ok, password required",
+				"230 Password ok, continue",
+				"250 Directory changed to /du",
+				"200 8 bytes in 2 files: /du",
+				"200 3 bytes in 1 files: /du/sub/b.txt",
+			}, responses)
+
+			assert.NoError(t, f.Stor("/du/c.txt", strings.NewReader("1")))
+			assert.NoError(t, f.Stor("/du/d.txt", strings.NewReader("1")))
+			responses = sendCommands(t, "localhost:2129", "USER admin", "PASS admin", "SITE DU /du")
+			assert.EqualValues(t, "550 Action not taken: Too many entries to compute the size", responses[2])
+
+			assert.NoError(t, f.RemoveDirRecur("/du"))
+			assert.NoError(t, f.Quit())
+			break
+		}
+	})
+}
@@ -0,0 +1,107 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// validityAuth accepts any user with the password "secret"
+type validityAuth struct {
+	users map[string]*server.UserInfo
+}
+
+func (auth *validityAuth) CheckPasswd(ctx *server.Context, name, pass string) (bool, error) {
+	return pass == "secret", nil
+}
+
+func (auth *validityAuth) UserInfo(ctx *server.Context, name string) (*server.UserInfo, error) {
+	return auth.users[name], nil
+}
+
+type loginNotifier struct {
+	server.NullNotifier
+	lock sync.Mutex
+	errs map[string]error
+}
+
+func (n *loginNotifier) AfterUserLogin(ctx *server.Context, userName, password string, passMatched bool, err error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.errs[userName] = err
+}
+
+func TestAccountValidity(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	now := time.Now()
+	notifier := &loginNotifier{errs: make(map[string]error)}
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2154,
+		Auth: &validityAuth{users: map[string]*server.UserInfo{
+			"expired":    {ExpiresAt: now.Add(-time.Hour)},
+			"future":     {NotBefore: now.Add(time.Hour)},
+			"contractor": {NotBefore: now.Add(-time.Hour), ExpiresAt: now.Add(time.Hour)},
+			"night": {Schedule: &server.LoginSchedule{
+				Start: now.UTC().Add(2 * time.Hour).Format("15:04"),
+				End:   now.UTC().Add(3 * time.Hour).Format("15:04"),
+			}},
+		}},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+	}
+
+	runServer(t, opt, []server.Notifier{notifier}, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			conn, err := net.Dial("tcp", "localhost:2154")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			conn.Close()
+			break
+		}
+
+		for user, reply := range map[string]string{
+			"expired":    "530 Account expired, not logged in",
+			"future":     "530 Account not yet valid, not logged in",
+			"night":      "530 Login not allowed at this time, not logged in",
+			"contractor": "230 Password ok, continue",
+			"permanent":  "230 Password ok, continue",
+		} {
+			responses := sendCommands(t, "localhost:2154", "USER "+user, "PASS secret")
+			if assert.Len(t, responses, 2) {
+				assert.EqualValues(t, reply, responses[1], user)
+			}
+		}
+	})
+
+	notifier.lock.Lock()
+	defer notifier.lock.Unlock()
+	assert.EqualValues(t, map[string]error{
+		"expired":    server.ErrAccountExpired,
+		"future":     server.ErrAccountNotYetValid,
+		"night":      server.ErrOutsideSchedule,
+		"contractor": nil,
+		"permanent":  nil,
+	}, notifier.errs)
+}
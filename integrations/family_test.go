@@ -0,0 +1,74 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDualStack(t *testing.T) {
+	l, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 is not available")
+	}
+	l.Close()
+
+	err = os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2144,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:             server.NewSimplePerm("test", "test"),
+		Logger:           new(server.DiscardLogger),
+		Hostnames:        []string{"127.0.0.1", "::1"},
+		PublicIP:         "1.2.3.4",
+		PassivePortsIPv6: "2145-2146",
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			conn, err := net.Dial("tcp", "[::1]:2144")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			conn.Close()
+			break
+		}
+
+		responses := sendCommands(t, "127.0.0.1:2144", "USER admin", "PASS admin", "PASV")
+		if assert.Len(t, responses, 3) {
+			assert.True(t, strings.HasPrefix(responses[2], "227 Entering Passive Mode (1,2,3,4,"), responses[2])
+		}
+
+		responses = sendCommands(t, "[::1]:2144", "USER admin", "PASS admin", "PASV", "EPSV")
+		assert.EqualValues(t, []string{
+			"331 User name ok, password required",
+			"230 Password ok, continue",
+			"425 PASV is not supported over IPv6, use EPSV",
+			"229 Entering Extended Passive Mode (|||2145|)",
+		}, responses)
+	})
+}
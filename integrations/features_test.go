@@ -0,0 +1,206 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/md5"
+	"encoding/hex"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeaturesDisabled(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:     "test ftpd",
+		Driver:   driver,
+		Port:     2197,
+		Auth:     &validityAuth{},
+		Perm:     server.NewSimplePerm("test", "test"),
+		Logger:   new(server.DiscardLogger),
+		Features: &server.Features{},
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			conn, err := net.Dial("tcp", "localhost:2197")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			conn.Close()
+			break
+		}
+
+		responses := sendCommands(t, "localhost:2197",
+			"USER anonymous", "PASS guest",
+			"USER admin", "PASS secret",
+			"FEAT", "MODE Z", "HASH /a.txt", "OPTS HASH MD5", "APPE /a.txt", "SITE HELP",
+			// the data connections with another host than the client
+			"PORT 10,0,0,1,8,0", "EPRT |1|10.0.0.1|2048|")
+		if assert.Len(t, responses, 12) {
+			// the anonymous logins are disabled
+			assert.EqualValues(t, "530 Incorrect password, not logged in", responses[1])
+			assert.EqualValues(t, "230 Password ok, continue", responses[3])
+			// the disabled commands are not advertised
+			assert.Contains(t, responses[4], "211 Extensions supported:")
+			assert.NotContains(t, responses[4], "MODE Z")
+			assert.NotContains(t, responses[4], "HASH")
+			assert.EqualValues(t, []string{
+				"504 MODE Z is disabled",
+				"502 Command not implemented",
+				"550 Unknow params",
+				"502 Command not implemented",
+				"502 Command not implemented",
+				"425 Data connection failed",
+				"425 Data connection failed",
+			}, responses[5:])
+		}
+	})
+}
+
+// dialPassive enters the extended passive mode and opens the data
+// connection
+func dialPassive(t *testing.T, conn *textproto.Conn) net.Conn {
+	_, err := conn.Cmd("EPSV")
+	assert.NoError(t, err)
+	_, msg, err := conn.ReadResponse(229)
+	assert.NoError(t, err)
+	port := strings.Trim(msg[strings.Index(msg, "(")+1:], "|)")
+	dataConn, err := net.Dial("tcp", net.JoinHostPort("localhost", port))
+	assert.NoError(t, err)
+	return dataConn
+}
+
+func TestFeaturesEnabled(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+	defer os.Remove("./testdata/features.txt")
+	var content = strings.Repeat("compressed content ", 100)
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	features := server.DefaultFeatures()
+	features.Anonymous = true
+	opt := &server.Options{
+		Name:     "test ftpd",
+		Driver:   driver,
+		Port:     2198,
+		Auth:     &validityAuth{},
+		Perm:     server.NewSimplePerm("test", "test"),
+		Logger:   new(server.DiscardLogger),
+		Features: features,
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			conn, err := net.Dial("tcp", "localhost:2198")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			conn.Close()
+			break
+		}
+
+		// the file is uploaded and downloaded in MODE Z
+		conn, err := textproto.Dial("tcp", "localhost:2198")
+		assert.NoError(t, err)
+		defer conn.Close()
+		_, _, err = conn.ReadResponse(220)
+		assert.NoError(t, err)
+		for _, cmd := range []string{"USER admin", "PASS secret", "MODE Z"} {
+			_, err = conn.Cmd("%s", cmd)
+			assert.NoError(t, err)
+			_, _, err = conn.ReadResponse(0)
+			assert.NoError(t, err)
+		}
+
+		dataConn := dialPassive(t, conn)
+		_, err = conn.Cmd("STOR /features.txt")
+		assert.NoError(t, err)
+		_, _, err = conn.ReadResponse(150)
+		assert.NoError(t, err)
+		w := zlib.NewWriter(dataConn)
+		_, err = w.Write([]byte(content))
+		assert.NoError(t, err)
+		assert.NoError(t, w.Close())
+		dataConn.Close()
+		_, _, err = conn.ReadResponse(226)
+		assert.NoError(t, err)
+		data, err := ioutil.ReadFile("./testdata/features.txt")
+		assert.NoError(t, err)
+		assert.EqualValues(t, content, string(data))
+
+		dataConn = dialPassive(t, conn)
+		_, err = conn.Cmd("RETR /features.txt")
+		assert.NoError(t, err)
+		_, _, err = conn.ReadResponse(150)
+		assert.NoError(t, err)
+		compressed, err := ioutil.ReadAll(dataConn)
+		assert.NoError(t, err)
+		dataConn.Close()
+		_, _, err = conn.ReadResponse(226)
+		assert.NoError(t, err)
+		assert.True(t, len(compressed) < len(content))
+		r, err := zlib.NewReader(bytes.NewReader(compressed))
+		if assert.NoError(t, err) {
+			data, err = ioutil.ReadAll(r)
+			assert.NoError(t, err)
+			assert.EqualValues(t, content, string(data))
+		}
+
+		sum := md5.Sum([]byte(content))
+		responses := sendCommands(t, "localhost:2198",
+			"USER admin", "PASS secret",
+			"FEAT", "OPTS HASH MD5", "HASH /features.txt")
+		if assert.Len(t, responses, 5) {
+			assert.Contains(t, responses[2], " MODE Z\n")
+			assert.Contains(t, responses[2], " HASH ")
+			assert.EqualValues(t, "200 MD5", responses[3])
+			assert.EqualValues(t, "213 MD5 0-1900 "+hex.EncodeToString(sum[:])+" /features.txt", responses[4])
+		}
+
+		// the anonymous users could only read the files
+		assert.EqualValues(t, []string{
+			"331 User name ok, password required",
+			"230 Password ok, continue",
+			"550 Action not taken: read-only access",
+			"550 Action not taken: read-only access",
+			"550 Action not taken: read-only access",
+			"550 Action not taken: read-only access",
+			"213 1900",
+		}, sendCommands(t, "localhost:2198",
+			"USER anonymous", "PASS guest@example.com",
+			"STOR /anonymous.txt", "MKD /anonymous", "DELE /features.txt",
+			"SITE UTIME 20200102150405 /features.txt",
+			"SIZE /features.txt"))
+		retrieved, _ := retrieveData(t, "localhost:2198", "/features.txt",
+			"USER ftp", "PASS guest@example.com", "EPSV")
+		assert.EqualValues(t, content, retrieved)
+	})
+}
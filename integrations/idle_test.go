@@ -0,0 +1,143 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdleTimeoutDuringTransfer(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2141,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:        server.NewSimplePerm("test", "test"),
+		Logger:      new(server.DiscardLogger),
+		IdleTimeout: 300 * time.Millisecond,
+		RateLimit:   8 * 1024,
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			f, err := ftp.Connect("localhost:2141")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, f.Login("admin", "admin"))
+
+			// the upload lasts longer than the idle timeout
+			var content = strings.Repeat("idle", 4*1024)
+			assert.NoError(t, f.Stor("/idle.txt", strings.NewReader(content)))
+			buf, err := ioutil.ReadFile("./testdata/idle.txt")
+			assert.NoError(t, err)
+			assert.EqualValues(t, content, string(buf))
+
+			assert.NoError(t, f.Delete("/idle.txt"))
+			assert.NoError(t, f.Quit())
+			break
+		}
+	})
+}
+
+// idleLogin logs in over a new control connection then waits for the
+// duration before sending NOOP, it returns the code and the message replied
+func idleLogin(t *testing.T, user string, wait time.Duration) (int, string) {
+	conn, err := textproto.Dial("tcp", "localhost:2200")
+	if !assert.NoError(t, err) {
+		return 0, ""
+	}
+	defer conn.Close()
+
+	_, _, err = conn.ReadResponse(220)
+	assert.NoError(t, err)
+	for _, cmd := range []string{"USER " + user, "PASS secret"} {
+		_, err = conn.Cmd("%s", cmd)
+		assert.NoError(t, err)
+		_, _, err = conn.ReadResponse(0)
+		assert.NoError(t, err)
+	}
+	time.Sleep(wait)
+	_, err = conn.Cmd("NOOP")
+	assert.NoError(t, err)
+	code, msg, _ := conn.ReadResponse(0)
+	return code, msg
+}
+
+func TestIdleTimeout(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2200,
+		Auth: &validityAuth{users: map[string]*server.UserInfo{
+			"patient": {IdleTimeout: time.Minute},
+		}},
+		Perm:        server.NewSimplePerm("test", "test"),
+		Logger:      new(server.DiscardLogger),
+		IdleTimeout: 300 * time.Millisecond,
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			conn, err := net.Dial("tcp", "localhost:2200")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			conn.Close()
+			break
+		}
+
+		// the session waiting for the login is closed too
+		conn, err := textproto.Dial("tcp", "localhost:2200")
+		assert.NoError(t, err)
+		_, _, err = conn.ReadResponse(220)
+		assert.NoError(t, err)
+		code, msg, _ := conn.ReadResponse(0)
+		assert.EqualValues(t, 421, code)
+		assert.EqualValues(t, "Idle timeout, closing control connection", msg)
+		conn.Close()
+
+		code, msg = idleLogin(t, "other", time.Second)
+		assert.EqualValues(t, 421, code)
+		assert.EqualValues(t, "Idle timeout, closing control connection", msg)
+
+		// the timeout of the user overrides the server one
+		code, _ = idleLogin(t, "patient", time.Second)
+		assert.EqualValues(t, 200, code)
+	})
+}
@@ -0,0 +1,105 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIgnoreUploads(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2196,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+		IgnoreUploads: []server.IgnoreRule{
+			{Pattern: "*.tmp", Action: server.IgnoreDrop},
+		},
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			f, err := ftp.Connect("localhost:2196")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, f.Login("admin", "admin"))
+
+			assert.NoError(t, f.Stor("/dropped.tmp", strings.NewReader("dropped")))
+			_, err = os.Stat("./testdata/dropped.tmp")
+			assert.True(t, os.IsNotExist(err))
+
+			assert.NoError(t, f.Stor("/stored.txt", strings.NewReader("stored")))
+			data, err := ioutil.ReadFile("./testdata/stored.txt")
+			assert.NoError(t, err)
+			assert.EqualValues(t, "stored", string(data))
+
+			assert.NoError(t, f.Delete("/stored.txt"))
+			assert.NoError(t, f.Quit())
+			break
+		}
+
+		// the data connection of the dropped upload is closed
+		conn, err := textproto.Dial("tcp", "localhost:2196")
+		assert.NoError(t, err)
+		defer conn.Close()
+		_, _, err = conn.ReadResponse(220)
+		assert.NoError(t, err)
+		for _, cmd := range []string{"USER admin", "PASS admin"} {
+			_, err = conn.Cmd("%s", cmd)
+			assert.NoError(t, err)
+			_, _, err = conn.ReadResponse(0)
+			assert.NoError(t, err)
+		}
+		_, err = conn.Cmd("EPSV")
+		assert.NoError(t, err)
+		_, msg, err := conn.ReadResponse(229)
+		assert.NoError(t, err)
+		port := strings.Trim(msg[strings.Index(msg, "(")+1:], "|)")
+		dataConn, err := net.Dial("tcp", net.JoinHostPort("localhost", port))
+		assert.NoError(t, err)
+		defer dataConn.Close()
+		_, err = conn.Cmd("STOR /dropped.tmp")
+		assert.NoError(t, err)
+		_, _, err = conn.ReadResponse(150)
+		assert.NoError(t, err)
+		_, err = dataConn.Write([]byte("dropped"))
+		assert.NoError(t, err)
+		assert.NoError(t, dataConn.(*net.TCPConn).CloseWrite())
+		_, _, err = conn.ReadResponse(226)
+		assert.NoError(t, err)
+		assert.NoError(t, dataConn.SetReadDeadline(time.Now().Add(time.Second)))
+		_, err = dataConn.Read(make([]byte, 1))
+		if netErr, ok := err.(net.Error); ok {
+			assert.False(t, netErr.Timeout(), "the data connection is still open")
+		}
+	})
+}
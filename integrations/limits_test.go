@@ -0,0 +1,74 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathLimits(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2130,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+		PathLimits: &server.PathLimits{
+			MaxLength:  20,
+			MaxDepth:   3,
+			MaxEntries: 2,
+		},
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			f, err := ftp.Connect("localhost:2130")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, f.Login("admin", "admin"))
+
+			assert.NoError(t, f.MakeDir("/limits"))
+			assert.NoError(t, f.MakeDir("/limits/a"))
+			assert.Error(t, f.MakeDir("/limits/a/b/c"))
+			assert.Error(t, f.Stor("/limits/a/a-very-long-name.txt", strings.NewReader("limits")))
+
+			assert.NoError(t, f.Stor("/limits/1.txt", strings.NewReader("limits")))
+			assert.Error(t, f.Stor("/limits/2.txt", strings.NewReader("limits")))
+			// overwriting doesn't add an entry
+			assert.NoError(t, f.Stor("/limits/1.txt", strings.NewReader("limits")))
+			assert.Error(t, f.Rename("/limits/1.txt", "/limits/a/b/c.txt"))
+
+			responses := sendCommands(t, "localhost:2130", "USER admin", "PASS admin", "MKD /limits/b")
+			assert.EqualValues(t, "553 Requested action not taken: Too many entries in the directory", responses[2])
+
+			assert.NoError(t, f.RemoveDirRecur("/limits"))
+			assert.NoError(t, f.Quit())
+			break
+		}
+	})
+}
@@ -0,0 +1,93 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingDriver counts the directories listed
+type countingDriver struct {
+	server.Driver
+	lists int32
+}
+
+func (driver *countingDriver) ListDir(ctx *server.Context, path string, callback func(os.FileInfo) error) error {
+	atomic.AddInt32(&driver.lists, 1)
+	return driver.Driver.ListDir(ctx, path, callback)
+}
+
+func TestListingCache(t *testing.T) {
+	err := os.MkdirAll("./testdata/listing", os.ModePerm)
+	assert.NoError(t, err)
+	defer os.RemoveAll("./testdata/listing")
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	counting := &countingDriver{Driver: driver}
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: counting,
+		Port:   2155,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:         server.NewSimplePerm("test", "test"),
+		Logger:       new(server.DiscardLogger),
+		ListingCache: &server.ListingCache{TTL: time.Minute},
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			f, err := ftp.Connect("localhost:2155")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+
+			assert.NoError(t, f.Login("admin", "admin"))
+			assert.NoError(t, f.Stor("/listing/a.txt", strings.NewReader("a")))
+
+			for i := 0; i < 3; i++ {
+				names, err := f.NameList("/listing")
+				assert.NoError(t, err)
+				assert.EqualValues(t, []string{"a.txt"}, names)
+			}
+			assert.EqualValues(t, 1, atomic.LoadInt32(&counting.lists))
+
+			// the uploads of the session clear its cache
+			assert.NoError(t, f.Stor("/listing/b.txt", strings.NewReader("b")))
+			names, err := f.NameList("/listing")
+			assert.NoError(t, err)
+			assert.EqualValues(t, []string{"a.txt", "b.txt"}, names)
+			assert.EqualValues(t, 2, atomic.LoadInt32(&counting.lists))
+
+			assert.NoError(t, f.Delete("/listing/a.txt"))
+			entries, err := f.List("/listing")
+			assert.NoError(t, err)
+			if assert.Len(t, entries, 1) {
+				assert.EqualValues(t, "b.txt", entries[0].Name)
+			}
+			assert.EqualValues(t, 3, atomic.LoadInt32(&counting.lists))
+
+			assert.NoError(t, f.Quit())
+			break
+		}
+	})
+}
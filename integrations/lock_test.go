@@ -0,0 +1,86 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrentUploads(t *testing.T) {
+	err := os.MkdirAll("./testdata/locks", os.ModePerm)
+	assert.NoError(t, err)
+	defer os.RemoveAll("./testdata/locks")
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2162,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		var first *ftp.ServerConn
+		for {
+			first, err = ftp.Connect("localhost:2162")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			break
+		}
+		assert.NoError(t, first.Login("admin", "admin"))
+
+		// the first upload is written until the pipe is closed
+		r, w := io.Pipe()
+		done := make(chan error)
+		go func() {
+			done <- first.Stor("/locks/a.txt", r)
+		}()
+		_, err = w.Write([]byte("first"))
+		assert.NoError(t, err)
+
+		second, err := ftp.Connect("localhost:2162")
+		assert.NoError(t, err)
+		assert.NoError(t, second.Login("admin", "admin"))
+		err = second.Stor("/locks/a.txt", strings.NewReader("second"))
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "450")
+		}
+		// the other paths are not locked
+		assert.NoError(t, second.Stor("/locks/b.txt", strings.NewReader("b")))
+
+		assert.NoError(t, w.Close())
+		assert.NoError(t, <-done)
+		data, err := ioutil.ReadFile("./testdata/locks/a.txt")
+		assert.NoError(t, err)
+		assert.EqualValues(t, "first", string(data))
+
+		// the lock is released once the upload is done
+		assert.NoError(t, second.Stor("/locks/a.txt", strings.NewReader("second")))
+		assert.NoError(t, first.Quit())
+		assert.NoError(t, second.Quit())
+	})
+}
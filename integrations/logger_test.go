@@ -0,0 +1,127 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// factoryLogger records the lines prefixed by the fields of the logger
+type factoryLogger struct {
+	fields server.LogFields
+	lock   *sync.Mutex
+	lines  *[]string
+}
+
+func newFactoryLogger() *factoryLogger {
+	return &factoryLogger{
+		lock:  new(sync.Mutex),
+		lines: new([]string),
+	}
+}
+
+func (logger *factoryLogger) NewSessionLogger(fields server.LogFields) server.Logger {
+	return &factoryLogger{
+		fields: fields,
+		lock:   logger.lock,
+		lines:  logger.lines,
+	}
+}
+
+func (logger *factoryLogger) Print(sessionID string, message interface{}) {
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+	*logger.lines = append(*logger.lines, fmt.Sprintf("%s %s@%s %v",
+		logger.fields.SessionID, logger.fields.User, logger.fields.RemoteAddr, message))
+}
+
+func (logger *factoryLogger) Printf(sessionID string, format string, v ...interface{}) {
+	logger.Print(sessionID, fmt.Sprintf(format, v...))
+}
+
+func (logger *factoryLogger) PrintCommand(sessionID string, command string, params string) {
+	logger.Print(sessionID, "> "+command+" "+params)
+}
+
+func (logger *factoryLogger) PrintResponse(sessionID string, code int, message string) {
+	logger.Print(sessionID, fmt.Sprintf("< %d %s", code, message))
+}
+
+// find returns the logged lines containing s
+func (logger *factoryLogger) find(s string) []string {
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+	var lines []string
+	for _, line := range *logger.lines {
+		if strings.Contains(line, s) {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func TestSessionLogger(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	logger := newFactoryLogger()
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2201,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: logger,
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			conn, err := net.Dial("tcp", "localhost:2201")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			conn.Close()
+			break
+		}
+
+		sendCommands(t, "localhost:2201", "USER admin", "PASS admin", "PWD", "QUIT")
+		sendCommands(t, "localhost:2201", "USER admin", "PASS admin", "PWD", "QUIT")
+	})
+
+	// the lines before the login are bound to the session without user, the
+	// ones after to the login user
+	users := logger.find("> USER admin")
+	pwds := logger.find("> PWD ")
+	if assert.Len(t, users, 2) && assert.Len(t, pwds, 2) {
+		for i := range users {
+			fields := strings.Fields(users[i])
+			assert.NotEmpty(t, fields[0])
+			assert.True(t, strings.HasPrefix(fields[1], "@127.0.0.1:"), fields[1])
+			assert.EqualValues(t, fields[0]+" admin"+fields[1], strings.Join(strings.Fields(pwds[i])[:2], " "))
+		}
+		// every session gets its own id
+		assert.NotEqual(t, strings.Fields(users[0])[0], strings.Fields(users[1])[0])
+	}
+}
@@ -5,6 +5,11 @@
 package integrations
 
 import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"strings"
 	"testing"
 
 	"goftp.io/server/v2"
@@ -27,3 +32,84 @@ func runServer(t *testing.T, opt *server.Options, notifiers []server.Notifier, e
 
 	assert.NoError(t, s.Shutdown())
 }
+
+// sendCommands sends the commands over a new control connection and returns
+// the responses formatted as "code message"
+func sendCommands(t *testing.T, addr string, commands ...string) []string {
+	conn, err := textproto.Dial("tcp", addr)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	defer conn.Close()
+
+	if _, _, err := conn.ReadResponse(220); !assert.NoError(t, err) {
+		return nil
+	}
+	var responses []string
+	for _, cmd := range commands {
+		if _, err := conn.Cmd("%s", cmd); !assert.NoError(t, err) {
+			return responses
+		}
+		code, msg, _ := conn.ReadResponse(0)
+		responses = append(responses, fmt.Sprintf("%d %s", code, msg))
+	}
+	return responses
+}
+
+// retrieveData sends the commands, which should contain EPSV, over a new
+// control connection then retrieves the file over the passive data
+// connection, it returns the data received and the responses formatted as
+// "code message"
+func retrieveData(t *testing.T, addr, path string, commands ...string) (string, []string) {
+	return receiveData(t, addr, "RETR "+path, commands...)
+}
+
+// receiveData sends the commands, which should contain EPSV, over a new
+// control connection then sends the command reading the passive data
+// connection, i.e. RETR or LIST, it returns the data received and the
+// responses formatted as "code message"
+func receiveData(t *testing.T, addr, command string, commands ...string) (string, []string) {
+	conn, err := textproto.Dial("tcp", addr)
+	if !assert.NoError(t, err) {
+		return "", nil
+	}
+	defer conn.Close()
+
+	if _, _, err := conn.ReadResponse(220); !assert.NoError(t, err) {
+		return "", nil
+	}
+	var responses []string
+	var port string
+	for _, cmd := range commands {
+		if _, err := conn.Cmd("%s", cmd); !assert.NoError(t, err) {
+			return "", responses
+		}
+		code, msg, _ := conn.ReadResponse(0)
+		responses = append(responses, fmt.Sprintf("%d %s", code, msg))
+		if code == 229 {
+			// Entering Extended Passive Mode (|||port|)
+			port = strings.Trim(msg[strings.Index(msg, "(")+1:], "|)")
+		}
+	}
+
+	host, _, _ := net.SplitHostPort(addr)
+	dataConn, err := net.Dial("tcp", net.JoinHostPort(host, port))
+	if !assert.NoError(t, err) {
+		return "", responses
+	}
+	defer dataConn.Close()
+
+	if _, err := conn.Cmd("%s", command); !assert.NoError(t, err) {
+		return "", responses
+	}
+	code, msg, _ := conn.ReadResponse(0)
+	responses = append(responses, fmt.Sprintf("%d %s", code, msg))
+	if code != 150 {
+		return "", responses
+	}
+	data, err := ioutil.ReadAll(dataConn)
+	assert.NoError(t, err)
+	code, msg, _ = conn.ReadResponse(0)
+	responses = append(responses, fmt.Sprintf("%d %s", code, msg))
+	return string(data), responses
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+)
+
+// readOnlyDriver refuses to delete files
+type readOnlyDriver struct {
+	server.Driver
+}
+
+func (driver *readOnlyDriver) DeleteFile(ctx *server.Context, path string) error {
+	return errors.New("read only")
+}
+
+func TestMiddleware(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2124,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+		DriverMiddlewares: []server.DriverMiddleware{
+			func(driver server.Driver) server.Driver {
+				return &readOnlyDriver{driver}
+			},
+		},
+	}
+
+	s, err := server.NewServer(opt)
+	assert.NoError(t, err)
+
+	var (
+		lock     sync.Mutex
+		commands []string
+	)
+	s.Use(func(next server.CommandHandler) server.CommandHandler {
+		return func(ctx *server.Context) {
+			lock.Lock()
+			commands = append(commands, ctx.Cmd)
+			lock.Unlock()
+			next(ctx)
+		}
+	}, func(next server.CommandHandler) server.CommandHandler {
+		return func(ctx *server.Context) {
+			if ctx.Cmd == "MKD" {
+				ctx.Sess.WriteMessage(550, "Directories cannot be created")
+				return
+			}
+			next(ctx)
+		}
+	})
+
+	go func() {
+		err := s.ListenAndServe()
+		assert.EqualError(t, err, server.ErrServerClosed.Error())
+	}()
+
+	// Give server 0.5 seconds to get to the listening state
+	timeout := time.NewTimer(time.Millisecond * 500)
+	for {
+		f, err := ftp.Connect("localhost:2124")
+		if err != nil && len(timeout.C) == 0 { // Retry errors
+			continue
+		}
+		assert.NoError(t, err)
+
+		assert.NoError(t, f.Login("admin", "admin"))
+		assert.Error(t, f.MakeDir("/src"))
+
+		_, err = os.Stat("./testdata/src")
+		assert.True(t, os.IsNotExist(err))
+
+		assert.NoError(t, f.Stor("/middleware.txt", strings.NewReader("test")))
+		assert.Error(t, f.Delete("/middleware.txt"))
+		assert.NoError(t, os.Remove("./testdata/middleware.txt"))
+
+		assert.NoError(t, f.Quit())
+		break
+	}
+
+	lock.Lock()
+	assert.Contains(t, commands, "PASS")
+	assert.Contains(t, commands, "MKD")
+	lock.Unlock()
+
+	assert.NoError(t, s.Shutdown())
+}
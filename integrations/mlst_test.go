@@ -0,0 +1,68 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMLST(t *testing.T) {
+	assert.NoError(t, os.MkdirAll("./testdata/mlst", os.ModePerm))
+	defer os.RemoveAll("./testdata/mlst")
+	assert.NoError(t, ioutil.WriteFile("./testdata/mlst/a.txt", []byte("hello"), 0644))
+	assert.NoError(t, os.Chmod("./testdata/mlst/a.txt", 0644))
+	mtime := time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC)
+	assert.NoError(t, os.Chtimes("./testdata/mlst/a.txt", mtime, mtime))
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2175,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			conn, err := net.Dial("tcp", "localhost:2175")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			conn.Close()
+			break
+		}
+
+		responses := sendCommands(t, "localhost:2175", "USER admin", "PASS admin", "FEAT",
+			"MLST /mlst/a.txt", "OPTS MLST size;TYPE;unknown;", "MLST /mlst/a.txt", "MLST /mlst/missing.txt")
+		if assert.Len(t, responses, 7) {
+			assert.Contains(t, responses[2], "\n MLST Type*;Modify*;Size*;Perm*;UNIX.owner*;UNIX.group*;\n")
+			assert.EqualValues(t, "250 Listing /mlst/a.txt\n"+
+				" Type=file;Modify=20200102150405;Size=5;Perm=radfw;UNIX.owner=test;UNIX.group=test; /mlst/a.txt\n"+
+				"End", responses[3])
+			assert.EqualValues(t, "200 MLST OPTS Type;Size;", responses[4])
+			assert.EqualValues(t, "250 Listing /mlst/a.txt\n Type=file;Size=5; /mlst/a.txt\nEnd", responses[5])
+			assert.Contains(t, responses[6], "550 ")
+		}
+	})
+}
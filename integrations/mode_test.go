@@ -0,0 +1,79 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"net"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateModes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no permission bits on windows")
+	}
+	assert.NoError(t, os.MkdirAll("./testdata/modes", os.ModePerm))
+	defer os.RemoveAll("./testdata/modes")
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2171,
+		Auth: &validityAuth{users: map[string]*server.UserInfo{
+			"private": {Umask: 0077},
+		}},
+		Perm:     server.NewSimplePerm("test", "test"),
+		Logger:   new(server.DiscardLogger),
+		FileMode: 0640,
+		DirMode:  0750,
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			conn, err := net.Dial("tcp", "localhost:2171")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			conn.Close()
+			break
+		}
+
+		for _, user := range []string{"shared", "private"} {
+			f, err := ftp.Connect("localhost:2171")
+			assert.NoError(t, err)
+			assert.NoError(t, f.Login(user, "secret"))
+			assert.NoError(t, f.MakeDir("/modes/"+user))
+			assert.NoError(t, f.Stor("/modes/"+user+"/a.txt", strings.NewReader("a")))
+			assert.NoError(t, f.Quit())
+		}
+	})
+
+	for path, mode := range map[string]os.FileMode{
+		"./testdata/modes/shared":        0750,
+		"./testdata/modes/shared/a.txt":  0640,
+		"./testdata/modes/private":       0700,
+		"./testdata/modes/private/a.txt": 0600,
+	} {
+		info, err := os.Stat(path)
+		if assert.NoError(t, err) {
+			assert.EqualValues(t, mode, info.Mode().Perm(), path)
+		}
+	}
+}
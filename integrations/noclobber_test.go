@@ -0,0 +1,121 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNoClobberPaths(t *testing.T) {
+	for _, dir := range []string{"./testdata/shared", "./testdata/incoming"} {
+		assert.NoError(t, os.MkdirAll(dir, os.ModePerm))
+		defer os.RemoveAll(dir)
+	}
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2170,
+		Auth: &validityAuth{users: map[string]*server.UserInfo{
+			"partner": {NoClobberPaths: []string{"/incoming"}},
+		}},
+		Perm:           server.NewSimplePerm("test", "test"),
+		Logger:         new(server.DiscardLogger),
+		NoClobberPaths: []string{"/shared"},
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			conn, err := net.Dial("tcp", "localhost:2170")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			conn.Close()
+			break
+		}
+
+		f, err := ftp.Connect("localhost:2170")
+		assert.NoError(t, err)
+		assert.NoError(t, f.Login("partner", "secret"))
+		assert.NoError(t, f.Stor("/shared/a.txt", strings.NewReader("a")))
+		err = f.Stor("/shared/a.txt", strings.NewReader("x"))
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "553 ")
+			assert.Contains(t, err.Error(), "/shared/a.txt already exists")
+		}
+		// a resume at the end of the file appends to it
+		assert.NoError(t, f.StorFrom("/shared/a.txt", strings.NewReader("b"), 1))
+		assert.Error(t, f.StorFrom("/shared/a.txt", strings.NewReader("x"), 0))
+		assert.NoError(t, f.Stor("/incoming/c.txt", strings.NewReader("c")))
+		assert.Error(t, f.Stor("/incoming/c.txt", strings.NewReader("x")))
+		assert.NoError(t, f.Delete("/incoming/c.txt"))
+		assert.NoError(t, f.Stor("/incoming/c.txt", strings.NewReader("d")))
+		assert.NoError(t, f.Quit())
+
+		// APPE appends to the end of the file
+		conn, err := textproto.Dial("tcp", "localhost:2170")
+		assert.NoError(t, err)
+		defer conn.Close()
+		_, _, err = conn.ReadResponse(220)
+		assert.NoError(t, err)
+		for _, cmd := range []string{"USER partner", "PASS secret"} {
+			_, err = conn.Cmd("%s", cmd)
+			assert.NoError(t, err)
+			_, _, err = conn.ReadResponse(0)
+			assert.NoError(t, err)
+		}
+		dataConn := dialPassive(t, conn)
+		_, err = conn.Cmd("APPE /shared/a.txt")
+		assert.NoError(t, err)
+		_, _, err = conn.ReadResponse(150)
+		assert.NoError(t, err)
+		_, err = dataConn.Write([]byte("c"))
+		assert.NoError(t, err)
+		dataConn.Close()
+		_, _, err = conn.ReadResponse(226)
+		assert.NoError(t, err)
+
+		// APPE could not resume in the middle of the file
+		responses := sendCommands(t, "localhost:2170", "USER partner", "PASS secret", "REST 1", "APPE /shared/a.txt")
+		if assert.Len(t, responses, 4) {
+			assert.EqualValues(t, "350 Start transfer from 1", responses[2])
+			assert.Contains(t, responses[3], "553 ")
+		}
+
+		// the no-clobber directories of the user could be overwritten by
+		// the others
+		f, err = ftp.Connect("localhost:2170")
+		assert.NoError(t, err)
+		assert.NoError(t, f.Login("other", "secret"))
+		assert.Error(t, f.Stor("/shared/a.txt", strings.NewReader("x")))
+		assert.NoError(t, f.Stor("/incoming/c.txt", strings.NewReader("e")))
+		assert.NoError(t, f.Quit())
+	})
+
+	data, err := ioutil.ReadFile("./testdata/shared/a.txt")
+	assert.NoError(t, err)
+	assert.EqualValues(t, "abc", string(data))
+	data, err = ioutil.ReadFile("./testdata/incoming/c.txt")
+	assert.NoError(t, err)
+	assert.EqualValues(t, "e", string(data))
+}
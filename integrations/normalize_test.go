@@ -0,0 +1,77 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnicodeNormalization(t *testing.T) {
+	err := os.MkdirAll("./testdata/normalize", os.ModePerm)
+	assert.NoError(t, err)
+	defer os.RemoveAll("./testdata/normalize")
+
+	// a decomposed name, as uploaded by macOS clients
+	err = ioutil.WriteFile("./testdata/normalize/cafe\u0301.txt", []byte("nfd"), os.ModePerm)
+	assert.NoError(t, err)
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2131,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:                 server.NewSimplePerm("test", "test"),
+		Logger:               new(server.DiscardLogger),
+		UnicodeNormalization: server.NormalizeNFC,
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			f, err := ftp.Connect("localhost:2131")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, f.Login("admin", "admin"))
+
+			r, err := f.Retr("/normalize/caf\u00e9.txt")
+			assert.NoError(t, err)
+			buf, err := ioutil.ReadAll(r)
+			assert.NoError(t, err)
+			assert.EqualValues(t, "nfd", string(buf))
+			assert.NoError(t, r.Close())
+
+			// the existing file is overwritten instead of being duplicated
+			assert.NoError(t, f.Stor("/normalize/caf\u00e9.txt", strings.NewReader("nfc")))
+			assert.NoError(t, f.Stor("/normalize/nai\u0308ve.txt", strings.NewReader("nfc")))
+			assert.NoError(t, f.MakeDir("/normalize/re\u0301sume\u0301"))
+
+			names, err := f.NameList("/normalize")
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, []string{"cafe\u0301.txt", "na\u00efve.txt", "r\u00e9sum\u00e9"}, names)
+
+			assert.NoError(t, f.Quit())
+			break
+		}
+	})
+}
@@ -7,6 +7,7 @@ package integrations
 import (
 	"io/ioutil"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -20,7 +21,8 @@ import (
 )
 
 var (
-	_ server.Notifier = &mockNotifier{}
+	_ server.Notifier         = &mockNotifier{}
+	_ server.TransferNotifier = &mockNotifier{}
 )
 
 type mockNotifier struct {
@@ -99,6 +101,17 @@ func (m *mockNotifier) AfterFileDownloaded(ctx *server.Context, dstPath string,
 	m.lock.Unlock()
 }
 
+func (m *mockNotifier) AfterFilePutEvent(ctx *server.Context, event *server.TransferEvent) {
+	m.lock.Lock()
+	m.actions = append(m.actions, "AfterFilePutEvent")
+	m.lock.Unlock()
+}
+func (m *mockNotifier) AfterFileDownloadedEvent(ctx *server.Context, event *server.TransferEvent) {
+	m.lock.Lock()
+	m.actions = append(m.actions, "AfterFileDownloadedEvent:"+strconv.FormatInt(event.Offset, 10)+":"+strconv.FormatInt(event.Size, 10))
+	m.lock.Unlock()
+}
+
 func assetMockNotifier(t *testing.T, mock *mockNotifier, lastActions []string) {
 	if len(lastActions) == 0 {
 		return
@@ -149,7 +162,7 @@ func TestNotification(t *testing.T) {
 
 			var content = `test`
 			assert.NoError(t, f.Stor("server_test.go", strings.NewReader(content)))
-			assetMockNotifier(t, mock, []string{"BeforePutFile", "AfterFilePut"})
+			assetMockNotifier(t, mock, []string{"BeforePutFile", "AfterFilePut", "AfterFilePutEvent"})
 
 			r, err := f.RetrFrom("/server_test.go", 2)
 			assert.NoError(t, err)
@@ -158,7 +171,7 @@ func TestNotification(t *testing.T) {
 			r.Close()
 			assert.NoError(t, err)
 			assert.EqualValues(t, "st", string(buf))
-			assetMockNotifier(t, mock, []string{"BeforeDownloadFile", "AfterFileDownloaded"})
+			assetMockNotifier(t, mock, []string{"BeforeDownloadFile", "AfterFileDownloaded", "AfterFileDownloadedEvent:2:2"})
 
 			err = f.Rename("/server_test.go", "/test.go")
 			assert.NoError(t, err)
@@ -0,0 +1,67 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPassivePortRange(t *testing.T) {
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	// the first port of the range is in use
+	busy, err := net.Listen("tcp", ":2177")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer busy.Close()
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2176,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+		// the host name is resolved
+		PublicIP:     "localhost",
+		PassivePorts: "2177-2179",
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			conn, err := net.Dial("tcp", "localhost:2176")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			conn.Close()
+			break
+		}
+
+		for i := 0; i < 3; i++ {
+			responses := sendCommands(t, "localhost:2176", "USER admin", "PASS admin", "PASV")
+			// 2178 = 8*256+130
+			assert.EqualValues(t, "227 Entering Passive Mode (127,0,0,1,8,130)", responses[2])
+		}
+	})
+
+	opt.PassivePorts = "30000"
+	_, err = server.NewServer(opt)
+	assert.EqualError(t, err, `Invalid passive port range "30000"`)
+}
@@ -0,0 +1,125 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+)
+
+type putNotifier struct {
+	server.NullNotifier
+	lock sync.Mutex
+	errs map[string]error
+}
+
+func (n *putNotifier) AfterFilePut(ctx *server.Context, dstPath string, size int64, err error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.errs[dstPath] = err
+}
+
+func TestPostProcessing(t *testing.T) {
+	assert.NoError(t, os.MkdirAll("./testdata/processed", os.ModePerm))
+	defer os.RemoveAll("./testdata/processed")
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	scan := func(ctx *server.Context, event *server.TransferEvent) error {
+		data, err := ioutil.ReadFile(filepath.Join("./testdata", event.Path))
+		if err != nil {
+			return err
+		}
+		if strings.Contains(string(data), "EICAR") {
+			os.Remove(filepath.Join("./testdata", event.Path))
+			return errors.New("virus found")
+		}
+		return nil
+	}
+	wait := func(ctx *server.Context, event *server.TransferEvent) error {
+		if strings.Contains(event.Path, "slow") {
+			<-ctx.Context().Done()
+			return ctx.Context().Err()
+		}
+		return nil
+	}
+
+	notifier := &putNotifier{errs: make(map[string]error)}
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2174,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+		PostProcessing: &server.PostProcessing{
+			Steps:   []server.UploadProcessor{scan, wait},
+			Timeout: 200 * time.Millisecond,
+		},
+	}
+
+	runServer(t, opt, []server.Notifier{notifier}, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			conn, err := net.Dial("tcp", "localhost:2174")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			conn.Close()
+			break
+		}
+
+		f, err := ftp.Connect("localhost:2174")
+		assert.NoError(t, err)
+		assert.NoError(t, f.Login("admin", "admin"))
+		assert.NoError(t, f.Stor("/processed/clean.txt", strings.NewReader("clean")))
+		err = f.Stor("/processed/infected.txt", strings.NewReader("EICAR"))
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "550 ")
+			assert.Contains(t, err.Error(), "Upload rejected: virus found")
+		}
+		err = f.Stor("/processed/slow.txt", strings.NewReader("slow"))
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "451 ")
+		}
+		assert.NoError(t, f.Quit())
+
+		// the rejected uploads are not counted
+		responses := sendCommands(t, "localhost:2174", "USER admin", "PASS admin", "SITE USAGE")
+		if assert.Len(t, responses, 3) {
+			assert.Contains(t, responses[2], "Uploaded: 14 bytes in 1 files")
+		}
+	})
+
+	_, err = os.Stat("./testdata/processed/clean.txt")
+	assert.NoError(t, err)
+	_, err = os.Stat("./testdata/processed/infected.txt")
+	assert.True(t, os.IsNotExist(err))
+
+	notifier.lock.Lock()
+	assert.NoError(t, notifier.errs["/processed/clean.txt"])
+	assert.EqualError(t, notifier.errs["/processed/infected.txt"], "virus found")
+	assert.Error(t, notifier.errs["/processed/slow.txt"])
+	notifier.lock.Unlock()
+}
@@ -0,0 +1,96 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrecompressed(t *testing.T) {
+	err := os.MkdirAll("./testdata/precompressed", os.ModePerm)
+	assert.NoError(t, err)
+	defer os.RemoveAll("./testdata/precompressed")
+
+	// the variant differs from the file so that the test tells which one
+	// was sent
+	original := strings.Repeat("original log line\n", 10000)
+	variant := strings.Repeat("precompressed log line\n", 10000)
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Name = "app.log"
+	_, err = w.Write([]byte(variant))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	for _, name := range []string{"app.log", "old.log"} {
+		assert.NoError(t, ioutil.WriteFile("./testdata/precompressed/"+name, []byte(original), os.ModePerm))
+		assert.NoError(t, ioutil.WriteFile("./testdata/precompressed/"+name+".gz", buf.Bytes(), os.ModePerm))
+	}
+	past := time.Now().Add(-time.Hour)
+	assert.NoError(t, os.Chtimes("./testdata/precompressed/old.log.gz", past, past))
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2152,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			f, err := ftp.Connect("localhost:2152")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, f.Quit())
+			break
+		}
+
+		retrieveZ := func(path string, sent int) string {
+			data, responses := retrieveData(t, "localhost:2152", path, "USER admin", "PASS admin", "MODE Z", "EPSV")
+			if assert.Len(t, responses, 6) {
+				assert.EqualValues(t, fmt.Sprintf("226 Closing data connection, sent %d bytes", sent), responses[5])
+			}
+			r, err := zlib.NewReader(strings.NewReader(data))
+			if !assert.NoError(t, err) {
+				return ""
+			}
+			content, err := ioutil.ReadAll(r)
+			assert.NoError(t, err)
+			return string(content)
+		}
+
+		assert.EqualValues(t, variant, retrieveZ("/precompressed/app.log", len(variant)))
+		// the outdated variants are ignored
+		assert.EqualValues(t, original, retrieveZ("/precompressed/old.log", len(original)))
+
+		data, _ := retrieveData(t, "localhost:2152", "/precompressed/app.log", "USER admin", "PASS admin", "EPSV")
+		assert.EqualValues(t, original, data)
+	})
+}
@@ -0,0 +1,79 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRang(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2134,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			f, err := ftp.Connect("localhost:2134")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, f.Login("admin", "admin"))
+			assert.NoError(t, f.Stor("/rang.txt", strings.NewReader("0123456789")))
+
+			data, responses := retrieveData(t, "localhost:2134", "/rang.txt", "USER admin", "PASS admin", "EPSV", "RANG 2 5")
+			assert.EqualValues(t, "2345", data)
+			assert.EqualValues(t, []string{
+				"331 User name ok, password required",
+				"230 Password ok, continue",
+			}, responses[:2])
+			assert.EqualValues(t, "350 Restarting at 2. End byte range at 5", responses[3])
+			assert.EqualValues(t, "150 Data transfer starting 4 bytes", responses[4])
+
+			// the range applies to the next RETR only
+			data, _ = retrieveData(t, "localhost:2134", "/rang.txt", "USER admin", "PASS admin", "EPSV", "RANG 2 5", "NOOP")
+			assert.EqualValues(t, "0123456789", data)
+			data, _ = retrieveData(t, "localhost:2134", "/rang.txt", "USER admin", "PASS admin", "EPSV", "RANG 2 100")
+			assert.EqualValues(t, "23456789", data)
+
+			responses = sendCommands(t, "localhost:2134", "USER admin", "PASS admin", "RANG 5 2", "RANG 1 0")
+			assert.EqualValues(t, []string{
+				"331 User name ok, password required",
+				"230 Password ok, continue",
+				"501 Syntax error in parameters or arguments",
+				"350 Restarting at 0. End byte range at EOF",
+			}, responses)
+
+			assert.NoError(t, f.Delete("/rang.txt"))
+			assert.NoError(t, f.Quit())
+			break
+		}
+	})
+}
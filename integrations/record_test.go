@@ -0,0 +1,117 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+	"goftp.io/server/v2/replay"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordReplay(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "ftp-record")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2147,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:      server.NewSimplePerm("test", "test"),
+		Logger:    new(server.DiscardLogger),
+		RecordDir: dir,
+	}
+
+	var content = "recorded upload"
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			f, err := ftp.Connect("localhost:2147")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, f.Login("admin", "admin"))
+
+			defer os.Remove("./testdata/record.txt")
+			assert.NoError(t, f.Stor("/record.txt", strings.NewReader(content)))
+			r, err := f.Retr("/record.txt")
+			assert.NoError(t, err)
+			_, err = ioutil.ReadAll(r)
+			assert.NoError(t, err)
+			assert.NoError(t, r.Close())
+			assert.NoError(t, f.Quit())
+			break
+		}
+
+		// the recording is written once the session is closed
+		var buf []byte
+		for i := 0; i < 50 && len(buf) == 0; i++ {
+			time.Sleep(10 * time.Millisecond)
+			files, _ := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+			if len(files) == 1 {
+				buf, _ = ioutil.ReadFile(files[0])
+			}
+		}
+		assert.NotEmpty(t, buf)
+		assert.NotContains(t, string(buf), "PASS admin")
+
+		records, err := server.ReadRecording(strings.NewReader(string(buf)))
+		assert.NoError(t, err)
+		var (
+			commands  []string
+			transfers []server.Record
+		)
+		for _, record := range records {
+			switch record.Type {
+			case server.RecordCommand:
+				commands = append(commands, record.Command+" "+record.Param)
+			case server.RecordTransfer:
+				transfers = append(transfers, record)
+			}
+		}
+		assert.Contains(t, commands, "PASS ****")
+		assert.Contains(t, commands, "STOR /record.txt")
+		if assert.Len(t, transfers, 2) {
+			assert.EqualValues(t, "STOR", transfers[0].Command)
+			assert.EqualValues(t, len(content), transfers[0].Size)
+			assert.EqualValues(t, "RETR", transfers[1].Command)
+		}
+
+		// the replay of the recording gets the same replies
+		conn, err := net.Dial("tcp", "localhost:2147")
+		if !assert.NoError(t, err) {
+			return
+		}
+		mismatches, err := replay.Replay(conn, records, &replay.Options{Password: "admin"})
+		assert.NoError(t, err)
+		assert.Empty(t, mismatches)
+		info, err := os.Stat("./testdata/record.txt")
+		assert.NoError(t, err)
+		assert.EqualValues(t, len(content), info.Size())
+	})
+}
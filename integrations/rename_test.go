@@ -0,0 +1,139 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenameDir(t *testing.T) {
+	assert.NoError(t, os.MkdirAll("./testdata/left/dir/sub", os.ModePerm))
+	assert.NoError(t, os.MkdirAll("./testdata/right", os.ModePerm))
+	defer os.RemoveAll("./testdata/left")
+	defer os.RemoveAll("./testdata/right")
+	assert.NoError(t, ioutil.WriteFile("./testdata/left/dir/a.txt", []byte("a"), os.ModePerm))
+	assert.NoError(t, ioutil.WriteFile("./testdata/left/dir/sub/b.txt", []byte("b"), os.ModePerm))
+
+	left, err := file.NewDriver("./testdata/left")
+	assert.NoError(t, err)
+	right, err := file.NewDriver("./testdata/right")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name: "test ftpd",
+		// the directories are moved across the drivers by copy
+		Driver: server.NewMultiDriver(map[string]server.Driver{
+			"/left":  left,
+			"/right": right,
+		}),
+		Port: 2169,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			conn, err := net.Dial("tcp", "localhost:2169")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			conn.Close()
+			break
+		}
+
+		assert.EqualValues(t, []string{
+			"331 User name ok, password required",
+			"230 Password ok, continue",
+			"350 Requested file action pending further information.",
+			"550 Action not taken: A directory could not be moved into itself",
+			"350 Requested file action pending further information.",
+			"250 File renamed",
+			"350 Requested file action pending further information.",
+			"550 Action not taken: The destination already exists",
+		}, sendCommands(t, "localhost:2169",
+			"USER admin", "PASS admin",
+			"RNFR /left/dir", "RNTO /left/dir/sub/dir",
+			"RNFR /left/dir", "RNTO /right/moved",
+			"RNFR /right/moved/sub", "RNTO /right/moved"))
+	})
+
+	_, err = os.Stat("./testdata/left/dir")
+	assert.True(t, os.IsNotExist(err))
+	data, err := ioutil.ReadFile("./testdata/right/moved/a.txt")
+	assert.NoError(t, err)
+	assert.EqualValues(t, "a", string(data))
+	data, err = ioutil.ReadFile("./testdata/right/moved/sub/b.txt")
+	assert.NoError(t, err)
+	assert.EqualValues(t, "b", string(data))
+}
+
+func TestRenameDirNative(t *testing.T) {
+	assert.NoError(t, os.MkdirAll("./testdata/native/dir", os.ModePerm))
+	defer os.RemoveAll("./testdata/native")
+	assert.NoError(t, ioutil.WriteFile("./testdata/native/dir/a.txt", []byte("a"), os.ModePerm))
+	before, err := os.Stat("./testdata/native/dir/a.txt")
+	assert.NoError(t, err)
+
+	driver, err := file.NewDriver("./testdata/native")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name: "test ftpd",
+		// the wrapped file driver still moves the directories natively
+		Driver: server.NewMultiDriver(map[string]server.Driver{
+			"/native": driver,
+		}),
+		Port: 2190,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			conn, err := net.Dial("tcp", "localhost:2190")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			conn.Close()
+			break
+		}
+
+		assert.EqualValues(t, []string{
+			"331 User name ok, password required",
+			"230 Password ok, continue",
+			"350 Requested file action pending further information.",
+			"250 File renamed",
+		}, sendCommands(t, "localhost:2190",
+			"USER admin", "PASS admin",
+			"RNFR /native/dir", "RNTO /native/moved"))
+	})
+
+	after, err := os.Stat("./testdata/native/moved/a.txt")
+	assert.NoError(t, err)
+	assert.True(t, os.SameFile(before, after))
+}
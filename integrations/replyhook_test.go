@@ -0,0 +1,69 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplyHook(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2186,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+		ReplyHook: func(ctx *server.Context, code int, message string) (int, string) {
+			return code, "[" + ctx.Cmd + "] " + message
+		},
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			conn, err := net.Dial("tcp", "localhost:2186")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			conn.Close()
+			break
+		}
+
+		// the messages are rewritten, the codes are kept
+		responses := sendCommands(t, "localhost:2186", "USER admin", "PASS wrong",
+			"USER admin", "PASS admin", "SITE HELP")
+		if assert.Len(t, responses, 5) {
+			assert.EqualValues(t, "331 [USER] User name ok, password required", responses[0])
+			assert.EqualValues(t, "530 [PASS] Incorrect password, not logged in", responses[1])
+			assert.EqualValues(t, "331 [USER] User name ok, password required", responses[2])
+			assert.EqualValues(t, "230 [PASS] Password ok, continue", responses[3])
+
+			// only the first line of the multiline responses is passed
+			assert.True(t, strings.HasPrefix(responses[4], "214 [SITE] The following SITE commands are recognized\n"), responses[4])
+			assert.True(t, strings.HasSuffix(responses[4], "\nEnd of help"), responses[4])
+		}
+	})
+}
@@ -0,0 +1,210 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type deleteNotifier struct {
+	server.NullNotifier
+	lock  sync.Mutex
+	files int
+	dirs  int
+}
+
+func (n *deleteNotifier) AfterFileDeleted(ctx *server.Context, dstPath string, err error) {
+	n.lock.Lock()
+	n.files++
+	n.lock.Unlock()
+}
+
+func (n *deleteNotifier) AfterDirDeleted(ctx *server.Context, dstPath string, err error) {
+	n.lock.Lock()
+	n.dirs++
+	n.lock.Unlock()
+}
+
+func TestSiteRmdirRecursive(t *testing.T) {
+	for i := 0; i < 3; i++ {
+		dir := filepath.Join("./testdata/tree", fmt.Sprint("dir", i), "sub")
+		assert.NoError(t, os.MkdirAll(dir, os.ModePerm))
+		for j := 0; j < 20; j++ {
+			assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, fmt.Sprint("file", j)), []byte("data"), os.ModePerm))
+		}
+	}
+	defer os.RemoveAll("./testdata/tree")
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	notifier := &deleteNotifier{}
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2168,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+	}
+
+	runServer(t, opt, []server.Notifier{notifier}, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		var conn *textproto.Conn
+		for {
+			conn, err = textproto.Dial("tcp", "localhost:2168")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			break
+		}
+		defer conn.Close()
+
+		_, _, err := conn.ReadResponse(220)
+		assert.NoError(t, err)
+		for _, cmd := range []string{"USER admin", "PASS admin", "CWD /tree/dir0/sub"} {
+			_, err = conn.Cmd("%s", cmd)
+			assert.NoError(t, err)
+			_, _, err = conn.ReadResponse(0)
+			assert.NoError(t, err)
+		}
+
+		_, err = conn.Cmd("SITE RMDIR /tree")
+		assert.NoError(t, err)
+		_, msg, err := conn.ReadResponse(501)
+		assert.NoError(t, err, msg)
+
+		_, err = conn.Cmd("SITE RMDIR RECURSIVE /tree")
+		assert.NoError(t, err)
+		_, msg, err = conn.ReadResponse(150)
+		assert.NoError(t, err)
+		assert.EqualValues(t, "Deleting 60 files and 7 directories", msg)
+		var code int
+		for {
+			code, msg, err = conn.ReadResponse(0)
+			if code != 150 {
+				break
+			}
+		}
+		assert.EqualValues(t, 250, code, msg)
+		assert.EqualValues(t, "Directory deleted, 67 entries", msg)
+
+		_, err = conn.Cmd("PWD")
+		assert.NoError(t, err)
+		_, msg, err = conn.ReadResponse(257)
+		assert.NoError(t, err)
+		assert.EqualValues(t, `"/" is the current directory`, msg)
+	})
+
+	_, err = os.Stat("./testdata/tree")
+	assert.True(t, os.IsNotExist(err))
+	notifier.lock.Lock()
+	assert.EqualValues(t, 60, notifier.files)
+	assert.EqualValues(t, 7, notifier.dirs)
+	notifier.lock.Unlock()
+}
+
+func TestSiteRmdirRecursiveRefused(t *testing.T) {
+	assert.NoError(t, os.MkdirAll("./testdata/guarded/sub", os.ModePerm))
+	defer os.RemoveAll("./testdata/guarded")
+	assert.NoError(t, ioutil.WriteFile("./testdata/guarded/sub/a.keep", []byte("data"), os.ModePerm))
+	assert.NoError(t, os.MkdirAll("./testdata/busy", os.ModePerm))
+	defer os.RemoveAll("./testdata/busy")
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2199,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:           server.NewSimplePerm("test", "test"),
+		Logger:         new(server.DiscardLogger),
+		ProtectedPaths: []string{"*.keep"},
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		var conn *textproto.Conn
+		for {
+			conn, err = textproto.Dial("tcp", "localhost:2199")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			break
+		}
+		defer conn.Close()
+
+		// the tree containing a protected file is not deleted
+		assert.EqualValues(t, []string{
+			"331 User name ok, password required",
+			"230 Password ok, continue",
+			"550 Directory delete failed after 0 entries: /guarded/sub/a.keep is protected",
+		}, sendCommands(t, "localhost:2199",
+			"USER admin", "PASS admin", "SITE RMDIR RECURSIVE /guarded"))
+		_, err = os.Stat("./testdata/guarded/sub/a.keep")
+		assert.NoError(t, err)
+
+		// nor the tree containing a file being uploaded
+		_, _, err := conn.ReadResponse(220)
+		assert.NoError(t, err)
+		for _, cmd := range []string{"USER admin", "PASS admin"} {
+			_, err = conn.Cmd("%s", cmd)
+			assert.NoError(t, err)
+			_, _, err = conn.ReadResponse(0)
+			assert.NoError(t, err)
+		}
+		dataConn := dialPassive(t, conn)
+		_, err = conn.Cmd("STOR /busy/upload.txt")
+		assert.NoError(t, err)
+		_, _, err = conn.ReadResponse(150)
+		assert.NoError(t, err)
+		_, err = dataConn.Write([]byte("data"))
+		assert.NoError(t, err)
+		for i := 0; i < 100; i++ {
+			if _, err := os.Stat("./testdata/busy/upload.txt"); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		assert.EqualValues(t, []string{
+			"331 User name ok, password required",
+			"230 Password ok, continue",
+			"550 Directory delete failed after 0 entries: /busy/upload.txt: file is being written by another session",
+		}, sendCommands(t, "localhost:2199",
+			"USER admin", "PASS admin", "SITE RMDIR RECURSIVE /busy"))
+
+		dataConn.Close()
+		_, _, err = conn.ReadResponse(226)
+		assert.NoError(t, err)
+		data, err := ioutil.ReadFile("./testdata/busy/upload.txt")
+		assert.NoError(t, err)
+		assert.EqualValues(t, "data", string(data))
+	})
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNameSanitizer(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2132,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+		NameSanitizer: func(name string) string {
+			return strings.ToLower(strings.Replace(name, " ", "_", -1))
+		},
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			f, err := ftp.Connect("localhost:2132")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, f.Login("admin", "admin"))
+
+			responses := sendCommands(t, "localhost:2132", "USER admin", "PASS admin",
+				"MKD /Sanitize Me", "MKD /sanitize_me/sub", "RNFR /sanitize_me/sub", "RNTO /sanitize_me/Sub Dir")
+			assert.EqualValues(t, []string{
+				"331 User name ok, password required",
+				"230 Password ok, continue",
+				"257 \"/sanitize_me\" directory created",
+				"257 Directory created",
+				"350 Requested file action pending further information.",
+				"250 File renamed to /sanitize_me/sub_dir",
+			}, responses)
+
+			assert.NoError(t, f.Stor("/sanitize_me/My File.TXT", strings.NewReader("sanitize")))
+			names, err := f.NameList("/sanitize_me")
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, []string{"my_file.txt", "sub_dir"}, names)
+
+			assert.NoError(t, f.RemoveDirRecur("/sanitize_me"))
+			assert.NoError(t, f.Quit())
+			break
+		}
+	})
+}
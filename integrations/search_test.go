@@ -0,0 +1,120 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSiteSearch(t *testing.T) {
+	err := os.MkdirAll("./testdata/search/deep/er", os.ModePerm)
+	assert.NoError(t, err)
+	assert.NoError(t, os.MkdirAll("./testdata/search/secret", os.ModePerm))
+	defer os.RemoveAll("./testdata/search")
+	for _, name := range []string{"search/a.csv", "search/deep/B.CSV", "search/deep/er/c.csv", "search/deep/d.txt", "search/secret/e.txt", "search/f.tmp"} {
+		assert.NoError(t, ioutil.WriteFile("./testdata/"+name, []byte("id,name\n"), os.ModePerm))
+	}
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2149,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+		Search: &server.Search{MaxResults: 2},
+		// the hidden files are not searched
+		HiddenFiles: &server.HiddenFiles{Patterns: []string{"secret", "*.tmp"}},
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			f, err := ftp.Connect("localhost:2149")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, f.Quit())
+			break
+		}
+
+		responses := sendCommands(t, "localhost:2149", "USER admin", "PASS admin", "CWD /search",
+			"SITE SEARCH *.csv", "SITE SEARCH *.txt", "SITE SEARCH [", "SITE SEARCH *.tmp")
+		if assert.Len(t, responses, 7) {
+			assert.EqualValues(t, "200 Files matching *.csv:\n/search/a.csv\n/search/deep/B.CSV\nEnd of search, more files may match", responses[3])
+			assert.EqualValues(t, "200 Files matching *.txt:\n/search/deep/d.txt\nEnd of search", responses[4])
+			assert.EqualValues(t, "550 Action not taken: syntax error in pattern", responses[5])
+			assert.EqualValues(t, "200 Files matching *.tmp:\nEnd of search", responses[6])
+		}
+	})
+}
+
+func TestSiteSearchIndex(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+	defer os.RemoveAll("./testdata/indexed")
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2150,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+		DriverMiddlewares: []server.DriverMiddleware{server.Indexing(&server.Index{
+			Indexers: []server.Indexer{server.TextIndexer{}},
+			Store:    server.NewMemoryIndexStore(),
+		})},
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			f, err := ftp.Connect("localhost:2150")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, f.Login("admin", "admin"))
+			assert.NoError(t, f.MakeDir("/indexed"))
+			assert.NoError(t, f.Stor("/indexed/report.txt", strings.NewReader("quarterly revenue")))
+			assert.NoError(t, f.Stor("/indexed/notes.txt", strings.NewReader("meeting notes")))
+			assert.NoError(t, f.Quit())
+			break
+		}
+
+		responses := sendCommands(t, "localhost:2150", "USER admin", "PASS admin",
+			"SITE SEARCH revenue", "SITE SEARCH *.txt")
+		if assert.Len(t, responses, 4) {
+			assert.EqualValues(t, "200 Files matching revenue:\n/indexed/report.txt\nEnd of search", responses[2])
+			assert.EqualValues(t, "200 Files matching *.txt:\n/indexed/notes.txt\n/indexed/report.txt\nEnd of search", responses[3])
+		}
+	})
+}
@@ -0,0 +1,156 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"encoding/hex"
+	"hash/crc32"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSegmentedDownload(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2135,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:        server.NewSimplePerm("test", "test"),
+		Logger:      new(server.DiscardLogger),
+		MaxSegments: 4,
+		// the digests of the segments are combined
+		TransferChecksum: "CRC32C",
+	}
+
+	notifier := &checksumNotifier{}
+	runServer(t, opt, []server.Notifier{notifier}, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			f, err := ftp.Connect("localhost:2135")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, f.Login("admin", "admin"))
+			assert.NoError(t, f.Stor("/segments.txt", strings.NewReader("0123456789")))
+
+			conn, err := textproto.Dial("tcp", "localhost:2135")
+			assert.NoError(t, err)
+			defer conn.Close()
+			_, _, err = conn.ReadResponse(220)
+			assert.NoError(t, err)
+			_, err = conn.Cmd("USER admin")
+			assert.NoError(t, err)
+			_, _, err = conn.ReadResponse(331)
+			assert.NoError(t, err)
+			_, err = conn.Cmd("PASS admin")
+			assert.NoError(t, err)
+			_, _, err = conn.ReadResponse(230)
+			assert.NoError(t, err)
+
+			_, err = conn.Cmd("SITE SEGMENTS 5")
+			assert.NoError(t, err)
+			_, _, err = conn.ReadResponse(501)
+			assert.NoError(t, err)
+
+			_, err = conn.Cmd("SITE SEGMENTS 3")
+			assert.NoError(t, err)
+			_, msg, err := conn.ReadResponse(229)
+			assert.NoError(t, err)
+			ports := regexp.MustCompile(`\(\|\|\|(\d+)\|\)`).FindAllStringSubmatch(msg, -1)
+			assert.Len(t, ports, 3)
+
+			var conns []net.Conn
+			for _, port := range ports {
+				dataConn, err := net.Dial("tcp", net.JoinHostPort("localhost", port[1]))
+				assert.NoError(t, err)
+				conns = append(conns, dataConn)
+			}
+
+			_, err = conn.Cmd("SITE SEGRETR /segments.txt")
+			assert.NoError(t, err)
+			_, msg, err = conn.ReadResponse(150)
+			assert.NoError(t, err)
+			assert.Contains(t, msg, "Sending 10 bytes in 3 segments")
+			assert.Contains(t, msg, ports[0][0]+" 0-2")
+			assert.Contains(t, msg, ports[1][0]+" 3-5")
+			assert.Contains(t, msg, ports[2][0]+" 6-9")
+
+			var segments []string
+			for _, dataConn := range conns {
+				data, err := ioutil.ReadAll(dataConn)
+				assert.NoError(t, err)
+				segments = append(segments, string(data))
+				dataConn.Close()
+			}
+			assert.EqualValues(t, []string{"012", "345", "6789"}, segments)
+			_, msg, err = conn.ReadResponse(226)
+			assert.NoError(t, err)
+			assert.EqualValues(t, "Closing data connections, sent 10 bytes", msg)
+			crc := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+			_, _ = crc.Write([]byte("0123456789"))
+			notifier.lock.Lock()
+			assert.Contains(t, notifier.checksums, "get:CRC32C:"+hex.EncodeToString(crc.Sum(nil)))
+			notifier.lock.Unlock()
+
+			_, err = conn.Cmd("SITE SEGRETR /segments.txt")
+			assert.NoError(t, err)
+			_, _, err = conn.ReadResponse(503)
+			assert.NoError(t, err)
+
+			// the data connections left open are closed with the session
+			_, err = conn.Cmd("SITE SEGMENTS 2")
+			assert.NoError(t, err)
+			_, msg, err = conn.ReadResponse(229)
+			assert.NoError(t, err)
+			ports = regexp.MustCompile(`\(\|\|\|(\d+)\|\)`).FindAllStringSubmatch(msg, -1)
+			assert.Len(t, ports, 2)
+			_, err = conn.Cmd("QUIT")
+			assert.NoError(t, err)
+			_, _, err = conn.ReadResponse(221)
+			assert.NoError(t, err)
+			_, _, err = conn.ReadResponse(0)
+			assert.Error(t, err)
+			for _, port := range ports {
+				dataConn, err := net.Dial("tcp", net.JoinHostPort("localhost", port[1]))
+				if err != nil {
+					continue
+				}
+				assert.NoError(t, dataConn.SetReadDeadline(time.Now().Add(time.Second)))
+				_, err = dataConn.Read(make([]byte, 1))
+				if netErr, ok := err.(net.Error); ok {
+					assert.False(t, netErr.Timeout(), "the data connection %s is still open", port[0])
+				}
+				dataConn.Close()
+			}
+
+			assert.NoError(t, f.Delete("/segments.txt"))
+			assert.NoError(t, f.Quit())
+			break
+		}
+	})
+}
@@ -0,0 +1,103 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessions(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2125,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+	}
+
+	s, err := server.NewServer(opt)
+	assert.NoError(t, err)
+
+	var (
+		others = make(chan []server.SessionInfo, 1)
+		passes = make(chan server.SessionInfo, 2)
+	)
+	s.Use(func(next server.CommandHandler) server.CommandHandler {
+		return func(ctx *server.Context) {
+			if ctx.Cmd == "MKD" {
+				others <- ctx.Sessions()
+			}
+			if ctx.Cmd == "PASS" {
+				passes <- ctx.Sess.Info()
+			}
+			next(ctx)
+		}
+	})
+
+	go func() {
+		err := s.ListenAndServe()
+		assert.EqualError(t, err, server.ErrServerClosed.Error())
+	}()
+
+	// Give server 0.5 seconds to get to the listening state
+	timeout := time.NewTimer(time.Millisecond * 500)
+	for {
+		f, err := ftp.Connect("localhost:2125")
+		if err != nil && len(timeout.C) == 0 { // Retry errors
+			continue
+		}
+		assert.NoError(t, err)
+		assert.NoError(t, f.Login("admin", "admin"))
+
+		f2, err := ftp.Connect("localhost:2125")
+		assert.NoError(t, err)
+		assert.NoError(t, f2.Login("admin", "admin"))
+		assert.NoError(t, f2.ChangeDir("/"))
+
+		assert.NoError(t, f.MakeDir("/sessions"))
+		infos := <-others
+		if assert.Len(t, infos, 1) {
+			assert.EqualValues(t, "admin", infos[0].User)
+			assert.EqualValues(t, "/", infos[0].CurDir)
+			assert.EqualValues(t, "", infos[0].Command)
+		}
+
+		assert.NoError(t, f.RemoveDir("/sessions"))
+
+		// the passwords never show up in the snapshots
+		for i := 0; i < 2; i++ {
+			info := <-passes
+			assert.EqualValues(t, "PASS", info.Command)
+			assert.NotContains(t, info.Param, "admin")
+			assert.EqualValues(t, "", info.Path)
+		}
+
+		assert.EqualValues(t, 2, s.KickUser("admin"))
+		assert.Error(t, f.NoOp())
+		assert.Error(t, f2.NoOp())
+		assert.EqualValues(t, 0, s.KickUser("nobody"))
+		break
+	}
+
+	assert.NoError(t, s.Shutdown())
+}
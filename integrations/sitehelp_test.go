@@ -0,0 +1,68 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSiteHelp(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2184,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			conn, err := net.Dial("tcp", "localhost:2184")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			conn.Close()
+			break
+		}
+
+		var names []string
+		for name := range server.DefaultSiteCommands() {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		// the sub commands are listed in order, one per line
+		responses := sendCommands(t, "localhost:2184", "USER admin", "PASS admin", "SITE HELP")
+		if assert.Len(t, responses, 3) {
+			assert.EqualValues(t, "214 The following SITE commands are recognized\n"+
+				strings.Join(names, "\n")+"\nEnd of help", responses[2])
+			assert.Contains(t, names, "HELP")
+			assert.Contains(t, names, "UTIME")
+		}
+	})
+}
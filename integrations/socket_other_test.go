@@ -0,0 +1,14 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package integrations
+
+import "errors"
+
+func listenReusePort(address string) error {
+	return errors.New("SO_REUSEPORT is only tested on linux")
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSocketOptions(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2142,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+		Socket: &server.SocketOptions{
+			KeepAlive:   time.Minute,
+			ReadBuffer:  256 * 1024,
+			WriteBuffer: 256 * 1024,
+			Nagle:       true,
+			ReusePort:   runtime.GOOS == "linux",
+		},
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			f, err := ftp.Connect("localhost:2142")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, f.Login("admin", "admin"))
+
+			var content = strings.Repeat("socket", 1000)
+			assert.NoError(t, f.Stor("/socket.txt", strings.NewReader(content)))
+			r, err := f.Retr("/socket.txt")
+			assert.NoError(t, err)
+			buf, err := ioutil.ReadAll(r)
+			assert.NoError(t, err)
+			assert.NoError(t, r.Close())
+			assert.EqualValues(t, content, string(buf))
+			assert.NoError(t, f.Delete("/socket.txt"))
+			assert.NoError(t, f.Quit())
+			break
+		}
+
+		if runtime.GOOS == "linux" {
+			// another process could listen on the same port
+			assert.NoError(t, listenReusePort("localhost:2142"))
+		}
+	})
+}
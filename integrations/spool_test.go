@@ -0,0 +1,298 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+)
+
+// slowDriver blocks the uploads until release is closed and fails the
+// first one
+type slowDriver struct {
+	server.Driver
+	release chan struct{}
+	lock    sync.Mutex
+	failed  bool
+}
+
+func (driver *slowDriver) PutFile(ctx *server.Context, destPath string, data io.Reader, offset int64) (int64, error) {
+	<-driver.release
+	driver.lock.Lock()
+	failed := driver.failed
+	driver.failed = true
+	driver.lock.Unlock()
+	if !failed {
+		return 0, errors.New("backend unavailable")
+	}
+	return driver.Driver.PutFile(ctx, destPath, data, offset)
+}
+
+type flushNotifier struct {
+	server.NullNotifier
+	flushed chan error
+}
+
+func (n *flushNotifier) AfterFileFlushed(ctx *server.Context, dstPath string, size int64, err error) {
+	n.flushed <- err
+}
+
+func TestSpool(t *testing.T) {
+	// outside of the root of the driver so that it's not listed
+	dir, err := ioutil.TempDir("", "ftp-spool")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+	slow := &slowDriver{Driver: driver, release: make(chan struct{})}
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: slow,
+		Port:   2139,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+		Spool: &server.Spool{
+			Dir:           dir,
+			Retries:       2,
+			RetryInterval: 10 * time.Millisecond,
+		},
+	}
+
+	notifier := &flushNotifier{flushed: make(chan error, 1)}
+	runServer(t, opt, []server.Notifier{notifier}, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			f, err := ftp.Connect("localhost:2139")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, f.Login("admin", "admin"))
+
+			// the upload is acknowledged and served before it's flushed
+			var content = "spooled content"
+			assert.NoError(t, f.Stor("/spool.txt", strings.NewReader(content)))
+			size, err := f.FileSize("/spool.txt")
+			assert.NoError(t, err)
+			assert.EqualValues(t, len(content), size)
+			r, err := f.Retr("/spool.txt")
+			assert.NoError(t, err)
+			buf, err := ioutil.ReadAll(r)
+			assert.NoError(t, err)
+			assert.NoError(t, r.Close())
+			assert.EqualValues(t, content, string(buf))
+			_, err = os.Stat("./testdata/spool.txt")
+			assert.True(t, os.IsNotExist(err))
+
+			// the failed flush is retried
+			close(slow.release)
+			select {
+			case err := <-notifier.flushed:
+				assert.NoError(t, err)
+			case <-time.After(5 * time.Second):
+				t.Fatal("the upload is not flushed")
+			}
+			buf, err = ioutil.ReadFile("./testdata/spool.txt")
+			assert.NoError(t, err)
+			assert.EqualValues(t, content, string(buf))
+
+			entries, err := ioutil.ReadDir(dir)
+			assert.NoError(t, err)
+			assert.Len(t, entries, 0)
+
+			assert.NoError(t, f.Delete("/spool.txt"))
+			assert.NoError(t, f.Quit())
+			break
+		}
+	})
+}
+
+// failingDriver fails all the uploads
+type failingDriver struct {
+	server.Driver
+}
+
+func (driver *failingDriver) PutFile(ctx *server.Context, destPath string, data io.Reader, offset int64) (int64, error) {
+	return 0, errors.New("backend unavailable")
+}
+
+func TestSpoolFailed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftp-spool")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: &failingDriver{Driver: driver},
+		Port:   2191,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+		Spool: &server.Spool{
+			Dir:           dir,
+			Retries:       1,
+			RetryInterval: 10 * time.Millisecond,
+		},
+	}
+
+	s, err := server.NewServer(opt)
+	assert.NoError(t, err)
+	notifier := &flushNotifier{flushed: make(chan error, 1)}
+	s.RegisterNotifer(notifier)
+	go func() {
+		err := s.ListenAndServe()
+		assert.EqualError(t, err, server.ErrServerClosed.Error())
+	}()
+	defer s.Shutdown()
+
+	// Give server 0.5 seconds to get to the listening state
+	timeout := time.NewTimer(time.Millisecond * 500)
+	for {
+		f, err := ftp.Connect("localhost:2191")
+		if err != nil && len(timeout.C) == 0 { // Retry errors
+			continue
+		}
+		assert.NoError(t, err)
+		assert.NoError(t, f.Login("admin", "admin"))
+
+		var content = "failed content"
+		assert.NoError(t, f.Stor("/failed.txt", strings.NewReader(content)))
+		select {
+		case err := <-notifier.flushed:
+			assert.EqualError(t, err, "backend unavailable")
+		case <-time.After(5 * time.Second):
+			t.Fatal("the flush is not reported")
+		}
+
+		// the acknowledged upload is still served and listed
+		r, err := f.Retr("/failed.txt")
+		assert.NoError(t, err)
+		buf, err := ioutil.ReadAll(r)
+		assert.NoError(t, err)
+		assert.NoError(t, r.Close())
+		assert.EqualValues(t, content, string(buf))
+		names, err := f.NameList("/")
+		assert.NoError(t, err)
+		assert.Contains(t, names, "failed.txt")
+
+		uploads := s.SpooledUploads()
+		if assert.Len(t, uploads, 1) {
+			assert.EqualValues(t, "/failed.txt", uploads[0].Path)
+			assert.EqualValues(t, "admin", uploads[0].User)
+			assert.EqualValues(t, len(content), uploads[0].Size)
+			assert.EqualValues(t, "backend unavailable", uploads[0].Error)
+		}
+		w := httptest.NewRecorder()
+		s.SpoolHandler().ServeHTTP(w, httptest.NewRequest("GET", "/spool", nil))
+		var served []server.SpooledUpload
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &served))
+		assert.EqualValues(t, uploads, served)
+
+		// the failed upload is deleted from the spool
+		assert.NoError(t, f.Delete("/failed.txt"))
+		assert.Len(t, s.SpooledUploads(), 0)
+		entries, err := ioutil.ReadDir(dir)
+		assert.NoError(t, err)
+		assert.Len(t, entries, 0)
+
+		assert.NoError(t, f.Quit())
+		break
+	}
+}
+
+func TestSpoolShutdown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftp-spool")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: &failingDriver{Driver: driver},
+		Port:   2192,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+		Spool: &server.Spool{
+			Dir:           dir,
+			RetryInterval: time.Hour,
+		},
+	}
+
+	s, err := server.NewServer(opt)
+	assert.NoError(t, err)
+	notifier := &flushNotifier{flushed: make(chan error, 1)}
+	s.RegisterNotifer(notifier)
+	go func() {
+		err := s.ListenAndServe()
+		assert.EqualError(t, err, server.ErrServerClosed.Error())
+	}()
+
+	// Give server 0.5 seconds to get to the listening state
+	timeout := time.NewTimer(time.Millisecond * 500)
+	for {
+		f, err := ftp.Connect("localhost:2192")
+		if err != nil && len(timeout.C) == 0 { // Retry errors
+			continue
+		}
+		assert.NoError(t, err)
+		assert.NoError(t, f.Login("admin", "admin"))
+		assert.NoError(t, f.Stor("/shutdown.txt", strings.NewReader("content")))
+		uploads := s.SpooledUploads()
+		if assert.Len(t, uploads, 1) {
+			assert.EqualValues(t, "", uploads[0].Error)
+		}
+		assert.NoError(t, f.Quit())
+		break
+	}
+
+	// the retries stop at the shutdown and the file is kept
+	assert.NoError(t, s.Shutdown())
+	select {
+	case err := <-notifier.flushed:
+		assert.EqualError(t, err, "backend unavailable")
+	case <-time.After(5 * time.Second):
+		t.Fatal("the retries are not stopped")
+	}
+	uploads := s.SpooledUploads()
+	if assert.Len(t, uploads, 1) {
+		assert.EqualValues(t, "backend unavailable", uploads[0].Error)
+	}
+	entries, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
@@ -0,0 +1,87 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatPath(t *testing.T) {
+	assert.NoError(t, os.MkdirAll("./testdata/stat/sub", os.ModePerm))
+	defer os.RemoveAll("./testdata/stat")
+	assert.NoError(t, ioutil.WriteFile("./testdata/stat/a.txt", []byte("hello"), 0644))
+	assert.NoError(t, ioutil.WriteFile("./testdata/stat/b.txt", []byte("hi"), 0644))
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2183,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			conn, err := net.Dial("tcp", "localhost:2183")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			conn.Close()
+			break
+		}
+
+		// the listings are sent over the control connection
+		responses := sendCommands(t, "localhost:2183", "USER admin", "PASS admin",
+			"STAT /stat/a.txt", "STAT /stat", "STAT /stat/missing.txt")
+		if assert.Len(t, responses, 5) {
+			lines := strings.Split(responses[2], "\n")
+			if assert.Len(t, lines, 3) {
+				assert.EqualValues(t, "213 Status of /stat/a.txt:", lines[0])
+				fields := strings.Fields(lines[1])
+				assert.True(t, strings.HasPrefix(lines[1], "-"), lines[1])
+				assert.Contains(t, fields, "5")
+				assert.EqualValues(t, "a.txt", fields[len(fields)-1])
+				assert.EqualValues(t, "End of status", lines[2])
+			}
+
+			lines = strings.Split(responses[3], "\n")
+			if assert.Len(t, lines, 5) {
+				assert.EqualValues(t, "213 Status of /stat:", lines[0])
+				var names []string
+				for _, line := range lines[1:4] {
+					fields := strings.Fields(line)
+					names = append(names, fields[len(fields)-1])
+					if fields[len(fields)-1] == "sub" {
+						assert.True(t, strings.HasPrefix(line, "d"), line)
+					}
+				}
+				assert.ElementsMatch(t, []string{"a.txt", "b.txt", "sub"}, names)
+				assert.EqualValues(t, "End of status", lines[4])
+			}
+
+			assert.EqualValues(t, "450 path /stat/missing.txt not found", responses[4])
+		}
+	})
+}
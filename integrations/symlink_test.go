@@ -0,0 +1,129 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSiteSymlink(t *testing.T) {
+	err := os.MkdirAll("./testdata/links", os.ModePerm)
+	assert.NoError(t, err)
+	defer os.RemoveAll("./testdata/links")
+	// a link created out of the server pointing out of the root
+	assert.NoError(t, os.Symlink(os.TempDir(), "./testdata/links/out"))
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2166,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			f, err := ftp.Connect("localhost:2166")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, f.Login("admin", "admin"))
+			assert.NoError(t, f.Quit())
+			break
+		}
+
+		responses := sendCommands(t, "localhost:2166", "USER admin", "PASS admin", "CWD /links",
+			"SITE SYMLINK a.txt b.txt", "SITE SYMLINK /links/a.txt", "SITE SYMLINK ../../../../etc /links/etc")
+		assert.EqualValues(t, []string{
+			"200 SITE SYMLINK command successful",
+			`501 invalid SITE SYMLINK param "/links/a.txt"`,
+			"200 SITE SYMLINK command successful",
+		}, responses[3:])
+
+		// the links are relative and never point out of the root
+		target, err := os.Readlink("./testdata/links/b.txt")
+		assert.NoError(t, err)
+		assert.EqualValues(t, "a.txt", target)
+		target, err = os.Readlink("./testdata/links/etc")
+		assert.NoError(t, err)
+		assert.EqualValues(t, filepath.Join("..", "etc"), target)
+
+		f, err := ftp.Connect("localhost:2166")
+		assert.NoError(t, err)
+		assert.NoError(t, f.Login("admin", "admin"))
+		assert.NoError(t, f.Stor("/links/a.txt", strings.NewReader("a")))
+		r, err := f.Retr("/links/b.txt")
+		if assert.NoError(t, err) {
+			data, err := ioutil.ReadAll(r)
+			assert.NoError(t, err)
+			assert.EqualValues(t, "a", string(data))
+			assert.NoError(t, r.Close())
+		}
+
+		assert.NoError(t, f.Quit())
+
+		// the client lists by MLSD, the targets are checked in both listings
+		listing, _ := receiveData(t, "localhost:2166", "LIST /links", "USER admin", "PASS admin", "EPSV")
+		var links = make(map[string]string)
+		for _, line := range strings.Split(strings.TrimSpace(listing), "\r\n") {
+			fields := strings.Fields(line)
+			if len(fields) >= 9 && strings.HasPrefix(fields[0], "l") {
+				links[fields[8]] = ""
+				if len(fields) == 11 && fields[9] == "->" {
+					links[fields[8]] = fields[10]
+				}
+			}
+		}
+		assert.EqualValues(t, map[string]string{
+			"b.txt": "/links/a.txt",
+			"etc":   "/etc",
+			"out":   "",
+		}, links)
+
+		facts, _ := receiveData(t, "localhost:2166", "MLSD /links", "USER admin", "PASS admin", "EPSV")
+		assert.Contains(t, facts, "Type=OS.unix=slink:/links/a.txt;")
+		assert.Contains(t, facts, "Type=OS.unix=slink:/etc;")
+		assert.Contains(t, facts, "Type=OS.unix=symlink;")
+
+		// a link created through another link is relative to the directory
+		// the system resolves, so it doesn't point out of the root
+		assert.NoError(t, os.MkdirAll("./testdata/links/deep/x/y/z", os.ModePerm))
+		responses = sendCommands(t, "localhost:2166", "USER admin", "PASS admin",
+			"SITE SYMLINK /links/deep/x/y/z /links/top", "SITE SYMLINK / /links/top/up",
+			"SITE SYMLINK /links/out /links/outer")
+		assert.EqualValues(t, []string{
+			"200 SITE SYMLINK command successful",
+			"200 SITE SYMLINK command successful",
+		}, responses[2:4])
+		assert.True(t, strings.HasPrefix(responses[4], "550 "), responses[4])
+		target, err = os.Readlink("./testdata/links/deep/x/y/z/up")
+		assert.NoError(t, err)
+		assert.EqualValues(t, filepath.Join("..", "..", "..", "..", ".."), target)
+		data, err := ioutil.ReadFile("./testdata/links/top/up/links/a.txt")
+		assert.NoError(t, err)
+		assert.EqualValues(t, "a", string(data))
+	})
+}
@@ -0,0 +1,135 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+)
+
+// thumbnail sends THMB over a new control connection and returns the
+// preview received and the last response
+func thumbnail(t *testing.T, addr, path string) ([]byte, string) {
+	conn, err := textproto.Dial("tcp", addr)
+	if !assert.NoError(t, err) {
+		return nil, ""
+	}
+	defer conn.Close()
+	_, _, err = conn.ReadResponse(220)
+	assert.NoError(t, err)
+	for _, cmd := range []string{"USER admin", "PASS admin"} {
+		_, err := conn.Cmd("%s", cmd)
+		assert.NoError(t, err)
+		_, _, err = conn.ReadResponse(0)
+		assert.NoError(t, err)
+	}
+
+	_, err = conn.Cmd("EPSV")
+	assert.NoError(t, err)
+	_, msg, err := conn.ReadResponse(229)
+	if !assert.NoError(t, err) {
+		return nil, msg
+	}
+	port := strings.Trim(msg[strings.Index(msg, "(")+1:], "|)")
+	dataConn, err := net.Dial("tcp", net.JoinHostPort("localhost", port))
+	if !assert.NoError(t, err) {
+		return nil, ""
+	}
+	defer dataConn.Close()
+
+	_, err = conn.Cmd("THMB %s", path)
+	assert.NoError(t, err)
+	code, msg, _ := conn.ReadResponse(0)
+	if code != 150 {
+		return nil, msg
+	}
+	data, err := ioutil.ReadAll(dataConn)
+	assert.NoError(t, err)
+	_, msg, err = conn.ReadResponse(226)
+	assert.NoError(t, err)
+	return data, msg
+}
+
+func TestThumbnail(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+	defer os.RemoveAll("./testdata/thumbnails")
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2151,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:       server.NewSimplePerm("test", "test"),
+		Logger:     new(server.DiscardLogger),
+		Thumbnails: &server.Thumbnails{Size: 16},
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, 64, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, img))
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			f, err := ftp.Connect("localhost:2151")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, f.Login("admin", "admin"))
+			assert.NoError(t, f.MakeDir("/thumbnails"))
+			assert.NoError(t, f.Stor("/thumbnails/image.png", bytes.NewReader(buf.Bytes())))
+			assert.NoError(t, f.Stor("/thumbnails/notes.txt", strings.NewReader("not an image")))
+			assert.NoError(t, f.Quit())
+			break
+		}
+
+		// the second preview is served from the cache
+		for i := 0; i < 2; i++ {
+			data, msg := thumbnail(t, "localhost:2151", "/thumbnails/image.png")
+			preview, err := jpeg.Decode(bytes.NewReader(data))
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, image.Rect(0, 0, 16, 8), preview.Bounds())
+				r, g, _, _ := preview.At(8, 4).RGBA()
+				assert.True(t, r > 0xf000 && g < 0x1000)
+			}
+			assert.Contains(t, msg, "Closing data connection")
+		}
+
+		_, msg := thumbnail(t, "localhost:2151", "/thumbnails/notes.txt")
+		assert.EqualValues(t, "Action not taken: Not a supported image", msg)
+		_, msg = thumbnail(t, "localhost:2151", "/thumbnails/missing.png")
+		assert.EqualValues(t, "File not available", msg)
+	})
+}
@@ -0,0 +1,278 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeCertificate writes a self-signed certificate and its key to dir
+func writeCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ftp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"ftp.example.com"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	assert.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return certFile, keyFile
+}
+
+type tlsNotifier struct {
+	server.NullNotifier
+	lock       sync.Mutex
+	handshakes []*server.TLSInfo
+	logins     []*server.TLSInfo
+}
+
+func (n *tlsNotifier) AfterTLSHandshake(ctx *server.Context, info *server.TLSInfo, err error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.handshakes = append(n.handshakes, info)
+}
+
+func (n *tlsNotifier) AfterUserLogin(ctx *server.Context, userName, password string, passMatched bool, err error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.logins = append(n.logins, ctx.Sess.TLS())
+}
+
+func TestTLSInfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftptls")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeCertificate(t, dir)
+
+	driver, err := file.NewDriver(dir)
+	assert.NoError(t, err)
+
+	var out syncBuffer
+	notifier := &tlsNotifier{}
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2153,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:         server.NewSimplePerm("test", "test"),
+		Logger:       new(server.DiscardLogger),
+		Audit:        server.NewJSONAuditSink(&out),
+		TLS:          true,
+		ExplicitFTPS: true,
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+	}
+
+	runServer(t, opt, []server.Notifier{notifier}, func() {
+		// Give server 0.5 seconds to get to the listening state
+		var (
+			conn    net.Conn
+			timeout = time.NewTimer(time.Millisecond * 500)
+		)
+		for {
+			conn, err = net.Dial("tcp", "localhost:2153")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			break
+		}
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+
+		control := textproto.NewConn(conn)
+		_, _, err = control.ReadResponse(220)
+		assert.NoError(t, err)
+		_, err = control.Cmd("AUTH TLS")
+		assert.NoError(t, err)
+		_, _, err = control.ReadResponse(234)
+		assert.NoError(t, err)
+
+		tlsConn := tls.Client(conn, &tls.Config{
+			ServerName:         "ftp.example.com",
+			InsecureSkipVerify: true,
+			MaxVersion:         tls.VersionTLS12,
+			CipherSuites:       []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+		})
+		control = textproto.NewConn(tlsConn)
+		for _, cmd := range []string{"USER admin", "PASS admin", "QUIT"} {
+			_, err = control.Cmd("%s", cmd)
+			assert.NoError(t, err)
+			_, _, err = control.ReadResponse(0)
+			assert.NoError(t, err)
+		}
+	})
+
+	expected := &server.TLSInfo{
+		Version:     "TLS 1.2",
+		CipherSuite: "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+		ServerName:  "ftp.example.com",
+	}
+	notifier.lock.Lock()
+	assert.EqualValues(t, []*server.TLSInfo{expected}, notifier.handshakes)
+	assert.EqualValues(t, []*server.TLSInfo{expected}, notifier.logins)
+	notifier.lock.Unlock()
+
+	var commands = make(map[string]*server.TLSInfo)
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var record server.AuditRecord
+		assert.NoError(t, json.Unmarshal([]byte(line), &record))
+		commands[record.Command] = record.TLS
+	}
+	assert.EqualValues(t, expected, commands["AUTH"])
+	assert.EqualValues(t, expected, commands["PASS"])
+	assert.Nil(t, commands["USER"])
+	assert.Contains(t, commands, "QUIT")
+}
+
+func TestRequireTLSLogin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftptls")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeCertificate(t, dir)
+
+	driver, err := file.NewDriver(dir)
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2159,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:            server.NewSimplePerm("test", "test"),
+		Logger:          new(server.DiscardLogger),
+		TLS:             true,
+		ExplicitFTPS:    true,
+		CertFile:        certFile,
+		KeyFile:         keyFile,
+		RequireTLSLogin: true,
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			conn, err := net.Dial("tcp", "localhost:2159")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			conn.Close()
+			break
+		}
+
+		responses := sendCommands(t, "localhost:2159", "FEAT", "USER admin", "PASS admin")
+		if assert.Len(t, responses, 3) {
+			assert.Contains(t, responses[0], "211")
+			assert.EqualValues(t, "530 TLS required", responses[1])
+			assert.EqualValues(t, "530 TLS required", responses[2])
+		}
+
+		responses = sendTLSCommands(t, "localhost:2159", "USER admin", "PASS admin")
+		assert.EqualValues(t, []string{"331 User name ok, password required", "230 Password ok, continue"}, responses)
+	})
+
+	opt.TLS = false
+	_, err = server.NewServer(opt)
+	assert.EqualError(t, err, "RequireTLSLogin requires TLS")
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftptls")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	cert, err := tls.LoadX509KeyPair(writeCertificate(t, dir))
+	assert.NoError(t, err)
+
+	driver, err := file.NewDriver(dir)
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2172,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:         server.NewSimplePerm("test", "test"),
+		Logger:       new(server.DiscardLogger),
+		TLS:          true,
+		ExplicitFTPS: true,
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		},
+		RequireTLSLogin: true,
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			conn, err := net.Dial("tcp", "localhost:2172")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			conn.Close()
+			break
+		}
+
+		responses := sendCommands(t, "localhost:2172", "USER admin")
+		assert.EqualValues(t, []string{"530 TLS required"}, responses)
+
+		responses = sendTLSCommands(t, "localhost:2172", "USER admin", "PASS admin", "PBSZ 0", "PROT P")
+		assert.EqualValues(t, []string{
+			"331 User name ok, password required",
+			"230 Password ok, continue",
+			"200 OK",
+			"200 OK",
+		}, responses)
+	})
+}
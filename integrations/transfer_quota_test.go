@@ -0,0 +1,114 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransferQuota(t *testing.T) {
+	err := os.MkdirAll("./testdata/partner", os.ModePerm)
+	assert.NoError(t, err)
+	defer os.RemoveAll("./testdata/partner")
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2161,
+		Auth: &validityAuth{users: map[string]*server.UserInfo{
+			"partner": {TransferQuota: &server.TransferQuota{
+				Period:        server.QuotaMonthly,
+				UploadLimit:   10,
+				DownloadLimit: 5,
+			}},
+		}},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+	}
+
+	s, err := server.NewServer(opt)
+	assert.NoError(t, err)
+	go func() {
+		err := s.ListenAndServe()
+		assert.EqualError(t, err, server.ErrServerClosed.Error())
+	}()
+	defer s.Shutdown()
+
+	// Give server 0.5 seconds to get to the listening state
+	timeout := time.NewTimer(time.Millisecond * 500)
+	for {
+		f, err := ftp.Connect("localhost:2161")
+		if err != nil && len(timeout.C) == 0 { // Retry errors
+			continue
+		}
+		assert.NoError(t, err)
+
+		assert.NoError(t, f.Login("partner", "secret"))
+		assert.NoError(t, f.Stor("/partner/a.txt", strings.NewReader("0123456789")))
+		err = f.Stor("/partner/b.txt", strings.NewReader("b"))
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "Transfer quota exceeded, 10/10 bytes of monthly upload quota used")
+		}
+
+		// the download started under the limit is completed
+		r, err := f.Retr("/partner/a.txt")
+		if assert.NoError(t, err) {
+			data, err := ioutil.ReadAll(r)
+			assert.NoError(t, err)
+			assert.EqualValues(t, "0123456789", string(data))
+			assert.NoError(t, r.Close())
+		}
+		_, err = f.Retr("/partner/a.txt")
+		assert.Error(t, err)
+
+		// the other users have no transfer quota
+		assert.NoError(t, f.Login("other", "secret"))
+		assert.NoError(t, f.Stor("/partner/b.txt", strings.NewReader("b")))
+		assert.NoError(t, f.Quit())
+		break
+	}
+
+	responses := sendCommands(t, "localhost:2161", "USER partner", "PASS secret", "SITE QUOTA")
+	if assert.Len(t, responses, 3) {
+		since := time.Now().Format("2006-01") + "-01"
+		assert.EqualValues(t, strings.Join([]string{
+			"200 The current quota for this session are [current/limit]:",
+			"Name: partner",
+			"Uploaded: 10/10 monthly since " + since,
+			"Downloaded: 10/5 monthly since " + since,
+			"End of quota",
+		}, "\n"), responses[2])
+	}
+
+	rec := httptest.NewRecorder()
+	s.TransferQuotaHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/quota?user=partner", nil))
+	assert.EqualValues(t, http.StatusOK, rec.Code)
+	var usage server.TransferUsage
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &usage))
+	assert.EqualValues(t, "partner", usage.User)
+	assert.EqualValues(t, "monthly", usage.Period)
+	assert.EqualValues(t, 10, usage.Uploaded)
+	assert.EqualValues(t, 10, usage.Downloaded)
+
+	rec = httptest.NewRecorder()
+	s.TransferQuotaHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/quota?user=other", nil))
+	assert.EqualValues(t, http.StatusNotFound, rec.Code)
+}
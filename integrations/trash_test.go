@@ -0,0 +1,217 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrash(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+	defer os.RemoveAll("./testdata/.trash")
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2127,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+		Trash:  &server.Trash{},
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			f, err := ftp.Connect("localhost:2127")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, f.Login("admin", "admin"))
+
+			assert.NoError(t, f.MakeDir("/trash"))
+			assert.NoError(t, f.Stor("/trash/a.txt", strings.NewReader("trash")))
+			assert.NoError(t, f.Delete("/trash/a.txt"))
+
+			names, err := f.NameList("/trash")
+			assert.NoError(t, err)
+			assert.Empty(t, names)
+			names, err = f.NameList("/")
+			assert.NoError(t, err)
+			assert.NotContains(t, names, ".trash")
+
+			responses := sendCommands(t, "localhost:2127", "USER admin", "PASS admin",
+				"SITE UNDELETE /trash/a.txt", "SITE UNDELETE /trash/a.txt")
+			assert.EqualValues(t, []string{
+				"331 User name ok, password required",
+				"230 Password ok, continue",
+				"200 /trash/a.txt restored",
+				"550 Action not taken: No deleted item found",
+			}, responses)
+
+			names, err = f.NameList("/trash")
+			assert.NoError(t, err)
+			assert.EqualValues(t, []string{"a.txt"}, names)
+
+			assert.NoError(t, f.Delete("/trash/a.txt"))
+			assert.NoError(t, f.RemoveDir("/trash"))
+			_, err = os.Stat("./testdata/trash")
+			assert.True(t, os.IsNotExist(err))
+
+			assert.NoError(t, f.Quit())
+			break
+		}
+	})
+}
+
+func TestTrashAreas(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+	defer os.RemoveAll("./testdata/.trash")
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2180,
+		Auth:   &validityAuth{},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+		Trash:  &server.Trash{},
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			f, err := ftp.Connect("localhost:2180")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, f.Login("alice", "secret"))
+
+			assert.NoError(t, f.Stor("/areas.txt", strings.NewReader("trash")))
+			assert.NoError(t, f.Delete("/areas.txt"))
+
+			// the users access their own area
+			names, err := f.NameList("/.trash/alice")
+			assert.NoError(t, err)
+			assert.Len(t, names, 1)
+			item := "/.trash/alice/" + names[0]
+			assert.NoError(t, f.ChangeDir("/.trash/alice"))
+			assert.Error(t, f.ChangeDirToParent())
+			assert.NoError(t, f.Quit())
+
+			// but not the ones of the others
+			assert.EqualValues(t, []string{
+				"550 Action not taken: /.trash/alice is not accessible",
+				"550 Action not taken: /.trash is not accessible",
+				"550 Action not taken: " + item + " is not accessible",
+				"550 Action not taken: " + item + " is not accessible",
+				"550 Action not taken: /.trash/alice is not accessible",
+				"200 Files matching areas.txt*:\nEnd of search",
+			}, sendCommands(t, "localhost:2180", "USER bob", "PASS secret",
+				"CWD /.trash/alice", "LIST /.trash", "RETR "+item, "RNFR "+item,
+				"SITE DU /.trash/alice", "SITE SEARCH areas.txt*")[2:])
+			break
+		}
+	})
+}
+
+func TestTrashRetention(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+	defer os.RemoveAll("./testdata/.trash")
+	defer os.RemoveAll("./testdata/retained")
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2181,
+		Auth:   &validityAuth{},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+		Trash:  &server.Trash{Retention: time.Hour},
+	}
+	s, err := server.NewServer(opt)
+	assert.NoError(t, err)
+	go func() {
+		err := s.ListenAndServe()
+		assert.EqualError(t, err, server.ErrServerClosed.Error())
+	}()
+	defer s.Shutdown()
+
+	// Give server 0.5 seconds to get to the listening state
+	timeout := time.NewTimer(time.Millisecond * 500)
+	for {
+		f, err := ftp.Connect("localhost:2181")
+		if err != nil && len(timeout.C) == 0 { // Retry errors
+			continue
+		}
+		assert.NoError(t, err)
+		assert.NoError(t, f.Login("alice", "secret"))
+
+		assert.NoError(t, f.MakeDir("/retained"))
+		assert.NoError(t, f.Stor("/retained/a.txt", strings.NewReader("retained")))
+		assert.NoError(t, f.Delete("/retained/a.txt"))
+		names, err := f.NameList("/.trash/alice/retained")
+		assert.NoError(t, err)
+		assert.Len(t, names, 1)
+		assert.NoError(t, f.Quit())
+
+		// the retained items are not modified
+		item := "/.trash/alice/retained/" + names[0]
+		assert.EqualValues(t, []string{
+			"550 Action not taken: Deleted items could not be removed or modified during the retention period",
+			"550 Action not taken: Deleted items could not be removed or modified during the retention period",
+			"550 Action not taken: Deleted items could not be removed or modified during the retention period",
+			"550 File delete failed. ",
+		}, sendCommands(t, "localhost:2181", "USER alice", "PASS secret",
+			"STOR "+item, "RNFR "+item, "RNFR /.trash/alice/retained", "DELE "+item)[2:])
+		break
+	}
+
+	rec := httptest.NewRecorder()
+	s.RestoreDeletedHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/restore?user=alice&path=/retained/a.txt", nil))
+	assert.EqualValues(t, http.StatusMethodNotAllowed, rec.Code)
+
+	rec = httptest.NewRecorder()
+	s.RestoreDeletedHandler().ServeHTTP(rec, httptest.NewRequest("POST", "/restore?user=alice&path=/retained/a.txt", nil))
+	assert.EqualValues(t, http.StatusNoContent, rec.Code)
+	data, err := ioutil.ReadFile("./testdata/retained/a.txt")
+	assert.NoError(t, err)
+	assert.EqualValues(t, "retained", string(data))
+
+	rec = httptest.NewRecorder()
+	s.RestoreDeletedHandler().ServeHTTP(rec, httptest.NewRequest("POST", "/restore?user=alice&path=/retained/a.txt", nil))
+	assert.EqualValues(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,68 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTVFS(t *testing.T) {
+	err := os.MkdirAll("./testdata/tvfs", os.ModePerm)
+	assert.NoError(t, err)
+	defer os.RemoveAll("./testdata/tvfs")
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2157,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			conn, err := net.Dial("tcp", "localhost:2157")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			conn.Close()
+			break
+		}
+
+		responses := sendCommands(t, "localhost:2157", "USER admin", "PASS admin", "FEAT",
+			`MKD /tvfs/say "hi"`, `CWD /tvfs//say "hi"/.`, "PWD",
+			"MKD /tvfs/cr\r\x00lf\x00", "CWD /tvfs/cr\r\x00lf\x00", "PWD")
+		if assert.Len(t, responses, 9) {
+			assert.Contains(t, responses[2], "\n TVFS\n")
+			assert.EqualValues(t, "257 Directory created", responses[3])
+			assert.EqualValues(t, `250 Directory changed to /tvfs/say "hi"`, responses[4])
+			assert.EqualValues(t, `257 "/tvfs/say ""hi""" is the current directory`, responses[5])
+			assert.EqualValues(t, "257 Directory created", responses[6])
+			assert.EqualValues(t, "257 \"/tvfs/cr\r\x00lf\x00\" is the current directory", responses[8])
+		}
+		info, err := os.Stat("./testdata/tvfs/cr\rlf\n")
+		if assert.NoError(t, err) {
+			assert.True(t, info.IsDir())
+		}
+	})
+}
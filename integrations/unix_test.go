@@ -0,0 +1,125 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnixSocket(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "ftp-unix")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "ftp.sock")
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	// the client ends of the data connections
+	var pipes = make(chan net.Conn, 1)
+	opt := &server.Options{
+		Name:       "test ftpd",
+		Driver:     driver,
+		UnixSocket: socket,
+		DataChannel: func(sess *server.Session) (net.Conn, error) {
+			serverConn, clientConn := net.Pipe()
+			pipes <- clientConn
+			return serverConn, nil
+		},
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:   server.NewSimplePerm("test", "test"),
+		Logger: new(server.DiscardLogger),
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			conn, err := textproto.Dial("unix", socket)
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer conn.Close()
+
+			_, _, err = conn.ReadResponse(220)
+			assert.NoError(t, err)
+			for _, cmd := range []string{"USER admin", "PASS admin"} {
+				_, err = conn.Cmd("%s", cmd)
+				assert.NoError(t, err)
+				_, _, err = conn.ReadResponse(0)
+				assert.NoError(t, err)
+			}
+
+			// the passive and the active modes are disabled
+			for _, cmd := range []string{"PASV", "EPSV", "PORT 127,0,0,1,8,100", "EPRT |1|127.0.0.1|2148|"} {
+				_, err = conn.Cmd("%s", cmd)
+				assert.NoError(t, err)
+				_, _, err = conn.ReadResponse(502)
+				assert.NoError(t, err, cmd)
+			}
+
+			var content = "unix socket"
+			defer os.Remove("./testdata/unix.txt")
+			_, err = conn.Cmd("STOR /unix.txt")
+			assert.NoError(t, err)
+			data := <-pipes
+			go func() {
+				_, _ = data.Write([]byte(content))
+				data.Close()
+			}()
+			_, _, err = conn.ReadResponse(150)
+			assert.NoError(t, err)
+			_, _, err = conn.ReadResponse(226)
+			assert.NoError(t, err)
+			buf, err := ioutil.ReadFile("./testdata/unix.txt")
+			assert.NoError(t, err)
+			assert.EqualValues(t, content, string(buf))
+
+			_, err = conn.Cmd("RETR /unix.txt")
+			assert.NoError(t, err)
+			data = <-pipes
+			buf, err = ioutil.ReadAll(data)
+			assert.NoError(t, err)
+			assert.EqualValues(t, content, string(buf))
+			_, _, err = conn.ReadResponse(150)
+			assert.NoError(t, err)
+			_, _, err = conn.ReadResponse(226)
+			assert.NoError(t, err)
+
+			_, err = conn.Cmd("NLST /")
+			assert.NoError(t, err)
+			data = <-pipes
+			buf, err = ioutil.ReadAll(data)
+			assert.NoError(t, err)
+			assert.Contains(t, strings.Fields(string(buf)), "unix.txt")
+			_, _, err = conn.ReadResponse(150)
+			assert.NoError(t, err)
+			_, _, err = conn.ReadResponse(226)
+			assert.NoError(t, err)
+			break
+		}
+	})
+}
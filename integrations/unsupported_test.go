@@ -0,0 +1,81 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnsupportedCommands(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	features := server.DefaultFeatures()
+	features.Hash = false
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2165,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:     server.NewSimplePerm("test", "test"),
+		Logger:   new(server.DiscardLogger),
+		Features: features,
+		UnsupportedReply: func(ctx *server.Context, code int, message string) (int, string) {
+			if ctx.Cmd == "XCRC" {
+				return code, "XCRC is not supported, use HASH"
+			}
+			return code, message
+		},
+	}
+
+	s, err := server.NewServer(opt)
+	assert.NoError(t, err)
+	go func() {
+		err := s.ListenAndServe()
+		assert.EqualError(t, err, server.ErrServerClosed.Error())
+	}()
+	defer s.Shutdown()
+
+	// Give server 0.5 seconds to get to the listening state
+	timeout := time.NewTimer(time.Millisecond * 500)
+	for {
+		conn, err := net.Dial("tcp", "localhost:2165")
+		if err != nil && len(timeout.C) == 0 { // Retry errors
+			continue
+		}
+		assert.NoError(t, err)
+		conn.Close()
+		break
+	}
+
+	responses := sendCommands(t, "localhost:2165", "USER admin", "PASS admin", "HASH a.txt", "XCRC a.txt", "XCRC", "NOOP")
+	assert.EqualValues(t, []string{
+		"331 User name ok, password required",
+		"230 Password ok, continue",
+		"502 Command not implemented",
+		"500 XCRC is not supported, use HASH",
+		"500 XCRC is not supported, use HASH",
+		"200 OK",
+	}, responses)
+
+	assert.EqualValues(t, map[string]int64{
+		"HASH": 1,
+		"XCRC": 2,
+	}, s.Stats().UnsupportedCommands)
+}
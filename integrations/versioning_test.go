@@ -0,0 +1,160 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersioning(t *testing.T) {
+	err := os.MkdirAll("./testdata", os.ModePerm)
+	assert.NoError(t, err)
+	defer os.RemoveAll("./testdata/.versions")
+	defer os.Remove("./testdata/versioned.txt")
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2128,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:              server.NewSimplePerm("test", "test"),
+		Logger:            new(server.DiscardLogger),
+		DriverMiddlewares: []server.DriverMiddleware{server.Versioning("")},
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			f, err := ftp.Connect("localhost:2128")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, f.Login("admin", "admin"))
+
+			assert.NoError(t, f.Stor("/versioned.txt", strings.NewReader("v1")))
+			assert.NoError(t, f.Stor("/versioned.txt", strings.NewReader("v2")))
+
+			names, err := f.NameList("/")
+			assert.NoError(t, err)
+			assert.NotContains(t, names, ".versions")
+
+			versions, err := ioutil.ReadDir("./testdata/.versions")
+			assert.NoError(t, err)
+			if assert.Len(t, versions, 1) {
+				id := strings.TrimPrefix(versions[0].Name(), "versioned.txt.v")
+				responses := sendCommands(t, "localhost:2128", "USER admin", "PASS admin",
+					"SITE VERSIONS /versioned.txt", "SITE VERSIONS RESTORE "+id+" /versioned.txt")
+				if assert.Len(t, responses, 4) {
+					assert.Contains(t, responses[2], id+" 2 ")
+					assert.EqualValues(t, "200 Version "+id+" of /versioned.txt restored", responses[3])
+				}
+			}
+
+			buf, err := ioutil.ReadFile("./testdata/versioned.txt")
+			assert.NoError(t, err)
+			assert.EqualValues(t, "v1", string(buf))
+
+			versions, err = ioutil.ReadDir("./testdata/.versions")
+			assert.NoError(t, err)
+			if assert.Len(t, versions, 1) {
+				// the versions are only accessible via SITE VERSIONS
+				version := "/.versions/" + versions[0].Name()
+				assert.EqualValues(t, []string{
+					"550 Action not taken: /.versions is not accessible",
+					"550 Action not taken: " + version + " is not accessible",
+					"550 Action not taken: " + version + " is not accessible",
+					"550 Action not taken: /.versions/new.txt is not accessible",
+					"550 Action not taken: /.versions is not accessible",
+					"200 SITE UTIME command successful",
+				}, sendCommands(t, "localhost:2128", "USER admin", "PASS admin",
+					"LIST /.versions", "RETR "+version, "DELE "+version, "STOR /.versions/new.txt",
+					"CWD /.versions", "SITE UTIME 20200102150405 /versioned.txt")[2:])
+			}
+
+			assert.NoError(t, f.Quit())
+			break
+		}
+	})
+}
+
+func TestVersioningWrapped(t *testing.T) {
+	err := os.MkdirAll("./testdata/inbox", os.ModePerm)
+	assert.NoError(t, err)
+	defer os.RemoveAll("./testdata/.versions")
+	defer os.RemoveAll("./testdata/inbox")
+	defer os.Remove("./testdata/wrapped.txt")
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2182,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:           server.NewSimplePerm("test", "test"),
+		Logger:         new(server.DiscardLogger),
+		ProtectedPaths: []string{"/locked.txt"},
+		NoClobberPaths: []string{"/inbox"},
+		// the versions are found below the aliases
+		DriverMiddlewares: []server.DriverMiddleware{
+			server.Aliases(map[string]string{"/current": "/wrapped.txt"}),
+			server.Versioning(""),
+		},
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			f, err := ftp.Connect("localhost:2182")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, f.Login("admin", "admin"))
+
+			assert.NoError(t, f.Stor("/wrapped.txt", strings.NewReader("v1")))
+			assert.NoError(t, f.Stor("/wrapped.txt", strings.NewReader("v2")))
+			assert.NoError(t, f.Stor("/inbox/kept.txt", strings.NewReader("v1")))
+
+			responses := sendCommands(t, "localhost:2182", "USER admin", "PASS admin",
+				"SITE VERSIONS /wrapped.txt",
+				"SITE VERSIONS /current",
+				"SITE VERSIONS RESTORE 1 /locked.txt",
+				"SITE VERSIONS RESTORE 1 /inbox/kept.txt")
+			if assert.Len(t, responses, 6) {
+				assert.Contains(t, responses[2], " 2 ")
+				assert.Contains(t, responses[3], " 2 ")
+				assert.EqualValues(t, "550 Action not taken: /locked.txt is protected", responses[4])
+				assert.True(t, strings.HasPrefix(responses[5], "553 "), responses[5])
+			}
+
+			assert.NoError(t, f.Quit())
+			break
+		}
+	})
+}
@@ -0,0 +1,158 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteOnlyPaths(t *testing.T) {
+	for _, dir := range []string{"./testdata/dropbox", "./testdata/incoming"} {
+		assert.NoError(t, os.MkdirAll(dir, os.ModePerm))
+		defer os.RemoveAll(dir)
+	}
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2163,
+		Auth: &validityAuth{users: map[string]*server.UserInfo{
+			"partner": {WriteOnlyPaths: []string{"/incoming"}},
+		}},
+		Perm:           server.NewSimplePerm("test", "test"),
+		Logger:         new(server.DiscardLogger),
+		WriteOnlyPaths: []string{"/dropbox"},
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			conn, err := net.Dial("tcp", "localhost:2163")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			conn.Close()
+			break
+		}
+
+		f, err := ftp.Connect("localhost:2163")
+		assert.NoError(t, err)
+		assert.NoError(t, f.Login("partner", "secret"))
+		assert.NoError(t, f.Stor("/dropbox/a.txt", strings.NewReader("a")))
+		assert.NoError(t, f.MakeDir("/dropbox/sub"))
+		assert.NoError(t, f.ChangeDir("/dropbox/sub"))
+		assert.NoError(t, f.Stor("b.txt", strings.NewReader("b")))
+		assert.NoError(t, f.Stor("/incoming/c.txt", strings.NewReader("c")))
+
+		// the write-only directories are listed in their parents
+		names, err := f.NameList("/")
+		assert.NoError(t, err)
+		assert.Contains(t, names, "dropbox")
+		assert.NoError(t, f.Quit())
+
+		responses := sendCommands(t, "localhost:2163", "USER partner", "PASS secret",
+			"LIST /dropbox", "CWD /dropbox", "NLST", "STAT -l sub", "RETR a.txt",
+			"SIZE /dropbox/sub/b.txt", "DELE a.txt", "RNFR a.txt", "RMD sub", "RMD /incoming", "STAT")
+		assert.Len(t, responses, 13)
+		assert.EqualValues(t, []string{
+			"550 Action not taken: /dropbox is write-only",
+			"250 Directory changed to /dropbox",
+			"550 Action not taken: /dropbox is write-only",
+			"550 Action not taken: /dropbox/sub is write-only",
+			"550 Action not taken: /dropbox/a.txt is write-only",
+			"550 Action not taken: /dropbox/sub/b.txt is write-only",
+			"550 Action not taken: /dropbox/a.txt is write-only",
+			"550 Action not taken: /dropbox/a.txt is write-only",
+			"550 Action not taken: /dropbox/sub is write-only",
+			"550 Action not taken: /incoming is write-only",
+		}, responses[2:12])
+		assert.True(t, strings.HasPrefix(responses[12], "211 "))
+
+		// nor the SITE commands read them
+		assert.EqualValues(t, []string{
+			"550 Action not taken: /dropbox is write-only",
+			"550 Action not taken: /dropbox/a.txt is write-only",
+			"200 Files matching ?.txt:\nEnd of search",
+		}, sendCommands(t, "localhost:2163", "USER partner", "PASS secret",
+			"SITE DU /dropbox", "SITE SYMLINK /dropbox/a.txt /link", "SITE SEARCH ?.txt")[2:])
+
+		// the write-only directories of the user are readable by the others
+		responses = sendCommands(t, "localhost:2163", "USER other", "PASS secret", "SIZE /incoming/c.txt")
+		assert.EqualValues(t, "213 1", responses[2])
+	})
+}
+
+func TestWriteOnlyVersions(t *testing.T) {
+	assert.NoError(t, os.MkdirAll("./testdata/dropbox", os.ModePerm))
+	defer os.RemoveAll("./testdata/dropbox")
+	defer os.RemoveAll("./testdata/.versions")
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2188,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:              server.NewSimplePerm("test", "test"),
+		Logger:            new(server.DiscardLogger),
+		WriteOnlyPaths:    []string{"/dropbox"},
+		DriverMiddlewares: []server.DriverMiddleware{server.Versioning("")},
+	}
+
+	runServer(t, opt, nil, func() {
+		// Give server 0.5 seconds to get to the listening state
+		timeout := time.NewTimer(time.Millisecond * 500)
+		for {
+			conn, err := net.Dial("tcp", "localhost:2188")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			assert.NoError(t, err)
+			conn.Close()
+			break
+		}
+
+		f, err := ftp.Connect("localhost:2188")
+		assert.NoError(t, err)
+		assert.NoError(t, f.Login("admin", "admin"))
+		assert.NoError(t, f.Stor("/dropbox/a.txt", strings.NewReader("a")))
+		assert.NoError(t, f.Stor("/dropbox/a.txt", strings.NewReader("b")))
+		assert.NoError(t, f.Quit())
+
+		// the versions of the files of a write-only directory are write-only
+		versions, err := ioutil.ReadDir("./testdata/.versions/dropbox")
+		assert.NoError(t, err)
+		if assert.Len(t, versions, 1) {
+			version := "/.versions/dropbox/" + versions[0].Name()
+			assert.EqualValues(t, []string{
+				"550 Action not taken: /.versions/dropbox is write-only",
+				"550 Action not taken: " + version + " is write-only",
+				"550 Action not taken: " + version + " is write-only",
+			}, sendCommands(t, "localhost:2188", "USER admin", "PASS admin",
+				"LIST /.versions/dropbox", "RETR "+version, "SIZE "+version)[2:])
+		}
+	})
+}
@@ -0,0 +1,126 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"net"
+	"net/textproto"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+	"goftp.io/server/v2/driver/file"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type xferlogNotifier struct {
+	server.NullNotifier
+	transfers chan []server.TransferRecord
+}
+
+func (n *xferlogNotifier) AfterFilePutEvent(ctx *server.Context, event *server.TransferEvent) {
+	n.transfers <- ctx.Sess.Info().Transfers
+}
+
+func (n *xferlogNotifier) AfterFileDownloadedEvent(ctx *server.Context, event *server.TransferEvent) {
+}
+
+func TestSiteXferlog(t *testing.T) {
+	assert.NoError(t, os.MkdirAll("./testdata/xferlog", os.ModePerm))
+	defer os.RemoveAll("./testdata/xferlog")
+
+	driver, err := file.NewDriver("./testdata")
+	assert.NoError(t, err)
+
+	notifier := &xferlogNotifier{transfers: make(chan []server.TransferRecord, 1)}
+	opt := &server.Options{
+		Name:   "test ftpd",
+		Driver: driver,
+		Port:   2173,
+		Auth: &server.SimpleAuth{
+			Name:     "admin",
+			Password: "admin",
+		},
+		Perm:             server.NewSimplePerm("test", "test"),
+		Logger:           new(server.DiscardLogger),
+		TransferChecksum: "CRC32C",
+	}
+
+	runServer(t, opt, []server.Notifier{notifier}, func() {
+		// Give server 0.5 seconds to get to the listening state
+		var (
+			conn    *textproto.Conn
+			timeout = time.NewTimer(time.Millisecond * 500)
+		)
+		for {
+			conn, err = textproto.Dial("tcp", "localhost:2173")
+			if err != nil && len(timeout.C) == 0 { // Retry errors
+				continue
+			}
+			break
+		}
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+
+		_, _, err = conn.ReadResponse(220)
+		assert.NoError(t, err)
+		for _, cmd := range []string{"USER admin", "PASS admin"} {
+			_, err = conn.Cmd("%s", cmd)
+			assert.NoError(t, err)
+			_, _, err = conn.ReadResponse(0)
+			assert.NoError(t, err)
+		}
+
+		_, err = conn.Cmd("SITE XFERLOG")
+		assert.NoError(t, err)
+		_, msg, err := conn.ReadResponse(200)
+		assert.NoError(t, err)
+		assert.EqualValues(t, "0 transfers in this session:\nEnd of transfers", msg)
+
+		_, err = conn.Cmd("EPSV")
+		assert.NoError(t, err)
+		_, msg, err = conn.ReadResponse(229)
+		assert.NoError(t, err)
+		port := strings.Trim(msg[strings.Index(msg, "(")+1:], "|)")
+		dataConn, err := net.Dial("tcp", net.JoinHostPort("localhost", port))
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = conn.Cmd("STOR /xferlog/check.txt")
+		assert.NoError(t, err)
+		_, _, err = conn.ReadResponse(150)
+		assert.NoError(t, err)
+		_, err = dataConn.Write([]byte("123456789"))
+		assert.NoError(t, err)
+		dataConn.Close()
+		_, _, err = conn.ReadResponse(226)
+		assert.NoError(t, err)
+
+		_, err = conn.Cmd("SITE XFERLOG")
+		assert.NoError(t, err)
+		_, msg, err = conn.ReadResponse(200)
+		assert.NoError(t, err)
+		lines := strings.Split(msg, "\n")
+		if assert.Len(t, lines, 3) {
+			assert.EqualValues(t, "1 transfers in this session:", lines[0])
+			// the CRC32C check value
+			assert.Regexp(t, `^ \S+Z STOR /xferlog/check.txt 9 bytes from 0 \[CRC32C e3069283\]$`, lines[1])
+			assert.EqualValues(t, "End of transfers", lines[2])
+		}
+	})
+
+	// the transfer is logged before the transfer notifiers get it
+	transfers := <-notifier.transfers
+	if assert.Len(t, transfers, 1) {
+		assert.EqualValues(t, "STOR", transfers[0].Command)
+		assert.EqualValues(t, "/xferlog/check.txt", transfers[0].Path)
+		assert.EqualValues(t, 9, transfers[0].Size)
+	}
+}
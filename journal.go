@@ -0,0 +1,286 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The operations of the journal records
+const (
+	JournalPut       = "put"
+	JournalDelete    = "delete"
+	JournalMakeDir   = "mkdir"
+	JournalRemoveDir = "rmdir"
+	JournalRename    = "rename"
+	JournalModTime   = "mtime"
+)
+
+// JournalRecord is a successful change of the files recorded in a journal
+type JournalRecord struct {
+	Seq  uint64    `json:"seq"` // the records are numbered from 1, in order
+	Time time.Time `json:"time"`
+	Op   string    `json:"op"`
+	Path string    `json:"path"`
+	User string    `json:"user,omitempty"`
+
+	// the new path, for JournalRename
+	To string `json:"to,omitempty"`
+
+	// the bytes written and where the upload started, -1 if the file was
+	// replaced, for JournalPut
+	Size   int64 `json:"size,omitempty"`
+	Offset int64 `json:"offset,omitempty"`
+
+	// the modification time set, for JournalModTime
+	ModTime *time.Time `json:"mod_time,omitempty"`
+}
+
+// ErrJournalCorrupted is returned when a record doesn't match its checksum
+var ErrJournalCorrupted = errors.New("journal corrupted")
+
+// Journal is an append-only log of the changes of the files, every record
+// is a line holding the CRC-32 of the record and the record encoded as JSON.
+// The journal is written by the Journaling middleware and could be read
+// while it's written, i.e. to drive an incremental sync.
+type Journal struct {
+	lock sync.Mutex
+	file *os.File
+	seq  uint64
+	sync bool
+}
+
+// OpenJournal opens the journal, creating it if needed. The record which
+// wasn't completely written when the process stopped is truncated. If sync
+// is set, the journal is synced to the disk after every record.
+func OpenJournal(name string, sync bool) (*Journal, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	journal := &Journal{file: f, sync: sync}
+	reader := NewJournalReader(f)
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		journal.seq = record.Seq
+	}
+	if len(reader.partial) > 0 {
+		if err := f.Truncate(reader.offset); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return journal, nil
+}
+
+// Append writes the record to the journal, its Seq and its Time are set
+func (journal *Journal) Append(record *JournalRecord) error {
+	journal.lock.Lock()
+	defer journal.lock.Unlock()
+	record.Seq = journal.seq + 1
+	record.Time = time.Now()
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line := fmt.Sprintf("%08x %s\n", crc32.ChecksumIEEE(data), data)
+	if _, err := io.WriteString(journal.file, line); err != nil {
+		return err
+	}
+	if journal.sync {
+		if err := journal.file.Sync(); err != nil {
+			return err
+		}
+	}
+	journal.seq = record.Seq
+	return nil
+}
+
+// Close closes the journal
+func (journal *Journal) Close() error {
+	journal.lock.Lock()
+	defer journal.lock.Unlock()
+	return journal.file.Close()
+}
+
+// JournalReader reads the records of a journal
+type JournalReader struct {
+	r      *bufio.Reader
+	offset int64 // the end of the last record read
+	// the start of a record which is still being written
+	partial []byte
+}
+
+// NewJournalReader returns a reader of the records of the journal
+func NewJournalReader(r io.Reader) *JournalReader {
+	return &JournalReader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next record, io.EOF at the end of the journal. A record
+// which is being written is returned by a next call once it's complete, so
+// Next could be called again after io.EOF to follow the journal.
+func (reader *JournalReader) Next() (*JournalRecord, error) {
+	line, err := reader.r.ReadBytes('\n')
+	reader.partial = append(reader.partial, line...)
+	if err != nil {
+		return nil, err
+	}
+	line, reader.partial = reader.partial, nil
+
+	sep := bytes.IndexByte(line, ' ')
+	if sep < 0 {
+		return nil, ErrJournalCorrupted
+	}
+	sum, err := strconv.ParseUint(string(line[:sep]), 16, 32)
+	data := line[sep+1 : len(line)-1]
+	if err != nil || uint32(sum) != crc32.ChecksumIEEE(data) {
+		return nil, ErrJournalCorrupted
+	}
+	var record JournalRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, ErrJournalCorrupted
+	}
+	reader.offset += int64(len(line))
+	return &record, nil
+}
+
+// Journaling returns a DriverMiddleware recording the successful changes of
+// the files to the journal. The changes are not undone if they couldn't be
+// recorded, the failures are logged.
+func Journaling(journal *Journal) DriverMiddleware {
+	return func(driver Driver) Driver {
+		journaled := &journalDriver{Driver: driver, journal: journal}
+		// keep the driver authentication
+		if auth, ok := driver.(Auth); ok {
+			return &journalAuthDriver{journalDriver: journaled, Auth: auth}
+		}
+		return journaled
+	}
+}
+
+var (
+	_ ModTimeSetter = &journalDriver{}
+	_ Versioner     = &journalDriver{}
+)
+
+type journalDriver struct {
+	Driver
+	journal *Journal
+}
+
+type journalAuthDriver struct {
+	*journalDriver
+	Auth
+}
+
+func (driver *journalDriver) unwrap() Driver {
+	return driver.Driver
+}
+
+func (driver *journalDriver) record(ctx *Context, record *JournalRecord) {
+	if ctx.Sess != nil {
+		record.User = ctx.Sess.pseudoUser(ctx.Sess.LoginUser())
+	}
+	if err := driver.journal.Append(record); err != nil && ctx.Sess != nil {
+		ctx.Sess.errorf("journaling %s %s failed: %v", record.Op, record.Path, err)
+	}
+}
+
+func (driver *journalDriver) DeleteDir(ctx *Context, p string) error {
+	if err := driver.Driver.DeleteDir(ctx, p); err != nil {
+		return err
+	}
+	driver.record(ctx, &JournalRecord{Op: JournalRemoveDir, Path: p})
+	return nil
+}
+
+func (driver *journalDriver) DeleteFile(ctx *Context, p string) error {
+	if err := driver.Driver.DeleteFile(ctx, p); err != nil {
+		return err
+	}
+	driver.record(ctx, &JournalRecord{Op: JournalDelete, Path: p})
+	return nil
+}
+
+func (driver *journalDriver) Rename(ctx *Context, fromPath string, toPath string) error {
+	if err := driver.Driver.Rename(ctx, fromPath, toPath); err != nil {
+		return err
+	}
+	driver.record(ctx, &JournalRecord{Op: JournalRename, Path: fromPath, To: toPath})
+	return nil
+}
+
+func (driver *journalDriver) MakeDir(ctx *Context, p string) error {
+	if err := driver.Driver.MakeDir(ctx, p); err != nil {
+		return err
+	}
+	driver.record(ctx, &JournalRecord{Op: JournalMakeDir, Path: p})
+	return nil
+}
+
+func (driver *journalDriver) PutFile(ctx *Context, destPath string, data io.Reader, offset int64) (int64, error) {
+	size, err := driver.Driver.PutFile(ctx, destPath, data, offset)
+	if err != nil {
+		return size, err
+	}
+	driver.record(ctx, &JournalRecord{Op: JournalPut, Path: destPath, Size: size, Offset: offset})
+	return size, nil
+}
+
+func (driver *journalDriver) SetModTime(ctx *Context, p string, mtime time.Time) error {
+	setter, ok := driver.Driver.(ModTimeSetter)
+	if !ok {
+		return errors.New("Not supported")
+	}
+	if err := setter.SetModTime(ctx, p, mtime); err != nil {
+		return err
+	}
+	driver.record(ctx, &JournalRecord{Op: JournalModTime, Path: p, ModTime: &mtime})
+	return nil
+}
+
+// Versions implements Versioner
+func (driver *journalDriver) Versions(ctx *Context, p string) ([]FileVersion, error) {
+	versioner, ok := driver.Driver.(Versioner)
+	if !ok {
+		return nil, errVersionsNotSupported
+	}
+	return versioner.Versions(ctx, p)
+}
+
+// RestoreVersion implements Versioner, the restored file is recorded as
+// replaced
+func (driver *journalDriver) RestoreVersion(ctx *Context, p string, id string) error {
+	versioner, ok := driver.Driver.(Versioner)
+	if !ok {
+		return errVersionsNotSupported
+	}
+	if err := versioner.RestoreVersion(ctx, p, id); err != nil {
+		return err
+	}
+	var size int64
+	if info, err := driver.Driver.Stat(ctx, p); err == nil {
+		size = info.Size()
+	}
+	driver.record(ctx, &JournalRecord{Op: JournalPut, Path: p, Size: size, Offset: -1})
+	return nil
+}
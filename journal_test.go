@@ -0,0 +1,117 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type journalStubDriver struct {
+	Driver
+}
+
+func (driver *journalStubDriver) MakeDir(ctx *Context, p string) error {
+	return nil
+}
+
+func (driver *journalStubDriver) DeleteFile(ctx *Context, p string) error {
+	return errors.New("denied")
+}
+
+func (driver *journalStubDriver) PutFile(ctx *Context, p string, data io.Reader, offset int64) (int64, error) {
+	return io.Copy(ioutil.Discard, data)
+}
+
+func readJournal(t *testing.T, name string) []JournalRecord {
+	f, err := os.Open(name)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	defer f.Close()
+	var records []JournalRecord
+	reader := NewJournalReader(f)
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			return records
+		}
+		if !assert.NoError(t, err) {
+			return records
+		}
+		records = append(records, *record)
+	}
+}
+
+func TestJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "journal")
+
+	journal, err := OpenJournal(name, true)
+	assert.NoError(t, err)
+	driver := Journaling(journal)(&journalStubDriver{})
+	ctx := &Context{}
+	assert.NoError(t, driver.MakeDir(ctx, "/dir"))
+	_, err = driver.PutFile(ctx, "/dir/a.txt", strings.NewReader("hello"), -1)
+	assert.NoError(t, err)
+	// the failed changes are not recorded
+	assert.Error(t, driver.DeleteFile(ctx, "/dir/a.txt"))
+	assert.NoError(t, journal.Close())
+
+	records := readJournal(t, name)
+	if assert.Len(t, records, 2) {
+		assert.EqualValues(t, 1, records[0].Seq)
+		assert.EqualValues(t, JournalMakeDir, records[0].Op)
+		assert.EqualValues(t, "/dir", records[0].Path)
+		assert.EqualValues(t, 2, records[1].Seq)
+		assert.EqualValues(t, JournalPut, records[1].Op)
+		assert.EqualValues(t, 5, records[1].Size)
+		assert.EqualValues(t, -1, records[1].Offset)
+	}
+
+	// the incomplete record is truncated and the numbering goes on
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0600)
+	assert.NoError(t, err)
+	_, err = f.WriteString(`01234567 {"seq":3`)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+	f, err = os.Open(name)
+	assert.NoError(t, err)
+	reader := NewJournalReader(f)
+	for i := 0; i < 2; i++ {
+		_, err = reader.Next()
+		assert.NoError(t, err)
+	}
+	_, err = reader.Next()
+	assert.Equal(t, io.EOF, err)
+	f.Close()
+
+	journal, err = OpenJournal(name, false)
+	assert.NoError(t, err)
+	driver = Journaling(journal)(&journalStubDriver{})
+	assert.NoError(t, driver.MakeDir(ctx, "/other"))
+	assert.NoError(t, journal.Close())
+	records = readJournal(t, name)
+	if assert.Len(t, records, 3) {
+		assert.EqualValues(t, 3, records[2].Seq)
+		assert.EqualValues(t, "/other", records[2].Path)
+	}
+
+	// the records which don't match their checksum are refused
+	data, err := ioutil.ReadFile(name)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(name, []byte(strings.Replace(string(data), "/dir", "/dur", 1)), 0600))
+	_, err = OpenJournal(name, false)
+	assert.Equal(t, ErrJournalCorrupted, err)
+}
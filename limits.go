@@ -0,0 +1,92 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// PathLimits represents the limits of the paths created by STOR, APPE, MKD
+// and RNTO, so that runaway clients could not create layouts which are
+// pathological for the backends. The zero values mean no limit.
+type PathLimits struct {
+	// The maximum length in bytes of the absolute path
+	MaxLength int
+
+	// The maximum number of path elements, "/a/b" has a depth of 2
+	MaxDepth int
+
+	// The maximum number of entries of a directory
+	MaxEntries int
+}
+
+var (
+	errPathTooLong   = errors.New("Path is too long")
+	errPathTooDeep   = errors.New("Path is too deep")
+	errDirectoryFull = errors.New("Too many entries in the directory")
+)
+
+func pathDepth(p string) int {
+	p = strings.Trim(path.Clean(p), "/")
+	if p == "" {
+		return 0
+	}
+	return strings.Count(p, "/") + 1
+}
+
+// check returns an error if the path could not be created
+func (limits *PathLimits) check(ctx *Context, driver Driver, p string) error {
+	if limits.MaxLength > 0 && len(p) > limits.MaxLength {
+		return errPathTooLong
+	}
+	if limits.MaxDepth > 0 && pathDepth(p) > limits.MaxDepth {
+		return errPathTooDeep
+	}
+	if limits.MaxEntries <= 0 {
+		return nil
+	}
+	if _, err := driver.Stat(ctx, p); err == nil {
+		// replacing an existing entry doesn't add one
+		return nil
+	}
+
+	var entries int
+	err := driver.ListDir(ctx, path.Dir(p), func(os.FileInfo) error {
+		entries++
+		if entries >= limits.MaxEntries {
+			return errDirectoryFull
+		}
+		return nil
+	})
+	if err == errDirectoryFull {
+		return err
+	}
+	// let the command report the other errors
+	return nil
+}
+
+// checkPathLimits replies an error and returns false if the path is not
+// allowed to be created by the command
+func (sess *Session) checkPathLimits(cmd, param, p string) bool {
+	if sess.server.PathLimits == nil {
+		return true
+	}
+	err := sess.server.PathLimits.check(&Context{
+		Sess:  sess,
+		Cmd:   cmd,
+		Param: param,
+		Data:  make(map[string]interface{}),
+	}, sess.server.Driver, p)
+	if err != nil {
+		sess.logf("%s %s refused: %v", cmd, p, err)
+		sess.writeMessage(553, fmt.Sprint("Requested action not taken: ", err))
+		return false
+	}
+	return true
+}
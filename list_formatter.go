@@ -7,6 +7,7 @@ package server
 import (
 	"bytes"
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -29,7 +30,7 @@ func (formatter listFormatter) Short() []byte {
 func (formatter listFormatter) Detailed() []byte {
 	var buf bytes.Buffer
 	for _, file := range formatter {
-		fmt.Fprint(&buf, file.Mode().String())
+		fmt.Fprint(&buf, modeString(file.Mode()))
 		fmt.Fprintf(&buf, " 1 %s %s ", file.Owner(), file.Group())
 		fmt.Fprint(&buf, lpad(strconv.FormatInt(file.Size(), 10), 12))
 		if file.ModTime().Before(time.Now().AddDate(-1, 0, 0)) {
@@ -37,11 +38,24 @@ func (formatter listFormatter) Detailed() []byte {
 		} else{
 			fmt.Fprint(&buf, file.ModTime().Format(" Jan _2 15:04 "))
 		}
-		fmt.Fprintf(&buf, "%s\r\n", file.Name())
+		if target := linkTarget(file); target != "" {
+			fmt.Fprintf(&buf, "%s -> %s\r\n", file.Name(), target)
+		} else {
+			fmt.Fprintf(&buf, "%s\r\n", file.Name())
+		}
 	}
 	return buf.Bytes()
 }
 
+// modeString returns the mode as ls does, os.FileMode marks the links
+// with L
+func modeString(mode os.FileMode) string {
+	if mode&os.ModeSymlink != 0 {
+		return "l" + mode.Perm().String()[1:]
+	}
+	return mode.String()
+}
+
 func lpad(input string, length int) (result string) {
 	if len(input) < length {
 		result = strings.Repeat(" ", length-len(input)) + input
@@ -0,0 +1,143 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"os"
+	"path"
+	"time"
+)
+
+// ListingCache represents the cache of the last directory listings of each
+// session, so that the clients listing the directory again after each
+// command, i.e. the GUI ones, don't list it from the driver each time. The
+// cache of a session is cleared by any command which may change the files.
+type ListingCache struct {
+	// The number of listings cached by each session, if 0 it's 8
+	Entries int
+
+	// How long the listings are cached, if 0 it's 5 seconds
+	TTL time.Duration
+}
+
+const (
+	defaultListingCacheEntries = 8
+	defaultListingCacheTTL     = 5 * time.Second
+)
+
+func (cache *ListingCache) entries() int {
+	if cache.Entries <= 0 {
+		return defaultListingCacheEntries
+	}
+	return cache.Entries
+}
+
+func (cache *ListingCache) ttl() time.Duration {
+	if cache.TTL <= 0 {
+		return defaultListingCacheTTL
+	}
+	return cache.TTL
+}
+
+// listingCommands are the commands which never change the files, the
+// listings are kept after them
+var listingCommands = map[string]bool{
+	"CDUP": true,
+	"CLNT": true,
+	"CWD":  true,
+	"EPRT": true,
+	"EPSV": true,
+	"FEAT": true,
+	"HASH": true,
+	"LIST": true,
+	"LPRT": true,
+	"MDTM": true,
+	"MLSD": true,
+	"MLST": true,
+	"MODE": true,
+	"NLST": true,
+	"NOOP": true,
+	"OPTS": true,
+	"PASV": true,
+	"PORT": true,
+	"PWD":  true,
+	"RANG": true,
+	"REST": true,
+	"RETR": true,
+	"SIZE": true,
+	"STAT": true,
+	"STRU": true,
+	"SYST": true,
+	"TYPE": true,
+	"XCUP": true,
+	"XCWD": true,
+	"XPWD": true,
+}
+
+type cachedListing struct {
+	dir     string
+	files   []os.FileInfo
+	expires time.Time
+}
+
+// listDir lists the directory from the driver, or from the cache of the
+// session if it was listed recently
+func (sess *Session) listDir(ctx *Context, dir string, callback func(os.FileInfo) error) error {
+	cache := sess.server.ListingCache
+	if cache == nil {
+		return sess.server.Driver.ListDir(ctx, dir, callback)
+	}
+
+	dir = path.Join("/", dir)
+	files, ok := sess.cachedListing(dir)
+	if !ok {
+		err := sess.server.Driver.ListDir(ctx, dir, func(f os.FileInfo) error {
+			files = append(files, f)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		sess.listings = append([]cachedListing{{
+			dir:     dir,
+			files:   files,
+			expires: time.Now().Add(cache.ttl()),
+		}}, sess.listings...)
+		if len(sess.listings) > cache.entries() {
+			sess.listings = sess.listings[:cache.entries()]
+		}
+	}
+	for _, f := range files {
+		if err := callback(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cachedListing returns the cached listing of the directory, the expired
+// ones are dropped
+func (sess *Session) cachedListing(dir string) ([]os.FileInfo, bool) {
+	now := time.Now()
+	for i, listing := range sess.listings {
+		if listing.dir != dir {
+			continue
+		}
+		if now.Before(listing.expires) {
+			return listing.files, true
+		}
+		sess.listings = append(sess.listings[:i], sess.listings[i+1:]...)
+		break
+	}
+	return nil, false
+}
+
+// invalidateListings clears the cached listings once the command was
+// executed, unless it never changes the files
+func (sess *Session) invalidateListings(cmd string) {
+	if len(sess.listings) > 0 && !listingCommands[cmd] {
+		sess.listings = nil
+	}
+}
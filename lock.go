@@ -0,0 +1,81 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrLocked is returned by a Locker when the path is locked by another
+// writer, the upload is refused with 450
+var ErrLocked = errors.New("file is being written by another session")
+
+// Locker is an optional interface a Driver could implement to lock the
+// paths being written, i.e. across the servers sharing a storage. If the
+// driver isn't a Locker the paths are locked in memory, so two sessions of
+// the server can't write the same file at once.
+type Locker interface {
+	// params  - the context of the upload, the path to write
+	// returns - the function releasing the lock, ErrLocked if the path is
+	//           locked by another writer or any other error encountered
+	Lock(ctx *Context, path string) (func(), error)
+}
+
+var _ Locker = &memoryLocker{}
+
+// memoryLocker locks the paths written by the sessions of the server
+type memoryLocker struct {
+	lock  sync.Mutex
+	paths map[string]struct{}
+}
+
+func (locker *memoryLocker) Lock(ctx *Context, path string) (func(), error) {
+	locker.lock.Lock()
+	defer locker.lock.Unlock()
+	if _, ok := locker.paths[path]; ok {
+		return nil, ErrLocked
+	}
+	if locker.paths == nil {
+		locker.paths = make(map[string]struct{})
+	}
+	locker.paths[path] = struct{}{}
+	return func() {
+		locker.lock.Lock()
+		delete(locker.paths, path)
+		locker.lock.Unlock()
+	}, nil
+}
+
+// lockUpload locks the path before it's written, it replies 450 and returns
+// false if the path is locked
+func (sess *Session) lockUpload(cmd, p string) (func(), bool) {
+	unlock, err := sess.lockPath(cmd, p)
+	if err != nil {
+		sess.logf("%v", err)
+		sess.writeMessage(450, fmt.Sprint("Action not taken: ", err))
+		return nil, false
+	}
+	return unlock, true
+}
+
+// lockPath locks the path with the Locker of the driver, or in memory
+func (sess *Session) lockPath(cmd, p string) (func(), error) {
+	var locker Locker = &sess.server.locks
+	var lockPath = p
+	if driver, mapPath := optionalDriver(sess.server.Driver, func(driver Driver) bool {
+		_, ok := driver.(Locker)
+		return ok
+	}); driver != nil {
+		locker, lockPath = driver.(Locker), mapPath(p)
+	}
+	return locker.Lock(&Context{
+		Sess:  sess,
+		Cmd:   cmd,
+		Param: p,
+		Data:  make(map[string]interface{}),
+	}, lockPath)
+}
@@ -0,0 +1,170 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// LogFilter controls what is sent to Options.Logger
+type LogFilter struct {
+	// The minimum level of the leveled messages logged
+	Level LogLevel
+
+	// Don't log the commands received from the clients
+	DisableCommands bool
+
+	// Don't log the responses sent to the clients
+	DisableResponses bool
+
+	// Log only one of every N occurrences of the commands, i.e. {"NOOP": 100},
+	// the responses of the skipped commands are not logged either
+	SampleCommands map[string]int
+
+	// The maximum length of the logged lines, longer lines are truncated,
+	// 0 means no limit
+	MaxLineLength int
+}
+
+// logSampler counts the occurrences of the sampled commands, it's shared by
+// all the loggers bound to the sessions
+type logSampler struct {
+	lock    sync.Mutex
+	counts  map[string]int
+	skipped map[string]bool // sessions whose last command was skipped
+}
+
+var (
+	_ Logger        = &filterLogger{}
+	_ LoggerFactory = &filterLogger{}
+	_ LeveledLogger = &filterLogger{}
+)
+
+// filterLogger applies a LogFilter to the wrapped logger
+type filterLogger struct {
+	logger  Logger
+	filter  *LogFilter
+	sampler *logSampler
+}
+
+func newFilterLogger(logger Logger, filter *LogFilter) *filterLogger {
+	return &filterLogger{
+		logger: logger,
+		filter: filter,
+		sampler: &logSampler{
+			counts:  make(map[string]int),
+			skipped: make(map[string]bool),
+		},
+	}
+}
+
+func (logger *filterLogger) truncate(line string) string {
+	if logger.filter.MaxLineLength > 0 && len(line) > logger.filter.MaxLineLength {
+		return line[:logger.filter.MaxLineLength] + "..."
+	}
+	return line
+}
+
+// NewSessionLogger implements LoggerFactory
+func (logger *filterLogger) NewSessionLogger(fields LogFields) Logger {
+	factory, ok := logger.logger.(LoggerFactory)
+	if !ok {
+		return logger
+	}
+	return &filterLogger{
+		logger:  factory.NewSessionLogger(fields),
+		filter:  logger.filter,
+		sampler: logger.sampler,
+	}
+}
+
+// Print implements Logger
+func (logger *filterLogger) Print(sessionID string, message interface{}) {
+	if logger.filter.Level > LevelInfo {
+		return
+	}
+	logger.logger.Print(sessionID, logger.truncate(fmt.Sprint(message)))
+}
+
+// Printf implements Logger
+func (logger *filterLogger) Printf(sessionID string, format string, v ...interface{}) {
+	logger.Print(sessionID, fmt.Sprintf(format, v...))
+}
+
+// PrintCommand implements Logger
+func (logger *filterLogger) PrintCommand(sessionID string, command string, params string) {
+	if logger.filter.DisableCommands {
+		return
+	}
+
+	var skip bool
+	logger.sampler.lock.Lock()
+	name := strings.ToUpper(command)
+	if rate := logger.filter.SampleCommands[name]; rate > 1 {
+		skip = logger.sampler.counts[name]%rate != 0
+		logger.sampler.counts[name]++
+	}
+	if skip {
+		logger.sampler.skipped[sessionID] = true
+	} else {
+		delete(logger.sampler.skipped, sessionID)
+	}
+	logger.sampler.lock.Unlock()
+
+	if !skip {
+		logger.logger.PrintCommand(sessionID, command, logger.truncate(params))
+	}
+}
+
+// PrintResponse implements Logger
+func (logger *filterLogger) PrintResponse(sessionID string, code int, message string) {
+	if logger.filter.DisableResponses {
+		return
+	}
+
+	logger.sampler.lock.Lock()
+	skip := logger.sampler.skipped[sessionID]
+	logger.sampler.lock.Unlock()
+
+	if !skip {
+		logger.logger.PrintResponse(sessionID, code, logger.truncate(message))
+	}
+}
+
+// closeSession forgets the sampling state of the terminated session
+func (logger *filterLogger) closeSession(sessionID string) {
+	logger.sampler.lock.Lock()
+	delete(logger.sampler.skipped, sessionID)
+	logger.sampler.lock.Unlock()
+}
+
+func (logger *filterLogger) log(level LogLevel, sessionID string, format string, v ...interface{}) {
+	if level < logger.filter.Level {
+		return
+	}
+	logLevel(logger.logger, level, sessionID, "%s", logger.truncate(fmt.Sprintf(format, v...)))
+}
+
+// Debug implements LeveledLogger
+func (logger *filterLogger) Debug(sessionID string, format string, v ...interface{}) {
+	logger.log(LevelDebug, sessionID, format, v...)
+}
+
+// Info implements LeveledLogger
+func (logger *filterLogger) Info(sessionID string, format string, v ...interface{}) {
+	logger.log(LevelInfo, sessionID, format, v...)
+}
+
+// Warn implements LeveledLogger
+func (logger *filterLogger) Warn(sessionID string, format string, v ...interface{}) {
+	logger.log(LevelWarn, sessionID, format, v...)
+}
+
+// Error implements LeveledLogger
+func (logger *filterLogger) Error(sessionID string, format string, v ...interface{}) {
+	logger.log(LevelError, sessionID, format, v...)
+}
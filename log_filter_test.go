@@ -0,0 +1,96 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"testing"
+)
+
+type recordLogger struct {
+	lines []string
+}
+
+func (logger *recordLogger) Print(sessionID string, message interface{}) {
+	logger.lines = append(logger.lines, fmt.Sprint(message))
+}
+
+func (logger *recordLogger) Printf(sessionID string, format string, v ...interface{}) {
+	logger.Print(sessionID, fmt.Sprintf(format, v...))
+}
+
+func (logger *recordLogger) PrintCommand(sessionID string, command string, params string) {
+	logger.lines = append(logger.lines, "> "+command+" "+params)
+}
+
+func (logger *recordLogger) PrintResponse(sessionID string, code int, message string) {
+	logger.lines = append(logger.lines, fmt.Sprintf("< %d %s", code, message))
+}
+
+func TestFilterLogger(t *testing.T) {
+	record := &recordLogger{}
+	logger := newFilterLogger(record, &LogFilter{
+		Level:          LevelInfo,
+		SampleCommands: map[string]int{"NOOP": 2},
+		MaxLineLength:  8,
+	})
+
+	for i := 0; i < 3; i++ {
+		logger.PrintCommand("1", "NOOP", "")
+		logger.PrintResponse("1", 200, "OK")
+	}
+	logger.PrintCommand("1", "CWD", "/a/very/long/path")
+	logger.Debug("1", "hidden")
+	logger.Warn("1", "shown")
+
+	var expected = []string{
+		"> NOOP ", "< 200 OK",
+		"> NOOP ", "< 200 OK",
+		"> CWD /a/very/...",
+		"WARN shown",
+	}
+	if fmt.Sprint(record.lines) != fmt.Sprint(expected) {
+		t.Errorf("expected %q, actual %q", expected, record.lines)
+	}
+}
+
+func TestFilterLoggerCloseSession(t *testing.T) {
+	logger := newFilterLogger(&recordLogger{}, &LogFilter{
+		SampleCommands: map[string]int{"NOOP": 2},
+	})
+
+	logger.PrintCommand("1", "NOOP", "")
+	logger.PrintCommand("1", "NOOP", "")
+	if !logger.sampler.skipped["1"] {
+		t.Fatal("expected the session to be skipped")
+	}
+	logger.closeSession("1")
+	if len(logger.sampler.skipped) != 0 {
+		t.Errorf("expected no skipped session, actual %v", logger.sampler.skipped)
+	}
+}
+
+func TestRedactParam(t *testing.T) {
+	var redactTests = []struct {
+		command  string
+		param    string
+		expected string
+	}{
+		{"PASS", "secret", "****"},
+		{"pass", "secret", "****"},
+		{"USER", "admin", "admin"},
+		{"SITE", "PASSWD old new", "PASSWD ****"},
+		{"SITE", "LOGIN user password=secret", "LOGIN user password=****"},
+		{"SITE", "LOGIN user token abc", "LOGIN user token ****"},
+		{"SITE", "LOGIN Authorization: Bearer abc", "LOGIN Authorization: **** ****"},
+		{"SITE", "UTIME 20200102150405 a.txt", "UTIME 20200102150405 a.txt"},
+	}
+
+	for _, tt := range redactTests {
+		if actual := redactParam(tt.command, tt.param); actual != tt.expected {
+			t.Errorf("redactParam(%s, %s): expected %q, actual %q", tt.command, tt.param, tt.expected, actual)
+		}
+	}
+}
@@ -17,12 +17,139 @@ type Logger interface {
 	PrintResponse(sessionID string, code int, message string)
 }
 
+// LogLevel represents the severity of a log message
+type LogLevel int
+
+// The log levels, from the least to the most severe
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// String returns the name of the level
+func (level LogLevel) String() string {
+	switch level {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LEVEL(%d)", int(level))
+}
+
+// LeveledLogger is an optional interface a Logger could implement to receive
+// the messages with their severity, the messages are sent to Printf with
+// the level as prefix otherwise.
+type LeveledLogger interface {
+	Debug(sessionID string, format string, v ...interface{})
+	Info(sessionID string, format string, v ...interface{})
+	Warn(sessionID string, format string, v ...interface{})
+	Error(sessionID string, format string, v ...interface{})
+}
+
+// logLevel sends a message to the logger with its level
+func logLevel(logger Logger, level LogLevel, sessionID string, format string, v ...interface{}) {
+	leveled, ok := logger.(LeveledLogger)
+	if !ok {
+		logger.Printf(sessionID, level.String()+" "+format, v...)
+		return
+	}
+	switch level {
+	case LevelDebug:
+		leveled.Debug(sessionID, format, v...)
+	case LevelInfo:
+		leveled.Info(sessionID, format, v...)
+	case LevelWarn:
+		leveled.Warn(sessionID, format, v...)
+	default:
+		leveled.Error(sessionID, format, v...)
+	}
+}
+
+// LogFields represents the fields of a session a logger could be bound to
+type LogFields struct {
+	SessionID  string
+	User       string // empty before the user login
+	RemoteAddr string
+}
+
+// LoggerFactory is an optional interface a Logger could implement to produce
+// a logger bound to every session, so that all the lines of a session could
+// be correlated. A new logger is produced when the session starts and
+// once the user has logged in.
+type LoggerFactory interface {
+	NewSessionLogger(fields LogFields) Logger
+}
+
+var (
+	_ Logger        = &StdLogger{}
+	_ LoggerFactory = &StdLogger{}
+	_ LeveledLogger = &StdLogger{}
+)
+
 // StdLogger use an instance of this to log in a standard format
-type StdLogger struct{}
+type StdLogger struct {
+	// The minimum level of the leveled messages logged, default is LevelDebug
+	Level LogLevel
+
+	fields *LogFields
+}
+
+// NewSessionLogger implements LoggerFactory
+func (logger *StdLogger) NewSessionLogger(fields LogFields) Logger {
+	return &StdLogger{
+		Level:  logger.Level,
+		fields: &fields,
+	}
+}
+
+func (logger *StdLogger) printLevel(level LogLevel, sessionID string, format string, v ...interface{}) {
+	if level < logger.Level {
+		return
+	}
+	log.Printf("%s  %s %s", logger.prefix(sessionID), level, fmt.Sprintf(format, v...))
+}
+
+// Debug implements LeveledLogger
+func (logger *StdLogger) Debug(sessionID string, format string, v ...interface{}) {
+	logger.printLevel(LevelDebug, sessionID, format, v...)
+}
+
+// Info implements LeveledLogger
+func (logger *StdLogger) Info(sessionID string, format string, v ...interface{}) {
+	logger.printLevel(LevelInfo, sessionID, format, v...)
+}
+
+// Warn implements LeveledLogger
+func (logger *StdLogger) Warn(sessionID string, format string, v ...interface{}) {
+	logger.printLevel(LevelWarn, sessionID, format, v...)
+}
+
+// Error implements LeveledLogger
+func (logger *StdLogger) Error(sessionID string, format string, v ...interface{}) {
+	logger.printLevel(LevelError, sessionID, format, v...)
+}
+
+func (logger *StdLogger) prefix(sessionID string) string {
+	if logger.fields == nil {
+		return sessionID
+	}
+	user := logger.fields.User
+	if user == "" {
+		user = "-"
+	}
+	return fmt.Sprintf("%s %s@%s", sessionID, user, logger.fields.RemoteAddr)
+}
 
 // Print implements Logger
 func (logger *StdLogger) Print(sessionID string, message interface{}) {
-	log.Printf("%s  %s", sessionID, message)
+	log.Printf("%s  %s", logger.prefix(sessionID), message)
 }
 
 // Printf implements Logger
@@ -33,20 +160,37 @@ func (logger *StdLogger) Printf(sessionID string, format string, v ...interface{
 // PrintCommand implements Logger
 func (logger *StdLogger) PrintCommand(sessionID string, command string, params string) {
 	if command == "PASS" {
-		log.Printf("%s > PASS ****", sessionID)
+		log.Printf("%s > PASS ****", logger.prefix(sessionID))
 	} else {
-		log.Printf("%s > %s %s", sessionID, command, params)
+		log.Printf("%s > %s %s", logger.prefix(sessionID), command, params)
 	}
 }
 
 // PrintResponse implements Logger
 func (logger *StdLogger) PrintResponse(sessionID string, code int, message string) {
-	log.Printf("%s < %d %s", sessionID, code, message)
+	log.Printf("%s < %d %s", logger.prefix(sessionID), code, message)
 }
 
+var (
+	_ Logger        = &DiscardLogger{}
+	_ LeveledLogger = &DiscardLogger{}
+)
+
 // DiscardLogger represents a silent logger, produces no output
 type DiscardLogger struct{}
 
+// Debug implements LeveledLogger
+func (logger *DiscardLogger) Debug(sessionID string, format string, v ...interface{}) {}
+
+// Info implements LeveledLogger
+func (logger *DiscardLogger) Info(sessionID string, format string, v ...interface{}) {}
+
+// Warn implements LeveledLogger
+func (logger *DiscardLogger) Warn(sessionID string, format string, v ...interface{}) {}
+
+// Error implements LeveledLogger
+func (logger *DiscardLogger) Error(sessionID string, format string, v ...interface{}) {}
+
 // Print implements Logger
 func (logger *DiscardLogger) Print(sessionID string, message interface{}) {}
 
@@ -0,0 +1,322 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package file implements a server.Logger writing to a file which is rotated
+// by size or by time, so that a daemon could log without logrotate.
+package file
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"goftp.io/server/v2"
+)
+
+const backupTimeFormat = "20060102T150405.000"
+
+// Options contains parameters for New()
+type Options struct {
+	// The path of the log file, required
+	Filename string
+
+	// Rotate the file once it's larger than MaxSize bytes, 0 means no limit
+	MaxSize int64
+
+	// Rotate the file once it's older than RotateEvery, 0 means never
+	RotateEvery time.Duration
+
+	// Compress the rotated files with gzip
+	Compress bool
+
+	// Remove the rotated files older than MaxAge, 0 means keep them forever
+	MaxAge time.Duration
+}
+
+var (
+	_ server.Logger        = &Logger{}
+	_ server.LeveledLogger = &Logger{}
+	_ server.LoggerFactory = &Logger{}
+)
+
+// Logger implements server.Logger to write to a rotated file
+type Logger struct {
+	*writer
+	fields *server.LogFields
+}
+
+// writer is shared between the loggers bound to the sessions
+type writer struct {
+	opts     Options
+	lock     sync.Mutex
+	f        *os.File
+	size     int64
+	openedAt time.Time
+	closed   bool
+	lastCut  time.Time      // the time of the last rotation
+	wg       sync.WaitGroup // compressions in progress
+}
+
+// New opens the log file and returns a Logger writing to it
+func New(opts Options) (*Logger, error) {
+	if opts.Filename == "" {
+		return nil, fmt.Errorf("file logger: Filename is required")
+	}
+	w := &writer{opts: opts}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return &Logger{writer: w}, nil
+}
+
+func (w *writer) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.opts.Filename), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(w.opts.Filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.f = f
+	w.size = info.Size()
+	w.openedAt = time.Now()
+	return nil
+}
+
+// backupName returns the name of a rotated file, the time is inserted
+// before the extension, i.e. ftpd-20200102T150405.000.log
+func (w *writer) backupName(t time.Time) string {
+	ext := filepath.Ext(w.opts.Filename)
+	prefix := strings.TrimSuffix(w.opts.Filename, ext)
+	return prefix + "-" + t.Format(backupTimeFormat) + ext
+}
+
+func (w *writer) needRotate(n int) bool {
+	if w.opts.MaxSize > 0 && w.size > 0 && w.size+int64(n) > w.opts.MaxSize {
+		return true
+	}
+	return w.opts.RotateEvery > 0 && time.Since(w.openedAt) >= w.opts.RotateEvery
+}
+
+// rotate renames the file and opens a new one, if the file couldn't be
+// renamed the logging goes on in it
+func (w *writer) rotate() error {
+	err := w.f.Close()
+	w.f = nil
+	if err != nil {
+		return err
+	}
+	// the backups are named by time, make sure two rotations in the same
+	// millisecond don't get the same name
+	now := time.Now()
+	if !now.After(w.lastCut.Add(time.Millisecond)) {
+		now = w.lastCut.Add(time.Millisecond)
+	}
+	w.lastCut = now
+	backup := w.backupName(now)
+	if err := os.Rename(w.opts.Filename, backup); err != nil {
+		if oerr := w.open(); oerr != nil {
+			return oerr
+		}
+		// the rotation is retried once the file is due again
+		w.size = 0
+		return err
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		if w.opts.Compress {
+			if err := compress(backup); err != nil {
+				fmt.Fprintf(os.Stderr, "file logger: compress %s failed: %v\n", backup, err)
+			}
+		}
+		w.removeExpired()
+	}()
+	return nil
+}
+
+// compress gzips the file and removes it
+func compress(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(name+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	if _, err = io.Copy(gz, src); err == nil {
+		err = gz.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(name + ".gz")
+		return err
+	}
+	return os.Remove(name)
+}
+
+// backups returns the rotated files, the oldest first
+func (w *writer) backups() ([]string, error) {
+	ext := filepath.Ext(w.opts.Filename)
+	prefix := filepath.Base(strings.TrimSuffix(w.opts.Filename, ext)) + "-"
+	infos, err := ioutil.ReadDir(filepath.Dir(w.opts.Filename))
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		ts := strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".gz"), ext)
+		if _, err := time.Parse(backupTimeFormat, ts); err != nil {
+			continue
+		}
+		names = append(names, filepath.Join(filepath.Dir(w.opts.Filename), name))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (w *writer) removeExpired() {
+	if w.opts.MaxAge <= 0 {
+		return
+	}
+	names, err := w.backups()
+	if err != nil {
+		return
+	}
+	for _, name := range names {
+		info, err := os.Stat(name)
+		if err == nil && time.Since(info.ModTime()) > w.opts.MaxAge {
+			os.Remove(name)
+		}
+	}
+}
+
+func (w *writer) writeLine(line string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.closed {
+		return
+	}
+	// the file is reopened if it couldn't be after a rotation
+	if w.f == nil {
+		if err := w.open(); err != nil {
+			return
+		}
+	}
+	if w.needRotate(len(line)) {
+		if err := w.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "file logger: rotate %s failed: %v\n", w.opts.Filename, err)
+			if w.f == nil {
+				return
+			}
+		}
+	}
+	n, _ := w.f.WriteString(line)
+	w.size += int64(n)
+}
+
+// Close closes the log file and waits for the rotated files to be compressed
+func (w *writer) Close() error {
+	w.lock.Lock()
+	var err error
+	if w.f != nil {
+		err = w.f.Close()
+		w.f = nil
+	}
+	w.closed = true
+	w.lock.Unlock()
+	w.wg.Wait()
+	return err
+}
+
+func (logger *Logger) prefix(sessionID string) string {
+	if logger.fields == nil {
+		return sessionID
+	}
+	user := logger.fields.User
+	if user == "" {
+		user = "-"
+	}
+	return fmt.Sprintf("%s %s@%s", sessionID, user, logger.fields.RemoteAddr)
+}
+
+func (logger *Logger) write(sessionID string, msg string) {
+	logger.writeLine(fmt.Sprintf("%s %s  %s\n", time.Now().Format("2006/01/02 15:04:05"), logger.prefix(sessionID), msg))
+}
+
+// NewSessionLogger implements server.LoggerFactory
+func (logger *Logger) NewSessionLogger(fields server.LogFields) server.Logger {
+	return &Logger{
+		writer: logger.writer,
+		fields: &fields,
+	}
+}
+
+// Print implements server.Logger
+func (logger *Logger) Print(sessionID string, message interface{}) {
+	logger.write(sessionID, fmt.Sprint(message))
+}
+
+// Printf implements server.Logger
+func (logger *Logger) Printf(sessionID string, format string, v ...interface{}) {
+	logger.write(sessionID, fmt.Sprintf(format, v...))
+}
+
+// PrintCommand implements server.Logger
+func (logger *Logger) PrintCommand(sessionID string, command string, params string) {
+	logger.write(sessionID, fmt.Sprintf("> %s %s", command, params))
+}
+
+// PrintResponse implements server.Logger
+func (logger *Logger) PrintResponse(sessionID string, code int, message string) {
+	logger.write(sessionID, fmt.Sprintf("< %d %s", code, message))
+}
+
+// Debug implements server.LeveledLogger
+func (logger *Logger) Debug(sessionID string, format string, v ...interface{}) {
+	logger.write(sessionID, "DEBUG "+fmt.Sprintf(format, v...))
+}
+
+// Info implements server.LeveledLogger
+func (logger *Logger) Info(sessionID string, format string, v ...interface{}) {
+	logger.write(sessionID, "INFO "+fmt.Sprintf(format, v...))
+}
+
+// Warn implements server.LeveledLogger
+func (logger *Logger) Warn(sessionID string, format string, v ...interface{}) {
+	logger.write(sessionID, "WARN "+fmt.Sprintf(format, v...))
+}
+
+// Error implements server.LeveledLogger
+func (logger *Logger) Error(sessionID string, format string, v ...interface{}) {
+	logger.write(sessionID, "ERROR "+fmt.Sprintf(format, v...))
+}
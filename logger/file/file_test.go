@@ -0,0 +1,68 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goftp-logger")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	logger, err := New(Options{
+		Filename: filepath.Join(dir, "ftpd.log"),
+		MaxSize:  100,
+		Compress: true,
+	})
+	assert.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		logger.PrintCommand("abc", "STOR", strings.Repeat("a", 40))
+	}
+	assert.NoError(t, logger.Close())
+
+	backups, err := logger.backups()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, backups)
+	for _, name := range backups {
+		assert.True(t, strings.HasSuffix(name, ".log.gz"), name)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "ftpd.log"))
+	assert.NoError(t, err)
+	assert.True(t, info.Size() <= 100)
+}
+
+func TestRotateFailed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goftp-logger")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "ftpd.log")
+	logger, err := New(Options{
+		Filename: name,
+		MaxSize:  100,
+	})
+	assert.NoError(t, err)
+
+	// the file removed behind the logger could not be renamed, the logging
+	// goes on in a new file
+	logger.PrintCommand("abc", "STOR", strings.Repeat("a", 40))
+	assert.NoError(t, os.Remove(name))
+	logger.PrintCommand("abc", "STOR", strings.Repeat("b", 40))
+	assert.NoError(t, logger.Close())
+
+	data, err := ioutil.ReadFile(name)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), strings.Repeat("b", 40))
+}
@@ -0,0 +1,148 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package syslog
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"goftp.io/server/v2"
+)
+
+// Format is the format of the audit events sent to syslog
+type Format int
+
+// The formats of the audit events
+const (
+	CEF  Format = iota // ArcSight Common Event Format
+	LEEF               // QRadar Log Event Extended Format 1.0
+)
+
+const (
+	vendor  = "goftp"
+	product = "server"
+	version = "2"
+)
+
+// event is a security relevant audit record
+type event struct {
+	id       string
+	name     string
+	severity int // CEF severity, from 0 to 10
+}
+
+// classify returns the event of an audit record, the other records are
+// not sent
+func classify(record *server.AuditRecord) (event, bool) {
+	switch {
+	case record.Command == "PASS" && record.Code == 230:
+		return event{"login", "Login succeeded", 3}, true
+	case record.Command == "PASS" && record.Code == 530:
+		return event{"login-failure", "Login failed", 6}, true
+	case record.Command == "CONNECT" && record.Code == 421:
+		return event{"ban", "Connection refused", 7}, true
+	case (record.Command == "DELE" || record.Command == "RMD" || record.Command == "XRMD") && record.Code == 250:
+		return event{"delete", "Deleted", 5}, true
+	case record.Code == 530 && record.Command != "USER" && record.Command != "PASS",
+		record.Code == 532, record.Code == 534, record.Code == 553:
+		return event{"denied", "Permission denied", 6}, true
+	}
+	return event{}, false
+}
+
+// auditSink sends the events to syslog
+type auditSink struct {
+	logger *Logger
+	format Format
+}
+
+// NewAuditSink returns a server.AuditSink sending the security relevant
+// records through the logger in the CEF or the LEEF format: the logins, the
+// failed logins, the refused connections, the deletions and the permission
+// denials.
+func NewAuditSink(logger *Logger, format Format) server.AuditSink {
+	return &auditSink{logger, format}
+}
+
+// Audit implements server.AuditSink
+func (sink *auditSink) Audit(record *server.AuditRecord) {
+	ev, ok := classify(record)
+	if !ok {
+		return
+	}
+	var msg string
+	if sink.format == LEEF {
+		msg = formatLEEF(ev, record)
+	} else {
+		msg = formatCEF(ev, record)
+	}
+	severity := severityInfo
+	if ev.severity >= 6 {
+		severity = severityWarning
+	}
+	sink.logger.write(severity, "AUDIT", nil, record.SessionID, msg)
+}
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`)
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+	leefEscaper         = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+)
+
+// formatCEF returns the CEF message of an event
+func formatCEF(ev event, record *server.AuditRecord) string {
+	var ext = []string{
+		fmt.Sprintf("rt=%d", record.Time.UnixNano()/int64(time.Millisecond)),
+		"src=" + cefExtensionEscaper.Replace(record.IP),
+	}
+	if record.User != "" {
+		ext = append(ext, "suser="+cefExtensionEscaper.Replace(record.User))
+	}
+	ext = append(ext,
+		"act="+cefExtensionEscaper.Replace(record.Command),
+		"cs1Label=session",
+		"cs1="+cefExtensionEscaper.Replace(record.SessionID),
+		fmt.Sprintf("cn1Label=code cn1=%d", record.Code),
+	)
+	if record.Param != "" {
+		ext = append(ext, "request="+cefExtensionEscaper.Replace(record.Param))
+	}
+	return fmt.Sprintf("CEF:0|%s|%s|%s|%s|%s|%d|%s",
+		vendor, product, version,
+		cefHeaderEscaper.Replace(ev.id),
+		cefHeaderEscaper.Replace(ev.name),
+		ev.severity,
+		strings.Join(ext, " "),
+	)
+}
+
+// formatLEEF returns the LEEF message of an event, the attributes are tab
+// separated
+func formatLEEF(ev event, record *server.AuditRecord) string {
+	var attrs = []string{
+		"devTime=" + record.Time.Format("Jan 02 2006 15:04:05.000 MST"),
+		"devTimeFormat=MMM dd yyyy HH:mm:ss.SSS z",
+		"src=" + leefEscaper.Replace(record.IP),
+	}
+	if record.User != "" {
+		attrs = append(attrs, "usrName="+leefEscaper.Replace(record.User))
+	}
+	attrs = append(attrs,
+		fmt.Sprintf("sev=%d", ev.severity),
+		"cat="+ev.id,
+		"action="+leefEscaper.Replace(record.Command),
+		"sessionID="+leefEscaper.Replace(record.SessionID),
+		fmt.Sprintf("code=%d", record.Code),
+	)
+	if record.Param != "" {
+		attrs = append(attrs, "resource="+leefEscaper.Replace(record.Param))
+	}
+	return fmt.Sprintf("LEEF:1.0|%s|%s|%s|%s|%s",
+		vendor, product, version,
+		strings.Replace(ev.id, "|", " ", -1),
+		strings.Join(attrs, "\t"),
+	)
+}
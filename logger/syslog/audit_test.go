@@ -0,0 +1,57 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package syslog
+
+import (
+	"net"
+	"regexp"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	logger, err := New(Options{
+		Network:  "udp",
+		Address:  conn.LocalAddr().String(),
+		Hostname: "ftp.example.com",
+	})
+	assert.NoError(t, err)
+	defer logger.Close()
+
+	var (
+		now = time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC)
+		buf = make([]byte, 1024)
+	)
+	for _, format := range []Format{CEF, LEEF} {
+		sink := NewAuditSink(logger, format)
+		// not a security event
+		sink.Audit(&server.AuditRecord{Time: now, SessionID: "abc", IP: "127.0.0.1", Command: "CWD", Code: 250})
+		sink.Audit(&server.AuditRecord{Time: now, SessionID: "abc", IP: "127.0.0.1", User: "admin", Command: "PASS", Param: "****", Code: 530})
+		sink.Audit(&server.AuditRecord{Time: now, SessionID: "abc", IP: "127.0.0.1", User: "admin", Command: "DELE", Param: "/a=b", Code: 250})
+
+		var msgs []string
+		for i := 0; i < 2; i++ {
+			assert.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+			n, _, err := conn.ReadFrom(buf)
+			assert.NoError(t, err)
+			msgs = append(msgs, string(buf[:n]))
+		}
+		if format == CEF {
+			assert.Regexp(t, regexp.MustCompile(`^<92>1 \S+ ftp.example.com goftp \d+ AUDIT \[ftp@32473 session="abc"\] CEF:0\|goftp\|server\|2\|login-failure\|Login failed\|6\|rt=1577977445000 src=127.0.0.1 suser=admin act=PASS cs1Label=session cs1=abc cn1Label=code cn1=530 request=\*\*\*\*$`), msgs[0])
+			assert.Regexp(t, regexp.MustCompile(`^<94>1 .* CEF:0\|goftp\|server\|2\|delete\|Deleted\|5\|.* request=/a\\=b$`), msgs[1])
+		} else {
+			assert.Regexp(t, regexp.MustCompile("^<92>1 .* LEEF:1.0\\|goftp\\|server\\|2\\|login-failure\\|devTime=Jan 02 2020 15:04:05.000 UTC\t.*\tsrc=127.0.0.1\tusrName=admin\tsev=6\t"), msgs[0])
+			assert.Regexp(t, regexp.MustCompile("^<94>1 .* LEEF:1.0\\|goftp\\|server\\|2\\|delete\\|.*\tresource=/a=b$"), msgs[1])
+		}
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package syslog implements a server.Logger sending RFC 5424 messages to a
+// syslog daemon over tcp, udp or unix sockets.
+package syslog
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"goftp.io/server/v2"
+)
+
+// Facility represents a syslog facility
+type Facility int
+
+// The syslog facilities defined by RFC 5424
+const (
+	Kern Facility = iota
+	User
+	Mail
+	Daemon
+	Auth
+	Syslog
+	LPR
+	News
+	UUCP
+	Cron
+	AuthPriv
+	FTP
+	_
+	_
+	_
+	_
+	Local0
+	Local1
+	Local2
+	Local3
+	Local4
+	Local5
+	Local6
+	Local7
+)
+
+// The syslog severities the log levels are mapped to
+const (
+	severityError   = 3
+	severityWarning = 4
+	severityInfo    = 6
+	severityDebug   = 7
+)
+
+// the private enterprise number used for the structured data of the sessions
+const sdID = "ftp@32473"
+
+// Options contains parameters for New()
+type Options struct {
+	// The network of the syslog daemon, "tcp", "udp", "unix" or "unixgram".
+	// If empty the local syslog daemon is used via /dev/log.
+	Network string
+
+	// The address of the syslog daemon, i.e. "127.0.0.1:514" or "/dev/log"
+	Address string
+
+	// The facility of the messages, default is FTP. Kern, the zero value,
+	// cannot be used by user processes and is replaced by FTP as well.
+	Facility Facility
+
+	// The application name of the messages, default is "goftp"
+	AppName string
+
+	// The hostname of the messages, default is os.Hostname()
+	Hostname string
+}
+
+var (
+	_ server.Logger        = &Logger{}
+	_ server.LeveledLogger = &Logger{}
+	_ server.LoggerFactory = &Logger{}
+)
+
+// Logger implements server.Logger to send messages to syslog
+type Logger struct {
+	*writer
+	fields *server.LogFields
+}
+
+// writer is shared between the loggers bound to the sessions
+type writer struct {
+	opts     Options
+	facility Facility
+	pid      int
+	lock     sync.Mutex
+	conn     net.Conn
+}
+
+// New connects to the syslog daemon and returns a Logger sending messages
+// to it
+func New(opts Options) (*Logger, error) {
+	w := &writer{
+		opts:     opts,
+		facility: FTP,
+		pid:      os.Getpid(),
+	}
+	if opts.Facility != Kern {
+		w.facility = opts.Facility
+	}
+	if w.opts.AppName == "" {
+		w.opts.AppName = "goftp"
+	}
+	if w.opts.Hostname == "" {
+		w.opts.Hostname, _ = os.Hostname()
+	}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return &Logger{writer: w}, nil
+}
+
+func (w *writer) connect() error {
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+
+	if w.opts.Network != "" {
+		conn, err := net.Dial(w.opts.Network, w.opts.Address)
+		if err != nil {
+			return err
+		}
+		w.conn = conn
+		return nil
+	}
+
+	for _, network := range []string{"unixgram", "unix"} {
+		for _, address := range []string{"/dev/log", "/var/run/syslog", "/var/run/log"} {
+			if conn, err := net.Dial(network, address); err == nil {
+				w.conn = conn
+				return nil
+			}
+		}
+	}
+	return errors.New("syslog: no local syslog daemon found")
+}
+
+// Close closes the connection to the syslog daemon
+func (w *writer) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// escapeParam escapes a structured data param value as specified by RFC 5424
+func escapeParam(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(v)
+}
+
+// format returns a RFC 5424 message
+func (w *writer) format(t time.Time, severity int, msgID string, fields *server.LogFields, sessionID, msg string) string {
+	var sd = "-"
+	if fields != nil {
+		sd = fmt.Sprintf(`[%s session="%s" user="%s" addr="%s"]`, sdID,
+			escapeParam(fields.SessionID), escapeParam(fields.User), escapeParam(fields.RemoteAddr))
+	} else if sessionID != "" {
+		sd = fmt.Sprintf(`[%s session="%s"]`, sdID, escapeParam(sessionID))
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s %s %s",
+		int(w.facility)*8+severity,
+		t.Format(time.RFC3339Nano),
+		w.opts.Hostname,
+		w.opts.AppName,
+		w.pid,
+		msgID,
+		sd,
+		msg,
+	)
+}
+
+func (w *writer) write(severity int, msgID string, fields *server.LogFields, sessionID, msg string) {
+	line := w.format(time.Now(), severity, msgID, fields, sessionID, msg)
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	// reconnect once if the daemon has been restarted
+	for i := 0; i < 2; i++ {
+		if w.conn == nil {
+			if err := w.connect(); err != nil {
+				return
+			}
+		}
+
+		var err error
+		switch w.opts.Network {
+		case "tcp", "tcp4", "tcp6", "unix":
+			// octet counting framing of RFC 6587
+			_, err = fmt.Fprintf(w.conn, "%d %s", len(line), line)
+		default:
+			_, err = w.conn.Write([]byte(line))
+		}
+		if err == nil {
+			return
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+}
+
+// NewSessionLogger implements server.LoggerFactory
+func (logger *Logger) NewSessionLogger(fields server.LogFields) server.Logger {
+	return &Logger{
+		writer: logger.writer,
+		fields: &fields,
+	}
+}
+
+// Print implements server.Logger
+func (logger *Logger) Print(sessionID string, message interface{}) {
+	logger.write(severityInfo, "-", logger.fields, sessionID, fmt.Sprint(message))
+}
+
+// Printf implements server.Logger
+func (logger *Logger) Printf(sessionID string, format string, v ...interface{}) {
+	logger.write(severityInfo, "-", logger.fields, sessionID, fmt.Sprintf(format, v...))
+}
+
+// PrintCommand implements server.Logger
+func (logger *Logger) PrintCommand(sessionID string, command string, params string) {
+	logger.write(severityInfo, "CMD", logger.fields, sessionID, strings.TrimSpace(command+" "+params))
+}
+
+// PrintResponse implements server.Logger
+func (logger *Logger) PrintResponse(sessionID string, code int, message string) {
+	logger.write(severityInfo, "RESP", logger.fields, sessionID, fmt.Sprintf("%d %s", code, message))
+}
+
+// Debug implements server.LeveledLogger
+func (logger *Logger) Debug(sessionID string, format string, v ...interface{}) {
+	logger.write(severityDebug, "-", logger.fields, sessionID, fmt.Sprintf(format, v...))
+}
+
+// Info implements server.LeveledLogger
+func (logger *Logger) Info(sessionID string, format string, v ...interface{}) {
+	logger.write(severityInfo, "-", logger.fields, sessionID, fmt.Sprintf(format, v...))
+}
+
+// Warn implements server.LeveledLogger
+func (logger *Logger) Warn(sessionID string, format string, v ...interface{}) {
+	logger.write(severityWarning, "-", logger.fields, sessionID, fmt.Sprintf(format, v...))
+}
+
+// Error implements server.LeveledLogger
+func (logger *Logger) Error(sessionID string, format string, v ...interface{}) {
+	logger.write(severityError, "-", logger.fields, sessionID, fmt.Sprintf(format, v...))
+}
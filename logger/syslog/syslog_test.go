@@ -0,0 +1,49 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package syslog
+
+import (
+	"net"
+	"regexp"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogger(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	logger, err := New(Options{
+		Network:  "udp",
+		Address:  conn.LocalAddr().String(),
+		Facility: Local3,
+		Hostname: "ftp.example.com",
+	})
+	assert.NoError(t, err)
+	defer logger.Close()
+
+	sessLogger := logger.NewSessionLogger(server.LogFields{
+		SessionID:  "abc",
+		User:       "admin",
+		RemoteAddr: "127.0.0.1:1234",
+	})
+	sessLogger.PrintCommand("abc", "CWD", "/")
+	sessLogger.(server.LeveledLogger).Warn("abc", "slow %s", "client")
+
+	var buf = make([]byte, 1024)
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	n, _, err := conn.ReadFrom(buf)
+	assert.NoError(t, err)
+	assert.Regexp(t, regexp.MustCompile(`^<158>1 \S+ ftp.example.com goftp \d+ CMD \[ftp@32473 session="abc" user="admin" addr="127.0.0.1:1234"\] CWD /$`), string(buf[:n]))
+
+	n, _, err = conn.ReadFrom(buf)
+	assert.NoError(t, err)
+	assert.Regexp(t, regexp.MustCompile(`^<156>1 .* slow client$`), string(buf[:n]))
+}
@@ -0,0 +1,131 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"io"
+	"sync"
+)
+
+// MemoryBudget represents the memory the buffers of the in-flight transfers
+// could use server wide. When the budget runs short the buffers get
+// smaller, down to MinBufferSize, and once it's exhausted the transfers wait
+// for the running ones to finish instead of exhausting the memory.
+type MemoryBudget struct {
+	// The bytes of all the buffers
+	Limit int64
+
+	// The size of the buffer of a transfer, if 0 it's 32KiB
+	BufferSize int64
+
+	// The smallest buffer a transfer gets, if 0 it's 4KiB
+	MinBufferSize int64
+}
+
+const (
+	defaultTransferBufferSize    = 32 * 1024
+	defaultMinTransferBufferSize = 4 * 1024
+)
+
+func (budget *MemoryBudget) bufferSizes() (int64, int64) {
+	size, min := budget.BufferSize, budget.MinBufferSize
+	if size <= 0 {
+		size = defaultTransferBufferSize
+	}
+	if min <= 0 {
+		min = defaultMinTransferBufferSize
+	}
+	if min > size {
+		min = size
+	}
+	return size, min
+}
+
+// memoryBudget tracks the memory used by the transfers
+type memoryBudget struct {
+	limit int64
+	lock  sync.Mutex
+	cond  *sync.Cond
+	used  int64
+}
+
+func newMemoryBudget(budget *MemoryBudget) *memoryBudget {
+	if budget == nil || budget.Limit <= 0 {
+		return nil
+	}
+	b := &memoryBudget{limit: budget.Limit}
+	b.cond = sync.NewCond(&b.lock)
+	return b
+}
+
+// acquire returns the bytes granted, size at most and min at least, it
+// waits while less than min bytes are available
+func (b *memoryBudget) acquire(size, min int64) int64 {
+	if b == nil {
+		return size
+	}
+	if min > b.limit {
+		min = b.limit
+	}
+	if size < min {
+		size = min
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for b.limit-b.used < min {
+		b.cond.Wait()
+	}
+	if available := b.limit - b.used; size > available {
+		size = available
+	}
+	b.used += size
+	return size
+}
+
+func (b *memoryBudget) release(size int64) {
+	if b == nil {
+		return
+	}
+	b.lock.Lock()
+	b.used -= size
+	b.lock.Unlock()
+	b.cond.Broadcast()
+}
+
+// AcquireMemory reserves memory of the budget of the server, i.e. for the
+// buffers of a driver. It returns the bytes granted, size at most and min
+// at least, and waits while less than min bytes are available. The memory
+// should be released by ReleaseMemory once it's not used anymore.
+func (server *Server) AcquireMemory(size, min int64) int64 {
+	return server.memory.acquire(size, min)
+}
+
+// ReleaseMemory releases the memory reserved by AcquireMemory
+func (server *Server) ReleaseMemory(size int64) {
+	server.memory.release(size)
+}
+
+// acquireTransferBuffer reserves the buffer of a transfer, it returns the
+// size granted and the function releasing it
+func (sess *Session) acquireTransferBuffer() (int64, func()) {
+	if sess.server.memory == nil {
+		return defaultTransferBufferSize, func() {}
+	}
+	size := sess.server.memory.acquire(sess.server.MemoryBudget.bufferSizes())
+	return size, func() {
+		sess.server.memory.release(size)
+	}
+}
+
+// copyBuffered copies the data with a buffer of the memory budget
+func (sess *Session) copyBuffered(w io.Writer, r io.Reader) (int64, error) {
+	if sess.server.memory == nil {
+		return io.Copy(w, r)
+	}
+	size, release := sess.acquireTransferBuffer()
+	defer release()
+	// hide ReadFrom and WriteTo so that the buffer is used
+	return io.CopyBuffer(struct{ io.Writer }{w}, struct{ io.Reader }{r}, make([]byte, size))
+}
@@ -0,0 +1,40 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryBudget(t *testing.T) {
+	var unlimited *memoryBudget
+	assert.EqualValues(t, 100, unlimited.acquire(100, 10))
+	unlimited.release(100)
+	assert.Nil(t, newMemoryBudget(&MemoryBudget{}))
+
+	budget := newMemoryBudget(&MemoryBudget{Limit: 100})
+	assert.EqualValues(t, 60, budget.acquire(60, 10))
+	// the buffer shrinks when the budget runs short
+	assert.EqualValues(t, 40, budget.acquire(60, 10))
+
+	var acquired = make(chan int64)
+	go func() {
+		acquired <- budget.acquire(60, 10)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("the budget is exhausted")
+	case <-time.After(50 * time.Millisecond):
+	}
+	budget.release(40)
+	assert.EqualValues(t, 40, <-acquired)
+
+	size, min := (&MemoryBudget{}).bufferSizes()
+	assert.EqualValues(t, defaultTransferBufferSize, size)
+	assert.EqualValues(t, defaultMinTransferBufferSize, min)
+}
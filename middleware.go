@@ -0,0 +1,98 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+// CommandHandler handles a command received from a client, ctx.Cmd is the
+// upper cased command and ctx.Param its parameter
+type CommandHandler func(ctx *Context)
+
+// CommandMiddleware wraps the command dispatching, a middleware could run
+// code before and after calling next, or reply to the client itself via
+// ctx.Sess.WriteMessage without calling next to reject the command.
+type CommandMiddleware func(next CommandHandler) CommandHandler
+
+// Use registers middlewares wrapping the dispatching of every command, the
+// first registered is the outermost one. It should be called before the
+// server starts serving.
+func (server *Server) Use(middlewares ...CommandMiddleware) {
+	server.middlewares = append(server.middlewares, middlewares...)
+}
+
+// commandHandler returns the dispatcher of commands wrapped by the
+// registered middlewares
+func (server *Server) commandHandler(sess *Session) CommandHandler {
+	var handler CommandHandler = sess.executeCommand
+	for i := len(server.middlewares) - 1; i >= 0; i-- {
+		handler = server.middlewares[i](handler)
+	}
+	return handler
+}
+
+// DriverMiddleware wraps a driver, i.e. to add quotas, caching or auditing.
+// The wrapper should forward the optional interfaces of the wrapped driver
+// it wants to keep, like Auth or ModTimeSetter.
+type DriverMiddleware func(Driver) Driver
+
+// wrapDriver wraps the driver by the middlewares, the first one is the
+// outermost one
+func wrapDriver(driver Driver, middlewares []DriverMiddleware) Driver {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		driver = middlewares[i](driver)
+	}
+	return driver
+}
+
+// driverWrapper is implemented by the wrappers of this package, so that the
+// server could find a wrapper below the others
+type driverWrapper interface {
+	unwrap() Driver
+}
+
+// pathMapper is implemented by the wrappers which only map the paths to the
+// ones of the driver they wrap, i.e. Aliases, so that the optional
+// interfaces of the driver are still used through them
+type pathMapper interface {
+	driverWrapper
+	mapPath(p string) string
+}
+
+// optionalDriver returns the driver implementing an optional interface,
+// looking through the wrappers mapping the paths, and the function mapping
+// the paths to the ones of the driver. The driver is nil if none matches.
+func optionalDriver(driver Driver, match func(Driver) bool) (Driver, func(string) string) {
+	var mapPath = func(p string) string {
+		return p
+	}
+	for {
+		if match(driver) {
+			return driver, mapPath
+		}
+		mapper, ok := driver.(pathMapper)
+		if !ok {
+			return nil, nil
+		}
+		outer := mapPath
+		mapPath = func(p string) string {
+			return mapper.mapPath(outer(p))
+		}
+		driver = mapper.unwrap()
+	}
+}
+
+// findDriver returns the first driver of the wrappers chain matching, nil if
+// none does. The chain stops at the wrappers not from this package.
+func findDriver(driver Driver, match func(Driver) bool) Driver {
+	for driver != nil {
+		if match(driver) {
+			return driver
+		}
+		wrapper, ok := driver.(driverWrapper)
+		if !ok {
+			return nil
+		}
+		driver = wrapper.unwrap()
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// mlstFacts are the facts of RFC 3659 listed by MLSD and MLST, in the order
+// they are listed. They are all listed unless the client selects some of
+// them by OPTS MLST.
+var mlstFacts = []string{"Type", "Modify", "Size", "Perm", "UNIX.owner", "UNIX.group"}
+
+// mlstFeat returns the MLST line of FEAT, the facts listed by default are
+// marked by an asterisk
+func mlstFeat() string {
+	var buf strings.Builder
+	buf.WriteString("MLST ")
+	for _, fact := range mlstFacts {
+		buf.WriteString(fact + "*;")
+	}
+	return buf.String()
+}
+
+// factsOrDefault returns the facts selected by the client, all if none
+func (sess *Session) factsOrDefault() []string {
+	if sess.mlstFacts == nil {
+		return mlstFacts
+	}
+	return sess.mlstFacts
+}
+
+// fileFacts returns the facts of the file, i.e.
+// "Type=file;Modify=20200102150405;Size=1024;"
+func fileFacts(file FileInfo, facts []string) string {
+	var buf strings.Builder
+	for _, fact := range facts {
+		var value string
+		switch fact {
+		case "Type":
+			value = factType(file)
+		case "Modify":
+			value = file.ModTime().UTC().Format("20060102150405")
+		case "Size":
+			value = fmt.Sprint(file.Size())
+		case "Perm":
+			value = factPerm(file)
+		case "UNIX.owner":
+			value = file.Owner()
+		case "UNIX.group":
+			value = file.Group()
+		}
+		buf.WriteString(fact + "=" + value + ";")
+	}
+	return buf.String()
+}
+
+func factType(file FileInfo) string {
+	if file.IsDir() {
+		return "dir"
+	} else if target := linkTarget(file); target != "" {
+		return "OS.unix=slink:" + target
+	} else if file.Mode()&os.ModeSymlink != 0 {
+		return "OS.unix=symlink"
+	}
+	return "file"
+}
+
+// factPerm returns the operations allowed on the file, they are derived
+// from the permissions of its owner
+func factPerm(file FileInfo) string {
+	var (
+		mode = file.Mode().Perm()
+		perm string
+	)
+	if file.IsDir() {
+		if mode&0100 != 0 {
+			perm += "e"
+		}
+		if mode&0400 != 0 {
+			perm += "l"
+		}
+		if mode&0200 != 0 {
+			perm += "cdfmp"
+		}
+		return perm
+	}
+	if mode&0400 != 0 {
+		perm += "r"
+	}
+	if mode&0200 != 0 {
+		perm += "adfw"
+	}
+	return perm
+}
+
+// executeOptsMLST responds to OPTS MLST, it selects the facts listed by
+// MLSD and MLST, the unknown facts are ignored
+func executeOptsMLST(sess *Session, params []string) {
+	if _, ok := sess.server.Commands["MLST"]; !ok {
+		sess.writeMessage(550, "Unknow params")
+		return
+	}
+	var names []string
+	if len(params) > 0 {
+		names = strings.Split(params[0], ";")
+	}
+	var selected = []string{}
+	for _, fact := range mlstFacts {
+		for _, name := range names {
+			if strings.EqualFold(name, fact) {
+				selected = append(selected, fact)
+				break
+			}
+		}
+	}
+	sess.mlstFacts = selected
+	var reply = "MLST OPTS "
+	for _, fact := range selected {
+		reply += fact + ";"
+	}
+	sess.writeMessage(200, reply)
+}
+
+// commandMLST responds to the MLST FTP command. It returns the facts of a
+// file or a directory over the control connection.
+type commandMLST struct{}
+
+func (cmd commandMLST) IsExtend() bool {
+	return false
+}
+
+func (cmd commandMLST) RequireParam() bool {
+	return false
+}
+
+func (cmd commandMLST) RequireAuth() bool {
+	return true
+}
+
+func (cmd commandMLST) Execute(sess *Session, param string) {
+	p := sess.buildPath(param)
+	var ctx = &Context{
+		Sess:  sess,
+		Cmd:   "MLST",
+		Param: param,
+		Data:  make(map[string]interface{}),
+	}
+	info, err := sess.server.Driver.Stat(ctx, p)
+	if err != nil {
+		sess.writeMessage(550, err.Error())
+		return
+	}
+	file, err := convertFileInfo(sess, info, p)
+	if err != nil {
+		sess.writeMessage(550, err.Error())
+		return
+	}
+	file = sess.withLinkTarget(ctx, file, p)
+	// the fact line starts with a space, and gives the absolute path
+	line := " " + fileFacts(file, sess.factsOrDefault()) + " " + p
+	sess.writeMessageLines(250, "Listing "+encodePathname(p), []string{line}, "End")
+}
@@ -0,0 +1,57 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import "os"
+
+// the modes of the created files and directories if only a umask is set
+const (
+	defaultFileMode os.FileMode = 0666
+	defaultDirMode  os.FileMode = 0777
+)
+
+// FileMode returns the permission bits the driver should give to the file
+// created by the upload, 0 if neither Options nor UserInfo set them so that
+// the driver uses its defaults
+func (ctx *Context) FileMode() os.FileMode {
+	if ctx.Sess == nil {
+		return 0
+	}
+	mode := ctx.Sess.server.FileMode
+	if info := ctx.Sess.userInfo; info != nil && info.FileMode != 0 {
+		mode = info.FileMode
+	}
+	return ctx.Sess.createMode(mode, defaultFileMode)
+}
+
+// DirMode returns the permission bits the driver should give to the
+// directory created by MKD, 0 if neither Options nor UserInfo set them so
+// that the driver uses its defaults
+func (ctx *Context) DirMode() os.FileMode {
+	if ctx.Sess == nil {
+		return 0
+	}
+	mode := ctx.Sess.server.DirMode
+	if info := ctx.Sess.userInfo; info != nil && info.DirMode != 0 {
+		mode = info.DirMode
+	}
+	return ctx.Sess.createMode(mode, defaultDirMode)
+}
+
+// createMode returns the mode masked by the umask of the server or of the
+// user, the default mode is used if only a umask is set
+func (sess *Session) createMode(mode, defaultMode os.FileMode) os.FileMode {
+	umask := sess.server.Umask
+	if sess.userInfo != nil && sess.userInfo.Umask != 0 {
+		umask = sess.userInfo.Umask
+	}
+	if mode == 0 {
+		if umask == 0 {
+			return 0
+		}
+		mode = defaultMode
+	}
+	return mode.Perm() &^ umask
+}
@@ -0,0 +1,51 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+)
+
+// isNoClobber reports whether the absolute path is in a no-clobber
+// directory, the patterns match as the ones of the write-only directories
+func isNoClobber(patterns []string, p string) bool {
+	return isWriteOnly(patterns, p)
+}
+
+// noClobberPatterns returns the no-clobber directories of the login user
+func (sess *Session) noClobberPatterns() []string {
+	patterns := sess.server.NoClobberPaths
+	if sess.userInfo != nil && len(sess.userInfo.NoClobberPaths) > 0 {
+		patterns = append(patterns[:len(patterns):len(patterns)], sess.userInfo.NoClobberPaths...)
+	}
+	return patterns
+}
+
+// checkClobber replies 553 and returns false if the upload would overwrite
+// a file of a no-clobber directory. A resume at the end of the file is
+// allowed since it only appends to it, as APPE does.
+func (sess *Session) checkClobber(cmd, p string) bool {
+	patterns := sess.noClobberPatterns()
+	if len(patterns) == 0 || !isNoClobber(patterns, p) {
+		return true
+	}
+	if cmd == "APPE" && sess.preCommand != "REST" {
+		return true
+	}
+	info, err := sess.server.Driver.Stat(&Context{
+		Sess:  sess,
+		Cmd:   cmd,
+		Param: p,
+		Data:  make(map[string]interface{}),
+	}, p)
+	if err != nil || info.IsDir() {
+		return true
+	}
+	if sess.preCommand == "REST" && sess.lastFilePos == info.Size() {
+		return true
+	}
+	sess.writeMessage(553, fmt.Sprintf("Requested action not taken: %s already exists, delete it first or use APPE", encodePathname(p)))
+	return false
+}
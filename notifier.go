@@ -4,6 +4,8 @@
 
 package server
 
+import "time"
+
 // Notifier represents a notification operator interface
 type Notifier interface {
 	BeforeLoginUser(ctx *Context, userName string)
@@ -22,10 +24,58 @@ type Notifier interface {
 	AfterDirDeleted(ctx *Context, dstPath string, err error)
 }
 
+// TransferEvent describes a finished upload or download
+type TransferEvent struct {
+	Path       string        // the path of the file
+	Size       int64         // the bytes transferred
+	Offset     int64         // the position the transfer started from
+	Duration   time.Duration // how long the transfer took
+	Throughput float64       // the average bytes per second
+	Aborted    bool          // if the transfer didn't complete
+	Err        error         // the error the transfer failed with
+
+	// The hex digest of the data transferred and the HASH name of its
+	// algorithm, if Options.TransferChecksum is set and the transfer
+	// succeeded
+	Checksum     string
+	ChecksumAlgo string
+
+	// The data transferred by the login user across the sessions, this
+	// transfer included
+	UserBandwidth UserBandwidth
+}
+
+func newTransferEvent(path string, size, offset int64, start time.Time, err error) *TransferEvent {
+	if offset < 0 {
+		offset = 0
+	}
+	var event = TransferEvent{
+		Path:     path,
+		Size:     size,
+		Offset:   offset,
+		Duration: time.Since(start),
+		Aborted:  err != nil,
+		Err:      err,
+	}
+	if event.Duration > 0 {
+		event.Throughput = float64(size) / event.Duration.Seconds()
+	}
+	return &event
+}
+
+// TransferNotifier is an optional interface a Notifier could implement to
+// receive the details of the finished transfers, the events are sent right
+// after AfterFilePut and AfterFileDownloaded
+type TransferNotifier interface {
+	AfterFilePutEvent(ctx *Context, event *TransferEvent)
+	AfterFileDownloadedEvent(ctx *Context, event *TransferEvent)
+}
+
 type notifierList []Notifier
 
 var (
-	_ Notifier = notifierList{}
+	_ Notifier         = notifierList{}
+	_ TransferNotifier = notifierList{}
 )
 
 func (notifiers notifierList) BeforeLoginUser(ctx *Context, userName string) {
@@ -82,6 +132,19 @@ func (notifiers notifierList) AfterFilePut(ctx *Context, dstPath string, size in
 	}
 }
 
+func (notifiers notifierList) AfterFilePutEvent(ctx *Context, event *TransferEvent) {
+	if ctx.Sess != nil {
+		event.UserBandwidth = ctx.Sess.server.bandwidth.get(ctx.Sess.LoginUser())
+		ctx.Sess.recorder.transfer(ctx, event)
+		ctx.Sess.logTransfer(ctx, event)
+	}
+	for _, notifier := range notifiers {
+		if n, ok := notifier.(TransferNotifier); ok {
+			n.AfterFilePutEvent(ctx, event)
+		}
+	}
+}
+
 func (notifiers notifierList) AfterFileDeleted(ctx *Context, dstPath string, err error) {
 	for _, notifier := range notifiers {
 		notifier.AfterFileDeleted(ctx, dstPath, err)
@@ -94,6 +157,19 @@ func (notifiers notifierList) AfterFileDownloaded(ctx *Context, dstPath string,
 	}
 }
 
+func (notifiers notifierList) AfterFileDownloadedEvent(ctx *Context, event *TransferEvent) {
+	if ctx.Sess != nil {
+		event.UserBandwidth = ctx.Sess.server.bandwidth.get(ctx.Sess.LoginUser())
+		ctx.Sess.recorder.transfer(ctx, event)
+		ctx.Sess.logTransfer(ctx, event)
+	}
+	for _, notifier := range notifiers {
+		if n, ok := notifier.(TransferNotifier); ok {
+			n.AfterFileDownloadedEvent(ctx, event)
+		}
+	}
+}
+
 func (notifiers notifierList) AfterCurDirChanged(ctx *Context, oldCurDir, newCurDir string, err error) {
 	for _, notifier := range notifiers {
 		notifier.AfterCurDirChanged(ctx, oldCurDir, newCurDir, err)
@@ -0,0 +1,145 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ParseMode represents how the command lines of the clients are parsed
+type ParseMode int
+
+const (
+	// ParseLenient tolerates the common deviations of the clients: the
+	// lines ended by a bare LF, the Telnet commands anywhere in the lines,
+	// the spaces before the commands and the params not separated from the
+	// commands, i.e. "CWD/pub"
+	ParseLenient ParseMode = iota
+
+	// ParseStrict rejects with 500 the lines which don't follow RFC 959,
+	// they are logged. The commands are still case insensitive as RFC 959
+	// requires and the Telnet IP and Synch could still precede them, i.e.
+	// before ABOR.
+	ParseStrict
+)
+
+var errTelnetCommand = errors.New("Telnet command inside the line")
+
+// telnetText returns the line without the Telnet commands, IAC IAC being a
+// 0xff byte of the text. In strict mode the commands are only allowed at the
+// start of the line.
+func telnetText(line string, strict bool) (string, error) {
+	// clients may send the Telnet IP and Synch sequences before ABOR
+	for len(line) > 0 && (line[0] == 0xff || line[0] == 0xf4 || line[0] == 0xf2) {
+		line = line[1:]
+	}
+	if strings.IndexByte(line, 0xff) < 0 {
+		return line, nil
+	}
+
+	var text = make([]byte, 0, len(line))
+	for i := 0; i < len(line); i++ {
+		if line[i] != 0xff {
+			text = append(text, line[i])
+			continue
+		}
+		if i+1 < len(line) && line[i+1] == 0xff {
+			text = append(text, 0xff)
+			i++
+			continue
+		}
+		if strict {
+			return "", errTelnetCommand
+		}
+		switch {
+		case i+1 >= len(line):
+		case line[i+1] >= 251 && line[i+1] <= 254:
+			// WILL, WONT, DO and DONT are followed by the option
+			i += 2
+		case line[i+1] == 250:
+			// the subnegotiation ends with IAC SE
+			end := strings.Index(line[i:], "\xff\xf0")
+			if end < 0 {
+				i = len(line)
+			} else {
+				i += end + 1
+			}
+		default:
+			i++
+		}
+	}
+	return string(text), nil
+}
+
+func isLetter(c byte) bool {
+	c |= 0x20
+	return c >= 'a' && c <= 'z'
+}
+
+// isCommandName reports whether the command is made of 3 or 4 letters as
+// RFC 959 requires
+func isCommandName(command string) bool {
+	if len(command) < 3 || len(command) > 4 {
+		return false
+	}
+	for i := 0; i < len(command); i++ {
+		if !isLetter(command[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// splitLine returns the command and the param of the line, in lenient mode
+// the param may follow a known command without space
+func (sess *Session) splitLine(line string, strict bool) (string, string, error) {
+	if !strict {
+		line = strings.TrimLeft(line, " ")
+	}
+	params := strings.SplitN(line, " ", 2)
+	command := params[0]
+	if !isCommandName(command) {
+		if strict {
+			return "", "", fmt.Errorf("invalid command %q", command)
+		}
+		for _, l := range []int{4, 3} {
+			if len(command) <= l || !isCommandName(command[:l]) || isLetter(command[l]) {
+				continue
+			}
+			if _, ok := sess.server.Commands[strings.ToUpper(command[:l])]; ok {
+				return command[:l], decodePathname(line[l:]), nil
+			}
+		}
+	}
+	if len(params) == 1 {
+		return command, "", nil
+	}
+	return command, decodePathname(params[1]), nil
+}
+
+// parseLine returns the command and the param of the line read from the
+// control connection, the error tells why it's rejected in strict mode
+func (sess *Session) parseLine(line string) (string, string, error) {
+	strict := sess.server.Parsing == ParseStrict
+	if strict {
+		if !strings.HasSuffix(line, "\r\n") {
+			return "", "", errors.New("line not ended by CRLF")
+		}
+		line = strings.TrimSuffix(line, "\r\n")
+		// a CR of a pathname is sent as CR NUL
+		if strings.Contains(strings.Replace(line, "\r\x00", "", -1), "\r") {
+			return "", "", errors.New("CR inside the line")
+		}
+	} else {
+		line = strings.Trim(line, "\r\n")
+	}
+	line, err := telnetText(line, strict)
+	if err != nil {
+		return "", "", err
+	}
+	return sess.splitLine(line, strict)
+}
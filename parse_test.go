@@ -0,0 +1,61 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLine(t *testing.T) {
+	server := &Server{Options: &Options{}}
+	server.Commands = defaultCommands
+	sess := &Session{server: server}
+
+	for _, mode := range []ParseMode{ParseLenient, ParseStrict} {
+		server.Parsing = mode
+		for line, expected := range map[string][2]string{
+			"USER admin\r\n":           {"USER", "admin"},
+			"user admin\r\n":           {"user", "admin"},
+			"PWD\r\n":                  {"PWD", ""},
+			"\xff\xf4\xff\xf2ABOR\r\n": {"ABOR", ""},
+			"RETR a\xff\xffb.txt\r\n":  {"RETR", "a\xffb.txt"},
+			"RETR a b.txt\r\n":         {"RETR", "a b.txt"},
+			"STOR a\r\x00.txt\r\n":     {"STOR", "a\r.txt"},
+			"CWD  two spaces\r\n":      {"CWD", " two spaces"},
+		} {
+			cmd, param, err := sess.parseLine(line)
+			assert.NoError(t, err, line)
+			assert.EqualValues(t, expected, [2]string{cmd, param}, line)
+		}
+	}
+
+	server.Parsing = ParseLenient
+	for line, expected := range map[string][2]string{
+		"PWD\n":                              {"PWD", ""},
+		" USER admin\r\n":                    {"USER", "admin"},
+		"CWD/pub\r\n":                        {"CWD", "/pub"},
+		"RETR\xff\xfb\x01 a\r\n":             {"RETR", "a"},
+		"RETR a\xff\xf1b\r\n":                {"RETR", "ab"},
+		"SIZE\xff\xfa\x18\x01\xff\xf0 a\r\n": {"SIZE", "a"},
+	} {
+		cmd, param, err := sess.parseLine(line)
+		assert.NoError(t, err, line)
+		assert.EqualValues(t, expected, [2]string{cmd, param}, line)
+	}
+
+	server.Parsing = ParseStrict
+	for line, reason := range map[string]string{
+		"PWD\n":               "line not ended by CRLF",
+		"PW\rD\r\n":           "CR inside the line",
+		" USER admin\r\n":     `invalid command ""`,
+		"CWD/pub\r\n":         `invalid command "CWD/pub"`,
+		"RETR a\xff\xf1b\r\n": "Telnet command inside the line",
+	} {
+		_, _, err := sess.parseLine(line)
+		assert.EqualError(t, err, reason, line)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// parsePortRange parses a passive port range, i.e. "30000-31000", the
+// ports are 0 if the range is empty
+func parsePortRange(ports string) (int, int, error) {
+	if ports == "" {
+		return 0, 0, nil
+	}
+	portRange := strings.Split(ports, "-")
+	if len(portRange) != 2 {
+		return 0, 0, fmt.Errorf("Invalid passive port range %q", ports)
+	}
+	minPort, err := strconv.Atoi(strings.TrimSpace(portRange[0]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("Invalid passive port range %q", ports)
+	}
+	maxPort, err := strconv.Atoi(strings.TrimSpace(portRange[1]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("Invalid passive port range %q", ports)
+	}
+	if minPort <= 0 || maxPort > 65535 || maxPort < minPort {
+		return 0, 0, fmt.Errorf("Invalid passive port range %q", ports)
+	}
+	return minPort, maxPort, nil
+}
+
+// validatePassiveOptions checks the port ranges and the public addresses
+// are well formed
+func validatePassiveOptions(opts *Options) error {
+	for _, ports := range []string{opts.PassivePorts, opts.PassivePortsIPv6} {
+		if _, _, err := parsePortRange(ports); err != nil {
+			return err
+		}
+	}
+	for _, host := range []string{opts.PublicIP, opts.PublicIPv6} {
+		if strings.ContainsAny(host, ":/ ") && net.ParseIP(host) == nil {
+			return fmt.Errorf("Invalid public address %q", host)
+		}
+	}
+	return nil
+}
+
+// nextPassivePort returns the port tried after port when it's in use, the
+// ports of the range are tried in turn
+func (sess *Session) nextPassivePort(port int) int {
+	minPort, maxPort, err := parsePortRange(sess.passivePorts())
+	if err != nil || minPort == 0 {
+		return 0
+	}
+	if port+1 >= maxPort {
+		return minPort
+	}
+	return port + 1
+}
+
+// passivePortCount returns the number of ports of the passive range, 0 if
+// the ports are chosen by the system
+func (sess *Session) passivePortCount() int {
+	minPort, maxPort, err := parsePortRange(sess.passivePorts())
+	if err != nil || minPort == 0 {
+		return 0
+	}
+	if maxPort == minPort {
+		return 1
+	}
+	return maxPort - minPort
+}
+
+// resolvePublicIP returns the address advertised for the public host, a
+// host name is resolved each time so that the dynamic addresses behind a
+// NAT are followed
+func (sess *Session) resolvePublicIP(host string) string {
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		sess.log(err)
+		return host
+	}
+	for _, ip := range ips {
+		if (ip.To4() == nil) == sess.isIPv6() {
+			return ip.String()
+		}
+	}
+	return host
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// UploadProcessor is a step of the processing of the uploads, it returns an
+// error to reject the upload. The event is the one the TransferNotifier
+// notifiers get, with the checksum if Options.TransferChecksum is set.
+type UploadProcessor func(ctx *Context, event *TransferEvent) error
+
+// PostProcessing represents the processing of the uploads before they are
+// acknowledged, i.e. verifying their checksum, scanning them for viruses or
+// moving them into place. STOR and APPE reply 226 only once the steps
+// succeeded, so the reply the client gets tells whether the upload has
+// been accepted. A rejected upload is reported to the notifiers as failed,
+// the steps should remove the rejected files.
+type PostProcessing struct {
+	// The steps run in order, the first error rejects the upload with 550
+	Steps []UploadProcessor
+
+	// The duration the steps could take, if 0 there is no limit. Once it's
+	// elapsed the context of the steps is cancelled and the upload fails
+	// with 451.
+	Timeout time.Duration
+}
+
+var errProcessingTimeout = errors.New("Processing of the upload timed out")
+
+// processUpload runs the steps of Options.PostProcessing on the upload, it
+// returns the code of the reply and the error if the upload is rejected
+func (sess *Session) processUpload(ctx *Context, event *TransferEvent) (int, error) {
+	processing := sess.server.PostProcessing
+	if processing == nil || len(processing.Steps) == 0 {
+		return 0, nil
+	}
+
+	// the steps may still run after the timeout
+	var stepCtx = *ctx
+	stepCtx.Data = make(map[string]interface{})
+	for k, v := range ctx.Data {
+		stepCtx.Data[k] = v
+	}
+	// the context of the transfer is cancelled once the data is received
+	stepCtx.ctx = nil
+	if processing.Timeout > 0 {
+		var cancel context.CancelFunc
+		stepCtx.ctx, cancel = context.WithTimeout(context.Background(), processing.Timeout)
+		defer cancel()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		for _, step := range processing.Steps {
+			if err := step(&stepCtx, event); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return 550, err
+		}
+		return 0, nil
+	case <-stepCtx.Context().Done():
+		return 451, errProcessingTimeout
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"hash/adler32"
+	"hash/crc32"
+	"io"
+	"sync"
+)
+
+// PrecompressedDriver is an optional interface a Driver could implement to
+// serve the gzip compressed variants of its files, i.e. file.gz next to the
+// file. In MODE Z, RETR sends the compressed data of the variant instead of
+// compressing the file again, which saves a lot of CPU on the static
+// archives. The variant is only decompressed to check it.
+type PrecompressedDriver interface {
+	// GetPrecompressedFile returns the gzip stream of the file,
+	// os.ErrNotExist if the file has no compressed variant or if it's
+	// older than the file
+	GetPrecompressedFile(ctx *Context, path string) (io.ReadCloser, error)
+}
+
+var errGzipFormat = errors.New("invalid gzip format of the precompressed file")
+
+const (
+	gzipFlagHCRC    = 1 << 1
+	gzipFlagExtra   = 1 << 2
+	gzipFlagName    = 1 << 3
+	gzipFlagComment = 1 << 4
+)
+
+// precompressedFile decompresses the gzip variant of a file while keeping
+// its deflate stream, which its dataWriter sends in place of the data
+// written so that the transfer is accounted as any other MODE Z transfer.
+// Multi-member gzip files are refused at their end.
+type precompressedFile struct {
+	src      *bufio.Reader
+	closer   io.Closer
+	inflater io.ReadCloser
+	crc      hash.Hash32
+	size     uint32
+
+	lock sync.Mutex
+	raw  bytes.Buffer // the deflate stream read but not sent yet
+}
+
+// recordingReader records the bytes read by the inflater, which reads
+// exactly the deflate stream from an io.ByteReader
+type recordingReader struct {
+	file *precompressedFile
+}
+
+func (r recordingReader) Read(p []byte) (int, error) {
+	n, err := r.file.src.Read(p)
+	r.file.lock.Lock()
+	r.file.raw.Write(p[:n])
+	r.file.lock.Unlock()
+	return n, err
+}
+
+func (r recordingReader) ReadByte() (byte, error) {
+	b, err := r.file.src.ReadByte()
+	if err == nil {
+		r.file.lock.Lock()
+		r.file.raw.WriteByte(b)
+		r.file.lock.Unlock()
+	}
+	return b, err
+}
+
+// newPrecompressedFile skips the gzip header of the data
+func newPrecompressedFile(data io.ReadCloser) (*precompressedFile, error) {
+	file := &precompressedFile{
+		src:    bufio.NewReader(data),
+		closer: data,
+		crc:    crc32.NewIEEE(),
+	}
+	if err := file.skipHeader(); err != nil {
+		return nil, err
+	}
+	file.inflater = flate.NewReader(recordingReader{file})
+	return file, nil
+}
+
+// skipHeader reads the gzip header, see RFC 1952
+func (file *precompressedFile) skipHeader() error {
+	var header [10]byte
+	if _, err := io.ReadFull(file.src, header[:]); err != nil {
+		return errGzipFormat
+	}
+	if header[0] != 0x1f || header[1] != 0x8b || header[2] != 8 {
+		return errGzipFormat
+	}
+	flags := header[3]
+	if flags&gzipFlagExtra != 0 {
+		var n [2]byte
+		if _, err := io.ReadFull(file.src, n[:]); err != nil {
+			return errGzipFormat
+		}
+		if _, err := file.src.Discard(int(binary.LittleEndian.Uint16(n[:]))); err != nil {
+			return errGzipFormat
+		}
+	}
+	for _, flag := range []byte{gzipFlagName, gzipFlagComment} {
+		if flags&flag != 0 {
+			if _, err := file.src.ReadBytes(0); err != nil {
+				return errGzipFormat
+			}
+		}
+	}
+	if flags&gzipFlagHCRC != 0 {
+		if _, err := file.src.Discard(2); err != nil {
+			return errGzipFormat
+		}
+	}
+	return nil
+}
+
+func (file *precompressedFile) Read(p []byte) (int, error) {
+	n, err := file.inflater.Read(p)
+	file.crc.Write(p[:n])
+	file.size += uint32(n)
+	if err == io.EOF {
+		if terr := file.checkTrailer(); terr != nil {
+			return n, terr
+		}
+	}
+	return n, err
+}
+
+// checkTrailer checks the checksum and the size of the trailer
+func (file *precompressedFile) checkTrailer() error {
+	var trailer [8]byte
+	if _, err := io.ReadFull(file.src, trailer[:]); err != nil {
+		return errGzipFormat
+	}
+	if binary.LittleEndian.Uint32(trailer[:4]) != file.crc.Sum32() ||
+		binary.LittleEndian.Uint32(trailer[4:]) != file.size {
+		return errGzipFormat
+	}
+	if _, err := file.src.Peek(1); err != io.EOF {
+		return errGzipFormat
+	}
+	return nil
+}
+
+func (file *precompressedFile) Close() error {
+	file.inflater.Close()
+	return file.closer.Close()
+}
+
+// flush sends the deflate stream read so far
+func (file *precompressedFile) flush(w io.Writer) error {
+	file.lock.Lock()
+	defer file.lock.Unlock()
+	_, err := file.raw.WriteTo(w)
+	return err
+}
+
+// dataWriter returns the writer of the zlib stream to the data connection
+func (file *precompressedFile) dataWriter(sess *Session) func() io.WriteCloser {
+	return func() io.WriteCloser {
+		return &precompressedWriter{w: sess.dataConn, file: file, adler: adler32.New()}
+	}
+}
+
+// precompressedWriter writes the zlib stream, see RFC 1950, wrapping the
+// deflate stream of the file. The data written is only checksummed.
+type precompressedWriter struct {
+	w      io.Writer
+	file   *precompressedFile
+	adler  hash.Hash32
+	header bool
+}
+
+func (w *precompressedWriter) Write(p []byte) (int, error) {
+	if !w.header {
+		// the default compression without dictionary
+		if _, err := w.w.Write([]byte{0x78, 0x9c}); err != nil {
+			return 0, err
+		}
+		w.header = true
+	}
+	w.adler.Write(p)
+	if err := w.file.flush(w.w); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *precompressedWriter) Close() error {
+	if _, err := w.Write(nil); err != nil {
+		return err
+	}
+	_, err := w.w.Write(w.adler.Sum(nil))
+	return err
+}
+
+// getFileToSend returns the file to send by RETR and the writer of its data,
+// the precompressed variant of the file if it could be sent in MODE Z
+func (sess *Session) getFileToSend(ctx *Context, p string, offset, length int64) (int64, io.ReadCloser, func() io.WriteCloser, error) {
+	driver, ok := sess.server.Driver.(PrecompressedDriver)
+	if ok && sess.modeZ && offset == 0 && length < 0 {
+		if info, err := sess.server.Driver.Stat(ctx, p); err == nil && !info.IsDir() {
+			if data, err := driver.GetPrecompressedFile(ctx, p); err == nil {
+				file, err := newPrecompressedFile(data)
+				if err == nil {
+					sess.debugf("sending the precompressed variant of %s", p)
+					return info.Size(), file, file.dataWriter(sess), nil
+				}
+				data.Close()
+				sess.warnf("%s: %v", p, err)
+			}
+		}
+	}
+	size, data, err := sess.getFile(ctx, p, offset, length)
+	return size, data, sess.dataWriter, err
+}
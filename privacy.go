@@ -0,0 +1,70 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"strings"
+)
+
+// Privacy replaces the user names and the client IPs by pseudonyms in the
+// logs, the audit records, the session recordings and the notifier payloads.
+// The pseudonyms are keyed HMACs, the records of a user or of an IP could be
+// correlated without revealing them.
+type Privacy struct {
+	// The HMAC key, it must be kept secret
+	Key []byte
+}
+
+// Pseudonym returns the pseudonym of a user name or an IP, i.e. to look up
+// the records of a given user
+func (privacy *Privacy) Pseudonym(v string) string {
+	if privacy == nil || v == "" {
+		return v
+	}
+	mac := hmac.New(sha256.New, privacy.Key)
+	_, _ = mac.Write([]byte(v))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// pseudoUser returns the user name as it could be logged
+func (sess *Session) pseudoUser(user string) string {
+	return sess.server.Privacy.Pseudonym(user)
+}
+
+// pseudoIP returns the IP of the client as it could be logged
+func (sess *Session) pseudoIP() string {
+	return sess.server.Privacy.Pseudonym(sess.remoteIP())
+}
+
+// pseudoAddr returns the address of the client as it could be logged, the
+// port is dropped if the IP is pseudonymized
+func (sess *Session) pseudoAddr() string {
+	return pseudoAddr(sess.server.Privacy, sess.RemoteAddr())
+}
+
+func pseudoAddr(privacy *Privacy, addr net.Addr) string {
+	if privacy == nil {
+		return addr.String()
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+	return privacy.Pseudonym(host)
+}
+
+// pseudoParam returns the redacted param of a command as it could be
+// logged, the user name of USER is pseudonymized
+func (sess *Session) pseudoParam(command, param string) string {
+	param = redactParam(command, param)
+	if sess.server.Privacy != nil && strings.EqualFold(command, "USER") {
+		return sess.pseudoUser(param)
+	}
+	return param
+}
@@ -0,0 +1,31 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrivacy(t *testing.T) {
+	var privacy *Privacy
+	assert.EqualValues(t, "admin", privacy.Pseudonym("admin"))
+	addr := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 1234}
+	assert.EqualValues(t, "192.0.2.1:1234", pseudoAddr(privacy, addr))
+
+	privacy = &Privacy{Key: []byte("secret")}
+	pseudonym := privacy.Pseudonym("admin")
+	assert.Len(t, pseudonym, 16)
+	assert.NotEqual(t, "admin", pseudonym)
+	assert.EqualValues(t, pseudonym, privacy.Pseudonym("admin"))
+	assert.NotEqual(t, pseudonym, privacy.Pseudonym("guest"))
+	assert.NotEqual(t, pseudonym, (&Privacy{Key: []byte("other")}).Pseudonym("admin"))
+	assert.EqualValues(t, "", privacy.Pseudonym(""))
+
+	// the port is dropped so that the pseudonym of an IP stays the same
+	assert.EqualValues(t, privacy.Pseudonym("192.0.2.1"), pseudoAddr(privacy, addr))
+}
@@ -0,0 +1,63 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"path"
+	"strings"
+)
+
+// validateProtectedPaths checks the patterns are well formed
+func validateProtectedPaths(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isProtected reports whether the absolute path could not be deleted or
+// renamed, because it or one of its children matches a protected pattern
+func isProtected(patterns []string, p string) bool {
+	p = path.Join("/", p)
+	for _, pattern := range patterns {
+		if matchPattern(pattern, p) || isPatternAncestor(pattern, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPatternAncestor reports whether the directory is a parent of the paths
+// the pattern containing a slash matches
+func isPatternAncestor(pattern, dir string) bool {
+	if !strings.Contains(pattern, "/") {
+		return false
+	}
+	patternParts := strings.Split(strings.TrimPrefix(path.Join("/", pattern), "/"), "/")
+	var dirParts []string
+	if dir != "/" {
+		dirParts = strings.Split(strings.TrimPrefix(dir, "/"), "/")
+	}
+	if len(dirParts) >= len(patternParts) {
+		return false
+	}
+	for i, part := range dirParts {
+		if matched, _ := path.Match(patternParts[i], part); !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// checkProtected replies an error and returns false if the path is protected
+func (sess *Session) checkProtected(p string) bool {
+	if isProtected(sess.server.ProtectedPaths, p) {
+		sess.writeMessage(550, "Action not taken: "+p+" is protected")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,37 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsProtected(t *testing.T) {
+	var patterns = []string{"/", "/incoming", "/etc/*", "*.keep"}
+
+	assert.NoError(t, validateProtectedPaths(patterns))
+	assert.Error(t, validateProtectedPaths([]string{"/["}))
+
+	var cases = []struct {
+		Path      string
+		Protected bool
+	}{
+		{"/", true},
+		{"/incoming", true},
+		{"/incoming/a.txt", false},
+		{"/etc", true},
+		{"/etc/passwd", true},
+		{"/etc/ssh/config", false},
+		{"/data/a.keep", true},
+		{"/data/a.txt", false},
+		{"/data", false},
+	}
+	for _, c := range cases {
+		assert.EqualValues(t, c.Protected, isProtected(patterns, c.Path), c.Path)
+	}
+	assert.False(t, isProtected(nil, "/"))
+}
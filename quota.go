@@ -0,0 +1,22 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+// Quota represents the quota and the usage of an user, a zero limit means
+// unlimited
+type Quota struct {
+	BytesUsed  int64
+	BytesLimit int64
+	FilesUsed  int64
+	FilesLimit int64
+}
+
+// QuotaReporter is an optional interface a Driver could implement to report
+// the quota of the login user, i.e. via SITE QUOTA.
+type QuotaReporter interface {
+	// params  - the context of the request
+	// returns - the quota of the login user or any error encountered
+	Quota(*Context) (*Quota, error)
+}
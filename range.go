@@ -0,0 +1,98 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// RangeGetter is an optional interface a Driver could implement to read a
+// range of a file, i.e. object stores could request exactly the bytes
+// needed instead of reading the object up to its end. It's used by RETR
+// after a RANG command.
+type RangeGetter interface {
+	// params  - path, offset, length or -1 to read up to the end
+	// returns - the number of bytes and the data to send to the client
+	GetFileRange(*Context, string, int64, int64) (int64, io.ReadCloser, error)
+}
+
+// readCloser reads from a Reader and closes a Closer
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// getFile returns the data of the file from offset, length bytes at most if
+// it's not -1
+func (sess *Session) getFile(ctx *Context, p string, offset, length int64) (int64, io.ReadCloser, error) {
+	if length < 0 {
+		return sess.server.Driver.GetFile(ctx, p, offset)
+	}
+	if driver, mapPath := optionalDriver(sess.server.Driver, func(driver Driver) bool {
+		_, ok := driver.(RangeGetter)
+		return ok
+	}); driver != nil {
+		return driver.(RangeGetter).GetFileRange(ctx, mapPath(p), offset, length)
+	}
+
+	size, data, err := sess.server.Driver.GetFile(ctx, p, offset)
+	if err != nil {
+		return size, data, err
+	}
+	if size > length {
+		size = length
+	}
+	return size, &readCloser{Reader: io.LimitReader(data, length), Closer: data}, nil
+}
+
+// commandRang responds to the RANG FTP command. It allows the client to
+// restrict the next RETR to a byte range, the end byte is included.
+// "RANG 1 0" resets the range.
+type commandRang struct{}
+
+func (cmd commandRang) IsExtend() bool {
+	return false
+}
+
+func (cmd commandRang) RequireParam() bool {
+	return true
+}
+
+func (cmd commandRang) RequireAuth() bool {
+	return true
+}
+
+func (cmd commandRang) Execute(sess *Session, param string) {
+	sess.lastFilePos, sess.rangeEnd = -1, -1
+	fields := strings.Fields(param)
+	if len(fields) != 2 {
+		sess.writeMessage(501, "Syntax error in parameters or arguments")
+		return
+	}
+	start, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil || start < 0 {
+		sess.writeMessage(501, "Syntax error in parameters or arguments")
+		return
+	}
+	end, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || end < 0 {
+		sess.writeMessage(501, "Syntax error in parameters or arguments")
+		return
+	}
+	if start == 1 && end == 0 {
+		sess.writeMessage(350, "Restarting at 0. End byte range at EOF")
+		return
+	}
+	if end < start {
+		sess.writeMessage(501, "Syntax error in parameters or arguments")
+		return
+	}
+
+	sess.lastFilePos, sess.rangeEnd = start, end
+	sess.writeMessage(350, fmt.Sprintf("Restarting at %d. End byte range at %d", start, end))
+}
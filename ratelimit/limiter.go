@@ -5,14 +5,53 @@
 package ratelimit
 
 import (
+	"sync"
 	"time"
 )
 
+// Policy returns the rate in bytes per second at a given time, 0 means don't
+// limit
+type Policy interface {
+	Rate(time.Time) int64
+}
+
+// policyInterval is how often the limiter consults its policy, a share is
+// active if it transferred data during the last interval
+const policyInterval = time.Second
+
 // Limiter represents a rate limiter
 type Limiter struct {
-	rate  time.Duration
-	count int64
-	t     time.Time
+	lock    sync.Mutex
+	rate    time.Duration
+	count   int64
+	t       time.Time
+	policy  Policy
+	checked time.Time
+
+	// the limiter a share is part of and its weight
+	parent *Limiter
+	weight int
+	// the last activity of the shares of the limiter
+	shares map[*Limiter]time.Time
+
+	// the bytes transferred and the time waited, including the ones of the
+	// shares
+	bytes     int64
+	throttled time.Duration
+
+	// the transfers are paused until then, i.e. while the storage is
+	// throttling the requests
+	paused   time.Time
+	backoffs int64
+}
+
+// Stats is the state of a limiter
+type Stats struct {
+	Rate      int64         // the current rate in bytes per second, 0 means no limit
+	Tokens    int64         // the bytes which could be transferred without waiting
+	Bytes     int64         // the bytes transferred through the limiter
+	Throttled time.Duration // how long the transfers waited for the limiter
+	Backoffs  int64         // the number of calls to Backoff
 }
 
 // New create a limiter for transfer speed, parameter rate means bytes per second
@@ -25,14 +64,157 @@ func New(rate int64) *Limiter {
 	}
 }
 
+// NewWithPolicy creates a limiter whose rate is returned by the policy, it's
+// consulted every second so the rate changes during long transfers too
+func NewWithPolicy(policy Policy) *Limiter {
+	now := time.Now()
+	return &Limiter{
+		rate:    time.Duration(policy.Rate(now)),
+		t:       now,
+		policy:  policy,
+		checked: now,
+	}
+}
+
+// Share returns a limiter sharing the rate of l with the other shares which
+// are active, in proportion to their weights. A share with a weight of 2
+// gets twice the bandwidth of a share with a weight of 1.
+func (l *Limiter) Share(weight int) *Limiter {
+	if weight <= 0 {
+		weight = 1
+	}
+	return &Limiter{
+		t:      time.Now(),
+		parent: l,
+		weight: weight,
+	}
+}
+
+// updateRate consults the policy, l.lock should be held
+func (l *Limiter) updateRate(now time.Time) {
+	if l.policy == nil || now.Sub(l.checked) < policyInterval {
+		return
+	}
+	l.checked = now
+	l.setRate(time.Duration(l.policy.Rate(now)), now)
+}
+
+// setRate changes the rate, l.lock should be held
+func (l *Limiter) setRate(rate time.Duration, now time.Time) {
+	if rate != l.rate {
+		l.rate = rate
+		l.count = 0
+		l.t = now
+	}
+}
+
+// shareRate records the activity of the share and returns its rate
+func (l *Limiter) shareRate(share *Limiter, now time.Time) time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.updateRate(now)
+	if l.shares == nil {
+		l.shares = make(map[*Limiter]time.Time)
+	}
+	l.shares[share] = now
+
+	var total int
+	for s, last := range l.shares {
+		if now.Sub(last) > policyInterval {
+			delete(l.shares, s)
+			continue
+		}
+		total += s.weight
+	}
+	return l.rate * time.Duration(share.weight) / time.Duration(total)
+}
+
+// Stats returns the state of the limiter, it's safe to be called while the
+// limiter is used
+func (l *Limiter) Stats() Stats {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	var stats = Stats{
+		Rate:      int64(l.rate),
+		Bytes:     l.bytes,
+		Throttled: l.throttled,
+		Backoffs:  l.backoffs,
+	}
+	if l.rate > 0 {
+		if tokens := int64(time.Since(l.t)*l.rate/time.Second) - l.count; tokens > 0 {
+			stats.Tokens = tokens
+		}
+	}
+	return stats
+}
+
+// Backoff pauses the transfers through the limiter and its shares for d,
+// i.e. when the storage asks to slow down. The transfers resume at the
+// latest end of the pauses.
+func (l *Limiter) Backoff(d time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.backoffs++
+	if until := time.Now().Add(d); until.After(l.paused) {
+		l.paused = until
+	}
+}
+
+// pause returns how long the transfers are still paused
+func (l *Limiter) pause(now time.Time) time.Duration {
+	l.lock.Lock()
+	d := l.paused.Sub(now)
+	l.lock.Unlock()
+	if l.parent != nil {
+		if pd := l.parent.pause(now); pd > d {
+			d = pd
+		}
+	}
+	return d
+}
+
+// account records a transfer of count bytes which waited for d
+func (l *Limiter) account(count int, d time.Duration) {
+	l.lock.Lock()
+	l.bytes += int64(count)
+	l.throttled += d
+	l.lock.Unlock()
+	if l.parent != nil {
+		l.parent.account(count, d)
+	}
+}
+
 // Wait sleep when write count bytes
 func (l *Limiter) Wait(count int) {
+	now := time.Now()
+	if pause := l.pause(now); pause > 0 {
+		l.account(0, pause)
+		time.Sleep(pause)
+		now = time.Now()
+	}
+	var rate time.Duration
+	if l.parent != nil {
+		rate = l.parent.shareRate(l, now)
+	}
+
+	l.lock.Lock()
+	if l.parent != nil {
+		l.setRate(rate, now)
+	} else {
+		l.updateRate(now)
+	}
 	if l.rate == 0 {
+		l.lock.Unlock()
+		l.account(count, 0)
 		return
 	}
 	l.count += int64(count)
 	t := time.Duration(l.count)*time.Second/l.rate - time.Since(l.t)
+	l.lock.Unlock()
 	if t > 0 {
+		l.account(count, t)
 		time.Sleep(t)
+	} else {
+		l.account(count, 0)
 	}
 }
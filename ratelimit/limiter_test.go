@@ -0,0 +1,88 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type switchPolicy struct {
+	rate int64
+}
+
+func (p *switchPolicy) Rate(time.Time) int64 {
+	return p.rate
+}
+
+func TestLimiterPolicy(t *testing.T) {
+	policy := &switchPolicy{rate: 0}
+	l := NewWithPolicy(policy)
+	start := time.Now()
+	l.Wait(1 << 20)
+	assert.True(t, time.Since(start) < 100*time.Millisecond)
+
+	policy.rate = 1000
+	l.checked = time.Now().Add(-policyInterval)
+	start = time.Now()
+	l.Wait(100)
+	assert.True(t, time.Since(start) >= 90*time.Millisecond)
+}
+
+func TestLimiterShare(t *testing.T) {
+	l := New(1000)
+	gold := l.Share(3)
+	bronze := l.Share(1)
+
+	now := time.Now()
+	assert.EqualValues(t, 1000, gold.parent.shareRate(gold, now))
+	assert.EqualValues(t, 250, l.shareRate(bronze, now))
+	assert.EqualValues(t, 750, l.shareRate(gold, now))
+
+	// the inactive shares don't count
+	assert.EqualValues(t, 1000, l.shareRate(gold, now.Add(2*policyInterval)))
+
+	unlimited := New(0).Share(1)
+	start := time.Now()
+	unlimited.Wait(1 << 20)
+	assert.True(t, time.Since(start) < 100*time.Millisecond)
+}
+
+func TestLimiterStats(t *testing.T) {
+	l := New(1000)
+	share := l.Share(1)
+	share.Wait(100)
+
+	stats := share.Stats()
+	assert.EqualValues(t, 1000, stats.Rate)
+	assert.EqualValues(t, 100, stats.Bytes)
+	assert.True(t, stats.Throttled >= 90*time.Millisecond)
+	assert.True(t, stats.Tokens < 100)
+
+	// the transfers of the shares are accounted to the parent
+	assert.EqualValues(t, 100, l.Stats().Bytes)
+	assert.EqualValues(t, stats.Throttled, l.Stats().Throttled)
+
+	assert.EqualValues(t, Stats{}, New(0).Stats())
+}
+
+func TestLimiterBackoff(t *testing.T) {
+	l := New(0)
+	share := l.Share(1)
+	l.Backoff(100 * time.Millisecond)
+
+	start := time.Now()
+	share.Wait(100)
+	assert.True(t, time.Since(start) >= 90*time.Millisecond)
+	assert.EqualValues(t, 1, l.Stats().Backoffs)
+	assert.True(t, l.Stats().Throttled >= 90*time.Millisecond)
+
+	// the pause is over
+	start = time.Now()
+	share.Wait(100)
+	assert.True(t, time.Since(start) < 50*time.Millisecond)
+}
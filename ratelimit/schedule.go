@@ -0,0 +1,77 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package ratelimit
+
+import "time"
+
+var _ Policy = &Schedule{}
+
+// Schedule is a Policy whose rate depends on the time of the day, i.e. 1MB/s
+// during business hours and unlimited overnight
+type Schedule struct {
+	// The first rule matching the time gives the rate
+	Rules []ScheduleRule
+
+	// The rate out of the rules
+	Default int64
+
+	// The location of the times of the rules, if nil it's time.Local
+	Location *time.Location
+}
+
+// ScheduleRule represents a rate applying to a period of the day
+type ScheduleRule struct {
+	// The days the rule applies to, if empty every day
+	Weekdays []time.Weekday
+
+	// The period of the day as the durations since midnight, the end is
+	// excluded. The period goes past midnight if End is before Start.
+	Start time.Duration
+	End   time.Duration
+
+	// The rate in bytes per second, 0 means don't limit
+	Rate int64
+}
+
+func (rule *ScheduleRule) matches(t time.Time) bool {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight)
+	day := t.Weekday()
+	if rule.End < rule.Start && offset < rule.End {
+		// in the period started the day before
+		day = (day + 6) % 7
+	}
+	if len(rule.Weekdays) > 0 {
+		var found bool
+		for _, weekday := range rule.Weekdays {
+			if weekday == day {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if rule.End < rule.Start {
+		return offset >= rule.Start || offset < rule.End
+	}
+	return offset >= rule.Start && offset < rule.End
+}
+
+// Rate implements Policy
+func (schedule *Schedule) Rate(t time.Time) int64 {
+	if schedule.Location != nil {
+		t = t.In(schedule.Location)
+	} else {
+		t = t.Local()
+	}
+	for i := range schedule.Rules {
+		if schedule.Rules[i].matches(t) {
+			return schedule.Rules[i].Rate
+		}
+	}
+	return schedule.Default
+}
@@ -0,0 +1,43 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedule(t *testing.T) {
+	var weekdays = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+	schedule := &Schedule{
+		Rules: []ScheduleRule{
+			{Weekdays: weekdays, Start: 9 * time.Hour, End: 18 * time.Hour, Rate: 1000},
+			{Weekdays: []time.Weekday{time.Friday}, Start: 22 * time.Hour, End: 2 * time.Hour, Rate: 500},
+		},
+		Default:  0,
+		Location: time.UTC,
+	}
+
+	var cases = []struct {
+		Time string
+		Rate int64
+	}{
+		{"2020-06-01T10:00:00Z", 1000}, // Monday
+		{"2020-06-01T18:00:00Z", 0},
+		{"2020-06-01T08:59:59Z", 0},
+		{"2020-06-06T10:00:00Z", 0},   // Saturday
+		{"2020-06-05T23:00:00Z", 500}, // Friday night
+		{"2020-06-06T01:00:00Z", 500},
+		{"2020-06-06T02:00:00Z", 0},
+		{"2020-06-04T23:00:00Z", 0}, // Thursday night
+	}
+	for _, c := range cases {
+		tm, err := time.Parse(time.RFC3339, c.Time)
+		assert.NoError(t, err)
+		assert.EqualValues(t, c.Rate, schedule.Rate(tm), c.Time)
+	}
+}
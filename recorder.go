@@ -0,0 +1,147 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// The types of the records of a session recording
+const (
+	RecordSession  = "session"  // the start of the session
+	RecordCommand  = "command"  // a command received from the client
+	RecordReply    = "reply"    // a reply sent to the client
+	RecordTransfer = "transfer" // a finished upload or download
+)
+
+// Record is an entry of a session recording, the recordings written to
+// Options.RecordDir hold one JSON encoded record per line. The credentials
+// are redacted the way they are in the logs.
+type Record struct {
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+
+	// the session, for RecordSession
+	SessionID  string `json:"session_id,omitempty"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+
+	// the command, for RecordCommand and RecordTransfer
+	Command string `json:"command,omitempty"`
+	Param   string `json:"param,omitempty"`
+
+	// the reply, for RecordReply. Only the first line of the multiline
+	// replies is recorded.
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+
+	// the transfer, for RecordTransfer
+	Path    string `json:"path,omitempty"`
+	Size    int64  `json:"size,omitempty"`
+	Offset  int64  `json:"offset,omitempty"`
+	Aborted bool   `json:"aborted,omitempty"`
+}
+
+// ReadRecording returns the records of a session recording
+func ReadRecording(r io.Reader) ([]Record, error) {
+	var (
+		records []Record
+		decoder = json.NewDecoder(r)
+	)
+	for {
+		var record Record
+		if err := decoder.Decode(&record); err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return records, err
+		}
+		records = append(records, record)
+	}
+}
+
+// recorder writes the recording of a session
+type recorder struct {
+	lock sync.Mutex
+	file *os.File
+	w    *bufio.Writer
+	enc  *json.Encoder
+}
+
+// startRecording starts to record the session if Options.RecordDir is set
+func (sess *Session) startRecording() {
+	if sess.server.RecordDir == "" {
+		return
+	}
+	name := time.Now().UTC().Format("20060102T150405") + "-" + sess.id + ".jsonl"
+	f, err := os.OpenFile(filepath.Join(sess.server.RecordDir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		sess.warnf("recording failed: %v", err)
+		return
+	}
+	w := bufio.NewWriter(f)
+	sess.recorder = &recorder{
+		file: f,
+		w:    w,
+		enc:  json.NewEncoder(w),
+	}
+	sess.recorder.record(Record{
+		Type:       RecordSession,
+		SessionID:  sess.id,
+		RemoteAddr: sess.pseudoAddr(),
+	})
+}
+
+// record appends the record to the recording, it's a no-op if the session
+// isn't recorded
+func (r *recorder) record(record Record) {
+	if r == nil {
+		return
+	}
+	record.Time = time.Now()
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.file == nil {
+		return
+	}
+	_ = r.enc.Encode(record)
+}
+
+func (r *recorder) command(command, param string) {
+	r.record(Record{Type: RecordCommand, Command: command, Param: param})
+}
+
+func (r *recorder) reply(code int, message string) {
+	r.record(Record{Type: RecordReply, Code: code, Message: message})
+}
+
+func (r *recorder) transfer(ctx *Context, event *TransferEvent) {
+	r.record(Record{
+		Type:    RecordTransfer,
+		Command: ctx.Cmd,
+		Path:    event.Path,
+		Size:    event.Size,
+		Offset:  event.Offset,
+		Aborted: event.Aborted,
+	})
+}
+
+func (r *recorder) close() error {
+	if r == nil {
+		return nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	err := r.w.Flush()
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	r.file = nil
+	return err
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"strings"
+)
+
+const redacted = "****"
+
+var (
+	// commands whose whole param is a secret
+	secretCommands = map[string]bool{
+		"PASS": true,
+		"ACCT": true,
+		"ADAT": true,
+	}
+
+	// SITE sub commands whose whole param is a secret
+	secretSiteCommands = map[string]bool{
+		"PASSWD":   true,
+		"PASSWORD": true,
+		"TOKEN":    true,
+	}
+
+	// the keys of key=value pairs whose value is a secret
+	secretKeys = map[string]bool{
+		"PASS":          true,
+		"PASSWD":        true,
+		"PASSWORD":      true,
+		"TOKEN":         true,
+		"SECRET":        true,
+		"APIKEY":        true,
+		"API_KEY":       true,
+		"AUTH":          true,
+		"AUTHORIZATION": true,
+	}
+)
+
+// redactParam returns the param of a command as it could be logged or
+// recorded, the credentials it may contain are masked.
+func redactParam(command, param string) string {
+	command = strings.ToUpper(command)
+	if param == "" {
+		return param
+	}
+	if secretCommands[command] {
+		return redacted
+	}
+	if command != "SITE" {
+		return param
+	}
+
+	fields := strings.Fields(param)
+	if secretSiteCommands[strings.ToUpper(fields[0])] {
+		return fields[0] + " " + redacted
+	}
+	for i := 1; i < len(fields); i++ {
+		field := fields[i]
+		if idx := strings.IndexAny(field, "=:"); idx > 0 {
+			if !secretKeys[strings.ToUpper(field[:idx])] {
+				continue
+			}
+			if idx < len(field)-1 {
+				// key=value, key:value
+				fields[i] = field[:idx+1] + redacted
+				continue
+			}
+			// Authorization: Bearer xxx, mask everything up to the end
+			for j := i + 1; j < len(fields); j++ {
+				fields[j] = redacted
+			}
+			break
+		} else if secretKeys[strings.ToUpper(field)] && i+1 < len(fields) {
+			// key value
+			fields[i+1] = redacted
+			i++
+		}
+	}
+	return strings.Join(fields, " ")
+}
@@ -0,0 +1,153 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"path"
+	"sync/atomic"
+	"time"
+)
+
+// how often a directory move by copy is logged
+const renameProgressInterval = time.Second
+
+// ErrRenameNotSupported is returned by Driver.Rename when the driver could
+// not move the path natively, i.e. a directory of an object store whose
+// Rename moves one object. RNTO moves such a directory by copying its files
+// and then deleting the sources.
+var ErrRenameNotSupported = errors.New("Rename not supported")
+
+var (
+	errRenameIntoItself = errors.New("A directory could not be moved into itself")
+	errRenameDstExists  = errors.New("The destination already exists")
+)
+
+// DirRenamer is an optional interface a Driver could implement to move the
+// directories with another call than Rename. The directories of the other
+// drivers are moved with Rename, or by copying their files when it returns
+// ErrRenameNotSupported.
+type DirRenamer interface {
+	// params  - from_path, to_path
+	// returns - nil if the directory was moved or any error encountered
+	RenameDir(*Context, string, string) error
+}
+
+// renameDir moves the directory with the native rename of the driver, or by
+// copying its tree when the driver doesn't support it. A copy which fails is rolled back so that the source is
+// left untouched, the sources are deleted only once the whole tree is
+// copied.
+func (sess *Session) renameDir(ctx *Context, fromPath, toPath string) error {
+	if isUnderPath(toPath, fromPath) {
+		return errRenameIntoItself
+	}
+	if renamer, ok := sess.server.Driver.(DirRenamer); ok {
+		return renamer.RenameDir(ctx, fromPath, toPath)
+	}
+	if _, err := sess.server.Driver.Stat(ctx, toPath); err == nil {
+		return errRenameDstExists
+	}
+	if err := sess.server.Driver.Rename(ctx, fromPath, toPath); err != ErrRenameNotSupported {
+		return err
+	}
+
+	files, dirs, err := sess.walkTree(ctx, fromPath)
+	if err != nil {
+		return err
+	}
+	target := func(p string) string {
+		return path.Join(toPath, p[len(fromPath):])
+	}
+
+	var (
+		created []string
+		copied  int64
+		done    = make(chan struct{})
+	)
+	go func() {
+		ticker := time.NewTicker(renameProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				sess.logf("Moving %s to %s: copied %d of %d files", fromPath, toPath, atomic.LoadInt64(&copied), len(files))
+			}
+		}
+	}()
+	err = func() error {
+		for _, dir := range dirs {
+			if err := sess.server.Driver.MakeDir(ctx, target(dir)); err != nil {
+				return err
+			}
+			created = append(created, target(dir))
+		}
+		for _, file := range files {
+			if err := sess.copyFile(ctx, file, target(file)); err != nil {
+				return err
+			}
+			created = append(created, target(file))
+			atomic.AddInt64(&copied, 1)
+		}
+		return nil
+	}()
+	close(done)
+	if err != nil {
+		sess.rollbackRename(ctx, created, len(dirs))
+		return err
+	}
+
+	for _, file := range files {
+		if err := sess.server.Driver.DeleteFile(ctx, file); err != nil {
+			return err
+		}
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := sess.server.Driver.DeleteDir(ctx, dirs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyFile copies the content of the file to the new path
+func (sess *Session) copyFile(ctx *Context, fromPath, toPath string) error {
+	_, data, err := sess.server.Driver.GetFile(ctx, fromPath, 0)
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+	_, err = sess.server.Driver.PutFile(ctx, toPath, data, -1)
+	return err
+}
+
+// rollbackRename deletes what a failed directory move created, the entries
+// are the directories, parents first, and then the files
+func (sess *Session) rollbackRename(ctx *Context, created []string, dirs int) {
+	for i := len(created) - 1; i >= 0; i-- {
+		var err error
+		if i < dirs {
+			err = sess.server.Driver.DeleteDir(ctx, created[i])
+		} else {
+			err = sess.server.Driver.DeleteFile(ctx, created[i])
+		}
+		if err != nil {
+			sess.warnf("Rollback of the move to %s: %v", created[i], err)
+		}
+	}
+}
+
+// rename renames the file or moves the directory
+func (sess *Session) rename(ctx *Context, fromPath, toPath string) error {
+	info, err := sess.server.Driver.Stat(ctx, fromPath)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return sess.renameDir(ctx, fromPath, toPath)
+	}
+	return sess.server.Driver.Rename(ctx, fromPath, toPath)
+}
@@ -0,0 +1,231 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package replay re-drives a session recorded with Options.RecordDir against
+// a server, to reproduce the bugs of a given client.
+package replay
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"goftp.io/server/v2"
+)
+
+// Options of a replay
+type Options struct {
+	// The password sent instead of the redacted ones
+	Password string
+
+	// How long to wait for a reply, defaults to 10 seconds
+	Timeout time.Duration
+}
+
+// Mismatch is a reply whose code differs from the recorded one
+type Mismatch struct {
+	Command  string // the command line, empty for the welcome message
+	Want     int    // the recorded code
+	Got      int    // the code replied
+	Message  string // the message replied
+	Recorded string // the recorded message
+}
+
+func (m Mismatch) String() string {
+	return fmt.Sprintf("%q: got %d %s, recorded %d %s", m.Command, m.Got, m.Message, m.Want, m.Recorded)
+}
+
+// the commands opening a data connection
+var transferCommands = map[string]bool{
+	"APPE": true,
+	"LIST": true,
+	"MLSD": true,
+	"NLST": true,
+	"RETR": true,
+	"STOR": true,
+	"STOU": true,
+}
+
+// the commands sending data to the server
+var uploadCommands = map[string]bool{
+	"APPE": true,
+	"STOR": true,
+	"STOU": true,
+}
+
+var (
+	pasvReply = regexp.MustCompile(`(\d+),(\d+),(\d+),(\d+),(\d+),(\d+)`)
+	epsvReply = regexp.MustCompile(`\(\|\|\|(\d+)\|\)`)
+)
+
+// step is a command of the recording with the replies it got
+type step struct {
+	line    string
+	command string
+	replies []server.Record
+	size    int64 // the bytes transferred, for the transfer commands
+}
+
+func steps(records []server.Record) (welcome []server.Record, steps []*step) {
+	var current *step
+	for _, record := range records {
+		switch record.Type {
+		case server.RecordCommand:
+			current = &step{
+				line:    strings.TrimSpace(record.Command + " " + record.Param),
+				command: strings.ToUpper(record.Command),
+			}
+			steps = append(steps, current)
+		case server.RecordReply:
+			if current == nil {
+				welcome = append(welcome, record)
+			} else {
+				current.replies = append(current.replies, record)
+			}
+		case server.RecordTransfer:
+			if current != nil {
+				current.size = record.Size
+			}
+		}
+	}
+	return welcome, steps
+}
+
+// Replay sends the commands of the recording over the control connection
+// conn and compares the codes of the replies with the recorded ones. The
+// uploads send as many bytes as recorded, the downloads are discarded.
+func Replay(conn net.Conn, records []server.Record, opts *Options) ([]Mismatch, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	var timeout = opts.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	var (
+		host, _, _ = net.SplitHostPort(conn.RemoteAddr().String())
+		control    = textproto.NewConn(conn)
+		mismatches []Mismatch
+		dataAddr   string
+	)
+	defer control.Close()
+
+	compare := func(line string, want server.Record) (int, string, error) {
+		_ = conn.SetReadDeadline(time.Now().Add(timeout))
+		code, msg, err := control.ReadResponse(0)
+		if err != nil {
+			return 0, "", err
+		}
+		if code != want.Code {
+			mismatches = append(mismatches, Mismatch{
+				Command:  line,
+				Want:     want.Code,
+				Got:      code,
+				Message:  msg,
+				Recorded: want.Message,
+			})
+		}
+		return code, msg, nil
+	}
+
+	welcome, steps := steps(records)
+	for _, want := range welcome {
+		if _, _, err := compare("", want); err != nil {
+			return mismatches, err
+		}
+	}
+
+	for _, step := range steps {
+		line := step.line
+		if step.command == "PASS" && opts.Password != "" {
+			line = "PASS " + opts.Password
+		}
+		if err := control.PrintfLine("%s", line); err != nil {
+			return mismatches, err
+		}
+
+		var (
+			data     net.Conn
+			transfer = make(chan error, 1)
+		)
+		if transferCommands[step.command] && dataAddr != "" {
+			var err error
+			data, err = net.DialTimeout("tcp", dataAddr, timeout)
+			if err != nil {
+				return mismatches, err
+			}
+			_ = data.SetDeadline(time.Now().Add(timeout))
+			go func(size int64, upload bool) {
+				var err error
+				if upload {
+					_, err = io.Copy(data, io.LimitReader(zeros{}, size))
+					data.Close()
+				} else {
+					_, err = io.Copy(ioutil.Discard, data)
+				}
+				transfer <- err
+			}(step.size, uploadCommands[step.command])
+			dataAddr = ""
+		}
+
+		for i, want := range step.replies {
+			if data != nil && i > 0 && i == len(step.replies)-1 {
+				// the final reply of a transfer comes after the data
+				if err := <-transfer; err != nil {
+					data.Close()
+					return mismatches, err
+				}
+			}
+			code, msg, err := compare(step.line, want)
+			if err != nil {
+				return mismatches, err
+			}
+			switch code {
+			case 227:
+				dataAddr = parsePasv(msg)
+			case 229:
+				dataAddr = parseEpsv(host, msg)
+			}
+		}
+		if data != nil {
+			data.Close()
+		}
+	}
+	return mismatches, nil
+}
+
+func parsePasv(msg string) string {
+	m := pasvReply.FindStringSubmatch(msg)
+	if m == nil {
+		return ""
+	}
+	hi, _ := strconv.Atoi(m[5])
+	lo, _ := strconv.Atoi(m[6])
+	return net.JoinHostPort(strings.Join(m[1:5], "."), strconv.Itoa(hi*256+lo))
+}
+
+func parseEpsv(host, msg string) string {
+	m := epsvReply.FindStringSubmatch(msg)
+	if m == nil {
+		return ""
+	}
+	return net.JoinHostPort(host, m[1])
+}
+
+// zeros is the data sent by the replayed uploads
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
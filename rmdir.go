@@ -0,0 +1,225 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// the files deleted at once by SITE RMDIR RECURSIVE
+	rmdirWorkers = 8
+	// how often SITE RMDIR RECURSIVE reports its progress
+	rmdirProgressInterval = time.Second
+)
+
+// siteRmdir responds to the SITE RMDIR RECURSIVE command. It deletes a
+// directory and all its content on the server side, so that the clients
+// don't need a round trip per entry:
+//
+//	SITE RMDIR RECURSIVE dir
+//
+// The files are deleted concurrently, the progress is reported by 150
+// replies until the final reply. The Notifier gets the events of every file
+// and directory deleted. If Options.Trash is set the directory is moved to
+// the trash as RMD does.
+type siteRmdir struct{}
+
+func (cmd siteRmdir) RequireParam() bool {
+	return true
+}
+
+func (cmd siteRmdir) Execute(sess *Session, param string) {
+	parts := strings.SplitN(strings.TrimSpace(param), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "RECURSIVE") || strings.TrimSpace(parts[1]) == "" {
+		sess.writeMessage(501, "Usage: SITE RMDIR RECURSIVE <dir>")
+		return
+	}
+	p := sess.buildPath(strings.TrimSpace(parts[1]))
+	if p == "/" {
+		sess.writeMessage(550, "Directory / cannot be deleted")
+		return
+	}
+	if !sess.checkProtected(p) {
+		return
+	}
+	if !sess.checkWriteOnly(p) || !sess.checkTrash(p) {
+		return
+	}
+
+	var ctx = Context{
+		Sess:  sess,
+		Cmd:   "SITE RMDIR",
+		Param: param,
+		Data:  make(map[string]interface{}),
+	}
+	info, err := sess.server.Driver.Stat(&ctx, p)
+	if err == nil && !info.IsDir() {
+		err = fmt.Errorf("%s is not a directory", p)
+	}
+	if err != nil {
+		sess.writeMessage(550, fmt.Sprint("Directory delete failed: ", err))
+		return
+	}
+
+	var deleted int64
+	if sess.server.Trash != nil {
+		sess.server.notifiers.BeforeDeleteDir(&ctx, p)
+		err = sess.deleteDir(&ctx, p)
+		sess.server.notifiers.AfterDirDeleted(&ctx, p, err)
+	} else {
+		var files, dirs []string
+		var unlock func()
+		files, dirs, err = sess.walkTree(&ctx, p)
+		if err == nil {
+			unlock, err = sess.lockTree("SITE RMDIR", files, dirs)
+		}
+		if err == nil {
+			sess.writeMessage(150, fmt.Sprintf("Deleting %d files and %d directories", len(files), len(dirs)))
+			deleted, err = sess.deleteTree(&ctx, files, dirs)
+			unlock()
+		}
+	}
+	if sess.curDir == p || strings.HasPrefix(sess.curDir, p+"/") {
+		sess.curDir = path.Dir(p)
+	}
+	if err != nil {
+		sess.logf("%v", err)
+		sess.writeMessage(550, fmt.Sprintf("Directory delete failed after %d entries: %v", deleted, err))
+		return
+	}
+	sess.writeMessage(250, fmt.Sprintf("Directory deleted, %d entries", deleted))
+}
+
+// walkTree returns the files and the directories of the tree, the
+// directories are returned before their children
+func (sess *Session) walkTree(ctx *Context, dir string) ([]string, []string, error) {
+	var (
+		files []string
+		dirs  = []string{dir}
+	)
+	for i := 0; i < len(dirs); i++ {
+		parent := dirs[i]
+		err := sess.server.Driver.ListDir(ctx, parent, func(f os.FileInfo) error {
+			if f.IsDir() {
+				dirs = append(dirs, path.Join(parent, f.Name()))
+			} else {
+				files = append(files, path.Join(parent, f.Name()))
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return files, dirs, nil
+}
+
+// lockTree checks that no entry of the tree is protected and locks its
+// files, so that none of them is being uploaded while the tree is deleted.
+// It returns the function releasing the locks.
+func (sess *Session) lockTree(cmd string, files, dirs []string) (func(), error) {
+	for _, entries := range [][]string{dirs, files} {
+		for _, p := range entries {
+			if isProtected(sess.server.ProtectedPaths, p) {
+				return nil, fmt.Errorf("%s is protected", p)
+			}
+		}
+	}
+
+	var unlocks []func()
+	unlockAll := func() {
+		for _, unlock := range unlocks {
+			unlock()
+		}
+	}
+	for _, p := range files {
+		unlock, err := sess.lockPath(cmd, p)
+		if err != nil {
+			unlockAll()
+			return nil, fmt.Errorf("%s: %v", p, err)
+		}
+		unlocks = append(unlocks, unlock)
+	}
+	return unlockAll, nil
+}
+
+// deleteTree deletes the files concurrently then the directories, children
+// first, it returns the number of the entries deleted. It stops at the
+// first error.
+func (sess *Session) deleteTree(ctx *Context, files, dirs []string) (int64, error) {
+	var (
+		deleted  int64
+		failed   int32
+		errOnce  sync.Once
+		firstErr error
+		wg       sync.WaitGroup
+		paths    = make(chan string)
+		done     = make(chan struct{})
+	)
+	for i := 0; i < rmdirWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// the drivers may use the data of their context
+			var workerCtx = *ctx
+			workerCtx.Data = make(map[string]interface{})
+			for p := range paths {
+				if atomic.LoadInt32(&failed) != 0 {
+					continue
+				}
+				sess.server.notifiers.BeforeDeleteFile(&workerCtx, p)
+				err := sess.server.Driver.DeleteFile(&workerCtx, p)
+				sess.server.notifiers.AfterFileDeleted(&workerCtx, p, err)
+				if err != nil {
+					atomic.StoreInt32(&failed, 1)
+					errOnce.Do(func() { firstErr = err })
+					continue
+				}
+				atomic.AddInt64(&deleted, 1)
+			}
+		}()
+	}
+	go func() {
+		for _, p := range files {
+			paths <- p
+		}
+		close(paths)
+		wg.Wait()
+		close(done)
+	}()
+
+	total := len(files) + len(dirs)
+	ticker := time.NewTicker(rmdirProgressInterval)
+	defer ticker.Stop()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		case <-ticker.C:
+			sess.writeMessage(150, fmt.Sprintf("Deleted %d of %d entries", atomic.LoadInt64(&deleted), total))
+		}
+	}
+	if firstErr != nil {
+		return deleted, firstErr
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		sess.server.notifiers.BeforeDeleteDir(ctx, dirs[i])
+		err := sess.server.Driver.DeleteDir(ctx, dirs[i])
+		sess.server.notifiers.AfterDirDeleted(ctx, dirs[i], err)
+		if err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
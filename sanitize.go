@@ -0,0 +1,48 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"path"
+	"strings"
+	"unicode"
+)
+
+// NameSanitizer rewrites the names of the files and directories created by
+// STOR, APPE, MKD and RNTO, i.e. for backends which choke on some
+// characters. The final name is reported back to the client, an empty name
+// refuses the command.
+type NameSanitizer func(name string) string
+
+// SanitizeName is a NameSanitizer removing the control characters and the
+// leading and trailing spaces of the name
+func SanitizeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	return strings.TrimSpace(name)
+}
+
+// sanitizePath returns the path with its name rewritten by the sanitizer,
+// it replies an error and returns false if the name is refused
+func (sess *Session) sanitizePath(p string) (string, bool) {
+	if sess.server.NameSanitizer == nil || p == "/" {
+		return p, true
+	}
+	name := path.Base(p)
+	sanitized := sess.server.NameSanitizer(name)
+	if sanitized == "" || sanitized == "." || sanitized == ".." || strings.Contains(sanitized, "/") {
+		sess.logf("Name %q refused by the sanitizer", name)
+		sess.writeMessage(553, "Requested action not taken. File name not allowed.")
+		return "", false
+	}
+	if sanitized != name {
+		sess.logf("Name %q sanitized to %q", name, sanitized)
+	}
+	return path.Join(path.Dir(p), sanitized), true
+}
@@ -0,0 +1,16 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeName(t *testing.T) {
+	assert.EqualValues(t, "a b.txt", SanitizeName(" a\x00 b\r\n.txt\t"))
+	assert.EqualValues(t, "", SanitizeName("\x1b "))
+}
@@ -0,0 +1,163 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrOutsideSchedule is the error AfterUserLogin gets for the logins outside
+// of the schedule of the user, they are refused with a distinct 530 reply
+var ErrOutsideSchedule = errors.New("login not allowed at this time")
+
+// LoginSchedule represents the times of the week a user could log in, i.e.
+// a batch account only allowed from 22:00 to 04:00 UTC:
+//
+//	&LoginSchedule{Start: "22:00", End: "04:00"}
+type LoginSchedule struct {
+	// The days the windows start on, every day if empty. A window wrapping
+	// around midnight belongs to the day it starts on.
+	Days []time.Weekday
+
+	// The times of the day the window starts and ends, as "15:04". The
+	// window wraps around midnight if End is before Start, it's the whole
+	// day if both are empty.
+	Start string
+	End   string
+
+	// The location of the times, UTC if nil
+	Location *time.Location
+
+	// Close the sessions once their window ends instead of only refusing
+	// the new logins
+	Disconnect bool
+}
+
+func parseScheduleTime(v string, def int) (int, error) {
+	if v == "" {
+		return def, nil
+	}
+	t, err := time.Parse("15:04", v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid login schedule time %q", v)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// bounds returns the minutes of the day the window starts and ends at, the
+// end is after the start, beyond a day if the window wraps around midnight
+func (schedule *LoginSchedule) bounds() (int, int, error) {
+	start, err := parseScheduleTime(schedule.Start, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseScheduleTime(schedule.End, 24*60)
+	if err != nil {
+		return 0, 0, err
+	}
+	if end <= start {
+		end += 24 * 60
+	}
+	return start, end, nil
+}
+
+func (schedule *LoginSchedule) allowsDay(day time.Weekday) bool {
+	if len(schedule.Days) == 0 {
+		return true
+	}
+	for _, d := range schedule.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// window returns the end of the window t is in, the zero time if t is
+// outside of the windows
+func (schedule *LoginSchedule) window(t time.Time) (time.Time, error) {
+	start, end, err := schedule.bounds()
+	if err != nil {
+		return time.Time{}, err
+	}
+	location := schedule.Location
+	if location == nil {
+		location = time.UTC
+	}
+	t = t.In(location)
+
+	// the window containing t started today or the day before
+	var windowEnd time.Time
+	for _, days := range []int{-1, 0} {
+		y, m, d := t.AddDate(0, 0, days).Date()
+		day := time.Date(y, m, d, 0, 0, 0, 0, location)
+		if !schedule.allowsDay(day.Weekday()) {
+			continue
+		}
+		from := day.Add(time.Duration(start) * time.Minute)
+		to := day.Add(time.Duration(end) * time.Minute)
+		if !t.Before(from) && t.Before(to) {
+			windowEnd = to
+		}
+	}
+	return windowEnd, nil
+}
+
+// windowEnd returns the end of the windows following on from t, the zero
+// time if t is outside of the windows. The windows are followed up to a
+// week later.
+func (schedule *LoginSchedule) windowEnd(t time.Time) (time.Time, error) {
+	end, err := schedule.window(t)
+	if err != nil || end.IsZero() {
+		return end, err
+	}
+	for limit := t.AddDate(0, 0, 7); end.Before(limit); {
+		next, _ := schedule.window(end)
+		if !next.After(end) {
+			break
+		}
+		end = next
+	}
+	return end, nil
+}
+
+// checkSchedule returns the error of a login at now outside of the schedule
+// of the user and the time the session should be closed at, the zero time
+// if it's left open
+func (info *UserInfo) checkSchedule(now time.Time) (time.Time, error) {
+	schedule := info.Schedule
+	if schedule == nil {
+		return time.Time{}, nil
+	}
+	end, err := schedule.windowEnd(now)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end.IsZero() {
+		return time.Time{}, ErrOutsideSchedule
+	}
+	if !schedule.Disconnect || !end.Before(now.AddDate(0, 0, 7)) {
+		return time.Time{}, nil
+	}
+	return end, nil
+}
+
+// closeAt closes the session at the end of its login window
+func (sess *Session) closeAt(end time.Time) {
+	if sess.scheduleTimer != nil {
+		sess.scheduleTimer.Stop()
+		sess.scheduleTimer = nil
+	}
+	if end.IsZero() {
+		return
+	}
+	user := sess.pseudoUser(sess.user)
+	sess.scheduleTimer = time.AfterFunc(time.Until(end), func() {
+		sess.logf("Login window of %s ended", user)
+		sess.kick()
+	})
+}
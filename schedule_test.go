@@ -0,0 +1,75 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginSchedule(t *testing.T) {
+	// 2020-06-01 is a Monday
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2020, 6, day, hour, min, 0, 0, time.UTC)
+	}
+	night := &UserInfo{Schedule: &LoginSchedule{
+		Days:       []time.Weekday{time.Monday, time.Tuesday},
+		Start:      "22:00",
+		End:        "04:00",
+		Disconnect: true,
+	}}
+
+	for _, c := range []struct {
+		now time.Time
+		end time.Time
+	}{
+		{at(1, 22, 0), at(2, 4, 0)},
+		{at(2, 3, 59), at(2, 4, 0)},
+		{at(2, 23, 0), at(3, 4, 0)},
+		// the window of Tuesday ends on Wednesday
+		{at(3, 1, 0), at(3, 4, 0)},
+	} {
+		end, err := night.checkSchedule(c.now)
+		assert.NoError(t, err, c.now)
+		assert.EqualValues(t, c.end, end, c.now)
+	}
+	for _, now := range []time.Time{at(1, 21, 59), at(1, 3, 0), at(2, 4, 0), at(3, 22, 0)} {
+		_, err := night.checkSchedule(now)
+		assert.EqualValues(t, ErrOutsideSchedule, err, now)
+	}
+
+	// the consecutive whole days are a single window
+	weekdays := &UserInfo{Schedule: &LoginSchedule{
+		Days:       []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+		Disconnect: true,
+	}}
+	end, err := weekdays.checkSchedule(at(2, 12, 0))
+	assert.NoError(t, err)
+	assert.EqualValues(t, at(6, 0, 0), end)
+	_, err = weekdays.checkSchedule(at(6, 12, 0))
+	assert.EqualValues(t, ErrOutsideSchedule, err)
+
+	// the sessions are not closed if the windows never end or if
+	// Disconnect is not set
+	end, err = (&UserInfo{Schedule: &LoginSchedule{Disconnect: true}}).checkSchedule(at(1, 0, 0))
+	assert.NoError(t, err)
+	assert.True(t, end.IsZero())
+	night.Schedule.Disconnect = false
+	end, err = night.checkSchedule(at(1, 22, 0))
+	assert.NoError(t, err)
+	assert.True(t, end.IsZero())
+
+	// the times are in the location of the schedule
+	tokyo := time.FixedZone("JST", 9*3600)
+	office := &UserInfo{Schedule: &LoginSchedule{Start: "09:00", End: "18:00", Location: tokyo, Disconnect: true}}
+	end, err = office.checkSchedule(at(1, 1, 0))
+	assert.NoError(t, err)
+	assert.True(t, at(1, 9, 0).Equal(end))
+
+	_, err = (&UserInfo{Schedule: &LoginSchedule{Start: "25:00"}}).checkSchedule(at(1, 0, 0))
+	assert.EqualError(t, err, `invalid login schedule time "25:00"`)
+}
@@ -0,0 +1,156 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// Search represents the limits of SITE SEARCH
+type Search struct {
+	// The maximum number of paths returned, if 0 it's 100
+	MaxResults int
+
+	// The maximum number of entries walked when the driver is not a
+	// Searcher, if 0 it's 100,000, the walk stops there
+	MaxEntries int
+}
+
+const (
+	defaultSearchMaxResults = 100
+	defaultSearchMaxEntries = 100000
+)
+
+var errSearchLimit = errors.New("search limit reached")
+
+func (search *Search) maxResults() int {
+	if search == nil || search.MaxResults <= 0 {
+		return defaultSearchMaxResults
+	}
+	return search.MaxResults
+}
+
+func (search *Search) maxEntries() int {
+	if search == nil || search.MaxEntries <= 0 {
+		return defaultSearchMaxEntries
+	}
+	return search.MaxEntries
+}
+
+// walkSearch walks the directory and returns the paths of the files which
+// names match the shell pattern, case insensitively. It tells if the walk
+// stopped at a limit.
+func (sess *Session) walkSearch(ctx *Context, dir, pattern string) ([]string, bool, error) {
+	pattern = strings.ToLower(pattern)
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, false, err
+	}
+
+	var (
+		search  = sess.server.Search
+		paths   []string
+		entries int
+		walk    func(dir string) error
+	)
+	walk = func(dir string) error {
+		var dirs []string
+		err := sess.server.Driver.ListDir(ctx, dir, func(info os.FileInfo) error {
+			entries++
+			if entries > search.maxEntries() {
+				return errSearchLimit
+			}
+			p := path.Join(dir, info.Name())
+			// the write-only directories, the trash of the other users and
+			// the hidden files are not searched
+			if sess.isWriteOnly(p) || sess.isForeignTrash(p) || sess.isHidden(dir, info.Name()) {
+				return nil
+			}
+			if info.IsDir() {
+				dirs = append(dirs, p)
+			}
+			if ok, _ := path.Match(pattern, strings.ToLower(info.Name())); ok {
+				paths = append(paths, p)
+				if len(paths) >= search.maxResults() {
+					return errSearchLimit
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, sub := range dirs {
+			if err := walk(sub); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	err := walk(dir)
+	if err == errSearchLimit {
+		return paths, true, nil
+	}
+	return paths, false, err
+}
+
+// siteSearch responds to the SITE SEARCH command. It lists the paths
+// matching the pattern, the results of the driver if it's a Searcher, i.e.
+// the Indexing middleware, otherwise the files below the current directory
+// which names match the shell pattern:
+//
+//	SITE SEARCH *.csv
+type siteSearch struct{}
+
+func (cmd siteSearch) RequireParam() bool {
+	return true
+}
+
+func (cmd siteSearch) Execute(sess *Session, param string) {
+	ctx := &Context{
+		Sess:  sess,
+		Cmd:   "SITE SEARCH",
+		Param: param,
+		Data:  make(map[string]interface{}),
+	}
+	limit := sess.server.Search.maxResults()
+
+	var (
+		paths     []string
+		truncated bool
+		err       error
+	)
+	if driver, _ := optionalDriver(sess.server.Driver, func(driver Driver) bool {
+		_, ok := driver.(Searcher)
+		return ok
+	}); driver != nil {
+		var entries []IndexEntry
+		entries, err = driver.(Searcher).Search(ctx, param, limit+1)
+		if len(entries) > limit {
+			entries, truncated = entries[:limit], true
+		}
+		for _, entry := range entries {
+			if !sess.isWriteOnly(entry.Path) && !sess.isForeignTrash(entry.Path) && !sess.isHiddenPath(entry.Path) {
+				paths = append(paths, entry.Path)
+			}
+		}
+	} else {
+		paths, truncated, err = sess.walkSearch(ctx, sess.buildPath(""), param)
+	}
+	if err != nil {
+		sess.logf("%v", err)
+		sess.writeMessage(550, fmt.Sprint("Action not taken: ", err))
+		return
+	}
+
+	end := "End of search"
+	if truncated {
+		end = "End of search, more files may match"
+	}
+	sess.writeMessageLines(200, fmt.Sprintf("Files matching %s:", param), paths, end)
+}
@@ -0,0 +1,206 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Segmented downloads let a client fetch disjoint ranges of a file over
+// several data connections in parallel, which is much faster over the high
+// latency links to object stores. They are enabled by Options.MaxSegments:
+//
+//	SITE SEGMENTS 4
+//	229-Entering Segmented Passive Mode
+//	 (|||50001|)
+//	 ...
+//	229 End of segments
+//	SITE SEGRETR path
+//	150-Sending 1000 bytes in 4 segments
+//	 (|||50001|) 0-249
+//	 ...
+//	150 Data transfer starting
+//	226 Closing data connections, sent 1000 bytes
+//
+// The segment i is sent over the i-th listed data connection, the ranges
+// include their end byte. MODE Z doesn't apply to the segments.
+
+// siteSegments responds to the SITE SEGMENTS command. It opens the passive
+// data connections of the next SITE SEGRETR.
+type siteSegments struct{}
+
+func (cmd siteSegments) RequireParam() bool {
+	return true
+}
+
+func (sess *Session) closeSegments() {
+	for _, socket := range sess.segments {
+		socket.Close()
+	}
+	sess.segments = nil
+}
+
+func (cmd siteSegments) Execute(sess *Session, param string) {
+	if sess.server.MaxSegments <= 0 {
+		sess.writeMessage(502, "Segmented downloads are disabled")
+		return
+	}
+	n, err := strconv.Atoi(param)
+	if err != nil || n <= 0 || n > sess.server.MaxSegments {
+		sess.writeMessage(501, fmt.Sprintf("The number of segments should be between 1 and %d", sess.server.MaxSegments))
+		return
+	}
+	if !sess.checkDataProtection() {
+		return
+	}
+
+	sess.closeSegments()
+	var ports = make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		socket, err := sess.listenPassive()
+		if err != nil {
+			sess.log(err)
+			sess.closeSegments()
+			sess.writeMessage(425, "Data connection failed")
+			return
+		}
+		sess.segments = append(sess.segments, socket)
+		ports = append(ports, fmt.Sprintf("(|||%d|)", socket.Port()))
+	}
+	sess.writeMessageLines(229, "Entering Segmented Passive Mode", ports, "End of segments")
+}
+
+// segmentRanges splits the size in n ranges, the end bytes are included and
+// the empty ranges are reported as [0, -1]
+func segmentRanges(size int64, n int) [][2]int64 {
+	var ranges = make([][2]int64, n)
+	for i := 0; i < n; i++ {
+		start := size * int64(i) / int64(n)
+		end := size*int64(i+1)/int64(n) - 1
+		if end < start {
+			start, end = 0, -1
+		}
+		ranges[i] = [2]int64{start, end}
+	}
+	return ranges
+}
+
+// siteSegretr responds to the SITE SEGRETR command. It sends the segments of
+// the file over the data connections opened by SITE SEGMENTS.
+type siteSegretr struct{}
+
+func (cmd siteSegretr) RequireParam() bool {
+	return true
+}
+
+func (cmd siteSegretr) Execute(sess *Session, param string) {
+	if sess.server.MaxSegments <= 0 {
+		sess.writeMessage(502, "Segmented downloads are disabled")
+		return
+	}
+	if len(sess.segments) == 0 {
+		sess.writeMessage(503, "SITE SEGMENTS is required first")
+		return
+	}
+	defer sess.closeSegments()
+
+	path := sess.buildPath(param)
+	if !sess.checkWriteOnly(path) || !sess.checkTrash(path) {
+		return
+	}
+	var ctx = Context{
+		Sess:  sess,
+		Cmd:   "SITE SEGRETR",
+		Param: param,
+		Data:  make(map[string]interface{}),
+	}
+	if !sess.checkTransferQuota("SITE SEGRETR", false) {
+		return
+	}
+	sess.server.notifiers.BeforeDownloadFile(&ctx, path)
+	start := time.Now()
+	info, err := sess.server.Driver.Stat(&ctx, path)
+	if err == nil && info.IsDir() {
+		err = fmt.Errorf("%s is a directory", path)
+	}
+	if err != nil {
+		sess.server.notifiers.AfterFileDownloaded(&ctx, path, 0, err)
+		sess.server.notifiers.AfterFileDownloadedEvent(&ctx, newTransferEvent(path, 0, 0, start, err))
+		sess.writeMessage(551, "File not available")
+		return
+	}
+
+	ranges := segmentRanges(info.Size(), len(sess.segments))
+	var lines = make([]string, 0, len(ranges))
+	for i, r := range ranges {
+		lines = append(lines, fmt.Sprintf("(|||%d|) %d-%d", sess.segments[i].Port(), r[0], r[1]))
+	}
+	tr := sess.startSegmentedTransfer(&ctx)
+	sess.writeMessageLines(150, fmt.Sprintf("Sending %d bytes in %d segments", info.Size(), len(ranges)), lines, "Data transfer starting")
+
+	var (
+		wg        sync.WaitGroup
+		lock      sync.Mutex
+		sent      int64
+		firstErr  error
+		checksums = sess.newSegmentChecksums(len(ranges))
+		sizes     = make([]int64, len(ranges))
+	)
+	for i, r := range ranges {
+		var checksum *transferChecksum
+		if checksums != nil {
+			checksum = checksums[i]
+		}
+		sizes[i] = r[1] - r[0] + 1
+		wg.Add(1)
+		go func(socket DataSocket, r [2]int64) {
+			defer wg.Done()
+			n, err := sess.sendSegment(&ctx, tr, checksum, socket, path, r[0], r[1]-r[0]+1)
+			lock.Lock()
+			defer lock.Unlock()
+			sent += n
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}(sess.segments[i], r)
+	}
+	wg.Wait()
+
+	sess.accountTransfer(&ctx, 0, sent, firstErr)
+	if tr.stop() {
+		sess.replyAborted(firstErr == nil, sent)
+		if firstErr != nil {
+			firstErr = errTransferAborted
+		}
+	} else if firstErr != nil {
+		sess.logf("%v", firstErr)
+		sess.writeMessage(551, "Error reading file")
+	}
+	sess.server.notifiers.AfterFileDownloaded(&ctx, path, sent, firstErr)
+	sess.server.notifiers.AfterFileDownloadedEvent(&ctx, combineChecksums(checksums, sizes).event(newTransferEvent(path, sent, 0, start, firstErr)))
+	if firstErr == nil && !tr.aborted {
+		sess.writeMessage(226, fmt.Sprintf("Closing data connections, sent %d bytes", sent))
+	}
+}
+
+// sendSegment sends length bytes of the file from offset over the socket,
+// and closes it
+func (sess *Session) sendSegment(ctx *Context, tr *transfer, checksum *transferChecksum, socket DataSocket, path string, offset, length int64) (int64, error) {
+	defer socket.Close()
+	if length <= 0 {
+		// wait for the connection to close it
+		_, err := socket.Write(nil)
+		return 0, err
+	}
+	_, data, err := sess.getFile(ctx, path, offset, length)
+	if err != nil {
+		return 0, err
+	}
+	defer data.Close()
+	return sess.copyBuffered(socket, tr.reader(checksum.teeReader(data)))
+}
@@ -11,7 +11,10 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"os"
 	"strconv"
+	"sync"
+	"time"
 
 	"goftp.io/server/v2/ratelimit"
 )
@@ -26,9 +29,125 @@ type Options struct {
 	// So that users could override the Commands
 	Commands map[string]Command
 
+	// This server supported sub commands of the SITE command, if blank, it will
+	// be defaultSiteCommands
+	SiteCommands map[string]SiteCommand
+
+	// The protocol capabilities enabled on this server, if nil, it will be
+	// DefaultFeatures()
+	Features *Features
+
+	// The files hidden from the listings, if nil all the files are listed
+	HiddenFiles *HiddenFiles
+
+	// How the recursive sizes of the directories are computed, if not nil
+	// SIZE reports them for directories too
+	DirSize *DirSize
+
+	// The limits of SITE SEARCH when the driver is not a Searcher, if nil
+	// the defaults are used
+	Search *Search
+
+	// The cache of the directory listings of the sessions, if nil the
+	// directories are listed from the driver each time
+	ListingCache *ListingCache
+
+	// If true, the drivers are asked to reserve the space of the uploads
+	// announced by ALLO, see Context.AllocatedSize
+	Preallocate bool
+
+	// How the command lines are parsed, ParseLenient by default
+	Parsing ParseMode
+
+	// The previews of the images returned by THMB, if nil THMB is disabled
+	Thumbnails *Thumbnails
+
+	// The maximum number of data connections of a segmented download, see
+	// SITE SEGMENTS. If 0 segmented downloads are disabled.
+	MaxSegments int
+
+	// The algorithm, as named by HASH, i.e. "CRC32C", "MD5" or "SHA-256",
+	// of the digest computed of every RETR, STOR and APPE transfer and
+	// reported by the TransferEvent. If empty no digest is computed. The
+	// segmented downloads of SITE SEGRETR report only the CRC32 and CRC32C
+	// digests, the ones of their segments are combined.
+	TransferChecksum string
+
+	// The memory the buffers of the transfers could use, if nil it's not
+	// limited
+	MemoryBudget *MemoryBudget
+
+	// The spooling of the uploads to the local disk before they are flushed
+	// to the driver, if nil the uploads are written to the driver directly
+	Spool *Spool
+
+	// The processing of the uploads before STOR and APPE reply 226, if nil
+	// the uploads are acknowledged once the driver stored them
+	PostProcessing *PostProcessing
+
+	// The recycle bin the deleted files and directories are moved to, if nil
+	// they are removed
+	Trash *Trash
+
+	// The shell patterns, as supported by path.Match, of the paths which
+	// could never be deleted or renamed whatever the Perm allows, i.e. "/",
+	// "/incoming" or "/etc/*". The parent directories of the matched paths
+	// are protected too.
+	ProtectedPaths []string
+
+	// The shell patterns of the write-only directories, see ProtectedPaths.
+	// Files could be uploaded to them and to their subdirectories but not
+	// listed, downloaded, deleted or renamed, i.e. for the drops of the
+	// untrusted partners. UserInfo.WriteOnlyPaths adds directories per user.
+	WriteOnlyPaths []string
+
+	// The shell patterns of the no-clobber directories, see WriteOnlyPaths.
+	// STOR could not overwrite their files, it's refused with 553 unless
+	// the file is deleted first or appended by APPE, i.e. for the drops
+	// shared by several partners. UserInfo.NoClobberPaths adds directories
+	// per user.
+	NoClobberPaths []string
+
+	// Create the missing parent directories of the uploads, i.e. for the
+	// clients which can't send MKD, UserInfo.AutoMkdir enables it per user
+	AutoMkdir bool
+
+	// The permission bits of the uploaded files and of the created
+	// directories, masked by Umask, the drivers supporting them get them by
+	// Context.FileMode and Context.DirMode. If they are all zero the
+	// drivers use their defaults, a zero mode with a Umask means 0666 for
+	// the files and 0777 for the directories. UserInfo overrides them per
+	// user.
+	FileMode os.FileMode
+	DirMode  os.FileMode
+	Umask    os.FileMode
+
+	// The limits of the created paths, if nil there are none
+	PathLimits *PathLimits
+
+	// Rewrites the names of the created files and directories, if nil they
+	// are kept
+	NameSanitizer NameSanitizer
+
+	// The uploads which are refused or dropped instead of being stored, i.e.
+	// Thumbs.db or .DS_Store
+	IgnoreUploads []IgnoreRule
+
 	// The driver that will be used to handle files persistent
 	Driver Driver
 
+	// The middlewares wrapping the driver, the first one is the outermost
+	// one
+	DriverMiddlewares []DriverMiddleware
+
+	// The Unicode normalization form of the file names, the paths are
+	// compared whatever their form if it's not NormalizeNone
+	UnicodeNormalization UnicodeNormalization
+
+	// Resolve the paths case insensitively, i.e. for Windows clients on
+	// case sensitive backends. The created files keep the case given.
+	CaseInsensitive bool
+
 	// How to hanle the authenticate requests
 	Auth Auth
 
@@ -42,12 +161,43 @@ type Options struct {
 	// "::", which means all hostnames on ipv4 and ipv6.
 	Hostname string
 
-	// Public IP of the server
+	// The hostnames the server listens on instead of Hostname, i.e. an IPv4
+	// and an IPv6 address to serve both families on separate sockets
+	Hostnames []string
+
+	// Public IP of the server, it's advertised by PASV to the IPv4 clients,
+	// i.e. the external address of a NAT or of the host of a container. A
+	// host name is resolved at every PASV, so that a dynamic address could
+	// be followed.
 	PublicIP string
 
-	// Passive ports
+	// The range of the passive ports, i.e. "30000-31000", so the data
+	// connections could be allowed by a firewall or published by a
+	// container. If empty the ports are chosen by the system.
 	PassivePorts string
 
+	// The public IP and the passive ports of the IPv6 control connections,
+	// if PassivePortsIPv6 is empty PassivePorts is used
+	PublicIPv6       string
+	PassivePortsIPv6 string
+
+	// The local IP, or the name of the network interface, the passive
+	// listeners are bound to, it's advertised if PublicIP is empty. If empty
+	// they listen on all the addresses.
+	PassiveBindAddress string
+
+	// The local IP, or the name of the network interface, the active data
+	// connections are opened from. If empty it's chosen by the system.
+	ActiveBindAddress string
+
+	// The path of the unix socket ListenAndServe listens on instead of the
+	// TCP addresses, the passive and the active modes are then disabled
+	UnixSocket string
+
+	// Opens the data connections in process instead of the passive and the
+	// active modes, see DataChannel
+	DataChannel DataChannel
+
 	// The port that the FTP should listen on. Optional, defaults to 3000. In
 	// a production environment you will probably want to change this to 21.
 	Port int
@@ -55,25 +205,99 @@ type Options struct {
 	// use tls, default is false
 	TLS bool
 
-	// if tls used, cert file is required
+	// if tls used, cert file is required unless TLSConfig is set
 	CertFile string
 
-	// if tls used, key file is required
+	// if tls used, key file is required unless TLSConfig is set
 	KeyFile string
 
+	// The TLS configuration used instead of CertFile and KeyFile if TLS is
+	// true, i.e. to load the certificates with GetCertificate or to restrict
+	// the versions and the cipher suites
+	TLSConfig *tls.Config
+
 	// If ture TLS is used in RFC4217 mode
 	ExplicitFTPS bool
 
 	// If true, client must upgrade to TLS before sending any other command
 	ForceTLS bool
 
+	// If true, the data connections of every user must be protected by
+	// PROT P, see UserInfo.ForceProtectedData to require it for some users
+	ForceProtectedData bool
+
+	// If true, USER and PASS are refused until the control connection is
+	// upgraded by AUTH TLS, unlike ForceTLS the other commands are allowed
+	RequireTLSLogin bool
+
 	WelcomeMessage string
 
-	// A logger implementation, if nil the StdLogger is used
+	// A logger implementation, if nil the StdLogger is used. If it implements
+	// LoggerFactory every session gets its own logger bound to the session.
 	Logger Logger
 
+	// Controls which messages, commands and responses are sent to the logger,
+	// if nil everything is logged
+	LogFilter *LogFilter
+
+	// The duration a session could wait for a command before it's closed, 0
+	// means no timeout. It could be overridden per user via UserInfoAuth.
+	IdleTimeout time.Duration
+
+	// The delays applied before replying to failed logins, if nil failed
+	// logins are replied at once
+	Tarpit *Tarpit
+
+	// The countries the clients could connect from, if nil clients could
+	// connect from everywhere
+	GeoIP *GeoIPPolicy
+
+	// The limits of the incoming connections, if nil there are none
+	AcceptLimit *AcceptLimit
+
+	// The kernel options of the control and data sockets, if nil the system
+	// defaults are used. They don't apply to the listener passed to Serve.
+	Socket *SocketOptions
+
+	// The DNS block lists the client IPs are checked against, if nil no
+	// lists are checked
+	DNSBL *DNSBL
+
 	// Rate Limit per connection bytes per second, 0 means no limit
 	RateLimit int64
+
+	// The rate limit varying over time, i.e. a ratelimit.Schedule, if not
+	// nil it's used instead of RateLimit
+	RatePolicy ratelimit.Policy
+
+	// ReplyHook, if not nil, could rewrite the code and the message of every
+	// response before it's sent to the client, i.e. to hide the server
+	// identity or to translate messages. For multiline responses only the
+	// first line is passed.
+	ReplyHook func(ctx *Context, code int, message string) (int, string)
+
+	// UnsupportedReply, if not nil, rewrites the reply to the commands the
+	// server doesn't execute, which are 500 "Command not found" for the
+	// unknown commands and 502 "Command not implemented" for the disabled
+	// ones, i.e. to point the users to the alternatives. See
+	// Stats.UnsupportedCommands for the commands the clients sent.
+	UnsupportedReply func(ctx *Context, code int, message string) (int, string)
+
+	// Persists the data transferred per user reported by Stats.Bandwidth and
+	// SITE USAGE, if nil they are counted since the server started
+	BandwidthStore BandwidthStore
+
+	// The directory the sessions are recorded to, one file per session, if
+	// not empty. See Record for the format; cmd/ftpreplay replays them.
+	RecordDir string
+
+	// Receives a record of every command, independently of the Logger,
+	// i.e. NewJSONAuditSink(file)
+	Audit AuditSink
+
+	// Pseudonymizes the user names and the client IPs in the logs and the
+	// events if not nil
+	Privacy *Privacy
 }
 
 // Server is the root of your FTP application. You should instantiate one
@@ -82,7 +306,7 @@ type Options struct {
 // Always use the NewServer() method to create a new Server.
 type Server struct {
 	*Options
-	listenTo  string
+	listenTo  []string
 	logger    Logger
 	listener  net.Listener
 	tlsConfig *tls.Config
@@ -90,8 +314,46 @@ type Server struct {
 	cancel    context.CancelFunc
 	feats     string
 	notifiers notifierList
+	// middlewares wrapping the commands dispatching
+	middlewares []CommandMiddleware
+	// the active sessions
+	sessions     map[string]*Session
+	sessionsLock sync.RWMutex
+	// the failed logins per source IP
+	tarpit *tarpitState
+	// the limits of the incoming connections
+	acceptLimiter *acceptLimiter
+	// the memory used by the transfers
+	memory *memoryBudget
+	// the cached sizes of the directories
+	dirUsages dirUsageCache
+	// the cached previews of the images
+	thumbnails thumbnailCache
 	// rate limiter per connection
 	rateLimiter *ratelimit.Limiter
+	// the driver before the wrappers
+	storage Driver
+	// the state of the storage backends
+	health healthState
+	// the number of the sessions which negotiated each capability
+	capabilities     map[string]int64
+	capabilitiesLock sync.Mutex
+	// the number of the unsupported commands received per command
+	unsupported     map[string]int64
+	unsupportedLock sync.Mutex
+	// the number of the sessions which announced each client software
+	clients     map[string]int64
+	clientsLock sync.Mutex
+	// the usage of the transfer quotas if the auth doesn't persist it
+	transferUsages memoryUsageStore
+	// the paths being written if the driver isn't a Locker
+	locks memoryLocker
+	// the directory of the versions if the driver is wrapped by Versioning
+	versionsDir string
+	// the spooling of the uploads if Options.Spool is set
+	spool *spoolDriver
+	// the data transferred per user
+	bandwidth bandwidthState
 }
 
 // ErrServerClosed is returned by ListenAndServe() or Serve() when a shutdown
@@ -137,6 +399,7 @@ func optsWithDefaults(opts *Options) *Options {
 	} else {
 		newOpts.Logger = &StdLogger{}
 	}
+	newOpts.LogFilter = opts.LogFilter
 
 	if opts.Commands == nil {
 		newOpts.Commands = defaultCommands
@@ -144,15 +407,76 @@ func optsWithDefaults(opts *Options) *Options {
 		newOpts.Commands = opts.Commands
 	}
 
+	if opts.SiteCommands == nil {
+		newOpts.SiteCommands = defaultSiteCommands
+	} else {
+		newOpts.SiteCommands = opts.SiteCommands
+	}
+
+	if opts.Features == nil {
+		newOpts.Features = DefaultFeatures()
+	} else {
+		newOpts.Features = opts.Features
+	}
+
 	newOpts.Perm = opts.Perm
 	newOpts.TLS = opts.TLS
 	newOpts.KeyFile = opts.KeyFile
 	newOpts.CertFile = opts.CertFile
+	newOpts.TLSConfig = opts.TLSConfig
 	newOpts.ExplicitFTPS = opts.ExplicitFTPS
 
 	newOpts.PublicIP = opts.PublicIP
 	newOpts.PassivePorts = opts.PassivePorts
+	newOpts.Hostnames = opts.Hostnames
+	newOpts.PublicIPv6 = opts.PublicIPv6
+	newOpts.PassivePortsIPv6 = opts.PassivePortsIPv6
+	newOpts.PassiveBindAddress = opts.PassiveBindAddress
+	newOpts.ActiveBindAddress = opts.ActiveBindAddress
+	newOpts.UnixSocket = opts.UnixSocket
+	newOpts.DataChannel = opts.DataChannel
 	newOpts.RateLimit = opts.RateLimit
+	newOpts.RatePolicy = opts.RatePolicy
+	newOpts.IdleTimeout = opts.IdleTimeout
+	newOpts.ReplyHook = opts.ReplyHook
+	newOpts.UnsupportedReply = opts.UnsupportedReply
+	newOpts.BandwidthStore = opts.BandwidthStore
+	newOpts.Tarpit = opts.Tarpit
+	newOpts.GeoIP = opts.GeoIP
+	newOpts.DNSBL = opts.DNSBL
+	newOpts.AcceptLimit = opts.AcceptLimit
+	newOpts.Socket = opts.Socket
+	newOpts.DriverMiddlewares = opts.DriverMiddlewares
+	newOpts.UnicodeNormalization = opts.UnicodeNormalization
+	newOpts.CaseInsensitive = opts.CaseInsensitive
+	newOpts.HiddenFiles = opts.HiddenFiles
+	newOpts.IgnoreUploads = opts.IgnoreUploads
+	newOpts.ProtectedPaths = opts.ProtectedPaths
+	newOpts.WriteOnlyPaths = opts.WriteOnlyPaths
+	newOpts.NoClobberPaths = opts.NoClobberPaths
+	newOpts.AutoMkdir = opts.AutoMkdir
+	newOpts.FileMode = opts.FileMode
+	newOpts.DirMode = opts.DirMode
+	newOpts.Umask = opts.Umask
+	newOpts.PathLimits = opts.PathLimits
+	newOpts.NameSanitizer = opts.NameSanitizer
+	newOpts.Trash = opts.Trash
+	newOpts.PostProcessing = opts.PostProcessing
+	newOpts.DirSize = opts.DirSize
+	newOpts.Search = opts.Search
+	newOpts.ListingCache = opts.ListingCache
+	newOpts.Parsing = opts.Parsing
+	newOpts.ForceProtectedData = opts.ForceProtectedData
+	newOpts.RequireTLSLogin = opts.RequireTLSLogin
+	newOpts.Preallocate = opts.Preallocate
+	newOpts.Thumbnails = opts.Thumbnails
+	newOpts.MaxSegments = opts.MaxSegments
+	newOpts.TransferChecksum = opts.TransferChecksum
+	newOpts.MemoryBudget = opts.MemoryBudget
+	newOpts.Spool = opts.Spool
+	newOpts.RecordDir = opts.RecordDir
+	newOpts.Audit = opts.Audit
+	newOpts.Privacy = opts.Privacy
 
 	return &newOpts
 }
@@ -176,14 +500,64 @@ func NewServer(opts *Options) (*Server, error) {
 	if opts.Perm == nil {
 		return nil, errors.New("No perm implementation")
 	}
-	s := new(Server)
+	if err := validateIgnoreRules(opts.IgnoreUploads); err != nil {
+		return nil, err
+	}
+	if _, ok := hashAlgos[opts.TransferChecksum]; opts.TransferChecksum != "" && !ok {
+		return nil, fmt.Errorf("Unknown checksum algorithm %s", opts.TransferChecksum)
+	}
+	if err := validateProtectedPaths(opts.ProtectedPaths); err != nil {
+		return nil, err
+	}
+	if err := validateProtectedPaths(opts.WriteOnlyPaths); err != nil {
+		return nil, err
+	}
+	if err := validateProtectedPaths(opts.NoClobberPaths); err != nil {
+		return nil, err
+	}
+	if opts.RequireTLSLogin && !opts.TLS {
+		return nil, errors.New("RequireTLSLogin requires TLS")
+	}
+	if err := validatePassiveOptions(opts); err != nil {
+		return nil, err
+	}
+	for _, addr := range []string{opts.PassiveBindAddress, opts.ActiveBindAddress} {
+		if err := validateBindAddress(addr); err != nil {
+			return nil, err
+		}
+	}
+	if opts.HiddenFiles != nil {
+		if err := opts.HiddenFiles.validate(); err != nil {
+			return nil, err
+		}
+	}
+	s := &Server{storage: opts.Driver}
+	opts.Driver = wrapDriver(foldNames(newSpoolDriver(s, opts.Driver, opts.Spool), opts.UnicodeNormalization, opts.CaseInsensitive), opts.DriverMiddlewares)
 	s.Options = opts
-	s.listenTo = net.JoinHostPort(opts.Hostname, strconv.Itoa(opts.Port))
+	s.versionsDir = findVersionsDir(opts.Driver)
+	hostnames := opts.Hostnames
+	if len(hostnames) == 0 {
+		hostnames = []string{opts.Hostname}
+	}
+	for _, hostname := range hostnames {
+		s.listenTo = append(s.listenTo, net.JoinHostPort(hostname, strconv.Itoa(opts.Port)))
+	}
 	s.logger = opts.Logger
+	s.sessions = make(map[string]*Session)
+	s.tarpit = newTarpitState(opts.Tarpit)
+	s.acceptLimiter = newAcceptLimiter(opts.AcceptLimit)
+	s.memory = newMemoryBudget(opts.MemoryBudget)
+	if err := s.bandwidth.load(opts.BandwidthStore); err != nil {
+		return nil, err
+	}
+	if opts.LogFilter != nil {
+		s.logger = newFilterLogger(opts.Logger, opts.LogFilter)
+	}
+	s.Commands = opts.Features.enabledCommands(opts.Commands)
 
 	var (
 		feats    = "Extensions supported:\n%s"
-		featCmds = " UTF8\n"
+		featCmds = " UTF8\n TVFS\n"
 	)
 
 	for k, v := range s.Commands {
@@ -195,8 +569,27 @@ func NewServer(opts *Options) (*Server, error) {
 	if opts.TLS {
 		featCmds += " AUTH TLS\n PBSZ\n PROT\n"
 	}
+	if opts.Features.ModeZ {
+		featCmds += " MODE Z\n"
+	}
+	if _, ok := s.Commands["MLST"]; ok {
+		featCmds += " " + mlstFeat() + "\n"
+	}
+	if _, ok := s.Commands["RANG"]; ok {
+		featCmds += " RANG STREAM\n"
+	}
+	if _, ok := s.Commands["HASH"]; ok {
+		featCmds += " HASH " + hashFeat(defaultHashAlgo) + "\n"
+	}
+	if _, ok := s.Commands["THMB"]; ok && opts.Thumbnails != nil {
+		featCmds += " THMB\n"
+	}
 	s.feats = fmt.Sprintf(feats, featCmds)
-	s.rateLimiter = ratelimit.New(opts.RateLimit)
+	if opts.RatePolicy != nil {
+		s.rateLimiter = ratelimit.NewWithPolicy(opts.RatePolicy)
+	} else {
+		s.rateLimiter = ratelimit.New(opts.RateLimit)
+	}
 
 	return s, nil
 }
@@ -211,10 +604,11 @@ func (server *Server) RegisterNotifer(notifier Notifier) {
 // it is handed to this functions. driver is an instance of FTPDriver that
 // will handle all auth and persistence details.
 func (server *Server) newSession(id string, tcpConn net.Conn) *Session {
-	return &Session{
+	sess := &Session{
 		id:            id,
 		server:        server,
 		conn:          tcpConn,
+		rawConn:       tcpConn,
 		controlReader: bufio.NewReader(tcpConn),
 		controlWriter: bufio.NewWriter(tcpConn),
 		curDir:        "/",
@@ -222,10 +616,19 @@ func (server *Server) newSession(id string, tcpConn net.Conn) *Session {
 		user:          "",
 		renameFrom:    "",
 		lastFilePos:   -1,
+		rangeEnd:      -1,
 		closed:        false,
 		tls:           false,
+		hashAlgo:      defaultHashAlgo,
 		Data:          make(map[string]interface{}),
+		info: SessionInfo{
+			ID:         id,
+			RemoteAddr: tcpConn.RemoteAddr().String(),
+			CurDir:     "/",
+		},
 	}
+	sess.bindLogger()
+	return sess
 }
 
 func simpleTLSConfig(certFile, keyFile string) (*tls.Config, error) {
@@ -252,28 +655,45 @@ func simpleTLSConfig(certFile, keyFile string) (*tls.Config, error) {
 // listening on the same port.
 //
 func (server *Server) ListenAndServe() error {
-	var listener net.Listener
 	var err error
 
-	if server.Options.TLS {
+	if server.Options.TLS && server.TLSConfig != nil {
+		server.tlsConfig = server.TLSConfig
+	} else if server.Options.TLS {
 		server.tlsConfig, err = simpleTLSConfig(server.CertFile, server.KeyFile)
 		if err != nil {
 			return err
 		}
+	}
 
-		if server.Options.ExplicitFTPS {
-			listener, err = net.Listen("tcp", server.listenTo)
-		} else {
-			listener, err = tls.Listen("tcp", server.listenTo, server.tlsConfig)
+	var listener net.Listener
+	if server.UnixSocket != "" {
+		listener, err = net.Listen("unix", server.UnixSocket)
+		if err != nil {
+			return err
 		}
 	} else {
-		listener, err = net.Listen("tcp", server.listenTo)
+		var listeners []net.Listener
+		for _, addr := range server.listenTo {
+			l, err := server.listenTCP(addr)
+			if err != nil {
+				for _, l := range listeners {
+					l.Close()
+				}
+				return err
+			}
+			listeners = append(listeners, l)
+		}
+		listener = listeners[0]
+		if len(listeners) > 1 {
+			listener = newMultiListener(listeners)
+		}
 	}
-	if err != nil {
-		return err
+	if server.Options.TLS && !server.Options.ExplicitFTPS {
+		listener = tls.NewListener(listener, server.tlsConfig)
 	}
 
-	server.logger.Printf("", "%s listening on %d", server.Name, server.Port)
+	server.logger.Printf("", "%s listening on %s", server.Name, listener.Addr())
 
 	return server.Serve(listener)
 }
@@ -285,7 +705,7 @@ func (server *Server) Serve(l net.Listener) error {
 	server.listener = l
 	server.ctx, server.cancel = context.WithCancel(context.Background())
 	defer server.cancel()
-	sessionID := newSessionID()
+	go server.purgeTrash()
 	for {
 		tcpConn, err := server.listener.Accept()
 		if err != nil {
@@ -294,18 +714,67 @@ func (server *Server) Serve(l net.Listener) error {
 				return ErrServerClosed
 			default:
 			}
-			server.logger.Printf(sessionID, "listening error: %v", err)
+			server.logger.Printf("", "listening error: %v", err)
 			if ne, ok := err.(net.Error); ok && ne.Temporary() {
 				continue
 			}
 			return err
 		}
 
-		ftpConn := server.newSession(sessionID, tcpConn)
+		if !server.acceptLimiter.allow() {
+			server.logger.Printf("", "Connection from %s refused over the accept limits", pseudoAddr(server.Privacy, tcpConn.RemoteAddr()))
+			go refuseConnection(tcpConn)
+			continue
+		}
+
+		// every session gets its own id so that its log lines could be
+		// correlated
+		ftpConn := server.newSession(newSessionID(), tcpConn)
+		ftpConn.pending = 1
+		server.addSession(ftpConn)
 		go ftpConn.Serve()
 	}
 }
 
+func (server *Server) addSession(sess *Session) {
+	server.sessionsLock.Lock()
+	server.sessions[sess.id] = sess
+	server.sessionsLock.Unlock()
+}
+
+func (server *Server) removeSession(sess *Session) {
+	// a session closed before logging in isn't pending anymore
+	sess.handshakeDone()
+	server.sessionsLock.Lock()
+	delete(server.sessions, sess.id)
+	server.sessionsLock.Unlock()
+}
+
+// userSessions returns the active sessions of the user
+func (server *Server) userSessions(userName string) []*Session {
+	server.sessionsLock.RLock()
+	defer server.sessionsLock.RUnlock()
+	var sessions []*Session
+	for _, sess := range server.sessions {
+		if sess.Info().User == userName {
+			sessions = append(sessions, sess)
+		}
+	}
+	return sessions
+}
+
+// KickUser terminates all the active sessions of the user and returns the
+// number of them, i.e. to make the revocation of the credentials or the
+// disabling of a user effective immediately
+func (server *Server) KickUser(userName string) int {
+	sessions := server.userSessions(userName)
+	for _, sess := range sessions {
+		server.logger.Printf(sess.id, "Kicking user %s", userName)
+		sess.kick()
+	}
+	return len(sessions)
+}
+
 // Shutdown will gracefully stop a server. Already connected clients will retain their connections
 func (server *Server) Shutdown() error {
 	if server.cancel != nil {
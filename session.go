@@ -6,19 +6,24 @@ package server
 
 import (
 	"bufio"
+	"compress/zlib"
 	"crypto/rand"
 	"crypto/sha256"
 	"crypto/tls"
 	"encoding/hex"
 	"fmt"
 	"io"
-	"log"
 	mrand "math/rand"
 	"net"
-	"path/filepath"
+	"path"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"goftp.io/server/v2/ratelimit"
 )
 
 const (
@@ -28,21 +33,100 @@ const (
 // Session represents a session between ftp client and the server
 type Session struct {
 	conn          net.Conn
+	rawConn       net.Conn // the accepted connection, before any TLS upgrade
 	controlReader *bufio.Reader
 	controlWriter *bufio.Writer
 	dataConn      DataSocket
 	server        *Server
+	logger        Logger
 	id            string
 	curDir        string
 	reqUser       string
 	user          string
+	userInfo      *UserInfo
+	anonymous     bool // logged in as an anonymous user
+	scheduleTimer *time.Timer // closes the session at the end of its login window
 	renameFrom    string
 	lastFilePos   int64
+	rangeEnd      int64
 	preCommand    string
 	closed        bool
 	tls           bool
 	clientSoft    string
+	hashAlgo      string
+	modeZ         bool
+	protected     bool                   // PROT P was accepted
+	allocSize     int64                  // the size of the next upload announced by ALLO
+	cmdCtx        *Context               // context of the command being executed
 	Data          map[string]interface{} // shared data between different commands
+	info          SessionInfo            // state shared with other sessions
+	infoLock      sync.Mutex             // protects info
+	kicked        int32                  // set atomically by kick
+	loginFailures int                    // failed logins of the connection
+	country       string                 // country of the client resolved by GeoIP
+	dnsblResult   chan []string          // the pending DNSBL lookup
+	dnsblListed   []string               // the DNSBL lists the client is listed in
+	segments      []*passiveSocket       // the data connections of SITE SEGRETR
+	limiter       *ratelimit.Limiter     // the share of the rate limit of the user
+	pending       int32                  // set to 1 until logged in, see handshakeDone
+	control       chan controlLine       // the pending read of the control connection
+	queued        []string               // the command lines received during a transfer
+	stopPath      string                 // the path of the last failed upload
+	stopOffset    int64                  // the offset the last failed upload stopped at
+	writeLock     sync.Mutex             // serializes the replies sent during a transfer
+	recorder      *recorder              // the recording of the session if any
+	lastCode      int                    // the code of the last reply, protected by writeLock
+	listings      []cachedListing        // the last directory listings, the most recent first
+	capability    string                 // the capability negotiated by the command, for its audit record
+	mlstFacts     []string               // the facts selected by OPTS MLST, nil for all
+}
+
+// SessionInfo is a snapshot of the state of a session which could be read
+// from other sessions
+type SessionInfo struct {
+	ID         string
+	User       string // empty if not login
+	RemoteAddr string
+	CurDir     string
+	Command    string    // the command being executed, empty if idle
+	Param      string    // the param of the command, credentials are masked
+	Path       string    // the param of the command as an absolute path
+	Since      time.Time // when the command started
+	TLS        *TLSInfo  // the TLS control connection, nil if not encrypted
+
+	// The capabilities negotiated by the client, in the order they were
+	// first used, i.e. CapabilityEPSV
+	Capabilities []string
+
+	// The unsupported commands sent by the client, in the order they were
+	// first sent
+	Unsupported []string
+
+	// The completed transfers of the session, the oldest first, see SITE
+	// XFERLOG
+	Transfers []TransferRecord
+
+	limiter *ratelimit.Limiter // the limiter of the login user
+}
+
+// Info returns a snapshot of the state of the session, it's safe to be called
+// from other sessions
+func (sess *Session) Info() SessionInfo {
+	sess.infoLock.Lock()
+	defer sess.infoLock.Unlock()
+	return sess.info
+}
+
+func (sess *Session) updateInfo(f func(info *SessionInfo)) {
+	sess.infoLock.Lock()
+	f(&sess.info)
+	sess.infoLock.Unlock()
+}
+
+// Country returns the ISO 3166-1 alpha-2 code of the client country resolved
+// by Options.GeoIP, an empty string if unknown
+func (sess *Session) Country() string {
+	return sess.country
 }
 
 // RemoteAddr returns the remote ftp client's address
@@ -55,13 +139,36 @@ func (sess *Session) LoginUser() string {
 	return sess.user
 }
 
+// UserInfo returns the settings of the login user, nil if not login
+func (sess *Session) UserInfo() *UserInfo {
+	return sess.userInfo
+}
+
+// rateLimiter returns the limiter of the transfers of the session
+func (sess *Session) rateLimiter() *ratelimit.Limiter {
+	if sess.limiter != nil {
+		return sess.limiter
+	}
+	return sess.server.rateLimiter
+}
+
 // IsLogin returns if user has login
 func (sess *Session) IsLogin() bool {
 	return len(sess.user) > 0
 }
 
-// PublicIP returns the public ip of the server
+// ClientSoftware returns the name and version of the client software
+// announced via the CLNT command, empty if the client didn't send it
+func (sess *Session) ClientSoftware() string {
+	return sess.clientSoft
+}
+
+// PublicIP returns the public ip of the server for the address family of the
+// control connection
 func (sess *Session) PublicIP() string {
+	if sess.isIPv6() {
+		return sess.server.PublicIPv6
+	}
 	return sess.server.PublicIP
 }
 
@@ -81,41 +188,34 @@ func (sess *Session) DataConn() DataSocket {
 }
 
 func (sess *Session) passiveListenIP() string {
-	var listenIP string
 	if len(sess.PublicIP()) > 0 {
-		listenIP = sess.PublicIP()
-	} else {
-		listenIP = sess.conn.LocalAddr().(*net.TCPAddr).IP.String()
+		return sess.resolvePublicIP(sess.PublicIP())
+	} else if ip, _ := sess.bindIP(sess.server.PassiveBindAddress); ip != nil {
+		return ip.String()
 	}
-
-	if listenIP == "::1" {
-		return listenIP
-	}
-
-	lastIdx := strings.LastIndex(listenIP, ":")
-	if lastIdx <= 0 {
-		return listenIP
+	if local, ok := sess.conn.LocalAddr().(*net.TCPAddr); ok {
+		return local.IP.String()
 	}
-	return listenIP[:lastIdx]
+	return ""
 }
 
-// PassivePort returns the port which could be used by passive mode.
+// PassivePort returns the port which could be used by passive mode, a
+// random port of the range, the last port of the range excluded unless it's
+// the first one
 func (sess *Session) PassivePort() int {
-	if len(sess.server.PassivePorts) > 0 {
-		portRange := strings.Split(sess.server.PassivePorts, "-")
-
-		if len(portRange) != 2 {
-			log.Println("empty port")
-			return 0
-		}
-
-		minPort, _ := strconv.Atoi(strings.TrimSpace(portRange[0]))
-		maxPort, _ := strconv.Atoi(strings.TrimSpace(portRange[1]))
-
-		return minPort + mrand.Intn(maxPort-minPort)
+	minPort, maxPort, err := parsePortRange(sess.passivePorts())
+	if err != nil {
+		sess.log(err)
+		return 0
+	}
+	if minPort == 0 {
+		// let system automatically chose one port
+		return 0
 	}
-	// let system automatically chose one port
-	return 0
+	if maxPort == minPort {
+		return minPort
+	}
+	return minPort + mrand.Intn(maxPort-minPort)
 }
 
 // returns a random 20 char string that can be used as a unique session ID
@@ -137,18 +237,68 @@ func newSessionID() string {
 // cleaned up.
 func (sess *Session) Serve() {
 	sess.log("Connection Established")
+	sess.startRecording()
+	defer func() {
+		if err := sess.recorder.close(); err != nil {
+			sess.warnf("recording failed: %v", err)
+		}
+	}()
+	if !sess.checkConnection() {
+		sess.writeMessage(421, "Service not available, closing control connection")
+		sess.audit(auditConnect, "", "", 421, time.Now())
+		sess.Close()
+		sess.server.removeSession(sess)
+		sess.log("Connection Terminated")
+		return
+	}
+	if conn, ok := sess.conn.(*tls.Conn); ok {
+		// implicit FTPS
+		if err := sess.handshakeTLS(conn, ""); err != nil {
+			sess.warnf("TLS handshake failed: %v", err)
+			sess.Close()
+			sess.server.removeSession(sess)
+			sess.log("Connection Terminated")
+			return
+		}
+		sess.tls = true
+	}
+	sess.startDNSBL()
 	// send welcome
 	sess.writeMessage(220, sess.server.WelcomeMessage)
 	// read commands
 	for {
-		line, err := sess.controlReader.ReadString('\n')
+		if sess.isKicked() {
+			sess.log("Session kicked")
+			sess.writeMessage(421, "Session terminated, closing control connection")
+			break
+		}
+		if timeout := sess.idleTimeout(); timeout > 0 {
+			_ = sess.conn.SetReadDeadline(time.Now().Add(timeout))
+			if sess.isKicked() {
+				// the deadline set by a kick since the check must not be
+				// overwritten
+				sess.kick()
+			}
+		}
+		line, err := sess.readLine()
 		if err != nil {
-			if err != io.EOF {
-				sess.log(fmt.Sprint("read error:", err))
+			if sess.isKicked() {
+				sess.log("Session kicked")
+				sess.writeMessage(421, "Session terminated, closing control connection")
+			} else if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				sess.log("Idle timeout")
+				sess.writeMessage(421, "Idle timeout, closing control connection")
+			} else if err != io.EOF {
+				sess.warnf("read error: %v", err)
 			}
 
 			break
 		}
+		if !sess.checkDNSBL() {
+			sess.writeMessage(421, "Service not available, closing control connection")
+			sess.audit(auditConnect, "", "", 421, time.Now())
+			break
+		}
 		sess.receiveLine(line)
 		// QUIT command closes connection, break to avoid error on reading from
 		// closed socket
@@ -157,7 +307,38 @@ func (sess *Session) Serve() {
 		}
 	}
 	sess.Close()
-	sess.log("Connection Terminated")
+	sess.server.removeSession(sess)
+	if sess.clientSoft != "" {
+		sess.logf("Connection Terminated, client software: %s", sess.clientSoft)
+	} else {
+		sess.log("Connection Terminated")
+	}
+}
+
+// checkConnection reports whether the client is allowed to connect
+func (sess *Session) checkConnection() bool {
+	return sess.checkGeoIP()
+}
+
+// kick asks the session to terminate, it's safe to be called from other
+// sessions. A waiting session is terminated at once, a busy one once the
+// running command completes.
+func (sess *Session) kick() {
+	atomic.StoreInt32(&sess.kicked, 1)
+	_ = sess.rawConn.SetReadDeadline(time.Now())
+}
+
+func (sess *Session) isKicked() bool {
+	return atomic.LoadInt32(&sess.kicked) == 1
+}
+
+// idleTimeout returns the duration the session could wait for a command, the
+// timeout of the login user overrides the server one
+func (sess *Session) idleTimeout() time.Duration {
+	if sess.userInfo != nil && sess.userInfo.IdleTimeout > 0 {
+		return sess.userInfo.IdleTimeout
+	}
+	return sess.server.IdleTimeout
 }
 
 // Close will manually close this connection, even if the client isn't ready.
@@ -166,16 +347,25 @@ func (sess *Session) Close() {
 	sess.closed = true
 	sess.reqUser = ""
 	sess.user = ""
+	sess.userInfo = nil
+	sess.anonymous = false
+	if sess.scheduleTimer != nil {
+		sess.scheduleTimer.Stop()
+	}
 	if sess.dataConn != nil {
 		sess.dataConn.Close()
 		sess.dataConn = nil
 	}
+	sess.closeSegments()
+	if logger, ok := sess.server.logger.(*filterLogger); ok {
+		logger.closeSession(sess.id)
+	}
 }
 
 func (sess *Session) upgradeToTLS() error {
-	sess.log("Upgrading connectiion to TLS")
+	sess.debugf("Upgrading connection to TLS")
 	tlsConn := tls.Server(sess.conn, sess.server.tlsConfig)
-	err := tlsConn.Handshake()
+	err := sess.handshakeTLS(tlsConn, "AUTH")
 	if err == nil {
 		sess.conn = tlsConn
 		sess.controlReader = bufio.NewReader(tlsConn)
@@ -192,20 +382,65 @@ func (sess *Session) receiveLine(line string) {
 		if err := recover(); err != nil {
 			buf := make([]byte, 1<<16)
 			buf = buf[:runtime.Stack(buf, false)]
-			sess.logf("handler crashed with error:%v\n%s", err, buf)
+			sess.errorf("handler crashed with error:%v\n%s", err, buf)
 		}
 	}()
 
-	command, param := sess.parseLine(line)
-	sess.server.Logger.PrintCommand(sess.id, command, param)
+	command, param, err := sess.parseLine(line)
+	if err != nil {
+		sess.warnf("Rejected command line: %v", err)
+		sess.writeMessage(500, "Syntax error, command unrecognized")
+		return
+	}
+	// the credentials are never sent to the logger
+	sess.logger.PrintCommand(sess.id, command, sess.pseudoParam(command, param))
+	sess.recorder.command(command, sess.pseudoParam(command, param))
+	defer func(user string, start time.Time) {
+		code := sess.lastReplyCode()
+		sess.capability = sess.negotiate(command, param, code)
+		sess.audit(command, param, user, code, start)
+		sess.capability = ""
+	}(sess.user, time.Now())
+
+	sess.cmdCtx = &Context{
+		Sess:  sess,
+		Cmd:   strings.ToUpper(command),
+		Param: param,
+		Data:  make(map[string]interface{}),
+	}
+	sess.updateInfo(func(info *SessionInfo) {
+		info.Command = sess.cmdCtx.Cmd
+		info.Param = redactParam(command, param)
+		info.Path = ""
+		// the redacted params, i.e. the passwords, are not paths
+		if param != "" && info.Param == param {
+			info.Path = sess.buildPath(param)
+		}
+		info.Since = time.Now()
+	})
+	defer func() {
+		sess.cmdCtx = nil
+		sess.updateInfo(func(info *SessionInfo) {
+			info.User = sess.user
+			info.CurDir = sess.curDir
+			info.Command = ""
+			info.Param = ""
+			info.Path = ""
+		})
+	}()
+	sess.server.commandHandler(sess)(sess.cmdCtx)
+}
 
+// executeCommand checks the requirements of the command and executes it
+func (sess *Session) executeCommand(ctx *Context) {
 	var (
 		commands = sess.server.Commands
-		theCmd   = strings.ToUpper(command)
+		theCmd   = ctx.Cmd
+		param    = ctx.Param
 		cmdObj   = commands[theCmd]
 	)
 	if cmdObj == nil {
-		sess.writeMessage(500, "Command not found")
+		sess.replyUnsupported(ctx)
 		return
 	}
 	if cmdObj.RequireParam() && param == "" {
@@ -214,27 +449,51 @@ func (sess *Session) receiveLine(line string) {
 		sess.writeMessage(534, "Request denied for policy reasons. AUTH TLS required.")
 	} else if cmdObj.RequireAuth() && sess.user == "" {
 		sess.writeMessage(530, "not logged in")
+	} else if sess.isReadOnly() && isWriteCommand(theCmd, param) {
+		sess.writeMessage(550, "Action not taken: read-only access")
+	} else if p, ok := sess.writeOnlyPath(theCmd, param); ok {
+		sess.writeMessage(550, "Action not taken: "+encodePathname(p)+" is write-only")
+	} else if p, ok := sess.foreignTrashPath(theCmd, param); ok {
+		sess.writeMessage(550, "Action not taken: "+encodePathname(p)+" is not accessible")
+	} else if p, ok := sess.versionsPath(theCmd, param); ok {
+		sess.writeMessage(550, "Action not taken: "+encodePathname(p)+" is not accessible")
+	} else if err := sess.checkRetainedCommand(ctx, theCmd, param); err != nil {
+		sess.writeMessage(550, fmt.Sprint("Action not taken: ", err))
 	} else {
 		cmdObj.Execute(sess, param)
 		sess.preCommand = theCmd
+		sess.invalidateListings(theCmd)
 	}
 }
 
-func (sess *Session) parseLine(line string) (string, string) {
-	params := strings.SplitN(strings.Trim(line, "\r\n"), " ", 2)
-	if len(params) == 1 {
-		return params[0], ""
-	}
-	return params[0], params[1]
-}
-
 func (sess *Session) WriteMessage(code int, message string) {
 	sess.writeMessage(code, message)
 }
 
+// rewriteMessage passes a response through Options.ReplyHook if there is
+// one.
+func (sess *Session) rewriteMessage(code int, message string) (int, string) {
+	if sess.server.ReplyHook == nil {
+		return code, message
+	}
+	ctx := sess.cmdCtx
+	if ctx == nil {
+		ctx = &Context{
+			Sess: sess,
+			Data: make(map[string]interface{}),
+		}
+	}
+	return sess.server.ReplyHook(ctx, code, message)
+}
+
 // writeMessage will send a standard FTP response back to the client.
 func (sess *Session) writeMessage(code int, message string) {
-	sess.server.Logger.PrintResponse(sess.id, code, message)
+	code, message = sess.rewriteMessage(code, message)
+	sess.writeLock.Lock()
+	defer sess.writeLock.Unlock()
+	sess.logger.PrintResponse(sess.id, code, message)
+	sess.recorder.reply(code, message)
+	sess.lastCode = code
 	line := fmt.Sprintf("%d %s\r\n", code, message)
 	_, _ = sess.controlWriter.WriteString(line)
 	sess.controlWriter.Flush()
@@ -242,12 +501,39 @@ func (sess *Session) writeMessage(code int, message string) {
 
 // writeMessage will send a standard FTP response back to the client.
 func (sess *Session) writeMessageMultiline(code int, message string) {
-	sess.server.Logger.PrintResponse(sess.id, code, message)
+	code, message = sess.rewriteMessage(code, message)
+	sess.writeLock.Lock()
+	defer sess.writeLock.Unlock()
+	sess.logger.PrintResponse(sess.id, code, message)
+	sess.recorder.reply(code, message)
+	sess.lastCode = code
 	line := fmt.Sprintf("%d-%s\r\n%d END\r\n", code, message, code)
 	_, _ = sess.controlWriter.WriteString(line)
 	sess.controlWriter.Flush()
 }
 
+// writeMessageLines will send a multiline FTP response back to the client,
+// the lines are sent between the first and the last line of the response.
+func (sess *Session) writeMessageLines(code int, first string, lines []string, last string) {
+	code, first = sess.rewriteMessage(code, first)
+	sess.writeLock.Lock()
+	defer sess.writeLock.Unlock()
+	sess.logger.PrintResponse(sess.id, code, first)
+	sess.recorder.reply(code, first)
+	sess.lastCode = code
+	_, _ = fmt.Fprintf(sess.controlWriter, "%d-%s\r\n", code, first)
+	for _, line := range lines {
+		// RFC 959 requires lines beginning with a digit to be padded so that
+		// they can't be mistaken for the end of the response
+		if len(line) > 0 && line[0] >= '0' && line[0] <= '9' {
+			line = " " + line
+		}
+		_, _ = sess.controlWriter.WriteString(encodePathname(line) + "\r\n")
+	}
+	_, _ = fmt.Fprintf(sess.controlWriter, "%d %s\r\n", code, last)
+	sess.controlWriter.Flush()
+}
+
 func (sess *Session) BuildPath(filename string) string {
 	return sess.buildPath(filename)
 }
@@ -271,23 +557,58 @@ func (sess *Session) BuildPath(filename string) string {
 // prefix the path with something to scope the users access to a sandbox.
 func (sess *Session) buildPath(filename string) (fullPath string) {
 	if len(filename) > 0 && filename[0:1] == "/" {
-		fullPath = filepath.Clean(filename)
+		fullPath = path.Clean(filename)
 	} else if len(filename) > 0 && filename != "-a" {
-		fullPath = filepath.Clean(sess.curDir + "/" + filename)
+		fullPath = path.Clean(sess.curDir + "/" + filename)
 	} else {
-		fullPath = filepath.Clean(sess.curDir)
+		fullPath = path.Clean(sess.curDir)
 	}
-	fullPath = strings.Replace(fullPath, "//", "/", -1)
-	fullPath = strings.Replace(fullPath, string(filepath.Separator), "/", -1)
 	return
 }
 
+// nopDataCloser wraps the data connection without closing it, it keeps the
+// ReadFrom of the data socket available to io.Copy
+type nopDataCloser struct {
+	DataSocket
+}
+
+func (nopDataCloser) Close() error {
+	return nil
+}
+
+// dataWriter returns a writer to the data connection, in MODE Z the data
+// is compressed and the writer must be closed to flush the compressed data.
+// Closing the writer does never close the data connection.
+func (sess *Session) dataWriter() io.WriteCloser {
+	if sess.modeZ {
+		return zlib.NewWriter(sess.dataConn)
+	}
+	return nopDataCloser{sess.dataConn}
+}
+
+// dataReader returns a reader from the data connection, in MODE Z the data
+// is decompressed.
+func (sess *Session) dataReader() (io.Reader, error) {
+	if err := sess.openDataChannel(); err != nil {
+		return nil, err
+	}
+	if sess.modeZ {
+		return zlib.NewReader(sess.dataConn)
+	}
+	return sess.dataConn, nil
+}
+
 // sendOutofbandData will send a string to the client via the currently open
 // data socket. Assumes the socket is open and ready to be used.
 func (sess *Session) sendOutofbandData(data []byte) {
 	bytes := len(data)
+	if err := sess.openDataChannel(); err != nil {
+		sess.log(err)
+	}
 	if sess.dataConn != nil {
-		_, _ = sess.dataConn.Write(data)
+		w := sess.dataWriter()
+		_, _ = w.Write(data)
+		_ = w.Close()
 		sess.dataConn.Close()
 		sess.dataConn = nil
 	}
@@ -295,19 +616,34 @@ func (sess *Session) sendOutofbandData(data []byte) {
 	sess.writeMessage(226, message)
 }
 
-func (sess *Session) sendOutofBandDataWriter(data io.ReadCloser) error {
-	bytes, err := io.Copy(sess.dataConn, data)
+// sendOutofBandDataWriter copies data to the client via the currently open
+// data socket, it returns the number of bytes sent.
+func (sess *Session) sendOutofBandDataWriter(data io.ReadCloser) (int64, error) {
+	return sess.sendOutofBandDataVia(data, sess.dataWriter)
+}
+
+// sendOutofBandDataVia copies data to the client via the writer returned
+// by newWriter once the data socket is open
+func (sess *Session) sendOutofBandDataVia(data io.ReadCloser, newWriter func() io.WriteCloser) (int64, error) {
+	if err := sess.openDataChannel(); err != nil {
+		return 0, err
+	}
+	w := newWriter()
+	bytes, err := sess.copyBuffered(w, data)
+	if err == nil {
+		err = w.Close()
+	}
 	if err != nil {
 		sess.dataConn.Close()
 		sess.dataConn = nil
-		return err
+		return bytes, err
 	}
 	message := "Closing data connection, sent " + strconv.Itoa(int(bytes)) + " bytes"
 	sess.writeMessage(226, message)
 	sess.dataConn.Close()
 	sess.dataConn = nil
 
-	return nil
+	return bytes, nil
 }
 
 func (sess *Session) changeCurDir(path string) error {
@@ -315,10 +651,41 @@ func (sess *Session) changeCurDir(path string) error {
 	return nil
 }
 
+// bindLogger binds the logger of the session to the current fields of the
+// session if Options.Logger is a LoggerFactory
+func (sess *Session) bindLogger() {
+	factory, ok := sess.server.logger.(LoggerFactory)
+	if !ok {
+		sess.logger = sess.server.logger
+		return
+	}
+
+	var fields = LogFields{
+		SessionID: sess.id,
+		User:      sess.pseudoUser(sess.user),
+	}
+	if addr := sess.RemoteAddr(); addr != nil {
+		fields.RemoteAddr = sess.pseudoAddr()
+	}
+	sess.logger = factory.NewSessionLogger(fields)
+}
+
 func (sess *Session) log(message interface{}) {
-	sess.server.logger.Print(sess.id, message)
+	sess.logger.Print(sess.id, message)
 }
 
 func (sess *Session) logf(format string, v ...interface{}) {
-	sess.server.logger.Printf(sess.id, format, v...)
+	sess.logger.Printf(sess.id, format, v...)
+}
+
+func (sess *Session) debugf(format string, v ...interface{}) {
+	logLevel(sess.logger, LevelDebug, sess.id, format, v...)
+}
+
+func (sess *Session) warnf(format string, v ...interface{}) {
+	logLevel(sess.logger, LevelWarn, sess.id, format, v...)
+}
+
+func (sess *Session) errorf(format string, v ...interface{}) {
+	logLevel(sess.logger, LevelError, sess.id, format, v...)
 }
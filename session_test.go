@@ -5,6 +5,7 @@
 package server
 
 import (
+	"fmt"
 	"net"
 	"testing"
 	"time"
@@ -23,6 +24,8 @@ func TestConnBuildPath(t *testing.T) {
 		{"/files/two.txt", "/files/two.txt"},
 		{"files/two.txt", "/files/two.txt"},
 		{"/../../../../etc/passwd", "/etc/passwd"},
+		{"//files/./two.txt/", "/files/two.txt"},
+		{`..\..\two.txt`, `/..\..\two.txt`},
 		{"rclone-test-roxarey8facabob5tuwetet4/hello? sausage/êé/Hello, 世界/ \" ' @ < > & ? + ≠/z.txt", "/rclone-test-roxarey8facabob5tuwetet4/hello? sausage/êé/Hello, 世界/ \" ' @ < > & ? + ≠/z.txt"},
 	}
 	for _, tt := range pathtests {
@@ -91,3 +94,81 @@ func TestPassiveListenIP(t *testing.T) {
 		t.Fatalf("Expected passive listen IP to be 1.1.1.1 but got %s", c.passiveListenIP())
 	}
 }
+
+func TestPassiveFamily(t *testing.T) {
+	var opts = &Options{
+		PublicIP:         "1.1.1.1",
+		PassivePorts:     "1000-1001",
+		PublicIPv6:       "2001:db8::1",
+		PassivePortsIPv6: "2000-2001",
+	}
+	c := &Session{
+		conn: mockConn{
+			ip: net.ParseIP("2001:db8::2"),
+		},
+		server: &Server{
+			Options: opts,
+		},
+	}
+	if c.passiveListenIP() != "2001:db8::1" {
+		t.Fatalf("Expected passive listen IP to be 2001:db8::1 but got %s", c.passiveListenIP())
+	}
+	if c.PassivePort() != 2000 {
+		t.Fatalf("Expected passive port to be 2000 but got %d", c.PassivePort())
+	}
+
+	// an IPv4 client of a dual stack listener
+	c.conn = mockConn{
+		ip: net.ParseIP("::ffff:1.1.1.2"),
+	}
+	if c.passiveListenIP() != "1.1.1.1" {
+		t.Fatalf("Expected passive listen IP to be 1.1.1.1 but got %s", c.passiveListenIP())
+	}
+	if c.PassivePort() != 1000 {
+		t.Fatalf("Expected passive port to be 1000 but got %d", c.PassivePort())
+	}
+}
+
+func TestParsePortRange(t *testing.T) {
+	for ports, expected := range map[string][2]int{
+		"":              {0, 0},
+		"30000-31000":   {30000, 31000},
+		" 2000 - 2000 ": {2000, 2000},
+	} {
+		minPort, maxPort, err := parsePortRange(ports)
+		if err != nil || minPort != expected[0] || maxPort != expected[1] {
+			t.Errorf("Unexpected range of %q: %d-%d %v", ports, minPort, maxPort, err)
+		}
+	}
+	for _, ports := range []string{"30000", "a-b", "0-10", "2000-1000", "60000-70000"} {
+		if _, _, err := parsePortRange(ports); err == nil {
+			t.Errorf("Expected an error for the range %q", ports)
+		}
+	}
+}
+
+func TestNextPassivePort(t *testing.T) {
+	c := &Session{
+		server: &Server{
+			Options: &Options{
+				PassivePorts: "1000-1003",
+			},
+		},
+	}
+	if c.passivePortCount() != 3 {
+		t.Fatalf("Expected 3 passive ports but got %d", c.passivePortCount())
+	}
+	var ports []int
+	for port, i := 1001, 0; i < 3; i++ {
+		port = c.nextPassivePort(port)
+		ports = append(ports, port)
+	}
+	if fmt.Sprint(ports) != "[1002 1000 1001]" {
+		t.Fatalf("Unexpected passive ports %v", ports)
+	}
+
+	c.server.PassivePorts = "1000-1000"
+	if c.PassivePort() != 1000 || c.passivePortCount() != 1 {
+		t.Fatalf("Expected the single passive port 1000 but got %d", c.PassivePort())
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"time"
+)
+
+// SocketOptions represents the kernel options of the control and data
+// sockets, i.e. larger buffers for high throughput links or shorter
+// keepalives behind NATs dropping idle connections
+type SocketOptions struct {
+	// The period of the TCP keepalive probes, if 0 the system default is
+	// used, if negative no probes are sent
+	KeepAlive time.Duration
+
+	// The sizes of the kernel receive and send buffers, if 0 the system
+	// defaults are used
+	ReadBuffer  int
+	WriteBuffer int
+
+	// Enable the Nagle's algorithm, TCP_NODELAY is set by default
+	Nagle bool
+
+	// Set SO_REUSEPORT on the listeners so that several servers could listen
+	// on the same port, it's only supported on unix systems
+	ReusePort bool
+}
+
+// control sets the options of the listening sockets
+func (opts *SocketOptions) control(network, address string, c syscall.RawConn) error {
+	if opts == nil || !opts.ReusePort {
+		return nil
+	}
+	var err error
+	if cerr := c.Control(func(fd uintptr) {
+		err = setReusePort(fd)
+	}); cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+// tune sets the options of a connected socket, the connections but TCP ones
+// are left untouched
+func (opts *SocketOptions) tune(conn net.Conn) error {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if opts == nil || !ok {
+		return nil
+	}
+	if opts.KeepAlive < 0 {
+		if err := tcpConn.SetKeepAlive(false); err != nil {
+			return err
+		}
+	} else if opts.KeepAlive > 0 {
+		if err := tcpConn.SetKeepAlive(true); err != nil {
+			return err
+		}
+		if err := tcpConn.SetKeepAlivePeriod(opts.KeepAlive); err != nil {
+			return err
+		}
+	}
+	if opts.ReadBuffer > 0 {
+		if err := tcpConn.SetReadBuffer(opts.ReadBuffer); err != nil {
+			return err
+		}
+	}
+	if opts.WriteBuffer > 0 {
+		if err := tcpConn.SetWriteBuffer(opts.WriteBuffer); err != nil {
+			return err
+		}
+	}
+	return tcpConn.SetNoDelay(!opts.Nagle)
+}
+
+// tunedListener sets the socket options of the accepted connections
+type tunedListener struct {
+	*net.TCPListener
+	opts *SocketOptions
+}
+
+func (l tunedListener) Accept() (net.Conn, error) {
+	conn, err := l.TCPListener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if err := l.opts.tune(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// listenTCP returns a TCP listener with the socket options of the server
+func (server *Server) listenTCP(address string) (tunedListener, error) {
+	var lc = net.ListenConfig{Control: server.Socket.control}
+	l, err := lc.Listen(context.Background(), "tcp", address)
+	if err != nil {
+		return tunedListener{}, err
+	}
+	return tunedListener{l.(*net.TCPListener), server.Socket}, nil
+}
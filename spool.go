@@ -0,0 +1,437 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Spool represents the spooling of the uploads to the local disk, the
+// uploads are acknowledged once they are written to the disk and are
+// flushed to the driver in the background, i.e. for object stores over a
+// WAN. The spooled files are reported by the driver until they are flushed.
+//
+// The failed flushes are retried and reported to the FlushNotifier
+// notifiers, the spooled file is kept in Dir and still reported by the
+// driver then, until it's uploaded again or deleted. The files not flushed
+// yet when the process exits are kept in Dir as well. The pending and the
+// failed flushes are listed by Server.SpooledUploads.
+//
+// The authentication of the driver is kept and its versions wait for the
+// pending flush of the file, but its other optional interfaces, i.e.
+// RangeGetter, StorageStats, Locker, Symlinker or Searcher, are not
+// available while spooling as they would miss the uploads not flushed yet.
+type Spool struct {
+	// The local directory the uploads are written to, if empty it's the
+	// temporary directory
+	Dir string
+
+	// The number of retries of a failed flush, if 0 it's 3
+	Retries int
+
+	// The interval between the retries, if 0 it's 10 seconds
+	RetryInterval time.Duration
+
+	// The number of flushes running at once, if 0 it's 4
+	Workers int
+}
+
+// FlushNotifier is an optional interface a Notifier could implement to be
+// notified of the spooled uploads flushed to the driver, err is the error of
+// the last retry if the flush failed
+type FlushNotifier interface {
+	AfterFileFlushed(ctx *Context, dstPath string, size int64, err error)
+}
+
+var _ FlushNotifier = notifierList{}
+
+func (notifiers notifierList) AfterFileFlushed(ctx *Context, dstPath string, size int64, err error) {
+	for _, notifier := range notifiers {
+		if n, ok := notifier.(FlushNotifier); ok {
+			n.AfterFileFlushed(ctx, dstPath, size, err)
+		}
+	}
+}
+
+// SpooledUpload represents an upload spooled to the local disk which isn't
+// flushed to the driver yet, or whose flush failed
+type SpooledUpload struct {
+	Path  string `json:"path"`
+	User  string `json:"user,omitempty"`
+	File  string `json:"file"`
+	Size  int64  `json:"size"`
+	Error string `json:"error,omitempty"` // the error of the failed flush
+}
+
+// spoolItem represents an upload not flushed yet
+type spoolItem struct {
+	ctx  *Context
+	path string
+	user string
+	file string
+	size int64
+	done chan struct{}
+	err  error // the error of the failed flush, set before done is closed
+}
+
+// failed returns the error of the failed flush, nil if it's pending or
+// flushed
+func (item *spoolItem) failed() error {
+	select {
+	case <-item.done:
+		return item.err
+	default:
+		return nil
+	}
+}
+
+var (
+	_ Driver        = &spoolDriver{}
+	_ ModTimeSetter = &spoolDriver{}
+	_ Versioner     = &spoolDriver{}
+)
+
+type spoolAuthDriver struct {
+	*spoolDriver
+	Auth
+}
+
+type spoolDriver struct {
+	Driver
+	server  *Server
+	spool   *Spool
+	workers chan struct{}
+
+	lock    sync.Mutex
+	pending map[string]*spoolItem
+}
+
+func (driver *spoolDriver) unwrap() Driver {
+	return driver.Driver
+}
+
+func newSpoolDriver(server *Server, driver Driver, spool *Spool) Driver {
+	if spool == nil {
+		return driver
+	}
+	workers := spool.Workers
+	if workers <= 0 {
+		workers = 4
+	}
+	spooled := &spoolDriver{
+		Driver:  driver,
+		server:  server,
+		spool:   spool,
+		workers: make(chan struct{}, workers),
+		pending: make(map[string]*spoolItem),
+	}
+	server.spool = spooled
+	// keep the driver authentication
+	if auth, ok := driver.(Auth); ok {
+		return &spoolAuthDriver{spoolDriver: spooled, Auth: auth}
+	}
+	return spooled
+}
+
+func (driver *spoolDriver) item(p string) *spoolItem {
+	driver.lock.Lock()
+	defer driver.lock.Unlock()
+	return driver.pending[path.Join("/", p)]
+}
+
+// wait waits for the flush of the pending upload of the path
+func (driver *spoolDriver) wait(p string) {
+	if item := driver.item(p); item != nil {
+		<-item.done
+	}
+}
+
+func (driver *spoolDriver) flush(item *spoolItem) {
+	driver.workers <- struct{}{}
+	defer func() {
+		<-driver.workers
+	}()
+
+	var (
+		retries  = driver.spool.Retries
+		interval = driver.spool.RetryInterval
+		err      error
+	)
+	if retries <= 0 {
+		retries = 3
+	}
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	for i := 0; i <= retries; i++ {
+		if i > 0 && !driver.sleep(interval) {
+			break
+		}
+		var f *os.File
+		f, err = os.Open(item.file)
+		if err != nil {
+			break
+		}
+		_, err = driver.Driver.PutFile(item.ctx, item.path, f, -1)
+		f.Close()
+		if err == nil {
+			break
+		}
+		driver.server.logger.Printf("", "Flushing %s failed: %v", item.path, err)
+	}
+
+	// the failed upload stays pending, so that it's still served
+	if err == nil {
+		os.Remove(item.file)
+		driver.forget(item)
+	} else {
+		driver.server.logger.Printf("", "%s is kept in %s", item.path, item.file)
+	}
+	item.err = err
+	close(item.done)
+	driver.server.notifiers.AfterFileFlushed(item.ctx, item.path, item.size, err)
+}
+
+// sleep waits for the interval between the retries, it returns false if the
+// server is shut down meanwhile
+func (driver *spoolDriver) sleep(interval time.Duration) bool {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	var done <-chan struct{}
+	if driver.server.ctx != nil {
+		done = driver.server.ctx.Done()
+	}
+	select {
+	case <-timer.C:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// forget removes the item from the pending uploads unless it's replaced
+func (driver *spoolDriver) forget(item *spoolItem) {
+	driver.lock.Lock()
+	if driver.pending[item.path] == item {
+		delete(driver.pending, item.path)
+	}
+	driver.lock.Unlock()
+}
+
+// uploads returns the pending and the failed flushes
+func (driver *spoolDriver) uploads() []SpooledUpload {
+	driver.lock.Lock()
+	var items = make([]*spoolItem, 0, len(driver.pending))
+	for _, item := range driver.pending {
+		items = append(items, item)
+	}
+	driver.lock.Unlock()
+
+	var uploads = make([]SpooledUpload, 0, len(items))
+	for _, item := range items {
+		upload := SpooledUpload{
+			Path: item.path,
+			User: item.user,
+			File: item.file,
+			Size: item.size,
+		}
+		if err := item.failed(); err != nil {
+			upload.Error = err.Error()
+		}
+		uploads = append(uploads, upload)
+	}
+	sort.Slice(uploads, func(i, j int) bool {
+		return uploads[i].Path < uploads[j].Path
+	})
+	return uploads
+}
+
+// SpooledUploads returns the uploads spooled to the local disk which are
+// not flushed to the driver yet or whose flush failed, nil if Options.Spool
+// isn't set
+func (server *Server) SpooledUploads() []SpooledUpload {
+	if server.spool == nil {
+		return nil
+	}
+	return server.spool.uploads()
+}
+
+// SpoolHandler returns a handler serving as JSON the spooled uploads
+func (server *Server) SpoolHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploads := server.SpooledUploads()
+		if uploads == nil {
+			uploads = []SpooledUpload{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(uploads)
+	})
+}
+
+func (driver *spoolDriver) Stat(ctx *Context, p string) (os.FileInfo, error) {
+	if item := driver.item(p); item != nil {
+		info, err := os.Stat(item.file)
+		if err == nil {
+			return &aliasInfo{FileInfo: info, name: path.Base(item.path)}, nil
+		}
+	}
+	return driver.Driver.Stat(ctx, p)
+}
+
+func (driver *spoolDriver) ListDir(ctx *Context, p string, callback func(os.FileInfo) error) error {
+	var listed = make(map[string]bool)
+	err := driver.Driver.ListDir(ctx, p, func(info os.FileInfo) error {
+		listed[info.Name()] = true
+		return callback(info)
+	})
+	if err != nil {
+		return err
+	}
+
+	dir := path.Join("/", p)
+	driver.lock.Lock()
+	var items []*spoolItem
+	for _, item := range driver.pending {
+		if path.Dir(item.path) == dir && !listed[path.Base(item.path)] {
+			items = append(items, item)
+		}
+	}
+	driver.lock.Unlock()
+	for _, item := range items {
+		info, err := os.Stat(item.file)
+		if err != nil {
+			continue
+		}
+		if err := callback(&aliasInfo{FileInfo: info, name: path.Base(item.path)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (driver *spoolDriver) DeleteDir(ctx *Context, p string) error {
+	return driver.Driver.DeleteDir(ctx, p)
+}
+
+func (driver *spoolDriver) DeleteFile(ctx *Context, p string) error {
+	driver.wait(p)
+	// the upload whose flush failed is deleted from the spool
+	if item := driver.item(p); item != nil && item.failed() != nil {
+		driver.forget(item)
+		os.Remove(item.file)
+		if _, err := driver.Driver.Stat(ctx, p); err != nil {
+			return nil
+		}
+	}
+	return driver.Driver.DeleteFile(ctx, p)
+}
+
+func (driver *spoolDriver) Rename(ctx *Context, fromPath string, toPath string) error {
+	driver.wait(fromPath)
+	driver.wait(toPath)
+	return driver.Driver.Rename(ctx, fromPath, toPath)
+}
+
+func (driver *spoolDriver) GetFile(ctx *Context, p string, offset int64) (int64, io.ReadCloser, error) {
+	if item := driver.item(p); item != nil {
+		f, err := os.Open(item.file)
+		if err == nil {
+			if _, err := f.Seek(offset, io.SeekStart); err != nil {
+				f.Close()
+				return 0, nil, err
+			}
+			return item.size - offset, f, nil
+		}
+	}
+	return driver.Driver.GetFile(ctx, p, offset)
+}
+
+func (driver *spoolDriver) PutFile(ctx *Context, destPath string, data io.Reader, offset int64) (int64, error) {
+	// the previous upload of the file is flushed first
+	driver.wait(destPath)
+	if offset != -1 {
+		return driver.Driver.PutFile(ctx, destPath, data, offset)
+	}
+
+	f, err := ioutil.TempFile(driver.spool.Dir, "spool-")
+	if err != nil {
+		return 0, err
+	}
+	size, err := io.Copy(f, data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return size, err
+	}
+
+	// the flush outlives the transfer, so it isn't cancelled with it and
+	// doesn't share its data
+	flushCtx := *ctx
+	flushCtx.ctx = nil
+	flushCtx.Data = make(map[string]interface{}, len(ctx.Data))
+	for k, v := range ctx.Data {
+		flushCtx.Data[k] = v
+	}
+	item := &spoolItem{
+		ctx:  &flushCtx,
+		path: path.Join("/", destPath),
+		file: f.Name(),
+		size: size,
+		done: make(chan struct{}),
+	}
+	if ctx.Sess != nil {
+		item.user = ctx.Sess.LoginUser()
+	}
+	driver.lock.Lock()
+	prev := driver.pending[item.path]
+	driver.pending[item.path] = item
+	driver.lock.Unlock()
+	// the upload replaces the one whose flush failed
+	if prev != nil && prev.failed() != nil {
+		os.Remove(prev.file)
+	}
+	go driver.flush(item)
+	return size, nil
+}
+
+func (driver *spoolDriver) SetModTime(ctx *Context, p string, mtime time.Time) error {
+	driver.wait(p)
+	setter, ok := driver.Driver.(ModTimeSetter)
+	if !ok {
+		return errors.New("Not supported")
+	}
+	return setter.SetModTime(ctx, p, mtime)
+}
+
+// Versions implements Versioner
+func (driver *spoolDriver) Versions(ctx *Context, p string) ([]FileVersion, error) {
+	driver.wait(p)
+	versioner, ok := driver.Driver.(Versioner)
+	if !ok {
+		return nil, errVersionsNotSupported
+	}
+	return versioner.Versions(ctx, p)
+}
+
+// RestoreVersion implements Versioner
+func (driver *spoolDriver) RestoreVersion(ctx *Context, p string, id string) error {
+	driver.wait(p)
+	versioner, ok := driver.Driver.(Versioner)
+	if !ok {
+		return errVersionsNotSupported
+	}
+	return versioner.RestoreVersion(ctx, p, id)
+}
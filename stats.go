@@ -0,0 +1,177 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"goftp.io/server/v2/ratelimit"
+)
+
+// Stats is a snapshot of the state of the server
+type Stats struct {
+	// The number of the sessions
+	Sessions int
+
+	// The state of the rate limiter of the server, the transfers of all the
+	// sessions are accounted to it
+	RateLimit ratelimit.Stats
+
+	// The state of the share of the rate limit of the login sessions, by
+	// session ID
+	SessionRateLimits map[string]ratelimit.Stats
+
+	// The number of the sessions which negotiated each capability since the
+	// server started, i.e. CapabilityPASV
+	Capabilities map[string]int64
+
+	// The number of the unsupported commands received since the server
+	// started per command, see UnsupportedCommandOther
+	UnsupportedCommands map[string]int64
+
+	// The number of the sessions which announced each client software via
+	// CLNT since the server started, by name without the version, see
+	// ClientSoftwareOther
+	ClientSoftware map[string]int64
+
+	// The data transferred per user, see Options.BandwidthStore
+	Bandwidth map[string]UserBandwidth
+}
+
+// Stats returns a snapshot of the state of the server, it's safe to be
+// called while the server is running
+func (server *Server) Stats() Stats {
+	server.sessionsLock.RLock()
+	var infos = make([]SessionInfo, 0, len(server.sessions))
+	for _, sess := range server.sessions {
+		infos = append(infos, sess.Info())
+	}
+	server.sessionsLock.RUnlock()
+
+	var stats = Stats{
+		Sessions:            len(infos),
+		RateLimit:           server.rateLimiter.Stats(),
+		SessionRateLimits:   make(map[string]ratelimit.Stats),
+		Capabilities:        server.capabilityStats(),
+		UnsupportedCommands: server.unsupportedStats(),
+		ClientSoftware:      server.clientStats(),
+		Bandwidth:           server.bandwidth.stats(),
+	}
+	for _, info := range infos {
+		if info.limiter != nil {
+			stats.SessionRateLimits[info.ID] = info.limiter.Stats()
+		}
+	}
+	return stats
+}
+
+// MetricsHandler returns a handler serving the stats in the Prometheus text
+// format, i.e. to be mounted on /metrics
+func (server *Server) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		bw := bufio.NewWriter(w)
+		writeMetrics(bw, server.Stats())
+		_ = bw.Flush()
+	})
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writeMetrics writes the stats in the Prometheus text format
+func writeMetrics(w *bufio.Writer, stats Stats) {
+	var ids = make([]string, 0, len(stats.SessionRateLimits))
+	for id := range stats.SessionRateLimits {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	fmt.Fprintln(w, "# HELP ftp_sessions The number of the sessions.")
+	fmt.Fprintln(w, "# TYPE ftp_sessions gauge")
+	fmt.Fprintf(w, "ftp_sessions %d\n", stats.Sessions)
+
+	var metrics = []struct {
+		name, help, typ string
+		value           func(ratelimit.Stats) interface{}
+	}{
+		{"ftp_ratelimit_rate_bytes", "The current rate limit in bytes per second, 0 means no limit.", "gauge",
+			func(s ratelimit.Stats) interface{} { return s.Rate }},
+		{"ftp_ratelimit_tokens_bytes", "The bytes which could be transferred without waiting.", "gauge",
+			func(s ratelimit.Stats) interface{} { return s.Tokens }},
+		{"ftp_ratelimit_transferred_bytes_total", "The bytes transferred through the rate limiter.", "counter",
+			func(s ratelimit.Stats) interface{} { return s.Bytes }},
+		{"ftp_ratelimit_throttled_seconds_total", "How long the transfers waited for the rate limiter.", "counter",
+			func(s ratelimit.Stats) interface{} { return s.Throttled.Seconds() }},
+		{"ftp_ratelimit_backoffs_total", "The times the transfers were paused because the storage was throttling.", "counter",
+			func(s ratelimit.Stats) interface{} { return s.Backoffs }},
+	}
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", m.name, m.typ)
+		fmt.Fprintf(w, "%s{scope=\"server\"} %v\n", m.name, m.value(stats.RateLimit))
+		for _, id := range ids {
+			fmt.Fprintf(w, "%s{scope=\"session\",session=\"%s\"} %v\n", m.name, labelEscaper.Replace(id), m.value(stats.SessionRateLimits[id]))
+		}
+	}
+
+	var capabilities = make([]string, 0, len(stats.Capabilities))
+	for capability := range stats.Capabilities {
+		capabilities = append(capabilities, capability)
+	}
+	sort.Strings(capabilities)
+
+	fmt.Fprintln(w, "# HELP ftp_capability_sessions_total The sessions which negotiated the capability.")
+	fmt.Fprintln(w, "# TYPE ftp_capability_sessions_total counter")
+	for _, capability := range capabilities {
+		fmt.Fprintf(w, "ftp_capability_sessions_total{capability=\"%s\"} %d\n", labelEscaper.Replace(capability), stats.Capabilities[capability])
+	}
+
+	var commands = make([]string, 0, len(stats.UnsupportedCommands))
+	for command := range stats.UnsupportedCommands {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+
+	fmt.Fprintln(w, "# HELP ftp_unsupported_commands_total The unsupported commands received.")
+	fmt.Fprintln(w, "# TYPE ftp_unsupported_commands_total counter")
+	for _, command := range commands {
+		fmt.Fprintf(w, "ftp_unsupported_commands_total{command=\"%s\"} %d\n", labelEscaper.Replace(command), stats.UnsupportedCommands[command])
+	}
+
+	var clients = make([]string, 0, len(stats.ClientSoftware))
+	for client := range stats.ClientSoftware {
+		clients = append(clients, client)
+	}
+	sort.Strings(clients)
+
+	fmt.Fprintln(w, "# HELP ftp_client_sessions_total The sessions which announced the client software.")
+	fmt.Fprintln(w, "# TYPE ftp_client_sessions_total counter")
+	for _, client := range clients {
+		fmt.Fprintf(w, "ftp_client_sessions_total{client=\"%s\"} %d\n", labelEscaper.Replace(client), stats.ClientSoftware[client])
+	}
+
+	var users = make([]string, 0, len(stats.Bandwidth))
+	for user := range stats.Bandwidth {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+
+	fmt.Fprintln(w, "# HELP ftp_user_transferred_bytes_total The bytes transferred by the user.")
+	fmt.Fprintln(w, "# TYPE ftp_user_transferred_bytes_total counter")
+	for _, user := range users {
+		fmt.Fprintf(w, "ftp_user_transferred_bytes_total{user=\"%s\",direction=\"upload\"} %d\n", labelEscaper.Replace(user), stats.Bandwidth[user].Uploaded)
+		fmt.Fprintf(w, "ftp_user_transferred_bytes_total{user=\"%s\",direction=\"download\"} %d\n", labelEscaper.Replace(user), stats.Bandwidth[user].Downloaded)
+	}
+	fmt.Fprintln(w, "# HELP ftp_user_transfers_total The files transferred by the user.")
+	fmt.Fprintln(w, "# TYPE ftp_user_transfers_total counter")
+	for _, user := range users {
+		fmt.Fprintf(w, "ftp_user_transfers_total{user=\"%s\",direction=\"upload\"} %d\n", labelEscaper.Replace(user), stats.Bandwidth[user].Uploads)
+		fmt.Fprintf(w, "ftp_user_transfers_total{user=\"%s\",direction=\"download\"} %d\n", labelEscaper.Replace(user), stats.Bandwidth[user].Downloads)
+	}
+}
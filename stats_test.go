@@ -0,0 +1,89 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"goftp.io/server/v2/ratelimit"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	writeMetrics(w, Stats{
+		Sessions:  2,
+		RateLimit: ratelimit.Stats{Rate: 1000, Bytes: 300, Throttled: 1500 * time.Millisecond, Backoffs: 3},
+		SessionRateLimits: map[string]ratelimit.Stats{
+			"b": {Rate: 250, Bytes: 100},
+			"a": {Rate: 750, Tokens: 10, Bytes: 200},
+		},
+		Capabilities:        map[string]int64{CapabilityPASV: 1, CapabilityAuthTLS: 4},
+		UnsupportedCommands: map[string]int64{"XCRC": 2, UnsupportedCommandOther: 1},
+		ClientSoftware:      map[string]int64{"FileZilla": 3, "curl": 1},
+		Bandwidth:           map[string]UserBandwidth{"admin": {Uploaded: 10, Downloaded: 20, Uploads: 1, Downloads: 2}},
+	})
+	assert.NoError(t, w.Flush())
+
+	out := buf.String()
+	assert.Contains(t, out, "ftp_sessions 2\n")
+	assert.Contains(t, out, "# TYPE ftp_ratelimit_rate_bytes gauge\n"+
+		"ftp_ratelimit_rate_bytes{scope=\"server\"} 1000\n"+
+		"ftp_ratelimit_rate_bytes{scope=\"session\",session=\"a\"} 750\n"+
+		"ftp_ratelimit_rate_bytes{scope=\"session\",session=\"b\"} 250\n")
+	assert.Contains(t, out, "ftp_ratelimit_tokens_bytes{scope=\"session\",session=\"a\"} 10\n")
+	assert.Contains(t, out, "ftp_ratelimit_throttled_seconds_total{scope=\"server\"} 1.5\n")
+	assert.Contains(t, out, "ftp_ratelimit_backoffs_total{scope=\"server\"} 3\n")
+	assert.Contains(t, out, "ftp_ratelimit_transferred_bytes_total{scope=\"session\",session=\"b\"} 100\n")
+	assert.Contains(t, out, "# TYPE ftp_capability_sessions_total counter\n"+
+		"ftp_capability_sessions_total{capability=\"AUTH TLS\"} 4\n"+
+		"ftp_capability_sessions_total{capability=\"PASV\"} 1\n")
+	assert.Contains(t, out, "# TYPE ftp_unsupported_commands_total counter\n"+
+		"ftp_unsupported_commands_total{command=\"OTHER\"} 1\n"+
+		"ftp_unsupported_commands_total{command=\"XCRC\"} 2\n")
+	assert.Contains(t, out, "# TYPE ftp_client_sessions_total counter\n"+
+		"ftp_client_sessions_total{client=\"FileZilla\"} 3\n"+
+		"ftp_client_sessions_total{client=\"curl\"} 1\n")
+	assert.Contains(t, out, "ftp_user_transferred_bytes_total{user=\"admin\",direction=\"upload\"} 10\n"+
+		"ftp_user_transferred_bytes_total{user=\"admin\",direction=\"download\"} 20\n")
+	assert.Contains(t, out, "ftp_user_transfers_total{user=\"admin\",direction=\"download\"} 2\n")
+}
+
+func TestCountUnsupported(t *testing.T) {
+	var server Server
+	for i := 0; i < maxUnsupportedCommands+10; i++ {
+		server.countUnsupported(fmt.Sprintf("X%c%c", 'A'+i/26, 'A'+i%26))
+	}
+	server.countUnsupported("XAA")
+	server.countUnsupported("NOT A COMMAND")
+
+	stats := server.unsupportedStats()
+	assert.Len(t, stats, maxUnsupportedCommands+1)
+	assert.EqualValues(t, 2, stats["XAA"])
+	assert.EqualValues(t, 11, stats[UnsupportedCommandOther])
+}
+
+func TestCountClient(t *testing.T) {
+	var server Server
+	server.countClient("FileZilla 3.50.0")
+	server.countClient("FileZilla 3.51.0")
+	server.countClient("")
+	server.countClient(strings.Repeat("x", maxClientNameLength+1))
+	for i := 0; i < maxClientSoftware+10; i++ {
+		server.countClient(fmt.Sprintf("client%d 1.0", i))
+	}
+
+	stats := server.clientStats()
+	assert.Len(t, stats, maxClientSoftware)
+	assert.EqualValues(t, 2, stats["FileZilla"])
+	assert.EqualValues(t, 13, stats[ClientSoftwareOther])
+}
@@ -0,0 +1,114 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// Symlinker is an optional interface a Driver could implement to create the
+// symbolic links via SITE SYMLINK and to report their targets in LIST and
+// MLSD. The listed links are the infos of the Driver with os.ModeSymlink.
+type Symlinker interface {
+	// params  - the context, the absolute path the link points to and the
+	//           path of the link
+	// returns - any error encountered
+	Symlink(ctx *Context, target, link string) error
+
+	// params  - the context, the path of the link
+	// returns - the absolute path the link points to or any error
+	//           encountered, i.e. if it points out of the storage
+	Readlink(ctx *Context, link string) (string, error)
+}
+
+func isSymlinker(driver Driver) bool {
+	_, ok := driver.(Symlinker)
+	return ok
+}
+
+// withLinkTarget sets the target of the listed link, if the driver reports
+// it
+func (sess *Session) withLinkTarget(ctx *Context, info FileInfo, p string) FileInfo {
+	f, ok := info.(*fileInfo)
+	if !ok || f.mode&os.ModeSymlink == 0 {
+		return info
+	}
+	driver, mapPath := optionalDriver(sess.server.Driver, isSymlinker)
+	if driver == nil {
+		return info
+	}
+	target, err := driver.(Symlinker).Readlink(ctx, mapPath(p))
+	if err != nil {
+		sess.debugf("%v", err)
+		return info
+	}
+	f.target = target
+	return f
+}
+
+// linkTarget returns the target of the listed link, empty if unknown
+func linkTarget(info FileInfo) string {
+	if f, ok := info.(*fileInfo); ok {
+		return f.target
+	}
+	return ""
+}
+
+// siteSymlink responds to the SITE SYMLINK command of proftpd. It creates a
+// symbolic link, a relative target is relative to the directory of the
+// link as for ln -s:
+//
+//	SITE SYMLINK target link
+type siteSymlink struct{}
+
+func (cmd siteSymlink) RequireParam() bool {
+	return true
+}
+
+func (cmd siteSymlink) Execute(sess *Session, param string) {
+	driver, mapPath := optionalDriver(sess.server.Driver, isSymlinker)
+	if driver == nil {
+		sess.writeMessage(502, "SITE SYMLINK is not supported by the driver")
+		return
+	}
+
+	parts := strings.SplitN(strings.TrimSpace(param), " ", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+		sess.writeMessage(501, fmt.Sprintf("invalid SITE SYMLINK param %q", param))
+		return
+	}
+	link, ok := sess.sanitizePath(sess.buildPath(strings.TrimSpace(parts[1])))
+	if !ok {
+		return
+	}
+	if !sess.checkPathLimits("SITE SYMLINK", param, link) {
+		return
+	}
+	target := parts[0]
+	if !path.IsAbs(target) {
+		target = path.Join(path.Dir(link), target)
+	}
+	// the files of the write-only directories are not readable by a link
+	var ctx = &Context{
+		Sess:  sess,
+		Cmd:   "SITE SYMLINK",
+		Param: param,
+		Data:  make(map[string]interface{}),
+	}
+	if !sess.checkWriteOnly(path.Clean(target)) || !sess.checkTrash(path.Clean(target)) || !sess.checkTrashWrite(ctx, link) {
+		return
+	}
+
+	err := driver.(Symlinker).Symlink(ctx, mapPath(path.Clean(target)), mapPath(link))
+	if err != nil {
+		sess.logf("%v", err)
+		sess.writeMessage(550, fmt.Sprint("Action not taken: ", err))
+		return
+	}
+	sess.writeMessage(200, "SITE SYMLINK command successful")
+}
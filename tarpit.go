@@ -0,0 +1,140 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// Tarpit represents the delays applied before replying to failed logins, the
+// delay doubles with every failure of the connection or of the source IP,
+// whichever is greater, so dictionary attacks are slowed down without
+// locking out the users making a typo.
+type Tarpit struct {
+	// The delay of the first failure
+	Delay time.Duration
+
+	// The maximum delay, 0 means no maximum
+	MaxDelay time.Duration
+
+	// The duration after which the failures of a source IP are forgotten,
+	// if 0 they are forgotten after 10 minutes
+	Window time.Duration
+}
+
+const defaultTarpitWindow = 10 * time.Minute
+
+type tarpitEntry struct {
+	failures int
+	last     time.Time
+}
+
+// tarpitState tracks the failed logins per source IP
+type tarpitState struct {
+	*Tarpit
+	lock    sync.Mutex
+	entries map[string]*tarpitEntry
+}
+
+func newTarpitState(tarpit *Tarpit) *tarpitState {
+	if tarpit == nil {
+		return nil
+	}
+	return &tarpitState{
+		Tarpit:  tarpit,
+		entries: make(map[string]*tarpitEntry),
+	}
+}
+
+func (t *tarpitState) window() time.Duration {
+	if t.Window > 0 {
+		return t.Window
+	}
+	return defaultTarpitWindow
+}
+
+// fail records a failed login of the IP and returns the failures of it
+func (t *tarpitState) fail(ip string) int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := time.Now()
+	for k, e := range t.entries {
+		if now.Sub(e.last) > t.window() {
+			delete(t.entries, k)
+		}
+	}
+
+	e := t.entries[ip]
+	if e == nil {
+		e = &tarpitEntry{}
+		t.entries[ip] = e
+	}
+	e.failures++
+	e.last = now
+	return e.failures
+}
+
+// reset forgets the failures of the IP
+func (t *tarpitState) reset(ip string) {
+	t.lock.Lock()
+	delete(t.entries, ip)
+	t.lock.Unlock()
+}
+
+// delay returns the delay applied after the given number of failures
+func (t *tarpitState) delay(failures int) time.Duration {
+	if failures <= 0 || t.Delay <= 0 {
+		return 0
+	}
+	d := t.Delay
+	// stop doubling at the maximum delay, or before overflowing if there is
+	// no maximum
+	for i := 1; i < failures && d <= math.MaxInt64/2 && (t.MaxDelay <= 0 || d < t.MaxDelay); i++ {
+		d *= 2
+	}
+	if t.MaxDelay > 0 && d > t.MaxDelay {
+		d = t.MaxDelay
+	}
+	return d
+}
+
+// remoteIP returns the IP of the client without the port
+func (sess *Session) remoteIP() string {
+	addr := sess.RemoteAddr().String()
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// loginFailed records a failed login and waits for the tarpit delay
+func (sess *Session) loginFailed() {
+	sess.loginFailures++
+	tarpit := sess.server.tarpit
+	if tarpit == nil {
+		return
+	}
+	failures := tarpit.fail(sess.remoteIP())
+	if sess.loginFailures > failures {
+		failures = sess.loginFailures
+	}
+	if d := tarpit.delay(failures); d > 0 {
+		sess.debugf("Delaying the failed login reply for %v", d)
+		time.Sleep(d)
+	}
+}
+
+// loginSucceeded forgets the failed logins of the session
+func (sess *Session) loginSucceeded() {
+	sess.loginFailures = 0
+	if sess.server.tarpit != nil {
+		sess.server.tarpit.reset(sess.remoteIP())
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTarpit(t *testing.T) {
+	tarpit := newTarpitState(&Tarpit{
+		Delay:    time.Second,
+		MaxDelay: 5 * time.Second,
+	})
+
+	assert.EqualValues(t, 0, tarpit.delay(0))
+	assert.EqualValues(t, time.Second, tarpit.delay(1))
+	assert.EqualValues(t, 2*time.Second, tarpit.delay(2))
+	assert.EqualValues(t, 4*time.Second, tarpit.delay(3))
+	assert.EqualValues(t, 5*time.Second, tarpit.delay(4))
+	assert.EqualValues(t, 5*time.Second, tarpit.delay(100))
+
+	// without maximum the delay never overflows
+	tarpit.MaxDelay = 0
+	assert.EqualValues(t, 8*time.Second, tarpit.delay(4))
+	tarpit.Delay = time.Hour
+	for _, failures := range []int{31, 33, 40, 64, 100, math.MaxInt32} {
+		assert.True(t, tarpit.delay(failures) >= tarpit.delay(failures-1), failures)
+	}
+	tarpit.Delay = time.Second
+	tarpit.MaxDelay = 5 * time.Second
+
+	assert.EqualValues(t, 1, tarpit.fail("127.0.0.1"))
+	assert.EqualValues(t, 2, tarpit.fail("127.0.0.1"))
+	assert.EqualValues(t, 1, tarpit.fail("127.0.0.2"))
+	tarpit.reset("127.0.0.1")
+	assert.EqualValues(t, 1, tarpit.fail("127.0.0.1"))
+
+	tarpit.Window = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	assert.EqualValues(t, 1, tarpit.fail("127.0.0.2"))
+
+	assert.Nil(t, newTarpitState(nil))
+}
@@ -0,0 +1,306 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	containerlist "container/list"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // register the GIF decoder
+	"image/jpeg"
+	_ "image/png" // register the PNG decoder
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// Thumbnailer creates the previews of the images returned by THMB
+type Thumbnailer interface {
+	// Thumbnail returns the preview of the image read from r, which fits in
+	// a square of size pixels
+	Thumbnail(ctx *Context, p string, r io.Reader, size int) ([]byte, error)
+}
+
+// Thumbnails represents the previews of the images returned by the THMB
+// command, i.e. to the media ingest tools of the cameras:
+//
+//	THMB path
+//	150 Sending thumbnail 4096 bytes
+//	226 Closing data connection, sent 4096 bytes
+//
+// The preview is sent over the data connection like RETR sends a file.
+type Thumbnails struct {
+	// The creator of the previews, if nil it's JPEGThumbnailer
+	Thumbnailer Thumbnailer
+
+	// The size of the square the previews fit in, if 0 it's 160 pixels
+	Size int
+
+	// The bytes of the images read, if 0 it's 32MiB. Larger images are
+	// refused.
+	MaxBytes int64
+
+	// The number of previews cached, if 0 it's 256, a negative number
+	// disables the cache. The previews are cached per path, size and
+	// modification time of the image.
+	CacheSize int
+}
+
+const (
+	defaultThumbnailSize      = 160
+	defaultThumbnailMaxBytes  = 32 * 1024 * 1024
+	defaultThumbnailCacheSize = 256
+
+	// the images are decoded in memory, so the larger ones are refused
+	maxThumbnailPixels = 64 * 1024 * 1024
+)
+
+var (
+	errImageTooLarge = errors.New("Image too large")
+	errNotAnImage    = errors.New("Not a supported image")
+)
+
+func (thumbnails *Thumbnails) thumbnailer() Thumbnailer {
+	if thumbnails.Thumbnailer == nil {
+		return JPEGThumbnailer{}
+	}
+	return thumbnails.Thumbnailer
+}
+
+func (thumbnails *Thumbnails) size() int {
+	if thumbnails.Size <= 0 {
+		return defaultThumbnailSize
+	}
+	return thumbnails.Size
+}
+
+func (thumbnails *Thumbnails) maxBytes() int64 {
+	if thumbnails.MaxBytes <= 0 {
+		return defaultThumbnailMaxBytes
+	}
+	return thumbnails.MaxBytes
+}
+
+func (thumbnails *Thumbnails) cacheSize() int {
+	if thumbnails.CacheSize == 0 {
+		return defaultThumbnailCacheSize
+	}
+	return thumbnails.CacheSize
+}
+
+// JPEGThumbnailer is a Thumbnailer decoding the JPEG, PNG and GIF images
+// and encoding their previews as JPEG
+type JPEGThumbnailer struct {
+	// The JPEG quality of the previews, if 0 it's 75
+	Quality int
+}
+
+// Thumbnail implements Thumbnailer
+func (thumbnailer JPEGThumbnailer) Thumbnail(ctx *Context, p string, r io.Reader, size int) ([]byte, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if int64(config.Width)*int64(config.Height) > maxThumbnailPixels {
+		return nil, errImageTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	quality := thumbnailer.Quality
+	if quality <= 0 {
+		quality = jpeg.DefaultQuality
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, downscale(img, size), &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// downscale returns the image shrunk to fit in a square of size pixels, every
+// pixel being the average of the pixels it covers
+func downscale(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= size && h <= size {
+		return img
+	}
+	tw, th := size, size
+	if w > h {
+		th = h * size / w
+	} else {
+		tw = w * size / h
+	}
+	if tw < 1 {
+		tw = 1
+	}
+	if th < 1 {
+		th = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := bounds.Min.Y+y*h/th, bounds.Min.Y+(y+1)*h/th
+		for x := 0; x < tw; x++ {
+			x0, x1 := bounds.Min.X+x*w/tw, bounds.Min.X+(x+1)*w/tw
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, b, a, n = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(b / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+	return dst
+}
+
+// thumbnailCache is a LRU cache of the previews
+type thumbnailCache struct {
+	lock    sync.Mutex
+	order   *containerlist.List // the keys, the most recently used first
+	entries map[string]*containerlist.Element
+}
+
+type thumbnailCacheEntry struct {
+	key  string
+	data []byte
+}
+
+func (cache *thumbnailCache) get(key string) ([]byte, bool) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	elem, ok := cache.entries[key]
+	if !ok {
+		return nil, false
+	}
+	cache.order.MoveToFront(elem)
+	return elem.Value.(*thumbnailCacheEntry).data, true
+}
+
+func (cache *thumbnailCache) put(key string, data []byte, size int) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	if cache.entries == nil {
+		cache.order = containerlist.New()
+		cache.entries = make(map[string]*containerlist.Element)
+	}
+	if elem, ok := cache.entries[key]; ok {
+		elem.Value.(*thumbnailCacheEntry).data = data
+		cache.order.MoveToFront(elem)
+		return
+	}
+	cache.entries[key] = cache.order.PushFront(&thumbnailCacheEntry{key: key, data: data})
+	for cache.order.Len() > size {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		delete(cache.entries, oldest.Value.(*thumbnailCacheEntry).key)
+	}
+}
+
+// thumbnail returns the preview of the image, from the cache if the image
+// didn't change since it was created
+func (sess *Session) thumbnail(ctx *Context, p string) ([]byte, error) {
+	thumbnails := sess.server.Thumbnails
+	info, err := sess.server.Driver.Stat(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, errors.New("Not a file")
+	}
+	if info.Size() > thumbnails.maxBytes() {
+		return nil, errImageTooLarge
+	}
+
+	size := thumbnails.size()
+	key := fmt.Sprintf("%s:%d:%d:%d", p, size, info.Size(), info.ModTime().UnixNano())
+	cacheSize := thumbnails.cacheSize()
+	if cacheSize > 0 {
+		if data, ok := sess.server.thumbnails.get(key); ok {
+			return data, nil
+		}
+	}
+
+	_, r, err := sess.server.Driver.GetFile(ctx, p, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := thumbnails.thumbnailer().Thumbnail(ctx, p, io.LimitReader(r, thumbnails.maxBytes()), size)
+	if err != nil {
+		sess.logf("thumbnail of %s failed: %v", p, err)
+		return nil, errNotAnImage
+	}
+	if cacheSize > 0 {
+		sess.server.thumbnails.put(key, data, cacheSize)
+	}
+	return data, nil
+}
+
+// commandThmb responds to the THMB FTP command. It sends the preview of an
+// image over the data connection, see Thumbnails.
+type commandThmb struct{}
+
+func (cmd commandThmb) IsExtend() bool {
+	return false
+}
+
+func (cmd commandThmb) RequireParam() bool {
+	return true
+}
+
+func (cmd commandThmb) RequireAuth() bool {
+	return true
+}
+
+func (cmd commandThmb) Execute(sess *Session, param string) {
+	if sess.server.Thumbnails == nil {
+		sess.writeMessage(502, "Thumbnails are disabled")
+		return
+	}
+	p := sess.buildPath(param)
+	ctx := &Context{
+		Sess:  sess,
+		Cmd:   "THMB",
+		Param: param,
+		Data:  make(map[string]interface{}),
+	}
+	start := time.Now()
+	data, err := sess.thumbnail(ctx, p)
+	if err != nil {
+		if err == errImageTooLarge || err == errNotAnImage {
+			sess.writeMessage(550, fmt.Sprint("Action not taken: ", err))
+		} else {
+			sess.logf("%v", err)
+			sess.writeMessage(550, "File not available")
+		}
+		return
+	}
+
+	sess.writeMessage(150, fmt.Sprintf("Sending thumbnail %d bytes", len(data)))
+	if _, err := sess.sendOutofBandDataWriter(ioutil.NopCloser(bytes.NewReader(data))); err != nil {
+		sess.logf("%v", err)
+		sess.writeMessage(551, "Error reading file")
+		return
+	}
+	sess.debugf("thumbnail of %s sent in %v", p, time.Since(start))
+}
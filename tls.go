@@ -0,0 +1,119 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"time"
+)
+
+// TLSInfo describes the TLS connection of a session, so that the weak
+// protocol versions or the cipher suites still in use could be spotted
+type TLSInfo struct {
+	Version       string `json:"version"`                  // i.e. "TLS 1.3"
+	CipherSuite   string `json:"cipher_suite"`             // i.e. "TLS_AES_128_GCM_SHA256"
+	ServerName    string `json:"server_name,omitempty"`    // the SNI sent by the client
+	ClientSubject string `json:"client_subject,omitempty"` // the subject of the client certificate
+}
+
+// TLSNotifier is an optional interface a Notifier could implement to
+// receive the TLS handshakes of the control connections, both AUTH TLS and
+// the implicit FTPS ones. The info is nil if the handshake failed.
+type TLSNotifier interface {
+	AfterTLSHandshake(ctx *Context, info *TLSInfo, err error)
+}
+
+func (notifiers notifierList) AfterTLSHandshake(ctx *Context, info *TLSInfo, err error) {
+	for _, notifier := range notifiers {
+		if n, ok := notifier.(TLSNotifier); ok {
+			n.AfterTLSHandshake(ctx, info, err)
+		}
+	}
+}
+
+var tlsVersionNames = map[uint16]string{
+	tls.VersionTLS10: "TLS 1.0",
+	tls.VersionTLS11: "TLS 1.1",
+	tls.VersionTLS12: "TLS 1.2",
+	tls.VersionTLS13: "TLS 1.3",
+}
+
+var cipherSuiteNames = map[uint16]string{
+	tls.TLS_RSA_WITH_RC4_128_SHA:                "TLS_RSA_WITH_RC4_128_SHA",
+	tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA:           "TLS_RSA_WITH_3DES_EDE_CBC_SHA",
+	tls.TLS_RSA_WITH_AES_128_CBC_SHA:            "TLS_RSA_WITH_AES_128_CBC_SHA",
+	tls.TLS_RSA_WITH_AES_256_CBC_SHA:            "TLS_RSA_WITH_AES_256_CBC_SHA",
+	tls.TLS_RSA_WITH_AES_128_CBC_SHA256:         "TLS_RSA_WITH_AES_128_CBC_SHA256",
+	tls.TLS_RSA_WITH_AES_128_GCM_SHA256:         "TLS_RSA_WITH_AES_128_GCM_SHA256",
+	tls.TLS_RSA_WITH_AES_256_GCM_SHA384:         "TLS_RSA_WITH_AES_256_GCM_SHA384",
+	tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA:        "TLS_ECDHE_ECDSA_WITH_RC4_128_SHA",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA:    "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA:    "TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA",
+	tls.TLS_ECDHE_RSA_WITH_RC4_128_SHA:          "TLS_ECDHE_RSA_WITH_RC4_128_SHA",
+	tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA:     "TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA",
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA:      "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA",
+	tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA:      "TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256: "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256",
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256:   "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256",
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256:   "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256: "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384:   "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384: "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305:    "TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305",
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305:  "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305",
+	tls.TLS_AES_128_GCM_SHA256:                  "TLS_AES_128_GCM_SHA256",
+	tls.TLS_AES_256_GCM_SHA384:                  "TLS_AES_256_GCM_SHA384",
+	tls.TLS_CHACHA20_POLY1305_SHA256:            "TLS_CHACHA20_POLY1305_SHA256",
+}
+
+func newTLSInfo(state tls.ConnectionState) *TLSInfo {
+	info := &TLSInfo{
+		Version:     tlsVersionNames[state.Version],
+		CipherSuite: cipherSuiteNames[state.CipherSuite],
+		ServerName:  state.ServerName,
+	}
+	if info.Version == "" {
+		info.Version = fmt.Sprintf("0x%04x", state.Version)
+	}
+	if info.CipherSuite == "" {
+		info.CipherSuite = fmt.Sprintf("0x%04x", state.CipherSuite)
+	}
+	if len(state.PeerCertificates) > 0 {
+		info.ClientSubject = state.PeerCertificates[0].Subject.String()
+	}
+	return info
+}
+
+// handshakeTLS completes the handshake of the TLS control connection and
+// notifies it
+func (sess *Session) handshakeTLS(conn *tls.Conn, cmd string) error {
+	ctx := &Context{
+		Sess: sess,
+		Cmd:  cmd,
+		Data: make(map[string]interface{}),
+	}
+	if timeout := sess.idleTimeout(); timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(timeout))
+		defer conn.SetDeadline(time.Time{})
+	}
+	if err := conn.Handshake(); err != nil {
+		sess.server.notifiers.AfterTLSHandshake(ctx, nil, err)
+		return err
+	}
+	info := newTLSInfo(conn.ConnectionState())
+	sess.updateInfo(func(sessInfo *SessionInfo) {
+		sessInfo.TLS = info
+	})
+	sess.debugf("TLS handshake completed: %s %s", info.Version, info.CipherSuite)
+	sess.server.notifiers.AfterTLSHandshake(ctx, info, nil)
+	return nil
+}
+
+// TLS returns the details of the TLS control connection, nil if it's not
+// encrypted, i.e. for the notifiers to record them in AfterUserLogin
+func (sess *Session) TLS() *TLSInfo {
+	return sess.Info().TLS
+}
@@ -0,0 +1,280 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errTransferAborted is the error of the transfers aborted by the client
+var errTransferAborted = errors.New("Transfer aborted")
+
+// controlLine is a line read from the control connection
+type controlLine struct {
+	line string
+	err  error
+}
+
+// requestLine returns the channel receiving the next line of the control
+// connection, a new read is only started if there is no pending one. The
+// caller receiving the line must reset sess.control.
+func (sess *Session) requestLine() chan controlLine {
+	if sess.control == nil {
+		var (
+			ch     = make(chan controlLine, 1)
+			reader = sess.controlReader
+		)
+		sess.control = ch
+		go func() {
+			line, err := reader.ReadString('\n')
+			ch <- controlLine{line, err}
+		}()
+	}
+	return sess.control
+}
+
+// readLine returns the next command line, the lines received during a
+// transfer are returned first
+func (sess *Session) readLine() (string, error) {
+	if len(sess.queued) > 0 {
+		line := sess.queued[0]
+		sess.queued = sess.queued[1:]
+		return line, nil
+	}
+	l := <-sess.requestLine()
+	sess.control = nil
+	return l.line, l.err
+}
+
+// transfer represents a data transfer in progress, the control connection
+// is watched for ABOR, NOOP and STAT while it runs
+type transfer struct {
+	sess     *Session
+	cmd      string
+	path     string
+	data     DataSocket
+	segments []*passiveSocket // the data connections of SITE SEGRETR
+	cancel   context.CancelFunc
+	done     chan struct{}
+	wg       sync.WaitGroup
+	aborted  bool
+	bytes    int64 // updated atomically
+}
+
+// startTransfer starts to watch the control connection, the context of ctx
+// is cancelled if the transfer is aborted
+func (sess *Session) startTransfer(ctx *Context) *transfer {
+	// the data connection opened by Options.DataChannel must be known to
+	// abort the transfer
+	if err := sess.openDataChannel(); err != nil {
+		sess.log(err)
+	}
+	return sess.watchTransfer(ctx, &transfer{
+		sess: sess,
+		cmd:  ctx.Cmd,
+		path: sess.buildPath(ctx.Param),
+		data: sess.dataConn,
+		done: make(chan struct{}),
+	})
+}
+
+// startSegmentedTransfer is startTransfer for SITE SEGRETR, the data
+// connections of the segments are closed if the transfer is aborted
+func (sess *Session) startSegmentedTransfer(ctx *Context) *transfer {
+	return sess.watchTransfer(ctx, &transfer{
+		sess:     sess,
+		cmd:      ctx.Cmd,
+		path:     sess.buildPath(ctx.Param),
+		segments: sess.segments,
+		done:     make(chan struct{}),
+	})
+}
+
+func (sess *Session) watchTransfer(ctx *Context, tr *transfer) *transfer {
+	ctx.ctx, tr.cancel = context.WithCancel(context.Background())
+
+	// the control connection is read during the whole transfer, and the
+	// idle timeout doesn't apply to a session transferring data
+	_ = sess.conn.SetReadDeadline(time.Time{})
+	if sess.isKicked() {
+		// the deadline set by kick must not be cleared
+		sess.kick()
+	}
+	tr.wg.Add(1)
+	go tr.watch()
+	return tr
+}
+
+func (tr *transfer) watch() {
+	defer tr.wg.Done()
+	sess := tr.sess
+	for {
+		var l controlLine
+		select {
+		case l = <-sess.requestLine():
+		case <-tr.done:
+			return
+		}
+		if l.err != nil {
+			// the control connection is gone, the error is left to the
+			// command loop
+			sess.control <- l
+			tr.abort()
+			return
+		}
+		sess.control = nil
+
+		// the rejected lines are queued, they are rejected once the
+		// transfer completes
+		command, param, _ := sess.parseLine(l.line)
+		switch strings.ToUpper(command) {
+		case "ABOR":
+			sess.logger.PrintCommand(sess.id, command, "")
+			sess.recorder.command(command, "")
+			// the transfer replies 226 to ABOR once it's stopped
+			sess.audit(command, "", sess.user, 226, time.Now())
+			tr.aborted = true
+			tr.abort()
+			return
+		case "NOOP":
+			sess.logger.PrintCommand(sess.id, command, param)
+			sess.recorder.command(command, param)
+			start := time.Now()
+			sess.writeMessage(200, "OK")
+			sess.audit(command, param, sess.user, 200, start)
+		case "STAT":
+			if param != "" {
+				sess.queued = append(sess.queued, l.line)
+				continue
+			}
+			sess.logger.PrintCommand(sess.id, command, param)
+			sess.recorder.command(command, param)
+			start := time.Now()
+			sess.writeMessageLines(213, "Status of the transfer:", []string{
+				fmt.Sprintf("%s %s: %d bytes transferred", tr.cmd, tr.path, atomic.LoadInt64(&tr.bytes)),
+			}, "End of status")
+			sess.audit(command, param, sess.user, 213, start)
+		default:
+			// the other commands are executed once the transfer completes
+			sess.queued = append(sess.queued, l.line)
+		}
+	}
+}
+
+// countReader counts the bytes transferred reading from r
+type countReader struct {
+	r     io.Reader
+	count *int64
+}
+
+func (r countReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	atomic.AddInt64(r.count, int64(n))
+	return n, err
+}
+
+// reader returns a reader counting the bytes transferred reading from r
+func (tr *transfer) reader(r io.Reader) io.Reader {
+	return countReader{r, &tr.bytes}
+}
+
+// readCloser is like reader for a ReadCloser
+func (tr *transfer) readCloser(r io.ReadCloser) io.ReadCloser {
+	return readCloser{tr.reader(r), r}
+}
+
+// abort cancels the driver operation and closes the data connection
+func (tr *transfer) abort() {
+	tr.cancel()
+	if tr.data != nil {
+		tr.data.Close()
+	}
+	for _, socket := range tr.segments {
+		socket.Close()
+	}
+}
+
+// stop stops to watch the control connection, it returns whether the client
+// aborted the transfer
+func (tr *transfer) stop() bool {
+	close(tr.done)
+	tr.wg.Wait()
+	tr.cancel()
+	return tr.aborted
+}
+
+// stoppedUpload records the offset the failed upload of p stopped at, so
+// that the client could resume it with REST. It's the size of the file stored
+// by the driver, the data the driver buffered but didn't store has to be sent
+// again.
+func (sess *Session) stoppedUpload(ctx *Context, p string) int64 {
+	var offset int64
+	if info, err := sess.server.Driver.Stat(ctx, p); err == nil && !info.IsDir() {
+		offset = info.Size()
+	}
+	sess.stopPath = p
+	sess.stopOffset = offset
+	return offset
+}
+
+// checkResume reports whether the upload of p could start, an upload
+// resuming a failed one must not start after the offset the failed one
+// stopped at
+func (sess *Session) checkResume(p string) bool {
+	defer func() {
+		sess.stopPath = ""
+	}()
+	if sess.stopPath != p || sess.preCommand != "REST" || sess.lastFilePos <= sess.stopOffset {
+		return true
+	}
+	sess.writeMessage(554, fmt.Sprintf("Requested action not taken: invalid REST parameter, the transfer stopped at offset %d", sess.stopOffset))
+	return false
+}
+
+// replyAborted replies to an aborted transfer, which stopped at the offset,
+// then to the ABOR command. The offset of a download is the one of the bytes
+// written to the data connection, not the ones read from the driver.
+func (sess *Session) replyAborted(completed bool, offset int64) {
+	if sess.dataConn != nil {
+		sess.dataConn.Close()
+		sess.dataConn = nil
+	}
+	if !completed {
+		sess.writeMessage(426, fmt.Sprintf("Connection closed; transfer aborted at offset %d", offset))
+	}
+	sess.writeMessage(226, "ABOR command successful")
+}
+
+// commandAbor responds to the ABOR FTP command. ABOR received during a
+// transfer is handled by the transfer, the command only closes the data
+// connection if any.
+type commandAbor struct{}
+
+func (cmd commandAbor) IsExtend() bool {
+	return false
+}
+
+func (cmd commandAbor) RequireParam() bool {
+	return false
+}
+
+func (cmd commandAbor) RequireAuth() bool {
+	return true
+}
+
+func (cmd commandAbor) Execute(sess *Session, param string) {
+	if sess.dataConn != nil {
+		sess.dataConn.Close()
+		sess.dataConn = nil
+	}
+	sess.writeMessage(226, "No transfer to abort")
+}
@@ -0,0 +1,226 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// QuotaPeriod represents the period the bytes transferred by an user are
+// accounted over
+type QuotaPeriod int
+
+// The periods of the transfer quotas, they start at midnight of the local
+// time of the server
+const (
+	QuotaDaily QuotaPeriod = iota
+	QuotaMonthly
+)
+
+func (period QuotaPeriod) String() string {
+	if period == QuotaMonthly {
+		return "monthly"
+	}
+	return "daily"
+}
+
+// start returns the start of the period including now
+func (period QuotaPeriod) start(now time.Time) time.Time {
+	year, month, day := now.Date()
+	if period == QuotaMonthly {
+		day = 1
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, now.Location())
+}
+
+// TransferQuota represents the bytes an user could transfer per period, i.e.
+// for the metered partner accounts, a zero limit means unlimited. Once a
+// limit is reached the transfers in that direction are refused with 552
+// until the next period, the transfers already started are completed.
+type TransferQuota struct {
+	Period        QuotaPeriod
+	UploadLimit   int64
+	DownloadLimit int64
+}
+
+// TransferUsage represents the bytes transferred by an user during the
+// current period of the quota
+type TransferUsage struct {
+	User          string
+	Period        string
+	Since         time.Time
+	Uploaded      int64
+	Downloaded    int64
+	UploadLimit   int64
+	DownloadLimit int64
+}
+
+// TransferUsageStore is an optional interface an Auth could implement to
+// persist the bytes transferred by the users along with their accounts, so
+// that the transfer quotas survive the restarts and are shared by the
+// servers. The usage is kept in memory otherwise.
+type TransferUsageStore interface {
+	// params  - the context, the user name and the start of the period
+	// returns - the bytes uploaded and downloaded since the start or any
+	//           error encountered
+	TransferUsage(ctx *Context, userName string, since time.Time) (int64, int64, error)
+
+	// params  - the context, the user name, the start of the period and the
+	//           bytes uploaded and downloaded to add
+	// returns - any error encountered
+	AddTransferUsage(ctx *Context, userName string, since time.Time, uploaded, downloaded int64) error
+}
+
+var _ TransferUsageStore = &memoryUsageStore{}
+
+// memoryUsageStore keeps the usage of the current period of the users
+type memoryUsageStore struct {
+	lock   sync.Mutex
+	usages map[string]TransferUsage
+}
+
+func (store *memoryUsageStore) TransferUsage(ctx *Context, userName string, since time.Time) (int64, int64, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	usage, ok := store.usages[userName]
+	if !ok || !usage.Since.Equal(since) {
+		return 0, 0, nil
+	}
+	return usage.Uploaded, usage.Downloaded, nil
+}
+
+func (store *memoryUsageStore) AddTransferUsage(ctx *Context, userName string, since time.Time, uploaded, downloaded int64) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if store.usages == nil {
+		store.usages = make(map[string]TransferUsage)
+	}
+	usage, ok := store.usages[userName]
+	if !ok || !usage.Since.Equal(since) {
+		// the previous periods are forgotten
+		usage = TransferUsage{Since: since}
+	}
+	usage.Uploaded += uploaded
+	usage.Downloaded += downloaded
+	store.usages[userName] = usage
+	return nil
+}
+
+// usageStore returns where the usage of the users is kept
+func (server *Server) usageStore() TransferUsageStore {
+	if store, ok := server.Auth.(TransferUsageStore); ok {
+		return store
+	}
+	return &server.transferUsages
+}
+
+// transferUsage returns the usage of the current period of the user under
+// the quota
+func (server *Server) transferUsage(ctx *Context, userName string, quota *TransferQuota) (*TransferUsage, error) {
+	since := quota.Period.start(time.Now())
+	uploaded, downloaded, err := server.usageStore().TransferUsage(ctx, userName, since)
+	if err != nil {
+		return nil, err
+	}
+	return &TransferUsage{
+		User:          userName,
+		Period:        quota.Period.String(),
+		Since:         since,
+		Uploaded:      uploaded,
+		Downloaded:    downloaded,
+		UploadLimit:   quota.UploadLimit,
+		DownloadLimit: quota.DownloadLimit,
+	}, nil
+}
+
+// TransferUsage returns the usage of the transfer quota of the user, nil if
+// the user has no transfer quota
+func (server *Server) TransferUsage(userName string) (*TransferUsage, error) {
+	ctx := &Context{
+		Cmd:  "SITE QUOTA",
+		Data: make(map[string]interface{}),
+	}
+	info, err := lookupUserInfo(ctx, server.Auth, userName)
+	if err != nil || info.TransferQuota == nil {
+		return nil, err
+	}
+	return server.transferUsage(ctx, userName, info.TransferQuota)
+}
+
+// TransferQuotaHandler returns a handler serving as JSON the usage of the
+// transfer quota of the user given by the user query parameter, the status
+// code is 404 if the user has no transfer quota
+func (server *Server) TransferQuotaHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userName := r.URL.Query().Get("user")
+		if userName == "" {
+			http.Error(w, "missing user", http.StatusBadRequest)
+			return
+		}
+		usage, err := server.TransferUsage(userName)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if usage == nil {
+			http.Error(w, "no transfer quota", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(usage)
+	})
+}
+
+// sessionTransferUsage returns the usage of the transfer quota of the login
+// user, nil if the user has no transfer quota
+func (sess *Session) sessionTransferUsage(ctx *Context) (*TransferUsage, error) {
+	if sess.userInfo == nil || sess.userInfo.TransferQuota == nil {
+		return nil, nil
+	}
+	return sess.server.transferUsage(ctx, sess.LoginUser(), sess.userInfo.TransferQuota)
+}
+
+// checkTransferQuota replies 552 and returns false once the transfer quota
+// of the login user in the direction is exhausted. The transfers are allowed
+// if the usage can't be read.
+func (sess *Session) checkTransferQuota(cmd string, upload bool) bool {
+	usage, err := sess.sessionTransferUsage(&Context{
+		Sess: sess,
+		Cmd:  cmd,
+		Data: make(map[string]interface{}),
+	})
+	if err != nil {
+		sess.logf("%v", err)
+		return true
+	}
+	if usage == nil {
+		return true
+	}
+	used, limit, direction := usage.Downloaded, usage.DownloadLimit, "download"
+	if upload {
+		used, limit, direction = usage.Uploaded, usage.UploadLimit, "upload"
+	}
+	if limit > 0 && used >= limit {
+		sess.writeMessage(552, fmt.Sprintf("Transfer quota exceeded, %d/%d bytes of %s %s quota used", used, limit, usage.Period, direction))
+		return false
+	}
+	return true
+}
+
+// addTransferUsage accounts the bytes transferred to the transfer quota of
+// the login user
+func (sess *Session) addTransferUsage(ctx *Context, uploaded, downloaded int64) {
+	if sess.userInfo == nil || sess.userInfo.TransferQuota == nil || uploaded+downloaded <= 0 {
+		return
+	}
+	since := sess.userInfo.TransferQuota.Period.start(time.Now())
+	if err := sess.server.usageStore().AddTransferUsage(ctx, sess.LoginUser(), since, uploaded, downloaded); err != nil {
+		sess.logf("%v", err)
+	}
+}
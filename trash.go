@@ -0,0 +1,414 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Trash represents the recycle bin deleted files and directories are moved
+// to instead of being removed, so a deletion is a tombstone whatever the
+// driver is. Every user has its own area below Dir, the items keep their
+// path and get the time of the deletion as suffix, and could be restored via
+// SITE UNDELETE, Server.RestoreDeleted or Server.RestoreDeletedHandler. Deleting an item inside the trash
+// removes it. The users could only access their own area, the rest of Dir is
+// refused to the commands.
+type Trash struct {
+	// The directory of the trash, if empty it's /.trash. It's hidden from
+	// the listings.
+	Dir string
+
+	// The duration the deleted items are kept, 0 means forever. The expired
+	// items of a user are purged when the user deletes something, and of all
+	// the users every PurgeInterval.
+	TTL time.Duration
+
+	// The interval of the purge of the expired items of all the users while
+	// the server is serving, 0 means no periodic purge
+	PurgeInterval time.Duration
+
+	// The duration the deleted items could not be removed from the trash,
+	// even by deleting them inside the trash, nor be overwritten, renamed or
+	// modified
+	Retention time.Duration
+}
+
+const (
+	defaultTrashDir = "/.trash"
+	trashSuffix     = ".deleted-"
+	trashTimeLayout = "20060102150405"
+)
+
+// trashCommands are the commands refused in the trash areas of the other
+// users, and in the versions kept by Versioning, with the way to get their
+// path from the param, the SITE commands check their paths themselves, see
+// checkTrash
+var trashCommands = map[string]func(param string) string{
+	"LIST": parseListParam,
+	"NLST": parseListParam,
+	"MLSD": parseListParam,
+	"STAT": parseListParam,
+	"MLST": pathParam,
+	"CWD":  pathParam,
+	"XCWD": pathParam,
+	"CDUP": parentParam,
+	"XCUP": parentParam,
+	"RETR": pathParam,
+	"SIZE": pathParam,
+	"MDTM": pathParam,
+	"HASH": pathParam,
+	"THMB": pathParam,
+	"STOR": pathParam,
+	"APPE": pathParam,
+	"MKD":  pathParam,
+	"XMKD": pathParam,
+	"DELE": pathParam,
+	"RMD":  pathParam,
+	"XRMD": pathParam,
+	"RNFR": pathParam,
+	"RNTO": pathParam,
+}
+
+// retainedCommands are the commands modifying their path, they are refused
+// on the retained items of the trash
+var retainedCommands = map[string]bool{
+	"STOR": true,
+	"APPE": true,
+	"MKD":  true,
+	"XMKD": true,
+	"RNFR": true,
+	"RNTO": true,
+}
+
+func parentParam(param string) string {
+	return ".."
+}
+
+var (
+	errNotInTrash = errors.New("No deleted item found")
+	errRetention  = errors.New("Deleted items could not be removed or modified during the retention period")
+)
+
+func (trash *Trash) dir() string {
+	if trash.Dir == "" {
+		return defaultTrashDir
+	}
+	return path.Join("/", trash.Dir)
+}
+
+// userDir returns the trash area of the user
+func (trash *Trash) userDir(userName string) string {
+	return path.Join(trash.dir(), userName)
+}
+
+// inTrash reports whether the path is inside the trash
+func (sess *Session) inTrash(p string) bool {
+	return isUnderPath(p, sess.server.Trash.dir())
+}
+
+// isForeignTrash reports whether the path is inside the trash but out of
+// the area of the login user
+func (sess *Session) isForeignTrash(p string) bool {
+	trash := sess.server.Trash
+	return trash != nil && sess.inTrash(p) && !isUnderPath(p, trash.userDir(sess.LoginUser()))
+}
+
+// checkTrash replies an error and returns false if the path is in the trash
+// area of another user or in the versions, for the SITE commands
+func (sess *Session) checkTrash(p string) bool {
+	if sess.isForeignTrash(p) || sess.inVersions(p) {
+		sess.writeMessage(550, "Action not taken: "+encodePathname(p)+" is not accessible")
+		return false
+	}
+	return true
+}
+
+// foreignTrashPath returns the path in the trash area of another user the
+// command would access, if any
+func (sess *Session) foreignTrashPath(cmd, param string) (string, bool) {
+	parse, ok := trashCommands[cmd]
+	// STAT without param reports the status of the server
+	if !ok || sess.server.Trash == nil || (cmd == "STAT" && param == "") {
+		return "", false
+	}
+	p := sess.buildPath(strings.TrimSpace(parse(param)))
+	return p, sess.isForeignTrash(p)
+}
+
+// deletedTime returns when the trash item has been deleted
+func deletedTime(name string) (time.Time, bool) {
+	idx := strings.LastIndex(name, trashSuffix)
+	if idx < 0 {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation(trashTimeLayout, name[idx+len(trashSuffix):], time.UTC)
+	return t, err == nil
+}
+
+// checkRetention returns an error if the path is inside a trash item which
+// is retained
+func (trash *Trash) checkRetention(p string) error {
+	if trash.Retention <= 0 {
+		return nil
+	}
+	for dir := p; dir != "/" && dir != "."; dir = path.Dir(dir) {
+		if deleted, ok := deletedTime(path.Base(dir)); ok && time.Since(deleted) < trash.Retention {
+			return errRetention
+		}
+	}
+	return nil
+}
+
+// checkRetained returns an error if the path is inside a retained trash item
+// or is a directory containing one
+func (sess *Session) checkRetained(ctx *Context, p string) error {
+	trash := sess.server.Trash
+	if trash == nil || trash.Retention <= 0 || !sess.inTrash(p) {
+		return nil
+	}
+	if err := trash.checkRetention(p); err != nil {
+		return err
+	}
+	info, err := sess.server.Driver.Stat(ctx, p)
+	if err != nil || !info.IsDir() {
+		return nil
+	}
+	files, dirs, err := sess.walkTree(ctx, p)
+	if err != nil {
+		return err
+	}
+	for _, item := range append(files, dirs...) {
+		if _, ok := deletedTime(path.Base(item)); ok {
+			if err := trash.checkRetention(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkRetainedCommand returns an error if the command would modify a
+// retained trash item
+func (sess *Session) checkRetainedCommand(ctx *Context, cmd, param string) error {
+	if !retainedCommands[cmd] || sess.server.Trash == nil {
+		return nil
+	}
+	return sess.checkRetained(ctx, sess.buildPath(strings.TrimSpace(param)))
+}
+
+// checkTrashWrite is checkTrash for the SITE commands modifying the path,
+// the retained items are refused as well
+func (sess *Session) checkTrashWrite(ctx *Context, p string) bool {
+	if !sess.checkTrash(p) {
+		return false
+	}
+	if err := sess.checkRetained(ctx, p); err != nil {
+		sess.writeMessage(550, fmt.Sprint("Action not taken: ", err))
+		return false
+	}
+	return true
+}
+
+// deleteFile deletes the file, or moves it to the trash if enabled
+func (sess *Session) deleteFile(ctx *Context, p string) error {
+	if sess.server.Trash == nil {
+		return sess.server.Driver.DeleteFile(ctx, p)
+	}
+	if sess.inTrash(p) {
+		if err := sess.server.Trash.checkRetention(p); err != nil {
+			return err
+		}
+		return sess.server.Driver.DeleteFile(ctx, p)
+	}
+	return sess.moveToTrash(ctx, p)
+}
+
+// deleteDir deletes the directory, or moves it to the trash if enabled
+func (sess *Session) deleteDir(ctx *Context, p string) error {
+	if sess.server.Trash == nil {
+		return sess.server.Driver.DeleteDir(ctx, p)
+	}
+	if sess.inTrash(p) {
+		if err := sess.checkRetained(ctx, p); err != nil {
+			return err
+		}
+		return sess.server.Driver.DeleteDir(ctx, p)
+	}
+	return sess.moveToTrash(ctx, p)
+}
+
+func (sess *Session) moveToTrash(ctx *Context, p string) error {
+	trash := sess.server.Trash
+	dst := path.Join(trash.userDir(sess.LoginUser()), p) + trashSuffix + time.Now().UTC().Format(trashTimeLayout)
+	if err := sess.server.Driver.MakeDir(ctx, path.Dir(dst)); err != nil {
+		return err
+	}
+	if err := sess.server.Driver.Rename(ctx, p, dst); err != nil {
+		return err
+	}
+	if trash.TTL > 0 {
+		if err := sess.server.purgeTrashDir(ctx, trash.userDir(sess.LoginUser())); err != nil {
+			sess.warnf("Purging the trash failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// PurgeTrash removes the expired items of the trash of all the users
+func (server *Server) PurgeTrash() error {
+	if server.Trash == nil || server.Trash.TTL <= 0 {
+		return nil
+	}
+	return server.purgeTrashDir(&Context{Data: make(map[string]interface{})}, server.Trash.dir())
+}
+
+// purgeTrash purges the trash every PurgeInterval until the server stops
+func (server *Server) purgeTrash() {
+	if server.Trash == nil || server.Trash.TTL <= 0 || server.Trash.PurgeInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(server.Trash.PurgeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-server.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := server.PurgeTrash(); err != nil {
+				server.logger.Printf("", "Purging the trash failed: %v", err)
+			}
+		}
+	}
+}
+
+func (server *Server) purgeTrashDir(ctx *Context, dir string) error {
+	var entries []os.FileInfo
+	err := server.Driver.ListDir(ctx, dir, func(info os.FileInfo) error {
+		entries = append(entries, info)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	expiry := time.Now().Add(-server.Trash.TTL)
+	for _, info := range entries {
+		p := path.Join(dir, info.Name())
+		deleted, ok := deletedTime(info.Name())
+		switch {
+		case ok && deleted.Before(expiry) && info.IsDir():
+			err = server.Driver.DeleteDir(ctx, p)
+		case ok && deleted.Before(expiry):
+			err = server.Driver.DeleteFile(ctx, p)
+		case !ok && info.IsDir():
+			err = server.purgeTrashDir(ctx, p)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RestoreDeleted moves the latest deleted item of the path of the user back
+// from the trash
+func (server *Server) RestoreDeleted(userName, p string) error {
+	if server.Trash == nil {
+		return errors.New("The trash is disabled")
+	}
+	return server.restoreFromTrash(&Context{Data: make(map[string]interface{})}, userName, path.Join("/", p))
+}
+
+// RestoreDeletedHandler returns a handler restoring via RestoreDeleted the
+// latest deleted item of the path and the user given by the path and user
+// query parameters of a POST request, the status code is 404 if there is no
+// such item
+func (server *Server) RestoreDeletedHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userName, p := r.URL.Query().Get("user"), r.URL.Query().Get("path")
+		if userName == "" || p == "" {
+			http.Error(w, "missing user or path", http.StatusBadRequest)
+			return
+		}
+		switch err := server.RestoreDeleted(userName, p); err {
+		case nil:
+			w.WriteHeader(http.StatusNoContent)
+		case errNotInTrash:
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+func (server *Server) restoreFromTrash(ctx *Context, userName, p string) error {
+	dir := path.Join(server.Trash.userDir(userName), path.Dir(p))
+	prefix := path.Base(p) + trashSuffix
+
+	var (
+		latest     string
+		latestTime time.Time
+	)
+	err := server.Driver.ListDir(ctx, dir, func(info os.FileInfo) error {
+		if !strings.HasPrefix(info.Name(), prefix) {
+			return nil
+		}
+		if deleted, ok := deletedTime(info.Name()); ok && !deleted.Before(latestTime) {
+			latest, latestTime = info.Name(), deleted
+		}
+		return nil
+	})
+	if err != nil || latest == "" {
+		return errNotInTrash
+	}
+
+	if _, err := server.Driver.Stat(ctx, p); err == nil {
+		return fmt.Errorf("%s already exists", p)
+	}
+	if err := server.Driver.MakeDir(ctx, path.Dir(p)); err != nil {
+		return err
+	}
+	return server.Driver.Rename(ctx, path.Join(dir, latest), p)
+}
+
+// siteUndelete responds to the SITE UNDELETE command. It restores the latest
+// deleted version of a path from the trash.
+type siteUndelete struct{}
+
+func (cmd siteUndelete) RequireParam() bool {
+	return true
+}
+
+func (cmd siteUndelete) Execute(sess *Session, param string) {
+	if sess.server.Trash == nil {
+		sess.writeMessage(502, "SITE UNDELETE is not supported, the trash is disabled")
+		return
+	}
+
+	p := sess.buildPath(param)
+	err := sess.server.restoreFromTrash(&Context{
+		Sess:  sess,
+		Cmd:   "SITE UNDELETE",
+		Param: param,
+		Data:  make(map[string]interface{}),
+	}, sess.LoginUser(), p)
+	if err != nil {
+		sess.logf("%v", err)
+		sess.writeMessage(550, fmt.Sprint("Action not taken: ", err))
+		return
+	}
+	sess.writeMessage(200, fmt.Sprintf("%s restored", p))
+}
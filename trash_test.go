@@ -0,0 +1,32 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrashRetention(t *testing.T) {
+	now := time.Now().UTC().Format(trashTimeLayout)
+	old := time.Now().Add(-48 * time.Hour).UTC().Format(trashTimeLayout)
+
+	deleted, ok := deletedTime("a.txt" + trashSuffix + old)
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(-48*time.Hour), deleted, time.Second)
+	_, ok = deletedTime("a.txt")
+	assert.False(t, ok)
+
+	trash := &Trash{Retention: 24 * time.Hour}
+	assert.Equal(t, errRetention, trash.checkRetention("/.trash/admin/a.txt"+trashSuffix+now))
+	assert.Equal(t, errRetention, trash.checkRetention("/.trash/admin/dir"+trashSuffix+now+"/a.txt"))
+	assert.NoError(t, trash.checkRetention("/.trash/admin/a.txt"+trashSuffix+old))
+	assert.NoError(t, trash.checkRetention("/.trash/admin/a.txt"))
+
+	trash.Retention = 0
+	assert.NoError(t, trash.checkRetention("/.trash/admin/a.txt"+trashSuffix+now))
+}
@@ -0,0 +1,38 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"strings"
+)
+
+// The pathnames follow the TVFS of RFC 3659: they are "/"-separated, the
+// absolute ones start with "/" and any other character, "\" included, is a
+// part of the names. The drivers always get the cleaned absolute pathnames.
+//
+// Over the control connection, a CR of a pathname is sent as CR NUL as
+// required by RFC 2640 and a LF, which could not be sent, as a NUL. The
+// Telnet IAC is doubled, see telnetText for the commands.
+var (
+	pathnameDecoder = strings.NewReplacer("\r\x00", "\r", "\x00", "\n")
+	pathnameEncoder = strings.NewReplacer("\r", "\r\x00", "\n", "\x00", "\xff", "\xff\xff")
+)
+
+// decodePathname returns the pathname sent by the client in the param of
+// a command
+func decodePathname(param string) string {
+	return pathnameDecoder.Replace(param)
+}
+
+// encodePathname returns the pathname to send in a reply
+func encodePathname(p string) string {
+	return pathnameEncoder.Replace(p)
+}
+
+// quotePathname returns the pathname quoted for the 257 replies, the
+// embedded quotes are doubled as RFC 959 requires
+func quotePathname(p string) string {
+	return `"` + encodePathname(strings.Replace(p, `"`, `""`, -1)) + `"`
+}
@@ -0,0 +1,25 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathnames(t *testing.T) {
+	for _, name := range []string{"a.txt", "a\rb", "a\nb", "a\r\nb", `a\b`} {
+		assert.EqualValues(t, name, decodePathname(encodePathname(name)))
+	}
+	assert.EqualValues(t, "a\r\x00\x00b", encodePathname("a\r\nb"))
+	assert.EqualValues(t, `"/say ""hi"""`, quotePathname(`/say "hi"`))
+
+	sess := &Session{server: &Server{Options: &Options{Parsing: ParseStrict}}}
+	cmd, param, err := sess.parseLine("STOR a\r\x00b\x00c.txt\r\n")
+	assert.NoError(t, err)
+	assert.EqualValues(t, "STOR", cmd)
+	assert.EqualValues(t, "a\rb\nc.txt", param)
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+// maxUnsupportedCommands bounds the distinct commands counted by the stats,
+// the clients could send anything
+const maxUnsupportedCommands = 100
+
+// UnsupportedCommandOther is the name the unsupported commands are counted
+// under once maxUnsupportedCommands distinct ones were counted, or if they
+// are not made of 3 or 4 letters
+const UnsupportedCommandOther = "OTHER"
+
+// isDisabledCommand reports whether the command, which the server doesn't
+// execute, is a default command disabled by the features or by
+// Options.Commands
+func isDisabledCommand(command string) bool {
+	_, ok := defaultCommands[command]
+	return ok
+}
+
+// replyUnsupported replies to a command the server doesn't execute, the
+// reply could be rewritten by Options.UnsupportedReply
+func (sess *Session) replyUnsupported(ctx *Context) {
+	code, message := 500, "Command not found"
+	if isDisabledCommand(ctx.Cmd) {
+		code, message = 502, "Command not implemented"
+	}
+	sess.server.countUnsupported(ctx.Cmd)
+	if sess.clientSoft != "" {
+		sess.debugf("Client %s sent the unsupported command %s", sess.clientSoft, ctx.Cmd)
+	} else {
+		sess.debugf("Client sent the unsupported command %s", ctx.Cmd)
+	}
+	sess.updateInfo(func(info *SessionInfo) {
+		for _, command := range info.Unsupported {
+			if command == ctx.Cmd {
+				return
+			}
+		}
+		// the snapshots returned by Info share the previous array
+		n := len(info.Unsupported)
+		if n < maxUnsupportedCommands && isCommandName(ctx.Cmd) {
+			info.Unsupported = append(info.Unsupported[:n:n], ctx.Cmd)
+		}
+	})
+	if sess.server.UnsupportedReply != nil {
+		code, message = sess.server.UnsupportedReply(ctx, code, message)
+	}
+	sess.writeMessage(code, message)
+}
+
+// countUnsupported counts the command in the stats
+func (server *Server) countUnsupported(command string) {
+	server.unsupportedLock.Lock()
+	defer server.unsupportedLock.Unlock()
+	if server.unsupported == nil {
+		server.unsupported = make(map[string]int64)
+	}
+	if _, ok := server.unsupported[command]; !ok {
+		if !isCommandName(command) || len(server.unsupported) >= maxUnsupportedCommands {
+			command = UnsupportedCommandOther
+		}
+	}
+	server.unsupported[command]++
+}
+
+// unsupportedStats returns the number of the unsupported commands received
+// per command
+func (server *Server) unsupportedStats() map[string]int64 {
+	server.unsupportedLock.Lock()
+	defer server.unsupportedLock.Unlock()
+	var stats = make(map[string]int64, len(server.unsupported))
+	for command, count := range server.unsupported {
+		stats[command] = count
+	}
+	return stats
+}
@@ -0,0 +1,104 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// UserInfo represents the settings of a login user which override the
+// server wide options, the zero values mean the server options are used
+type UserInfo struct {
+	// The duration the session could wait for a command before it's closed
+	IdleTimeout time.Duration
+
+	// The share of the bandwidth the transfers get when the rate limit is
+	// reached, PriorityBronze if zero
+	Priority Priority
+
+	// The period the user could log in, i.e. for the accounts of the
+	// contractors, the zero times mean no limit. The sessions already
+	// logged in are not closed when the account expires.
+	NotBefore time.Time
+	ExpiresAt time.Time
+
+	// The times of the week the user could log in, if nil at any time
+	Schedule *LoginSchedule
+
+	// The data connections must be protected by PROT P, the transfers are
+	// refused otherwise
+	ForceProtectedData bool
+
+	// The bytes the user could transfer per period, if nil no limit
+	TransferQuota *TransferQuota
+
+	// The shell patterns of the write-only directories of the user, added
+	// to Options.WriteOnlyPaths
+	WriteOnlyPaths []string
+
+	// The shell patterns of the no-clobber directories of the user, added
+	// to Options.NoClobberPaths
+	NoClobberPaths []string
+
+	// Create the missing parent directories of the uploads of the user
+	AutoMkdir bool
+
+	// The permission bits of the files and directories created by the
+	// user, they override the ones of Options
+	FileMode os.FileMode
+	DirMode  os.FileMode
+	Umask    os.FileMode
+}
+
+// The errors AfterUserLogin gets for the logins outside of the validity
+// period of the account, they are refused with distinct 530 replies
+var (
+	ErrAccountExpired     = errors.New("account expired")
+	ErrAccountNotYetValid = errors.New("account not yet valid")
+)
+
+// checkValidity returns the error of a login at now outside of the validity
+// period of the account
+func (info *UserInfo) checkValidity(now time.Time) error {
+	if !info.NotBefore.IsZero() && now.Before(info.NotBefore) {
+		return ErrAccountNotYetValid
+	}
+	if !info.ExpiresAt.IsZero() && !now.Before(info.ExpiresAt) {
+		return ErrAccountExpired
+	}
+	return nil
+}
+
+// Priority represents a class of users sharing the bandwidth, it's the
+// weight of their share so gold users get four times the bandwidth of
+// bronze ones and twice the one of silver ones.
+type Priority int
+
+// The predefined priority classes, any positive weight could be used
+const (
+	PriorityBronze Priority = 1
+	PrioritySilver Priority = 2
+	PriorityGold   Priority = 4
+)
+
+// UserInfoAuth is an optional interface an Auth could implement to provide
+// the settings of the users, it's called once the password is checked.
+type UserInfoAuth interface {
+	UserInfo(ctx *Context, userName string) (*UserInfo, error)
+}
+
+// lookupUserInfo returns the settings of the user, an empty UserInfo if the
+// auth doesn't provide them
+func lookupUserInfo(ctx *Context, auth Auth, userName string) (*UserInfo, error) {
+	if infoAuth, ok := auth.(UserInfoAuth); ok {
+		info, err := infoAuth.UserInfo(ctx, userName)
+		if err != nil || info != nil {
+			return info, err
+		}
+	}
+	return &UserInfo{}, nil
+}
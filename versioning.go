@@ -0,0 +1,336 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FileVersion represents a previous version of a file
+type FileVersion struct {
+	ID      string
+	Size    int64
+	ModTime time.Time
+}
+
+// Versioner is an optional interface a Driver could implement to keep the
+// previous versions of the overwritten files, they could be listed and
+// restored via SITE VERSIONS.
+type Versioner interface {
+	// Versions returns the previous versions of the file, the latest first
+	Versions(ctx *Context, path string) ([]FileVersion, error)
+
+	// RestoreVersion replaces the file by the version, the replaced file
+	// becomes a version itself
+	RestoreVersion(ctx *Context, path string, id string) error
+}
+
+const (
+	defaultVersionsDir = "/.versions"
+	versionSuffix      = ".v"
+	uploadSuffix       = ".upload"
+	versionIDLayout    = "20060102150405.000000"
+)
+
+var (
+	errNoSuchVersion = errors.New("No such version")
+
+	// errVersionsNotSupported is returned by the middlewares wrapping a
+	// driver which doesn't implement Versioner
+	errVersionsNotSupported = errors.New("Versions not supported")
+)
+
+// Versioning returns a DriverMiddleware implementing Versioner on top of any
+// driver, the previous version of an overwritten file is renamed below dir,
+// keeping its path, with the time of the overwrite as suffix. The new file
+// is uploaded below dir too and replaces the current one once complete. If
+// dir is empty it's /.versions, it's hidden from the listings and the
+// versions are only accessible via SITE VERSIONS.
+func Versioning(dir string) DriverMiddleware {
+	if dir == "" {
+		dir = defaultVersionsDir
+	}
+	dir = path.Join("/", dir)
+	return func(driver Driver) Driver {
+		versioned := &versioningDriver{
+			Driver: driver,
+			dir:    dir,
+		}
+		// keep the driver authentication and only set the modification
+		// times if the driver does
+		auth, isAuth := driver.(Auth)
+		if _, ok := driver.(ModTimeSetter); ok {
+			if isAuth {
+				return &versioningAuthModTimeDriver{versioningModTimeDriver: &versioningModTimeDriver{versioned}, Auth: auth}
+			}
+			return &versioningModTimeDriver{versioned}
+		}
+		if isAuth {
+			return &versioningAuthDriver{versioningDriver: versioned, Auth: auth}
+		}
+		return versioned
+	}
+}
+
+var (
+	_ Driver        = &versioningDriver{}
+	_ Versioner     = &versioningDriver{}
+	_ ModTimeSetter = &versioningModTimeDriver{}
+)
+
+type versioningDriver struct {
+	Driver
+	dir string
+}
+
+type versioningAuthDriver struct {
+	*versioningDriver
+	Auth
+}
+
+type versioningModTimeDriver struct {
+	*versioningDriver
+}
+
+type versioningAuthModTimeDriver struct {
+	*versioningModTimeDriver
+	Auth
+}
+
+func (driver *versioningDriver) unwrap() Driver {
+	return driver.Driver
+}
+
+func (driver *versioningDriver) versionsDir() string {
+	return driver.dir
+}
+
+// versionsKeeper is implemented by the Versioning drivers
+type versionsKeeper interface {
+	versionsDir() string
+}
+
+// findVersionsDir returns the directory of the versions of the Versioning
+// middleware wrapped by the driver, empty if there is none
+func findVersionsDir(driver Driver) string {
+	found := findDriver(driver, func(driver Driver) bool {
+		_, ok := driver.(versionsKeeper)
+		return ok
+	})
+	if found == nil {
+		return ""
+	}
+	return found.(versionsKeeper).versionsDir()
+}
+
+// inVersions reports whether the path is in the versions kept by
+// Versioning
+func (sess *Session) inVersions(p string) bool {
+	dir := sess.server.versionsDir
+	return dir != "" && isUnderPath(p, dir)
+}
+
+// versionsPath returns the path in the versions the command would access,
+// if any
+func (sess *Session) versionsPath(cmd, param string) (string, bool) {
+	parse, ok := trashCommands[cmd]
+	// STAT without param reports the status of the server
+	if !ok || sess.server.versionsDir == "" || (cmd == "STAT" && param == "") {
+		return "", false
+	}
+	p := sess.buildPath(strings.TrimSpace(parse(param)))
+	return p, sess.inVersions(p)
+}
+
+// versionedPath returns the path of the file or the directory whose versions
+// are kept in the path, or the path itself if it's not in the versions
+func (server *Server) versionedPath(p string) string {
+	if server.versionsDir == "" || !isUnderPath(p, server.versionsDir) {
+		return p
+	}
+	return path.Join("/", strings.TrimPrefix(p, server.versionsDir))
+}
+
+func (driver *versioningDriver) versionPath(p, id string) string {
+	return path.Join(driver.dir, p) + versionSuffix + id
+}
+
+// keepVersion renames the current file to a new version, it returns an
+// empty path if there is no file to keep
+func (driver *versioningDriver) keepVersion(ctx *Context, p string) (string, error) {
+	info, err := driver.Driver.Stat(ctx, p)
+	if err != nil || info.IsDir() {
+		return "", nil
+	}
+	versionPath := driver.versionPath(p, time.Now().UTC().Format(versionIDLayout))
+	if err := driver.Driver.MakeDir(ctx, path.Dir(versionPath)); err != nil {
+		return "", err
+	}
+	if err := driver.Driver.Rename(ctx, p, versionPath); err != nil {
+		return "", err
+	}
+	return versionPath, nil
+}
+
+func (driver *versioningDriver) ListDir(ctx *Context, p string, callback func(os.FileInfo) error) error {
+	return driver.Driver.ListDir(ctx, p, func(info os.FileInfo) error {
+		if path.Join("/", p, info.Name()) == driver.dir {
+			return nil
+		}
+		return callback(info)
+	})
+}
+
+func (driver *versioningDriver) PutFile(ctx *Context, destPath string, data io.Reader, offset int64) (int64, error) {
+	if offset > 0 || isUnderPath(destPath, driver.dir) {
+		return driver.Driver.PutFile(ctx, destPath, data, offset)
+	}
+
+	// the current file stays readable while the new one is uploaded
+	uploadPath := path.Join(driver.dir, destPath) + uploadSuffix + time.Now().UTC().Format(versionIDLayout)
+	if err := driver.Driver.MakeDir(ctx, path.Dir(uploadPath)); err != nil {
+		return 0, err
+	}
+	size, err := driver.Driver.PutFile(ctx, uploadPath, data, offset)
+	if err != nil {
+		_ = driver.Driver.DeleteFile(ctx, uploadPath)
+		return size, err
+	}
+
+	versionPath, err := driver.keepVersion(ctx, destPath)
+	if err == nil {
+		err = driver.Driver.Rename(ctx, uploadPath, destPath)
+		if err != nil && versionPath != "" {
+			// the previous version is still the current one
+			_ = driver.Driver.Rename(ctx, versionPath, destPath)
+		}
+	}
+	if err != nil {
+		_ = driver.Driver.DeleteFile(ctx, uploadPath)
+		return 0, err
+	}
+	return size, nil
+}
+
+func (driver *versioningModTimeDriver) SetModTime(ctx *Context, p string, mtime time.Time) error {
+	return driver.Driver.(ModTimeSetter).SetModTime(ctx, p, mtime)
+}
+
+// Versions implements Versioner
+func (driver *versioningDriver) Versions(ctx *Context, p string) ([]FileVersion, error) {
+	var (
+		prefix   = path.Base(p) + versionSuffix
+		versions []FileVersion
+	)
+	err := driver.Driver.ListDir(ctx, path.Join(driver.dir, path.Dir(p)), func(info os.FileInfo) error {
+		if !info.IsDir() && strings.HasPrefix(info.Name(), prefix) {
+			versions = append(versions, FileVersion{
+				ID:      strings.TrimPrefix(info.Name(), prefix),
+				Size:    info.Size(),
+				ModTime: info.ModTime(),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		// no version has been kept in the directory
+		return nil, nil
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].ID > versions[j].ID
+	})
+	return versions, nil
+}
+
+// RestoreVersion implements Versioner
+func (driver *versioningDriver) RestoreVersion(ctx *Context, p string, id string) error {
+	versionPath := driver.versionPath(p, id)
+	if strings.Contains(id, "/") {
+		return errNoSuchVersion
+	}
+	if _, err := driver.Driver.Stat(ctx, versionPath); err != nil {
+		return errNoSuchVersion
+	}
+	if _, err := driver.keepVersion(ctx, p); err != nil {
+		return err
+	}
+	return driver.Driver.Rename(ctx, versionPath, p)
+}
+
+// siteVersions responds to the SITE VERSIONS command. It lists the previous
+// versions of a file or restores one of them:
+//
+//	SITE VERSIONS path
+//	SITE VERSIONS RESTORE id path
+type siteVersions struct{}
+
+func (cmd siteVersions) RequireParam() bool {
+	return true
+}
+
+func (cmd siteVersions) Execute(sess *Session, param string) {
+	versioner, ok := sess.server.Driver.(Versioner)
+	if !ok {
+		sess.writeMessage(502, "SITE VERSIONS is not supported by the driver")
+		return
+	}
+	var ctx = &Context{
+		Sess:  sess,
+		Cmd:   "SITE VERSIONS",
+		Param: param,
+		Data:  make(map[string]interface{}),
+	}
+
+	fields := strings.SplitN(param, " ", 3)
+	if strings.EqualFold(fields[0], "RESTORE") {
+		if len(fields) != 3 {
+			sess.writeMessage(501, "SITE VERSIONS RESTORE requires a version and a path")
+			return
+		}
+		p := sess.buildPath(fields[2])
+		if !sess.checkWriteOnly(p) || !sess.checkTrashWrite(ctx, p) ||
+			!sess.checkProtected(p) || !sess.checkClobber(ctx.Cmd, p) {
+			return
+		}
+		if err := versioner.RestoreVersion(ctx, p, fields[1]); err != nil {
+			if err == errVersionsNotSupported {
+				sess.writeMessage(502, "SITE VERSIONS is not supported by the driver")
+				return
+			}
+			sess.logf("%v", err)
+			sess.writeMessage(550, fmt.Sprint("Action not taken: ", err))
+			return
+		}
+		sess.writeMessage(200, fmt.Sprintf("Version %s of %s restored", fields[1], p))
+		return
+	}
+
+	p := sess.buildPath(param)
+	if !sess.checkWriteOnly(p) || !sess.checkTrash(p) {
+		return
+	}
+	versions, err := versioner.Versions(ctx, p)
+	if err == errVersionsNotSupported {
+		sess.writeMessage(502, "SITE VERSIONS is not supported by the driver")
+		return
+	}
+	if err != nil {
+		sess.logf("%v", err)
+		sess.writeMessage(550, fmt.Sprint("Action not taken: ", err))
+		return
+	}
+	var lines = make([]string, 0, len(versions))
+	for _, version := range versions {
+		lines = append(lines, fmt.Sprintf("%s %d %s", version.ID, version.Size, version.ModTime.UTC().Format("20060102150405")))
+	}
+	sess.writeMessageLines(200, fmt.Sprintf("Versions of %s [id size modified]:", p), lines, "End of versions")
+}
@@ -0,0 +1,92 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"path"
+	"strings"
+)
+
+// writeOnlyCommands are the commands refused in the write-only directories
+// with the way to get their path from the param, the uploads and the
+// commands creating directories are allowed so the directories are blind
+// drops. The SITE commands reading the files check their paths themselves,
+// see checkWriteOnly.
+var writeOnlyCommands = map[string]func(param string) string{
+	"LIST": parseListParam,
+	"NLST": parseListParam,
+	"MLSD": parseListParam,
+	"STAT": parseListParam,
+	"MLST": pathParam,
+	"RETR": pathParam,
+	"SIZE": pathParam,
+	"MDTM": pathParam,
+	"HASH": pathParam,
+	"THMB": pathParam,
+	"DELE": pathParam,
+	"RNFR": pathParam,
+	"RMD":  pathParam,
+	"XRMD": pathParam,
+}
+
+func pathParam(param string) string {
+	return param
+}
+
+// isWriteOnly reports whether the absolute path is in a write-only
+// directory, the patterns match the directories as HiddenFiles.Patterns do
+func isWriteOnly(patterns []string, p string) bool {
+	for p = path.Join("/", p); ; p = path.Dir(p) {
+		for _, pattern := range patterns {
+			if matchPattern(pattern, p) {
+				return true
+			}
+		}
+		if p == "/" {
+			return false
+		}
+	}
+}
+
+// isWriteOnly reports whether the absolute path is in a write-only directory
+// of the login user, the versions kept by Versioning are in the directories
+// of their files
+func (sess *Session) isWriteOnly(p string) bool {
+	return isWriteOnly(sess.writeOnlyPatterns(), sess.server.versionedPath(p))
+}
+
+// writeOnlyPatterns returns the write-only directories of the login user
+func (sess *Session) writeOnlyPatterns() []string {
+	patterns := sess.server.WriteOnlyPaths
+	if sess.userInfo != nil && len(sess.userInfo.WriteOnlyPaths) > 0 {
+		patterns = append(patterns[:len(patterns):len(patterns)], sess.userInfo.WriteOnlyPaths...)
+	}
+	return patterns
+}
+
+// checkWriteOnly replies an error and returns false if the path is in a
+// write-only directory, for the SITE commands reading the files
+func (sess *Session) checkWriteOnly(p string) bool {
+	if sess.isWriteOnly(p) {
+		sess.writeMessage(550, "Action not taken: "+encodePathname(p)+" is write-only")
+		return false
+	}
+	return true
+}
+
+// writeOnlyPath returns the path of the write-only directory the command
+// would read or remove, if any
+func (sess *Session) writeOnlyPath(cmd, param string) (string, bool) {
+	parse, ok := writeOnlyCommands[cmd]
+	// STAT without param reports the status of the server
+	if !ok || (cmd == "STAT" && param == "") {
+		return "", false
+	}
+	if len(sess.writeOnlyPatterns()) == 0 {
+		return "", false
+	}
+	p := sess.buildPath(strings.TrimSpace(parse(param)))
+	return p, sess.isWriteOnly(p)
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"time"
+)
+
+// the completed transfers kept per session, the oldest are dropped
+const maxTransferLog = 1000
+
+// TransferRecord represents a completed transfer of a session, the
+// transfers are listed by SessionInfo.Transfers and SITE XFERLOG
+type TransferRecord struct {
+	Time    time.Time // when the transfer completed
+	Command string    // the command of the transfer, i.e. STOR or RETR
+	Path    string    // the path of the file
+	Size    int64     // the bytes transferred
+	Offset  int64     // the position the transfer started from
+
+	// The hex digest of the data transferred and the HASH name of its
+	// algorithm, if Options.TransferChecksum is set
+	Checksum     string
+	ChecksumAlgo string
+}
+
+// logTransfer adds the transfer to the log of the session if it completed,
+// it's done before the final reply so the client could check it right after
+func (sess *Session) logTransfer(ctx *Context, event *TransferEvent) {
+	if event.Err != nil {
+		return
+	}
+	record := TransferRecord{
+		Time:         time.Now().UTC(),
+		Command:      ctx.Cmd,
+		Path:         event.Path,
+		Size:         event.Size,
+		Offset:       event.Offset,
+		Checksum:     event.Checksum,
+		ChecksumAlgo: event.ChecksumAlgo,
+	}
+	sess.updateInfo(func(info *SessionInfo) {
+		// the snapshots returned by Info share the previous array
+		n := len(info.Transfers)
+		info.Transfers = append(info.Transfers[:n:n], record)
+		if len(info.Transfers) > maxTransferLog {
+			info.Transfers = info.Transfers[1:]
+		}
+	})
+}
+
+// siteXferlog responds to the SITE XFERLOG command. It lists the completed
+// transfers of the session, the oldest first, so that the clients could
+// check what the server recorded before disconnecting:
+//
+//	2020-01-02T15:04:05Z STOR /dir/file 1024 bytes from 0 [SHA-256 3a4f...]
+type siteXferlog struct{}
+
+func (cmd siteXferlog) RequireParam() bool {
+	return false
+}
+
+func (cmd siteXferlog) Execute(sess *Session, param string) {
+	transfers := sess.Info().Transfers
+	lines := make([]string, 0, len(transfers))
+	for _, record := range transfers {
+		line := fmt.Sprintf("%s %s %s %d bytes from %d", record.Time.Format(time.RFC3339), record.Command, record.Path, record.Size, record.Offset)
+		if record.Checksum != "" {
+			line += fmt.Sprintf(" [%s %s]", record.ChecksumAlgo, record.Checksum)
+		}
+		lines = append(lines, line)
+	}
+	sess.writeMessageLines(200, fmt.Sprintf("%d transfers in this session:", len(transfers)), lines, "End of transfers")
+}